@@ -5,21 +5,22 @@ Auto-Air opens the air-cleaner automatically when the pm2.5 >= 130.
 package main
 
 import (
-	"encoding/json"
-	"fmt"
-	"io/ioutil"
 	"log"
-	"net/http"
 	"time"
 
 	"github.com/jakefau/rpi-devices/dev"
 	"github.com/jakefau/rpi-devices/iot"
 	"github.com/jakefau/rpi-devices/util"
+	"github.com/jakefau/rpi-devices/util/schedule"
+	"github.com/jakefau/rpi-devices/util/sensors"
 	"github.com/stianeikeland/go-rpio"
 )
 
 const (
 	pinSG = 18
+
+	// the sensor server providing the pm2.5
+	sserver = "http://localhost:8000"
 )
 
 const (
@@ -27,6 +28,11 @@ const (
 	trigOffPm25 = 100
 )
 
+var (
+	// the auto air-cleaner is disabled out of the schedule
+	cleanHours = schedule.Daily("08:00", "20:00")
+)
+
 var (
 	autoair  *autoAir
 	bool2int = map[bool]int{
@@ -35,14 +41,10 @@ var (
 	}
 )
 
-type pm25Response struct {
-	PM25     uint16 `json:"pm25"`
-	ErrorMsg string `json:"error_msg"`
-}
-
 type autoAir struct {
 	sg      *dev.SG90
 	cloud   iot.Cloud
+	sensors *sensors.Client
 	state   bool        // true: turn on, false: turn off
 	chClean chan uint16 // for turning on/off the air-cleaner
 	chCloud chan uint16 // for pushing to iot cloud
@@ -74,6 +76,7 @@ func newAutoAir(sg *dev.SG90, cloud iot.Cloud) *autoAir {
 	return &autoAir{
 		sg:      sg,
 		cloud:   cloud,
+		sensors: sensors.NewClient(sserver),
 		state:   false,
 		chClean: make(chan uint16, 4),
 		chCloud: make(chan uint16, 4),
@@ -88,28 +91,25 @@ func (a *autoAir) start() {
 	a.detect()
 }
 
+// detect watches the pm2.5 pushed by the sensor server
 func (a *autoAir) detect() {
 	log.Printf("[autoair]detecting pm2.5")
-	for {
-		pm25, err := a.getPM25()
-		if err != nil {
-			log.Printf("[autoair]failed to get pm2.5, error: %v", err)
-			time.Sleep(5 * time.Second)
-			continue
+	a.sensors.Watch(nil, func(e *sensors.Event) {
+		if e.Error != "" {
+			log.Printf("[autoair]failed to get pm2.5, error: %v", e.Error)
+			return
 		}
+		pm25 := uint16(e.Value)
 		log.Printf("[autoair]pm2.5: %v ug/m3", pm25)
-
 		a.chClean <- pm25
-		time.Sleep(60 * time.Second)
-	}
+	}, "pm25")
 }
 
 func (a *autoAir) clean() {
 	for pm25 := range a.chClean {
-		hour := time.Now().Hour()
-		if pm25 < 400 && (hour >= 20 || hour < 8) {
-			// disable at 20:00-08:00
-			log.Printf("[autoair]auto air-cleaner was disabled at 20:00-08:00")
+		if pm25 < 400 && !cleanHours.Active(time.Now()) {
+			// disable out of the clean hours
+			log.Printf("[autoair]auto air-cleaner was disabled out of %v", cleanHours)
 			if a.state {
 				a.off()
 			}
@@ -143,30 +143,6 @@ func (a *autoAir) push() {
 	}
 }
 
-func (a *autoAir) getPM25() (uint16, error) {
-	resp, err := http.Get("http://localhost:8000/pm25")
-	if err != nil {
-		return 0, fmt.Errorf("failed to get pm2.5 from sensers server, status: %v, err: %v", resp.Status, err)
-	}
-	defer resp.Body.Close()
-
-	body, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		return 0, fmt.Errorf("failed to read resp body, err: %v", err)
-	}
-
-	var pm25Resp pm25Response
-	if err := json.Unmarshal(body, &pm25Resp); err != nil {
-		return 0, fmt.Errorf("failed to unmarshal resp, err: %v", err)
-	}
-
-	if pm25Resp.ErrorMsg != "" {
-		return 0, fmt.Errorf("failed to get pm2.5 from sensers server, status: %v, err msg: %v", resp.Status, pm25Resp.ErrorMsg)
-	}
-
-	return pm25Resp.PM25, nil
-}
-
 func (a *autoAir) on() {
 	a.sg.Roll(0)
 	time.Sleep(1 * time.Second)
@@ -55,12 +55,14 @@ import (
 
 	"github.com/jakefau/rpi-devices/dev"
 	"github.com/jakefau/rpi-devices/util"
+	"github.com/jakefau/rpi-devices/util/sampler"
 	"github.com/stianeikeland/go-rpio"
 )
 
 const (
 	relayPin           = 7
 	intervalTime       = 1 * time.Minute
+	readTimeout        = 10 * time.Second
 	triggerTemperature = 27.3
 )
 
@@ -100,18 +102,30 @@ type autoFan struct {
 }
 
 func (f *autoFan) start() {
-	for {
-		time.Sleep(intervalTime)
-		c, err := f.temp.GetTemperature()
-		if err != nil {
-			log.Printf("[autofan]failed to get temperature, error: %v", err)
-			continue
-		}
-		if c >= triggerTemperature {
-			f.on()
-		} else {
-			f.off()
-		}
+	s := sampler.New()
+	err := s.Add(&sampler.Sensor{
+		Name:    "temperature",
+		Read:    func() (interface{}, error) { return f.temp.GetTemperature() },
+		Period:  intervalTime,
+		Timeout: readTimeout,
+	})
+	if err != nil {
+		log.Printf("[autofan]failed to add the temperature sensor, error: %v", err)
+		return
+	}
+	s.Subscribe(f.onReading)
+	s.Run(nil)
+}
+
+func (f *autoFan) onReading(r *sampler.Reading) {
+	if r.Err != nil {
+		log.Printf("[autofan]failed to get temperature, error: %v", r.Err)
+		return
+	}
+	if r.Value.(float32) >= triggerTemperature {
+		f.on()
+	} else {
+		f.off()
 	}
 }
 
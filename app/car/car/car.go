@@ -4,88 +4,136 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"io/ioutil"
+	"image"
 	"log"
-	"strings"
+	"math"
 	"sync"
 	"time"
 
 	"github.com/jakefau/rpi-devices/dev"
 	"github.com/jakefau/rpi-devices/util"
+	"github.com/jakefau/rpi-devices/util/audio"
+	vision "github.com/jakefau/rpi-devices/util/cv"
 	cv "github.com/jakefau/rpi-devices/util/cv/mock"
 	"github.com/jakefau/rpi-devices/util/geo"
+	"github.com/jakefau/rpi-devices/util/nav"
+	"github.com/jakefau/rpi-devices/util/radio"
+	"github.com/jakefau/rpi-devices/util/tts"
 	"github.com/shanghuiyang/go-speech/oauth"
 	"github.com/shanghuiyang/go-speech/speech"
-	"github.com/shanghuiyang/image-recognizer/recognizer"
 )
 
 // Car ...
 type Car struct {
-	engine *dev.L298N
-	horn   *dev.Buzzer
-	led    *dev.Led
-	light  *dev.Led
+	engine dev.Motor
+	sup    *supervisor
+	rec    *Recorder
+	horn   dev.Beeper
+	led    dev.Light
+	light  dev.Light
 	camera *dev.Camera
-	lc12s  *dev.LC12S
+	lc12s  dev.Radio
 	chOp   chan Op
+	clock  Clock
+	mu     sync.Mutex // for the state changed by the ops and read by the loops, e.g. speedv, dir and mission
+	speedv uint32
+	tm     telemetry
+	smu    sync.Mutex // for sampling the sensors
 
 	// self-driving
-	servo       *dev.SG90
+	servo       dev.Roller
 	dmeter      dev.DistMeter
-	encoder     *dev.Encoder
-	gy25        *dev.GY25
-	collisions  []*dev.Collision
-	selfdriving bool
+	encoder     dev.PulseCounter
+	gy25        dev.AngleMeter
+	collisions  []dev.CollisionSwitch
+	selfdriving flag
 	servoAngle  int
 
 	// speed-driving
-	asr           *speech.ASR
-	tts           *speech.TTS
-	imgr          *recognizer.Recognizer
-	speechdriving bool
+	asr           Recognizer
+	grammar       Grammar
+	voice         tts.Engine
+	speaker       *tts.Queue
+	speakerOnce   sync.Once
+	imgr          vision.Recognizer
+	speechdriving flag
 	volume        int
 
 	// self-tracking
-	tracker      *cv.Tracker
-	selftracking bool
+	tracker      Tracker
+	profiles     []vision.HSV
+	newTracker   bool // the tracker is created by the car and will be closed when self-tracking is off
+	selftracking flag
 
 	// nav
-	gps       *dev.GPS
+	gps       dev.Locator
 	dest      *geo.Point
 	lastLoc   *geo.Point
 	gpslogger *util.GPSLogger
-	selfnav   bool
+	loc       *nav.Localizer
+	dir       int // the moving direction, 1: forward, -1: backward, 0: stop or turning
+	selfnav   flag
+	mission   *Mission
+	mlogger   *missionLogger
 }
 
 // New ...
 func New(cfg *Config) *Car {
+	if cfg.Recorder != nil {
+		cfg = cfg.Recorder.wrap(cfg)
+	}
 	car := &Car{
 		engine:     cfg.Engine,
 		horn:       cfg.Horn,
 		led:        cfg.Led,
-		light:      cfg.Led,
+		light:      cfg.Light,
 		camera:     cfg.Camera,
 		lc12s:      cfg.LC12S,
 		servo:      cfg.Servo,
 		dmeter:     cfg.DistMeter,
+		encoder:    cfg.Encoder,
 		gy25:       cfg.GY25,
 		collisions: cfg.Collisions,
 		gps:        cfg.GPS,
-
-		servoAngle:    0,
-		selfdriving:   false,
-		speechdriving: false,
-		selftracking:  false,
-		selfnav:       false,
-		chOp:          make(chan Op, chSize),
+		tracker:    cfg.Tracker,
+		profiles:   cfg.Profiles,
+		asr:        cfg.ASR,
+		grammar:    cfg.Grammar,
+		voice:      cfg.TTS,
+		imgr:       cfg.Recognizer,
+
+		servoAngle: 0,
+		chOp:       make(chan Op, chSize),
+		tm:         telemetry{dist: -1},
+		rec:        cfg.Recorder,
+		clock:      cfg.Clock,
+	}
+	if car.clock == nil {
+		car.clock = realClock{}
+	}
+	if len(car.profiles) == 0 {
+		car.profiles = []vision.HSV{vision.Tennis}
+	}
+	if car.grammar == nil {
+		car.grammar = DefaultGrammar()
+	}
+	if cfg.Engine != nil {
+		car.sup = newSupervisor(cfg.Engine, cfg.Safety, cfg.Collisions, car.distAhead, func() {
+			car.setOp(stop)
+		})
+		car.sup.clock = car.clock
+		car.engine = car.sup
 	}
 	return car
 }
 
 // Start ...
 func (c *Car) Start() error {
+	if c.sup != nil {
+		c.sup.start()
+	}
 	go c.start()
-	go c.servo.Roll(0)
+	go c.rollServo(0)
 	go c.blink()
 	go c.joystick()
 	go c.setVolume(40)
@@ -93,33 +141,79 @@ func (c *Car) Start() error {
 	return nil
 }
 
-// Do ...
+// Do does the op from a remote client, e.g. the web page.
+// the client must send heartbeats to keep the car moving after it moves the car.
 func (c *Car) Do(op Op) {
+	c.rec.cmd(op)
+	switch op {
+	case heartbeat:
+		c.sup.heartbeat(srcRemote)
+		return
+	case forward, backward, left, right:
+		c.sup.take(srcRemote)
+	}
 	c.chOp <- op
 }
 
 // Stop ...
 func (c *Car) Stop() error {
 	close(c.chOp)
+	if c.sup != nil {
+		c.sup.close()
+	}
+	if c.speaker != nil {
+		c.speaker.Close()
+	}
 	c.engine.Stop()
 	return nil
 }
 
 // GetState ...
 func (c *Car) GetState() (selfDriving, selfTracking, speechDriving bool) {
-	return c.selfdriving, c.selftracking, c.speechdriving
+	return c.selfdriving.get(), c.selftracking.get(), c.speechdriving.get()
 }
 
 // SetDest ...
 func (c *Car) SetDest(dest *geo.Point) {
-	if c.selfnav {
+	c.rec.dest(dest)
+	if c.selfnav.get() {
 		return
 	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
 	c.dest = dest
+	c.mission = nil
+}
+
+// SetMission sets a mission for self-nav, it will replace the destination
+func (c *Car) SetMission(m *Mission) error {
+	if c.selfnav.get() {
+		return errors.New("can't set a mission in nav")
+	}
+	for _, wp := range m.Waypoints {
+		if !bbox.IsInside(wp.Point()) {
+			return fmt.Errorf("waypoint %v(%v) isn't in bbox", wp.Name, wp.Point())
+		}
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.mission = m
+	c.dest = nil
+	return nil
+}
+
+// MissionState returns the progress of current mission
+func (c *Car) MissionState() (MissionState, bool) {
+	m := c.getMission()
+	if m == nil {
+		return MissionState{}, false
+	}
+	return m.State(), true
 }
 
 func (c *Car) start() {
 	for op := range c.chOp {
+		c.rec.op(op)
 		switch op {
 		case forward:
 			c.forward()
@@ -159,6 +253,12 @@ func (c *Car) start() {
 			go c.selfNavOn()
 		case selfnavoff:
 			go c.selfNavOff()
+		case missionpause:
+			go c.missionPause()
+		case missionresume:
+			go c.missionResume()
+		case missionabort:
+			go c.missionAbort()
 		default:
 			log.Printf("[car]invalid op")
 		}
@@ -169,35 +269,110 @@ func (c *Car) start() {
 func (c *Car) forward() {
 	log.Printf("[car]forward")
 	c.engine.Forward()
+	c.setOp(forward)
+	c.setDir(1)
 }
 
 // backward ...
 func (c *Car) backward() {
 	log.Printf("[car]backward")
 	c.engine.Backward()
+	c.setOp(backward)
+	c.setDir(-1)
 }
 
 // left ...
 func (c *Car) left() {
 	log.Printf("[car]left")
 	c.engine.Left()
+	c.setOp(left)
+	c.setDir(0)
 }
 
 // right ...
 func (c *Car) right() {
 	log.Printf("[car]right")
 	c.engine.Right()
+	c.setOp(right)
+	c.setDir(0)
 }
 
 // stop ...
 func (c *Car) stop() {
 	log.Printf("[car]stop")
 	c.engine.Stop()
+	c.setOp(stop)
+	c.setDir(0)
 }
 
 func (c *Car) speed(s uint32) {
 	log.Printf("[car]speed %v%%", s)
 	c.engine.Speed(s)
+	c.mu.Lock()
+	c.speedv = s
+	c.mu.Unlock()
+}
+
+func (c *Car) getSpeed() uint32 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.speedv
+}
+
+func (c *Car) setDir(dir int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.dir = dir
+}
+
+func (c *Car) getDir() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.dir
+}
+
+func (c *Car) getMission() *Mission {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.mission
+}
+
+func (c *Car) delayMs(ms int) {
+	c.clock.Sleep(time.Duration(ms) * time.Millisecond)
+}
+
+func (c *Car) since(t time.Time) time.Duration {
+	return c.clock.Now().Sub(t)
+}
+
+// drive drives the left and right wheels in the ratios of current speed
+func (c *Car) drive(left, right float64) {
+	speed := float64(c.getSpeed())
+	l := int(left * speed)
+	r := int(right * speed)
+	log.Printf("[car]drive: left=%v%%, right=%v%%", l, r)
+	c.engine.Drive(l, r)
+	op := driveOp(l, r)
+	c.setOp(op)
+	switch op {
+	case forward:
+		c.setDir(1)
+	case backward:
+		c.setDir(-1)
+	default:
+		c.setDir(0)
+	}
+}
+
+// rollServo rolls the servo of the distance meter
+func (c *Car) rollServo(angle int) {
+	if c.servo == nil {
+		return
+	}
+	c.servo.Roll(angle)
+	c.tm.mu.Lock()
+	c.tm.servo = angle
+	c.tm.mu.Unlock()
 }
 
 // beep ...
@@ -211,8 +386,8 @@ func (c *Car) beep() {
 
 func (c *Car) blink() {
 	for {
-		if c.speechdriving {
-			util.DelayMs(2000)
+		if c.speechdriving.get() {
+			c.delayMs(2000)
 			continue
 		}
 		c.led.Blink(1, 1000)
@@ -227,7 +402,7 @@ func (c *Car) musicOn() {
 func (c *Car) musicOff() {
 	log.Printf("[car]music off")
 	util.StopMp3()
-	time.Sleep(1 * time.Second)
+	c.clock.Sleep(1 * time.Second)
 }
 
 func (c *Car) servoLeft() {
@@ -237,10 +412,7 @@ func (c *Car) servoLeft() {
 	}
 	c.servoAngle = angle
 	log.Printf("[car]servo roll %v", angle)
-	if c.servo == nil {
-		return
-	}
-	c.servo.Roll(angle)
+	c.rollServo(angle)
 }
 
 func (c *Car) servoRight() {
@@ -250,19 +422,13 @@ func (c *Car) servoRight() {
 	}
 	c.servoAngle = angle
 	log.Printf("[car]servo roll %v", angle)
-	if c.servo == nil {
-		return
-	}
-	c.servo.Roll(angle)
+	c.rollServo(angle)
 }
 
 func (c *Car) servoAhead() {
 	c.servoAngle = 0
 	log.Printf("[car]servo roll %v", 0)
-	if c.servo == nil {
-		return
-	}
-	c.servo.Roll(0)
+	c.rollServo(0)
 }
 
 func (c *Car) selfDriving() {
@@ -285,7 +451,9 @@ func (c *Car) selfDriving() {
 		chOp      = make(chan Op, 4)
 	)
 
-	for c.selfdriving || c.selftracking {
+	c.sup.take(srcAuto)
+	for c.selfdriving.get() || c.selftracking.get() {
+		c.sup.heartbeat(srcAuto)
 		select {
 		case p := <-chOp:
 			op = p
@@ -302,15 +470,15 @@ func (c *Car) selfDriving() {
 		case backward:
 			fwd = false
 			c.stop()
-			util.DelayMs(20)
+			c.delayMs(20)
 			c.backward()
-			util.DelayMs(500)
+			c.delayMs(500)
 			chOp <- stop
 			continue
 		case stop:
 			fwd = false
 			c.stop()
-			util.DelayMs(20)
+			c.delayMs(20)
 			chOp <- scan
 			continue
 		case scan:
@@ -327,7 +495,7 @@ func (c *Car) selfDriving() {
 		case turn:
 			fwd = false
 			c.turn(maxdAngle)
-			util.DelayMs(150)
+			c.delayMs(150)
 			chOp <- forward
 			continue
 		case forward:
@@ -336,16 +504,16 @@ func (c *Car) selfDriving() {
 				fwd = true
 				go c.detecting(chOp)
 			}
-			util.DelayMs(50)
+			c.delayMs(50)
 			continue
 		case pause:
 			fwd = false
-			util.DelayMs(500)
+			c.delayMs(500)
 			continue
 		}
 	}
 	c.stop()
-	util.DelayMs(1000)
+	c.delayMs(1000)
 	close(chOp)
 }
 
@@ -359,7 +527,9 @@ func (c *Car) speechDriving() {
 
 	wg.Add(1)
 	go c.detectSpeech(chOp, &wg)
-	for c.speechdriving {
+	c.sup.take(srcAuto)
+	for c.speechdriving.get() {
+		c.sup.heartbeat(srcAuto)
 		select {
 		case p := <-chOp:
 			op = p
@@ -379,42 +549,45 @@ func (c *Car) speechDriving() {
 				fwd = true
 				go c.detecting(chOp)
 			}
-			util.DelayMs(50)
+			c.delayMs(50)
 			continue
 		case backward:
 			fwd = false
 			c.stop()
-			util.DelayMs(20)
+			c.delayMs(20)
 			c.backward()
-			util.DelayMs(600)
+			c.delayMs(600)
 			chOp <- stop
 			continue
 		case left:
 			fwd = false
 			c.stop()
-			util.DelayMs(20)
+			c.delayMs(20)
 			c.turn(-90)
-			util.DelayMs(20)
+			c.delayMs(20)
 			chOp <- forward
 			continue
 		case right:
 			fwd = false
 			c.stop()
-			util.DelayMs(20)
+			c.delayMs(20)
 			c.turn(90)
-			util.DelayMs(20)
+			c.delayMs(20)
 			chOp <- forward
 			continue
 		case roll:
 			fwd = false
 			c.engine.Left()
-			util.DelayMs(3000)
+			for i := 0; i < 30 && c.speechdriving.get(); i++ {
+				c.sup.heartbeat(srcAuto)
+				c.delayMs(100)
+			}
 			chOp <- stop
 			continue
 		case stop:
 			fwd = false
 			c.stop()
-			util.DelayMs(500)
+			c.delayMs(500)
 			continue
 		}
 	}
@@ -424,78 +597,91 @@ func (c *Car) speechDriving() {
 }
 
 func (c *Car) selfDrivingOn() {
-	if c.selfdriving {
+	if c.selfdriving.get() {
 		return
 	}
-	c.selftracking = false
-	c.speechdriving = false
-	util.DelayMs(1000) // wait for self-tracking and speech-driving quit
+	c.selftracking.set(false)
+	c.speechdriving.set(false)
+	c.delayMs(1000) // wait for self-tracking and speech-driving quit
 
-	c.selfdriving = true
+	c.selfdriving.set(true)
 	log.Printf("[car]self-drving on")
+	c.rec.mode(c.mode())
 	c.speed(30)
 	c.selfDriving()
 }
 
 func (c *Car) selfDrivingOff() {
-	c.selfdriving = false
-	c.servo.Roll(0)
+	c.selfdriving.set(false)
+	c.rollServo(0)
 	log.Printf("[car]self-drving off")
+	c.rec.mode(c.mode())
 }
 
 func (c *Car) selfTrackingOn() {
-	if c.selftracking {
+	if c.selftracking.get() {
 		return
 	}
 	util.StopMotion()
-	c.selfdriving = false
-	c.speechdriving = false
-	c.selfnav = false
-	util.DelayMs(1000) // wait to quit self-driving & speech-driving
+	c.selfdriving.set(false)
+	c.speechdriving.set(false)
+	c.selfnav.set(false)
+	c.delayMs(1000) // wait to quit self-driving & speech-driving
 
 	// start slef-tracking
-	t, err := cv.NewTracker(lh, ls, lv, hh, hs, hv)
-	if err != nil {
-		log.Printf("[carapp]failed to create a tracker, error: %v", err)
-		return
+	if c.tracker == nil {
+		t, err := cv.NewMultiTracker(c.profiles...)
+		if err != nil {
+			log.Printf("[carapp]failed to create a tracker, error: %v", err)
+			return
+		}
+		c.tracker = t
+		c.newTracker = true
 	}
-	c.tracker = t
-	c.selftracking = true
+	c.selftracking.set(true)
 	log.Printf("[car]self-tracking on")
+	c.rec.mode(c.mode())
 	c.speed(30)
 	c.selfDriving()
 }
 
 func (c *Car) selfTrackingOff() {
-	c.selftracking = false
-	c.tracker.Close()
-	c.servo.Roll(0)
-	util.DelayMs(500)
+	c.selftracking.set(false)
+	if c.newTracker {
+		c.tracker.Close()
+		c.tracker = nil
+		c.newTracker = false
+	}
+	c.rollServo(0)
+	c.delayMs(500)
 
 	if err := util.StartMotion(); err != nil {
 		log.Printf("[car]failed to start motion, error: %v", err)
 	}
 	log.Printf("[car]self-tracking off")
+	c.rec.mode(c.mode())
 }
 
 func (c *Car) speechDrivingOn() {
-	if c.speechdriving {
+	if c.speechdriving.get() {
 		return
 	}
-	c.selfdriving = false
-	c.selftracking = false
-	util.DelayMs(1000) // wait for self-driving and self-tracking quit
+	c.selfdriving.set(false)
+	c.selftracking.set(false)
+	c.delayMs(1000) // wait for self-driving and self-tracking quit
 
-	c.speechdriving = true
+	c.speechdriving.set(true)
 	log.Printf("[car]speech-drving on")
+	c.rec.mode(c.mode())
 	c.speed(30)
 	c.speechDriving()
 }
 
 func (c *Car) speechDrivingOff() {
-	c.speechdriving = false
-	c.servo.Roll(0)
+	c.speechdriving.set(false)
+	c.rollServo(0)
 	log.Printf("[car]speech-drving off")
+	c.rec.mode(c.mode())
 }
 
 func (c *Car) detecting(chOp chan Op) {
@@ -508,7 +694,7 @@ func (c *Car) detecting(chOp chan Op) {
 	wg.Add(1)
 	go c.detectObstacles(ctx, chOp, &wg, cancel)
 
-	if c.selftracking {
+	if c.selftracking.get() {
 		wg.Add(1)
 		go c.trackingObj(ctx, chOp, &wg, cancel)
 	}
@@ -520,7 +706,7 @@ func (c *Car) detecting(chOp chan Op) {
 func (c *Car) detectObstacles(ctx context.Context, chOp chan Op, wg *sync.WaitGroup, cancel func()) {
 	defer wg.Done()
 
-	for c.selfdriving || c.selftracking || c.speechdriving {
+	for c.selfdriving.get() || c.selftracking.get() || c.speechdriving.get() {
 		for _, angle := range aheadAngles {
 			select {
 			case <-ctx.Done():
@@ -528,9 +714,10 @@ func (c *Car) detectObstacles(ctx context.Context, chOp chan Op, wg *sync.WaitGr
 			default:
 				// do nothing
 			}
-			c.servo.Roll(angle)
-			util.DelayMs(70)
+			c.rollServo(angle)
+			c.delayMs(70)
 			d := c.dmeter.Dist()
+			c.setDist(d)
 			if d < 20 {
 				chOp <- backward
 				cancel()
@@ -548,7 +735,7 @@ func (c *Car) detectObstacles(ctx context.Context, chOp chan Op, wg *sync.WaitGr
 func (c *Car) detectCollision(ctx context.Context, chOp chan Op, wg *sync.WaitGroup, cancel func()) {
 	defer wg.Done()
 
-	for c.selfdriving || c.selftracking || c.speechdriving {
+	for c.selfdriving.get() || c.selftracking.get() || c.speechdriving.get() {
 		select {
 		case <-ctx.Done():
 			return
@@ -564,14 +751,15 @@ func (c *Car) detectCollision(ctx context.Context, chOp chan Op, wg *sync.WaitGr
 				return
 			}
 		}
-		util.DelayMs(10)
+		c.delayMs(10)
 	}
 }
 
 func (c *Car) trackingObj(ctx context.Context, chOp chan Op, wg *sync.WaitGroup, cancel func()) {
 	defer wg.Done()
 	angle := 0
-	for c.selftracking {
+	locked := 0
+	for c.selftracking.get() {
 		select {
 		case <-ctx.Done():
 			return
@@ -579,7 +767,7 @@ func (c *Car) trackingObj(ctx context.Context, chOp chan Op, wg *sync.WaitGroup,
 			// do nothing
 		}
 
-		ok, _ := c.tracker.Locate()
+		ok, _, _ := c.locate(&locked)
 		if !ok {
 			continue
 		}
@@ -591,8 +779,8 @@ func (c *Car) trackingObj(ctx context.Context, chOp chan Op, wg *sync.WaitGroup,
 		c.stop()
 
 		firstTime := true // see a ball at the first time
-		for c.selftracking {
-			ok, rect := c.tracker.Locate()
+		for c.selftracking.get() {
+			ok, rect, x := c.locate(&locked)
 			if !ok {
 				// lost the ball, looking for it by turning 360 degree
 				log.Printf("[car]lost the ball")
@@ -600,7 +788,7 @@ func (c *Car) trackingObj(ctx context.Context, chOp chan Op, wg *sync.WaitGroup,
 				if angle < 360 {
 					c.turn(30)
 					angle += 30
-					util.DelayMs(200)
+					c.delayMs(200)
 					continue
 				}
 				chOp <- scan
@@ -616,51 +804,107 @@ func (c *Car) trackingObj(ctx context.Context, chOp chan Op, wg *sync.WaitGroup,
 				go c.horn.Beep(2, 100)
 			}
 			firstTime = false
-			x, y := c.tracker.MiddleXY(rect)
-			log.Printf("[car]found a ball at: (%v, %v)", x, y)
+			log.Printf("[car]found a ball at: %v, aim at x: %v", *rect, x)
 			if x < 200 {
 				log.Printf("[car]turn right to the ball")
 				c.engine.Right()
-				util.DelayMs(100)
+				c.delayMs(100)
 				c.engine.Stop()
 				continue
 			}
 			if x > 400 {
 				log.Printf("[car]turn left to the ball")
 				c.engine.Left()
-				util.DelayMs(100)
+				c.delayMs(100)
 				c.engine.Stop()
 				continue
 			}
 			log.Printf("[car]forward to the ball")
 			c.engine.Forward()
-			util.DelayMs(100)
+			c.delayMs(100)
 			c.engine.Stop()
 		}
 
 	}
 }
 
+// locate locates the target to follow, and returns its box and the x to aim at.
+// if the tracker tracks multiple targets, the target locked is followed until it is lost,
+// and x is where the target will be after targetLead by its velocity.
+func (c *Car) locate(locked *int) (bool, *image.Rectangle, int) {
+	tt, ok := c.tracker.(TargetTracker)
+	if !ok {
+		ok, rect := c.tracker.Locate()
+		if !ok {
+			return false, nil, 0
+		}
+		x, _ := c.tracker.MiddleXY(rect)
+		return true, rect, x
+	}
+
+	targets, err := tt.Track()
+	if err != nil {
+		log.Printf("[car]failed to track, error: %v", err)
+		return false, nil, 0
+	}
+	t := pickTarget(targets, *locked)
+	if t == nil {
+		*locked = 0
+		return false, nil, 0
+	}
+	if t.ID != *locked {
+		log.Printf("[car]lock on target %v(%v)", t.ID, t.Profile)
+		*locked = t.ID
+	}
+	return true, &t.Box, int(t.X + t.VX*targetLead.Seconds())
+}
+
+// pickTarget picks the target locked, or the largest one if it is lost
+func pickTarget(targets []*vision.Target, locked int) *vision.Target {
+	for _, t := range targets {
+		if t.ID == locked {
+			return t
+		}
+	}
+	if len(targets) == 0 {
+		return nil
+	}
+	// the largest one
+	return targets[0]
+}
+
 func (c *Car) detectSpeech(chOp chan Op, wg *sync.WaitGroup) {
 	defer wg.Done()
 
 	speechAuth := oauth.New(baiduSpeechAppKey, baiduSpeechSecretKey, oauth.NewCacheMan())
-	c.asr = speech.NewASR(speechAuth)
-	c.tts = speech.NewTTS(speechAuth)
+	if c.asr == nil {
+		c.asr = speech.NewASR(speechAuth)
+	}
 
-	imgAuth := oauth.New(baiduImgRecognitionAppKey, baiduImgRecognitionSecretKey, oauth.NewCacheMan())
-	c.imgr = recognizer.New(imgAuth)
+	if c.imgr == nil {
+		c.imgr = vision.NewBaiduObject(baiduImgRecognitionAppKey, baiduImgRecognitionSecretKey)
+	}
 
-	for c.speechdriving {
+	vad := audio.NewVAD()
+	for c.speechdriving.get() {
 		log.Printf("[car]start recording")
 		go c.led.On()
-		wav := "car.wav"
-		if err := util.Record(2, wav); err != nil {
+		b, err := audio.Record(util.CaptureDevice, audio.Voice, 2*time.Second)
+		go c.led.Off()
+		log.Printf("[car]stop recording")
+		if err != nil {
 			log.Printf("[car]failed to record the speech: %v", err)
+			c.delayMs(500)
+			continue
+		}
+		if !vad.HasVoice(b) {
+			continue
+		}
+		wav := "car.wav"
+		if err := audio.WriteFile(wav, vad.Trim(b)); err != nil {
+			log.Printf("[car]failed to save the speech: %v", err)
 			continue
 		}
-		go c.led.Off()
-		log.Printf("[car]stop recording")
 
 		text, err := c.asr.ToText(wav)
 		if err != nil {
@@ -669,30 +913,25 @@ func (c *Car) detectSpeech(chOp chan Op, wg *sync.WaitGroup) {
 		}
 		log.Printf("[car]speech: %v", text)
 
-		switch {
-		case strings.Index(text, "前") >= 0:
-			chOp <- forward
-		case strings.Index(text, "后") >= 0:
-			chOp <- backward
-		case strings.Index(text, "左") >= 0:
-			chOp <- left
-		case strings.Index(text, "右") >= 0:
-			chOp <- right
-		case strings.Index(text, "停") >= 0:
-			chOp <- stop
-		case strings.Index(text, "转圈") >= 0:
-			chOp <- roll
-		case strings.Index(text, "是什么") >= 0:
+		op, ok := c.grammar.Match(text)
+		if !ok {
+			continue
+		}
+		log.Printf("[car]voice command: %v", op)
+		switch op {
+		case forward, backward, left, right, stop, roll:
+			chOp <- op
+		case whatisit:
 			c.recognize()
-		case strings.Index(text, "开灯") >= 0:
+		case lighton:
 			c.light.On()
-		case strings.Index(text, "关灯") >= 0:
+		case lightoff:
 			c.light.Off()
-		case strings.Index(text, "大声") >= 0:
+		case volumeup:
 			c.volumeUp()
-		case strings.Index(text, "小声") >= 0:
+		case volumedown:
 			c.volumeDown()
-		case strings.Index(text, "唱歌") >= 0:
+		case sing:
 			go util.PlayWav("./music/xiaomaolv.wav")
 		default:
 			// do nothing
@@ -709,13 +948,14 @@ func (c *Car) scan() (mind, maxd float64, mindAngle, maxdAngle int) {
 	mind = 9999
 	maxd = -9999
 	for _, ang := range scanningAngles {
-		c.servo.Roll(ang)
-		util.DelayMs(100)
+		c.rollServo(ang)
+		c.delayMs(100)
 		d := c.dmeter.Dist()
 		for i := 0; d < 0 && i < 3; i++ {
-			util.DelayMs(100)
+			c.delayMs(100)
 			d = c.dmeter.Dist()
 		}
+		c.setDist(d)
 		if d < 0 {
 			continue
 		}
@@ -729,8 +969,8 @@ func (c *Car) scan() (mind, maxd float64, mindAngle, maxdAngle int) {
 			maxdAngle = ang
 		}
 	}
-	c.servo.Roll(0)
-	util.DelayMs(50)
+	c.rollServo(0)
+	c.delayMs(50)
 	return
 }
 
@@ -741,16 +981,18 @@ func (c *Car) turn(angle int) {
 		angle *= (-1)
 	}
 
-	yaw, _, _, err := c.gy25.Angles()
+	yaw, pitch, roll, err := c.gy25.Angles()
 	if err != nil {
 		log.Printf("[car]failed to get angles from gy-25, error: %v", err)
 		return
 	}
+	c.setAngles(yaw, pitch, roll)
 
 	retry := 0
 	for {
+		c.sup.heartbeat(srcAuto)
 		turnf()
-		yaw2, _, _, err := c.gy25.Angles()
+		yaw2, pitch, roll, err := c.gy25.Angles()
 		if err != nil {
 			log.Printf("[car]failed to get angles from gy-25, error: %v", err)
 			if retry < 3 {
@@ -759,42 +1001,19 @@ func (c *Car) turn(angle int) {
 			}
 			break
 		}
+		c.setAngles(yaw2, pitch, roll)
 		ang := c.gy25.IncludedAngle(yaw, yaw2)
 		if ang >= float64(angle) {
 			break
 		}
-		time.Sleep(100 * time.Millisecond)
+		c.clock.Sleep(100 * time.Millisecond)
 		c.engine.Stop()
-		time.Sleep(100 * time.Millisecond)
+		c.clock.Sleep(100 * time.Millisecond)
 	}
 	c.engine.Stop()
 	return
 }
 
-func (c *Car) turnLeft(angle int) {
-	n := angle/5 - 1
-	c.encoder.Start()
-	defer c.encoder.Stop()
-
-	c.chOp <- left
-	for i := 0; i < n; {
-		i += c.encoder.Count1()
-	}
-	return
-}
-
-func (c *Car) turnRight(angle int) {
-	n := angle/5 - 1
-	c.encoder.Start()
-	defer c.encoder.Stop()
-
-	c.chOp <- right
-	for i := 0; i < n; {
-		i += c.encoder.Count1()
-	}
-	return
-}
-
 func (c *Car) recognize() error {
 	log.Printf("[car]take photo")
 	imagef, err := c.camera.TakePhoto()
@@ -813,7 +1032,7 @@ func (c *Car) recognize() error {
 	}
 	log.Printf("[car]object: %v", objname)
 
-	if err := c.playText("这是" + objname); err != nil {
+	if err := c.playText("这是"+objname, tts.Normal); err != nil {
 		log.Printf("[car]failed to play text, error: %v", err)
 		return err
 	}
@@ -836,7 +1055,7 @@ func (c *Car) volumeUp() {
 		v = 100
 	}
 	c.setVolume(v)
-	go c.playText(fmt.Sprintf("音量%v%%", v))
+	go c.playText(fmt.Sprintf("音量%v%%", v), tts.Chatter)
 }
 
 func (c *Car) volumeDown() {
@@ -845,43 +1064,43 @@ func (c *Car) volumeDown() {
 		v = 0
 	}
 	c.setVolume(v)
-	go c.playText(fmt.Sprintf("音量%v%%", v))
+	go c.playText(fmt.Sprintf("音量%v%%", v), tts.Chatter)
 }
 
 func (c *Car) recognizeImg(imageFile string) (string, error) {
 	if c.imgr == nil {
 		return "", errors.New("invalid image recognizer")
 	}
-	name, err := c.imgr.Recognize(imageFile)
+	results, err := c.imgr.Recognize(imageFile)
 	if err != nil {
 		return "", err
 	}
-	return name, nil
-}
-
-func (c *Car) toSpeech(text string) (string, error) {
-	data, err := c.tts.ToSpeech(text)
-	if err != nil {
-		log.Printf("[car]failed to convert text to speech, error: %v", err)
-		return "", err
+	best := vision.Best(results, minRecognitionScore)
+	if best == nil {
+		return "", errors.New("nothing recognized")
 	}
-
-	if err := ioutil.WriteFile(thisIsXWav, data, 0644); err != nil {
-		log.Printf("[car]failed to save %v, error: %v", thisIsXWav, err)
-		return "", err
-	}
-	return thisIsXWav, nil
+	return best.Label, nil
 }
 
-func (c *Car) playText(text string) error {
-	wav, err := c.toSpeech(text)
-	if err != nil {
-		log.Printf("[car]failed to tts, error: %v", err)
-		return err
-	}
+// ttsQueue returns the queue of text to speech, it's created at the first time
+func (c *Car) ttsQueue() *tts.Queue {
+	c.speakerOnce.Do(func() {
+		if c.voice == nil {
+			c.voice = tts.NewBaidu(baiduSpeechAppKey, baiduSpeechSecretKey)
+		}
+		cache, err := tts.NewCache(ttsCacheDir)
+		if err != nil {
+			log.Printf("[car]failed to create tts cache, error: %v", err)
+			cache = nil
+		}
+		c.speaker = tts.NewQueue(c.voice, cache, util.PlaybackDevice)
+	})
+	return c.speaker
+}
 
-	if err := util.PlayWav(wav); err != nil {
-		log.Printf("[car]failed to play wav: %v, error: %v", wav, err)
+func (c *Car) playText(text string, prio tts.Priority) error {
+	if err := c.ttsQueue().Say(text, prio).Wait(); err != nil {
+		log.Printf("[car]failed to play text: %v, error: %v", text, err)
 		return err
 	}
 	return nil
@@ -895,54 +1114,72 @@ func (c *Car) joystick() {
 	c.lc12s.Wakeup()
 	defer c.lc12s.Sleep()
 
+	link := radio.NewLink(c.lc12s)
+	driving := false // driving by the joystick
 	for {
-		time.Sleep(200 * time.Millisecond)
-
-		if c.selfdriving {
-			continue
+		ctl, err := link.RecvControl()
+		if !link.Lost(joystickBeat) {
+			c.sup.heartbeat(srcJoystick)
 		}
-
-		data, err := c.lc12s.Receive()
 		if err != nil {
-			log.Printf("[car]failed to receive data from LC12S, error: %v", err)
+			log.Printf("[car]failed to receive control from LC12S, error: %v", err)
+			c.delayMs(100)
 			continue
 		}
-		log.Printf("[car]LC12S received: %v", data)
-
-		if len(data) != 1 {
-			log.Printf("[car]invalid data from LC12S, data len: %v", len(data))
+		if ctl == nil {
+			if driving && link.Lost(linkTimeout) {
+				// failsafe
+				log.Printf("[car]lost the joystick, stop")
+				c.chOp <- stop
+				driving = false
+			}
 			continue
 		}
+		log.Printf("[car]joystick: x=%v, y=%v, button=%v", ctl.X, ctl.Y, ctl.Button)
 
-		op := (data[0] >> 4)
-		speed := data[0] & 0x0F
-
-		switch op {
-		case 0:
-			c.chOp <- stop
-		case 1:
-			c.chOp <- forward
-		case 2:
-			c.chOp <- backward
-		case 3:
-			c.chOp <- left
-		case 4:
-			c.chOp <- right
-		case 5:
-			if c.selfdriving {
+		if ctl.Button {
+			if c.selfdriving.get() {
 				c.chOp <- selfdrivingoff
 				continue
 			}
 			c.chOp <- selfdrivingon
-		default:
-			c.chOp <- stop
+			continue
+		}
+		if c.selfdriving.get() {
+			continue
+		}
+
+		if abs(int(ctl.X)) < joystickDeadZone && abs(int(ctl.Y)) < joystickDeadZone {
+			if driving {
+				c.chOp <- stop
+				driving = false
+			}
+			continue
 		}
-		c.speed(uint32(speed * 10))
+		driving = true
+		c.sup.take(srcJoystick)
+		c.drive(mix(ctl))
 	}
 }
 
+// mix mixes the throttle(x) and the steering(y) of the joystick to the ratios of the left and right wheels
+func mix(ctl *radio.Control) (left, right float64) {
+	throttle := float64(ctl.X) / 100
+	steer := float64(ctl.Y) / 100
+	left = math.Max(-1, math.Min(1, throttle+steer))
+	right = math.Max(-1, math.Min(1, throttle-steer))
+	return
+}
+
+func abs(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
+
 func (c *Car) selfNavOn() {
-	if c.selfnav {
+	if c.selfnav.get() {
 		return
 	}
 	if c.gps == nil {
@@ -950,34 +1187,49 @@ func (c *Car) selfNavOn() {
 		return
 	}
 
-	c.selfdriving = false
-	c.selftracking = false
-	c.speechdriving = false
-	util.DelayMs(1000) // wait for self-tracking and speech-driving quit
+	c.selfdriving.set(false)
+	c.selftracking.set(false)
+	c.speechdriving.set(false)
+	c.delayMs(1000) // wait for self-tracking and speech-driving quit
 
-	c.selfnav = true
+	c.selfnav.set(true)
 	log.Printf("[car]nav on")
+	c.rec.mode(c.mode())
 	if err := c.selfNav(); err != nil {
-		return
+		log.Printf("[car]nav stopped, error: %v", err)
 	}
-	c.selfnav = false
+	c.selfnav.set(false)
+	c.rec.mode(c.mode())
 }
 
 func (c *Car) selfNavOff() {
-	c.selfnav = false
+	c.selfnav.set(false)
 	log.Printf("[car]nav off")
+	c.rec.mode(c.mode())
 }
 
 func (c *Car) selfNav() error {
-	if c.dest == nil {
+	c.mu.Lock()
+	if c.mission == nil && c.dest != nil {
+		c.mission = NewMission(c.dest)
+	}
+	m := c.mission
+	c.mu.Unlock()
+	if m == nil {
 		log.Printf("[car]destination didn't be set, stop nav")
 		return errors.New("destination isn't set")
 	}
+	if err := m.init(); err != nil {
+		return err
+	}
 
 	c.horn.Beep(3, 300)
-	if !bbox.IsInside(c.dest) {
-		log.Printf("[car]destination isn't in bbox, stop nav")
-		return errors.New("destination isn't in bbox")
+	for _, wp := range m.Waypoints {
+		if !bbox.IsInside(wp.Point()) {
+			log.Printf("[car]waypoint %v isn't in bbox, stop nav", wp.Name)
+			m.setStatus(MissionFailed)
+			return errors.New("waypoint isn't in bbox")
+		}
 	}
 
 	c.gpslogger = util.NewGPSLogger()
@@ -987,121 +1239,310 @@ func (c *Car) selfNav() error {
 	}
 	defer c.gpslogger.Close()
 
+	c.mlogger = newMissionLogger(m)
+	defer c.mlogger.close()
+
 	var org *geo.Point
-	for c.selfnav {
-		pt, err := c.gps.Loc()
+	c.loc = nav.NewLocalizer(localizerCfg)
+	for c.selfnav.get() {
+		fix, err := c.gps.Fix()
 		if err != nil {
 			log.Printf("[car]gps sensor is not ready")
-			util.DelayMs(1000)
+			c.delayMs(1000)
 			continue
 		}
-		c.gpslogger.AddPoint(org)
-		if !bbox.IsInside(pt) {
-			log.Printf("current loc(%v) isn't in bbox(%v)", pt, bbox)
+		c.gpslogger.AddPoint(fix.Loc)
+		c.setFix(fix, 0)
+		if !bbox.IsInside(fix.Loc) {
+			log.Printf("current loc(%v) isn't in bbox(%v)", fix.Loc, bbox)
 			continue
 		}
-		org = pt
+		c.loc.Update(fix.Loc, fix.HDOP)
+		org = fix.Loc
 		break
 	}
-	if !c.selfnav {
+	if !c.selfnav.get() {
+		m.setStatus(MissionAborted)
 		return errors.New("nav abort")
 	}
 	c.lastLoc = org
 
-	path, err := findPath(org, c.dest)
+	ctx, cancel := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go c.localize(ctx, &wg)
+	defer func() {
+		cancel()
+		wg.Wait()
+	}()
+
+	m.setStatus(MissionRunning)
+	log.Printf("[car]mission %v started, waypoints: %v", m.Name, len(m.Waypoints))
+	for i, wp := range m.Waypoints {
+		m.setCurrent(i)
+		log.Printf("[car]mission %v: heading to waypoint %v/%v(%v)", m.Name, i+1, len(m.Waypoints), wp.Name)
+		if err := c.navToWaypoint(wp); err != nil {
+			log.Printf("[car]failed to nav to waypoint %v, error: %v", wp.Name, err)
+			if m.status() != MissionAborted {
+				m.setStatus(MissionFailed)
+			}
+			c.chOp <- stop
+			return err
+		}
+		c.mlogger.actual(wp.Name, c.lastLoc)
+		c.arrive(wp)
+	}
+	m.setStatus(MissionDone)
+	log.Printf("[car]mission %v done", m.Name)
+	c.chOp <- stop
+	return nil
+}
+
+func (c *Car) navToWaypoint(wp *Waypoint) error {
+	path, err := findPath(c.lastLoc, wp.Point())
 	if err != nil {
 		log.Printf("[car]failed to find a path, error: %v", err)
 		return errors.New("failed to find a path")
 	}
 	turns := turnPoints(path)
 
-	var turnPts []*geo.Point
+	// the polyline from current location to the waypoint through the turn points,
+	// use the waypoint itself as the last point instead of the grid point.
+	polyline := []*geo.Point{c.lastLoc}
 	var str string
-	for _, xy := range turns {
+	for i, xy := range turns {
 		pt := xy2geo(xy)
+		if i == len(turns)-1 {
+			pt = wp.Point()
+		}
 		str += fmt.Sprintf("(%v) ", pt)
-		turnPts = append(turnPts, pt)
+		polyline = append(polyline, pt)
+		c.mlogger.planned(wp.Name, pt)
 	}
 	log.Printf("[car]turn points(lat,lon): %v", str)
 
+	pp, err := nav.NewPurePursuit(polyline, pursuitCfg)
+	if err != nil {
+		log.Printf("[car]failed to new a pure pursuit controller, error: %v", err)
+		return err
+	}
+
 	c.chOp <- forward
-	util.DelayMs(1000)
-	for i, p := range turnPts {
-		if err := c.navTo(p); err != nil {
-			log.Printf("[car]failed to nav to (%v), error: %v", p, err)
-			break
+	c.delayMs(1000)
+	if err := c.follow(pp, wp.Radius); err != nil {
+		return err
+	}
+	if !c.selfnav.get() {
+		return errors.New("nav abort")
+	}
+	return nil
+}
+
+// arrive stays at the waypoint for the dwell time and takes the actions of the waypoint
+func (c *Car) arrive(wp *Waypoint) {
+	log.Printf("[car]arrived at waypoint %v", wp.Name)
+	c.chOp <- stop
+	go c.horn.Beep(5, 300)
+	for _, a := range wp.Actions {
+		c.doAction(a)
+	}
+	for t := c.clock.Now(); c.since(t) < time.Duration(wp.Dwell)*time.Second && c.selfnav.get(); {
+		c.delayMs(200)
+	}
+}
+
+func (c *Car) doAction(a *WaypointAction) {
+	log.Printf("[car]action: %v %v", a.Type, a.Text)
+	switch a.Type {
+	case ActionBeep:
+		c.horn.Beep(3, 100)
+	case ActionPhoto:
+		if c.camera == nil {
+			log.Printf("[car]can't take photo without camera")
+			return
+		}
+		imagef, err := c.camera.TakePhoto()
+		if err != nil {
+			log.Printf("[car]failed to take phote, error: %v", err)
+			return
 		}
-		if i < len(turnPts)-1 {
-			// turn point
-			go c.horn.Beep(2, 100)
-		} else {
-			// destination
-			go c.horn.Beep(5, 300)
+		log.Printf("[car]took photo: %v", imagef)
+	case ActionSay:
+		if err := c.playText(a.Text, tts.Normal); err != nil {
+			log.Printf("[car]failed to say %v, error: %v", a.Text, err)
 		}
 	}
-	c.chOp <- stop
-	return nil
 }
 
-func (c *Car) navTo(dest *geo.Point) error {
-	retry := 8
-	for c.selfnav {
-		loc, err := c.gps.Loc()
+func (c *Car) missionPause() {
+	m := c.getMission()
+	if m == nil || m.status() != MissionRunning {
+		return
+	}
+	m.setStatus(MissionPaused)
+	log.Printf("[car]mission paused")
+}
+
+func (c *Car) missionResume() {
+	m := c.getMission()
+	if m == nil || m.status() != MissionPaused {
+		return
+	}
+	m.setStatus(MissionRunning)
+	log.Printf("[car]mission resumed")
+}
+
+func (c *Car) missionAbort() {
+	m := c.getMission()
+	if m == nil {
+		return
+	}
+	m.setStatus(MissionAborted)
+	c.selfnav.set(false)
+	log.Printf("[car]mission aborted")
+	c.rec.mode(c.mode())
+}
+
+// follow follows the path using the pure pursuit controller,
+// until the car is in the radius of the end of the path.
+func (c *Car) follow(pp *nav.PurePursuit, radius float64) error {
+	var (
+		heading = -1.0
+		prev    = c.lastLoc
+		last    = c.clock.Now()
+		m       = c.getMission()
+	)
+	c.sup.take(srcAuto)
+	for c.selfnav.get() {
+		// beat in every step, including the waiting ones, so the motors are cut if the loop stalls
+		c.sup.heartbeat(srcAuto)
+		if m != nil && m.status() == MissionPaused {
+			c.chOp <- stop
+			c.delayMs(500)
+			continue
+		}
+
+		fix, err := c.gps.Fix()
+		// waiting for the fix takes up to a period of the gps
+		c.sup.heartbeat(srcAuto)
 		if err != nil {
 			c.chOp <- stop
 			log.Printf("[car]gps sensor is not ready")
-			util.DelayMs(1000)
+			c.delayMs(1000)
 			continue
 		}
 
-		if !bbox.IsInside(loc) {
+		if !bbox.IsInside(fix.Loc) {
 			c.chOp <- stop
-			log.Printf("current loc(%v) isn't in bbox(%v)", loc, bbox)
-			util.DelayMs(1000)
+			log.Printf("current loc(%v) isn't in bbox(%v)", fix.Loc, bbox)
+			c.delayMs(1000)
 			continue
 		}
 
-		c.gpslogger.AddPoint(loc)
-		log.Printf("[car]current loc: %v", loc)
-
-		d := loc.DistanceWith(c.lastLoc)
-		log.Printf("[car]distance to last loc: %.2f m", d)
-		if d > 4 && retry < 5 {
+		if err := c.loc.Update(fix.Loc, fix.HDOP); err != nil {
 			c.chOp <- stop
-			log.Printf("[car]bad gps signal, waiting for better gps signal")
-			retry++
-			util.DelayMs(1000)
+			log.Printf("[car]bad gps signal, waiting for better gps signal, error: %v", err)
+			c.delayMs(1000)
+			continue
+		}
+		est, _ := c.loc.Estimate()
+		loc := est.Loc
+		c.setFix(fix, est.PosStd)
+		c.gpslogger.AddEstimate(loc, est.PosStd)
+		if m != nil {
+			c.mlogger.actual(m.State().Waypoint, loc)
+		}
+		log.Printf("[car]current loc: %v, hdop: %.1f, std: %.2f m", loc, fix.HDOP, est.PosStd)
+
+		now := c.clock.Now()
+		speed := loc.DistanceWith(prev) / now.Sub(last).Seconds()
+		prev, last = loc, now
+
+		if est.HeadingStd <= maxHeadingStd {
+			heading = est.Heading
+			c.lastLoc = loc
+		} else if d := loc.DistanceWith(c.lastLoc); d > minHeadingDist {
+			// the localizer doesn't know the heading, e.g. without encoder,
+			// use the heading from the last loc instead.
+			heading = geo.Bearing(c.lastLoc, loc)
+			c.lastLoc = loc
+		}
+		if heading < 0 {
+			// don't know the heading until the car moves
+			c.chOp <- forward
+			c.delayMs(500)
 			continue
 		}
 
-		retry = 0
-		d = loc.DistanceWith(dest)
-		log.Printf("[car]distance to destination: %.2f m", d)
-		if d < 4 {
+		k, remain := pp.Steer(&nav.Pose{Loc: loc, Heading: heading}, speed)
+		log.Printf("[car]distance to destination: %.2f m", remain)
+		if m != nil {
+			m.setLoc(loc, remain)
+		}
+		if remain < radius {
 			c.chOp <- stop
+			c.lastLoc = loc
 			log.Printf("[car]arrived at the destination, nav done")
 			return nil
 		}
 
-		side := geo.Side(c.lastLoc, loc, dest)
-		angle := int(180 - geo.Angle(c.lastLoc, loc, dest))
-		if angle < 10 {
-			side = geo.MiddleSide
-		}
-		log.Printf("[car]nav angle: %v, side: %v", angle, side)
-
-		switch side {
-		case geo.LeftSide:
-			c.turnLeft(angle)
-		case geo.RightSide:
-			c.turnRight(angle)
-		case geo.MiddleSide:
-			// do nothing
-		}
-		c.chOp <- forward
-		util.DelayMs(1000)
-		c.lastLoc = loc
+		log.Printf("[car]heading: %.0f(std: %.0f), speed: %.2f m/s, curvature: %.3f", heading, est.HeadingStd, speed, k)
+		c.drive(pp.Wheels(k, 1))
 	}
 	c.chOp <- stop
 	return nil
 }
+
+// localize feeds the localizer with the odometry from the encoder and the yaw from the gy25
+func (c *Car) localize(ctx context.Context, wg *sync.WaitGroup) {
+	defer wg.Done()
+	if c.encoder == nil && c.gy25 == nil {
+		log.Printf("[car]localize without odometry")
+		return
+	}
+	if c.encoder != nil {
+		c.encoder.Start()
+		defer c.encoder.Stop()
+	}
+
+	var (
+		ticks   int
+		yaw     float64
+		hasYaw  bool
+		lastOdo = c.clock.Now()
+	)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		default:
+		}
+		if c.encoder != nil {
+			ticks += c.encoder.Count1()
+		}
+		if c.since(lastOdo) < odoInterval {
+			c.delayMs(2)
+			continue
+		}
+		dt := c.since(lastOdo).Seconds()
+		lastOdo = c.clock.Now()
+
+		ds := float64(ticks*c.getDir()) * distPerTick
+		ticks = 0
+		if c.encoder != nil {
+			c.setEncoderSpeed(ds / dt)
+		}
+		dyaw := 0.0
+		if c.gy25 != nil {
+			y, pitch, roll, err := c.gy25.Angles()
+			if err == nil {
+				if hasYaw {
+					dyaw = yawSign * yawDiff(yaw, y)
+				}
+				yaw, hasYaw = y, true
+				c.setAngles(y, pitch, roll)
+			}
+		}
+		c.loc.Predict(ds, dyaw)
+	}
+}
@@ -3,6 +3,7 @@ package car
 import (
 	"testing"
 
+	vision "github.com/jakefau/rpi-devices/util/cv"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -10,3 +11,36 @@ func TestCar(t *testing.T) {
 	car := New(&Config{})
 	assert.NotNil(t, car)
 }
+
+func TestYawDiff(t *testing.T) {
+	testCases := []struct {
+		yaw, yaw2 float64
+		want      float64
+	}{
+		{10, 30, 20},
+		{30, 10, -20},
+		{170, -170, 20},
+		{-170, 170, -20},
+		{0, 180, 180},
+	}
+	for _, test := range testCases {
+		assert.Equal(t, test.want, yawDiff(test.yaw, test.yaw2))
+	}
+}
+
+func TestPickTarget(t *testing.T) {
+	targets := []*vision.Target{{ID: 3, Area: 900}, {ID: 1, Area: 400}}
+	testCases := []struct {
+		desc   string
+		locked int
+		id     int
+	}{
+		{"keep the locked", 1, 1},
+		{"the largest without locked", 0, 3},
+		{"the largest if the locked is lost", 2, 3},
+	}
+	for _, test := range testCases {
+		assert.Equal(t, test.id, pickTarget(targets, test.locked).ID, test.desc)
+	}
+	assert.Nil(t, pickTarget(nil, 1))
+}
@@ -1,11 +1,19 @@
 package car
 
+import (
+	"sync/atomic"
+	"time"
+)
+
 const (
 	chSize        = 8
 	letMeThinkWav = "let_me_think.wav"
-	thisIsXWav    = "this_is_x.wav"
 	iDontKnowWav  = "i_dont_know.wav"
 	errorWav      = "error.wav"
+	ttsCacheDir   = "tts-cache"
+
+	// the min score of the object recognized
+	minRecognitionScore = 0.3
 )
 
 const (
@@ -42,6 +50,23 @@ const (
 	speechdrivingoff Op = "speechdrivingoff"
 	selfnavon        Op = "selfnavon"
 	selfnavoff       Op = "selfnavoff"
+	missionpause     Op = "missionpause"
+	missionresume    Op = "missionresume"
+	missionabort     Op = "missionabort"
+	heartbeat        Op = "heartbeat"
+	whatisit         Op = "whatisit"
+	volumeup         Op = "volumeup"
+	volumedown       Op = "volumedown"
+	sing             Op = "sing"
+)
+
+const (
+	// the car stops if nothing is received from the joystick in the timeout
+	linkTimeout = 1 * time.Second
+	// the joystick in the dead zone means stop
+	joystickDeadZone = 10
+	// the joystick is alive if anything is received from it in the time
+	joystickBeat = 300 * time.Millisecond
 )
 
 var (
@@ -50,13 +75,8 @@ var (
 )
 
 const (
-	// the hsv of a tennis
-	lh float64 = 33
-	ls float64 = 108
-	lv float64 = 138
-	hh float64 = 61
-	hs float64 = 255
-	hv float64 = 255
+	// aim at where the target will be after targetLead when following a target
+	targetLead = 300 * time.Millisecond
 )
 
 type (
@@ -65,3 +85,18 @@ type (
 	// Option ...
 	Option func(c *Car)
 )
+
+// flag is a bool set by the ops and read by the loops of the modes
+type flag int32
+
+func (f *flag) get() bool {
+	return atomic.LoadInt32((*int32)(f)) == 1
+}
+
+func (f *flag) set(on bool) {
+	var v int32
+	if on {
+		v = 1
+	}
+	atomic.StoreInt32((*int32)(f), v)
+}
@@ -1,20 +1,74 @@
 package car
 
 import (
+	"image"
+	"time"
+
 	"github.com/jakefau/rpi-devices/dev"
+	vision "github.com/jakefau/rpi-devices/util/cv"
+	"github.com/jakefau/rpi-devices/util/tts"
 )
 
-// Config ...
+// Config is the devices of a car,
+// leave a device nil if the car is built without it.
+// Tracker is optional, a tracker will be created with the hsv Profiles if it is nil.
+// Profiles is optional, the tracker created by the car tracks a tennis if it is empty.
+// Safety is optional, DefaultSafetyConfig() will be used if it is nil.
+// Recorder is optional, the drive session is recorded if it isn't nil.
+// ASR is optional, the baidu asr will be used for speech-driving if it is nil.
+// Grammar is optional, DefaultGrammar() will be used if it is nil.
+// TTS is optional, the baidu tts will be used if it is nil.
+// Recognizer is optional, the baidu image recognition will be used if it is nil.
+// Clock is optional, the car runs in the real time if it is nil.
 type Config struct {
-	Engine     *dev.L298N
-	Servo      *dev.SG90
-	GY25       *dev.GY25
-	Horn       *dev.Buzzer
-	Led        *dev.Led
-	Light      *dev.Led
+	Engine     dev.Motor
+	Servo      dev.Roller
+	GY25       dev.AngleMeter
+	Encoder    dev.PulseCounter
+	Horn       dev.Beeper
+	Led        dev.Light
+	Light      dev.Light
 	Camera     *dev.Camera
-	GPS        *dev.GPS
-	LC12S      *dev.LC12S
-	Collisions []*dev.Collision
+	GPS        dev.Locator
+	LC12S      dev.Radio
+	Collisions []dev.CollisionSwitch
 	DistMeter  dev.DistMeter
+	Tracker    Tracker
+	Profiles   []vision.HSV
+	Safety     *SafetyConfig
+	Recorder   *Recorder
+	ASR        Recognizer
+	Grammar    Grammar
+	TTS        tts.Engine
+	Recognizer vision.Recognizer
+	Clock      Clock
+}
+
+// Clock is the time of the car, all of the delays and timings of the car go through it,
+// so a simulator can run the car faster than the real time.
+type Clock interface {
+	Now() time.Time
+	Sleep(d time.Duration)
+	After(d time.Duration) <-chan time.Time
+}
+
+// realClock is the real time
+type realClock struct{}
+
+func (realClock) Now() time.Time                         { return time.Now() }
+func (realClock) Sleep(d time.Duration)                  { time.Sleep(d) }
+func (realClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+
+// Tracker locates an object in the view of the camera
+type Tracker interface {
+	Locate() (bool, *image.Rectangle)
+	MiddleXY(rect *image.Rectangle) (x int, y int)
+	Close()
+}
+
+// TargetTracker is a tracker tracking multiple targets with persistent ids,
+// the car keeps following the same target until it is lost, and aims at where the target is moving to.
+type TargetTracker interface {
+	Tracker
+	Track() ([]*vision.Target, error)
 }
@@ -0,0 +1,311 @@
+package car
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jakefau/rpi-devices/util/geo"
+)
+
+const (
+	// the default arrival radius in meter
+	defaultRadius float64 = 4
+)
+
+// Action is an action the car takes when it arrived at a waypoint
+type Action string
+
+const (
+	// ActionBeep beeps the horn
+	ActionBeep Action = "beep"
+	// ActionPhoto takes a photo with the camera
+	ActionPhoto Action = "photo"
+	// ActionSay plays the text of the action
+	ActionSay Action = "say"
+)
+
+// MissionStatus ...
+type MissionStatus string
+
+const (
+	// MissionIdle ...
+	MissionIdle MissionStatus = "idle"
+	// MissionRunning ...
+	MissionRunning MissionStatus = "running"
+	// MissionPaused ...
+	MissionPaused MissionStatus = "paused"
+	// MissionAborted ...
+	MissionAborted MissionStatus = "aborted"
+	// MissionDone ...
+	MissionDone MissionStatus = "done"
+	// MissionFailed ...
+	MissionFailed MissionStatus = "failed"
+)
+
+// WaypointAction ...
+type WaypointAction struct {
+	Type Action `json:"type"`
+	Text string `json:"text,omitempty"`
+}
+
+// Waypoint is a point of a mission
+// radius: the arrival radius in meter
+// dwell: the time staying at the waypoint in second
+type Waypoint struct {
+	Name    string            `json:"name"`
+	Lat     float64           `json:"lat"`
+	Lon     float64           `json:"lon"`
+	Radius  float64           `json:"radius"`
+	Dwell   int               `json:"dwell"`
+	Actions []*WaypointAction `json:"actions"`
+}
+
+// Point ...
+func (w *Waypoint) Point() *geo.Point {
+	return &geo.Point{
+		Lat: w.Lat,
+		Lon: w.Lon,
+	}
+}
+
+// MissionState is the progress of a mission
+type MissionState struct {
+	Name     string        `json:"name"`
+	Status   MissionStatus `json:"status"`
+	Current  int           `json:"current"`
+	Total    int           `json:"total"`
+	Waypoint string        `json:"waypoint"`
+	Dist     float64       `json:"dist"`
+	Loc      *geo.Point    `json:"loc"`
+	Started  time.Time     `json:"started"`
+	Updated  time.Time     `json:"updated"`
+}
+
+// Mission is an ordered list of waypoints
+type Mission struct {
+	Name      string      `json:"name"`
+	Waypoints []*Waypoint `json:"waypoints"`
+
+	mu    sync.Mutex
+	state MissionState
+}
+
+// NewMission creates a mission with only one waypoint
+func NewMission(dest *geo.Point) *Mission {
+	m := &Mission{
+		Name: "dest",
+		Waypoints: []*Waypoint{
+			{
+				Name: "dest",
+				Lat:  dest.Lat,
+				Lon:  dest.Lon,
+			},
+		},
+	}
+	m.init()
+	return m
+}
+
+// ParseMission parses a mission in json
+func ParseMission(r io.Reader) (*Mission, error) {
+	var m Mission
+	if err := json.NewDecoder(r).Decode(&m); err != nil {
+		return nil, err
+	}
+	if err := m.init(); err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+type gpxAction struct {
+	Type string `xml:",chardata"`
+	Text string `xml:"text,attr"`
+}
+
+type gpxPoint struct {
+	Lat     float64     `xml:"lat,attr"`
+	Lon     float64     `xml:"lon,attr"`
+	Name    string      `xml:"name"`
+	Radius  float64     `xml:"extensions>radius"`
+	Dwell   int         `xml:"extensions>dwell"`
+	Actions []gpxAction `xml:"extensions>action"`
+}
+
+type gpxFile struct {
+	Routes []struct {
+		Name   string     `xml:"name"`
+		Points []gpxPoint `xml:"rtept"`
+	} `xml:"rte"`
+	Waypoints []gpxPoint `xml:"wpt"`
+}
+
+// ParseGPX parses a mission from a gpx route.
+// the first route will be used, or all the waypoints if there isn't any route in the gpx.
+// the radius, dwell time and actions of a waypoint can be set in the extensions, e.g.
+//
+//	<rtept lat="39.955980" lon="116.444390">
+//	  <name>gate</name>
+//	  <extensions>
+//	    <radius>3</radius>
+//	    <dwell>10</dwell>
+//	    <action>beep</action>
+//	    <action text="hello">say</action>
+//	  </extensions>
+//	</rtept>
+func ParseGPX(r io.Reader) (*Mission, error) {
+	var g gpxFile
+	if err := xml.NewDecoder(r).Decode(&g); err != nil {
+		return nil, err
+	}
+
+	m := &Mission{}
+	pts := g.Waypoints
+	if len(g.Routes) > 0 {
+		m.Name = g.Routes[0].Name
+		pts = g.Routes[0].Points
+	}
+	for _, p := range pts {
+		wp := &Waypoint{
+			Name:   p.Name,
+			Lat:    p.Lat,
+			Lon:    p.Lon,
+			Radius: p.Radius,
+			Dwell:  p.Dwell,
+		}
+		for _, a := range p.Actions {
+			wp.Actions = append(wp.Actions, &WaypointAction{
+				Type: Action(a.Type),
+				Text: a.Text,
+			})
+		}
+		m.Waypoints = append(m.Waypoints, wp)
+	}
+	if err := m.init(); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// State ...
+func (m *Mission) State() MissionState {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.state
+}
+
+func (m *Mission) init() error {
+	if len(m.Waypoints) == 0 {
+		return errors.New("mission without any waypoints")
+	}
+	for i, wp := range m.Waypoints {
+		if wp.Name == "" {
+			wp.Name = fmt.Sprintf("wp%v", i+1)
+		}
+		if wp.Radius <= 0 {
+			wp.Radius = defaultRadius
+		}
+		if wp.Dwell < 0 {
+			return fmt.Errorf("invalid dwell time %v of %v", wp.Dwell, wp.Name)
+		}
+		for _, a := range wp.Actions {
+			switch a.Type {
+			case ActionBeep, ActionPhoto, ActionSay:
+			default:
+				return fmt.Errorf("invalid action %v of %v", a.Type, wp.Name)
+			}
+		}
+	}
+	if m.Name == "" {
+		m.Name = "mission"
+	}
+	// the name is a part of the log file name
+	if strings.ContainsAny(m.Name, `/\`) {
+		return fmt.Errorf("invalid mission name %v", m.Name)
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.state = MissionState{
+		Name:   m.Name,
+		Status: MissionIdle,
+		Total:  len(m.Waypoints),
+	}
+	return nil
+}
+
+func (m *Mission) setStatus(s MissionStatus) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if s == MissionRunning && m.state.Status == MissionIdle {
+		m.state.Started = time.Now()
+	}
+	m.state.Status = s
+	m.state.Updated = time.Now()
+}
+
+func (m *Mission) status() MissionStatus {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.state.Status
+}
+
+func (m *Mission) setCurrent(i int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.state.Current = i
+	m.state.Waypoint = m.Waypoints[i].Name
+	m.state.Updated = time.Now()
+}
+
+func (m *Mission) setLoc(loc *geo.Point, dist float64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.state.Loc = loc
+	m.state.Dist = dist
+	m.state.Updated = time.Now()
+}
+
+// missionLogger logs the planned track and the actual track of a mission in csv
+type missionLogger struct {
+	f *os.File
+}
+
+func newMissionLogger(m *Mission) *missionLogger {
+	fname := fmt.Sprintf("%v_%v.csv", time.Now().Format("2006-01-02T15:04:05"), m.Name)
+	f, err := os.OpenFile(fname, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0666)
+	if err != nil {
+		return nil
+	}
+	f.WriteString("timestamp,track,waypoint,lat,lon\n")
+	return &missionLogger{f: f}
+}
+
+func (l *missionLogger) planned(wp string, pt *geo.Point) {
+	l.write("planned", wp, pt)
+}
+
+func (l *missionLogger) actual(wp string, pt *geo.Point) {
+	l.write("actual", wp, pt)
+}
+
+func (l *missionLogger) write(track, wp string, pt *geo.Point) {
+	if l == nil || pt == nil {
+		return
+	}
+	tm := time.Now().Format("2006-01-02T15:04:05")
+	l.f.WriteString(fmt.Sprintf("%v,%v,%v,%.6f,%.6f\n", tm, track, wp, pt.Lat, pt.Lon))
+}
+
+func (l *missionLogger) close() {
+	if l == nil {
+		return
+	}
+	l.f.Close()
+}
@@ -0,0 +1,127 @@
+package car
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseMission(t *testing.T) {
+	testCases := []struct {
+		desc    string
+		json    string
+		wps     int
+		radius  float64
+		dwell   int
+		actions int
+		hasErr  bool
+	}{
+		{
+			desc:    "normal case",
+			json:    `{"name":"m1","waypoints":[{"lat":39.956,"lon":116.4443,"radius":2,"dwell":5,"actions":[{"type":"beep"},{"type":"say","text":"hi"}]}]}`,
+			wps:     1,
+			radius:  2,
+			dwell:   5,
+			actions: 2,
+			hasErr:  false,
+		},
+		{
+			desc:    "default radius",
+			json:    `{"waypoints":[{"lat":39.956,"lon":116.4443},{"lat":39.9561,"lon":116.4444}]}`,
+			wps:     2,
+			radius:  defaultRadius,
+			dwell:   0,
+			actions: 0,
+			hasErr:  false,
+		},
+		{
+			desc:   "without waypoints",
+			json:   `{"name":"m1","waypoints":[]}`,
+			hasErr: true,
+		},
+		{
+			desc:   "invalid action",
+			json:   `{"waypoints":[{"lat":39.956,"lon":116.4443,"actions":[{"type":"fly"}]}]}`,
+			hasErr: true,
+		},
+		{
+			desc:   "invalid name",
+			json:   `{"name":"../m1","waypoints":[{"lat":39.956,"lon":116.4443}]}`,
+			hasErr: true,
+		},
+		{
+			desc:   "invalid json",
+			json:   `{"waypoints":`,
+			hasErr: true,
+		},
+	}
+
+	for _, test := range testCases {
+		m, err := ParseMission(strings.NewReader(test.json))
+		if test.hasErr {
+			assert.Error(t, err, test.desc)
+			continue
+		}
+		assert.NoError(t, err, test.desc)
+		assert.Equal(t, test.wps, len(m.Waypoints), test.desc)
+		assert.Equal(t, test.radius, m.Waypoints[0].Radius, test.desc)
+		assert.Equal(t, test.dwell, m.Waypoints[0].Dwell, test.desc)
+		assert.Equal(t, test.actions, len(m.Waypoints[0].Actions), test.desc)
+		assert.Equal(t, MissionIdle, m.State().Status, test.desc)
+	}
+}
+
+func TestParseGPX(t *testing.T) {
+	gpx := `<?xml version="1.0" encoding="UTF-8"?>
+<gpx version="1.1" xmlns="http://www.topografix.com/GPX/1/1">
+  <rte>
+    <name>patrol</name>
+    <rtept lat="39.955980" lon="116.444390">
+      <name>gate</name>
+      <extensions>
+        <radius>3</radius>
+        <dwell>10</dwell>
+        <action>beep</action>
+        <action text="hello">say</action>
+      </extensions>
+    </rtept>
+    <rtept lat="39.956100" lon="116.444500"></rtept>
+  </rte>
+</gpx>`
+
+	m, err := ParseGPX(strings.NewReader(gpx))
+	assert.NoError(t, err)
+	assert.Equal(t, "patrol", m.Name)
+	assert.Equal(t, 2, len(m.Waypoints))
+
+	wp := m.Waypoints[0]
+	assert.Equal(t, "gate", wp.Name)
+	assert.Equal(t, 39.955980, wp.Lat)
+	assert.Equal(t, 116.444390, wp.Lon)
+	assert.Equal(t, float64(3), wp.Radius)
+	assert.Equal(t, 10, wp.Dwell)
+	assert.Equal(t, 2, len(wp.Actions))
+	assert.Equal(t, ActionSay, wp.Actions[1].Type)
+	assert.Equal(t, "hello", wp.Actions[1].Text)
+
+	wp = m.Waypoints[1]
+	assert.Equal(t, "wp2", wp.Name)
+	assert.Equal(t, defaultRadius, wp.Radius)
+}
+
+func TestSetMission(t *testing.T) {
+	car := New(&Config{})
+
+	m, err := ParseMission(strings.NewReader(`{"waypoints":[{"lat":39.956,"lon":116.4443}]}`))
+	assert.NoError(t, err)
+	assert.NoError(t, car.SetMission(m))
+	state, ok := car.MissionState()
+	assert.True(t, ok)
+	assert.Equal(t, 1, state.Total)
+
+	// out of bbox
+	m, err = ParseMission(strings.NewReader(`{"waypoints":[{"lat":40,"lon":116}]}`))
+	assert.NoError(t, err)
+	assert.Error(t, car.SetMission(m))
+}
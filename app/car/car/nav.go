@@ -2,8 +2,11 @@ package car
 
 import (
 	"log"
+	"math"
+	"time"
 
 	"github.com/jakefau/rpi-devices/util/geo"
+	"github.com/jakefau/rpi-devices/util/nav"
 	"github.com/shanghuiyang/a-star/astar"
 	"github.com/shanghuiyang/a-star/tilemap"
 )
@@ -70,6 +73,39 @@ const tilemapStr = `
 
 const gridsize float64 = 0.000010
 
+// the min moving distance in meter for calculating the heading from gps
+const minHeadingDist float64 = 0.5
+
+var pursuitCfg = &nav.PursuitConfig{
+	MinLookahead:  3,
+	MaxLookahead:  8,
+	LookaheadGain: 2,
+	TrackWidth:    0.15,
+}
+
+// the distance in meter the car travels in a tick of the encoder,
+// the wheel is 6.5cm in diameter and the encoder disk has 20 slots.
+const distPerTick = math.Pi * 0.065 / 20
+
+// yawSign is 1 if the yaw of gy25 increases when turning clockwise, otherwise -1
+const yawSign float64 = 1
+
+// the interval for feeding the localizer with odometry
+const odoInterval = 100 * time.Millisecond
+
+// the max std of the estimated heading in degree for steering
+const maxHeadingStd float64 = 30
+
+var localizerCfg = &nav.LocalizerConfig{
+	OdomNoise:   0.1,
+	YawNoise:    0.05,
+	YawDrift:    0.05,
+	UERE:        3,
+	Gate:        16,
+	MaxRejects:  5,
+	HeadingDist: 3,
+}
+
 var bbox = &geo.Bbox{
 	Left:   116.444217,
 	Right:  116.444652,
@@ -134,3 +170,14 @@ func xy2geo(p *astar.Point) *geo.Point {
 		Lon: bbox.Left + float64(p.Y)*gridsize,
 	}
 }
+
+// yawDiff returns the change from yaw to yaw2 in degree, in (-180, 180]
+func yawDiff(yaw, yaw2 float64) float64 {
+	d := math.Mod(yaw2-yaw, 360)
+	if d > 180 {
+		d -= 360
+	} else if d <= -180 {
+		d += 360
+	}
+	return d
+}
@@ -0,0 +1,331 @@
+package car
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/jakefau/rpi-devices/dev"
+	"github.com/jakefau/rpi-devices/util/geo"
+)
+
+const (
+	// the recorder flushes the events to the file in the interval
+	flushInterval = time.Second
+)
+
+// Kind is the kind of an event
+type Kind string
+
+const (
+	// KindCmd is an op from the clients, e.g. the web page
+	KindCmd Kind = "cmd"
+	// KindDest is a destination from the clients, V: [lat, lon]
+	KindDest Kind = "dest"
+	// KindOp is an op handled by the car
+	KindOp Kind = "op"
+	// KindMode is a change of the mode
+	KindMode Kind = "mode"
+	// KindMotor is a command to the motors, V: [left, right] for Drive, [speed] for Speed
+	KindMotor Kind = "motor"
+	// KindDist is a reading of the distance meter, V: [dist in cm]
+	KindDist Kind = "dist"
+	// KindAngles is a reading of the gy-25, V: [yaw, pitch, roll]
+	KindAngles Kind = "angles"
+	// KindCollision is a change of the collision switch ID, V: [1] for collided, [0] for not
+	KindCollision Kind = "collision"
+	// KindEncoder is a non-zero reading of the encoder, V: [count]
+	KindEncoder Kind = "encoder"
+	// KindGPS is a reading of the gps, V: [lat, lon, hdop, sats]
+	KindGPS Kind = "gps"
+)
+
+// Event is an event in a drive session
+// T: the time since the session started, it is monotonic
+// Op: the op of the cmd, op and motor events
+// Mode: the mode of the mode events
+// ID: the index of the collision switch
+// V: the values of the event
+// Err: the error of reading the sensor
+type Event struct {
+	T    time.Duration `json:"t"`
+	Kind Kind          `json:"k"`
+	Op   Op            `json:"op,omitempty"`
+	Mode Mode          `json:"mode,omitempty"`
+	ID   int           `json:"id,omitempty"`
+	V    []float64     `json:"v,omitempty"`
+	Err  string        `json:"err,omitempty"`
+}
+
+// Recorder records the ops, the mode changes, the sensor readings and the motor commands
+// of a car in json lines, one event per line.
+type Recorder struct {
+	mu      sync.Mutex
+	w       *bufio.Writer
+	enc     *json.Encoder
+	closer  io.Closer
+	start   time.Time
+	flushed time.Time
+}
+
+// NewRecorder creates a recorder writing the events to w
+func NewRecorder(w io.Writer) *Recorder {
+	bw := bufio.NewWriter(w)
+	now := time.Now()
+	return &Recorder{
+		w:       bw,
+		enc:     json.NewEncoder(bw),
+		start:   now,
+		flushed: now,
+	}
+}
+
+// CreateRecorder creates a recorder writing the events to the file
+func CreateRecorder(file string) (*Recorder, error) {
+	f, err := os.Create(file)
+	if err != nil {
+		return nil, err
+	}
+	r := NewRecorder(f)
+	r.closer = f
+	return r, nil
+}
+
+// Record records the event, the time of the event is set by the recorder
+func (r *Recorder) Record(e *Event) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	e.T = time.Since(r.start)
+	if err := r.enc.Encode(e); err != nil {
+		log.Printf("[recorder]failed to record event, error: %v", err)
+		return
+	}
+	if time.Since(r.flushed) > flushInterval {
+		r.w.Flush()
+		r.flushed = time.Now()
+	}
+}
+
+// Close flushes the events and closes the file
+func (r *Recorder) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err := r.w.Flush(); err != nil {
+		return err
+	}
+	if r.closer != nil {
+		return r.closer.Close()
+	}
+	return nil
+}
+
+// ReadSession reads the events recorded by a recorder
+func ReadSession(rd io.Reader) ([]*Event, error) {
+	var events []*Event
+	dec := json.NewDecoder(rd)
+	for {
+		var e Event
+		if err := dec.Decode(&e); err != nil {
+			if err == io.EOF {
+				return events, nil
+			}
+			return nil, err
+		}
+		events = append(events, &e)
+	}
+}
+
+// LoadSession reads the events from a file written by a recorder
+func LoadSession(file string) ([]*Event, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ReadSession(f)
+}
+
+func (r *Recorder) cmd(op Op) {
+	r.Record(&Event{Kind: KindCmd, Op: op})
+}
+
+func (r *Recorder) dest(pt *geo.Point) {
+	r.Record(&Event{Kind: KindDest, V: []float64{pt.Lat, pt.Lon}})
+}
+
+func (r *Recorder) op(op Op) {
+	r.Record(&Event{Kind: KindOp, Op: op})
+}
+
+func (r *Recorder) mode(m Mode) {
+	r.Record(&Event{Kind: KindMode, Mode: m})
+}
+
+// wrap wraps the sensors and the engine in the config to record them
+func (r *Recorder) wrap(cfg *Config) *Config {
+	c := *cfg
+	if cfg.Engine != nil {
+		c.Engine = &recMotor{Motor: cfg.Engine, r: r}
+	}
+	if cfg.DistMeter != nil {
+		c.DistMeter = &recDistMeter{DistMeter: cfg.DistMeter, r: r}
+	}
+	if cfg.GY25 != nil {
+		c.GY25 = &recAngleMeter{AngleMeter: cfg.GY25, r: r}
+	}
+	if cfg.Encoder != nil {
+		c.Encoder = &recPulseCounter{PulseCounter: cfg.Encoder, r: r}
+	}
+	if cfg.GPS != nil {
+		c.GPS = &recLocator{Locator: cfg.GPS, r: r}
+	}
+	c.Collisions = nil
+	for i, sw := range cfg.Collisions {
+		c.Collisions = append(c.Collisions, &recCollision{CollisionSwitch: sw, r: r, id: i})
+	}
+	return &c
+}
+
+func errString(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
+
+type recMotor struct {
+	dev.Motor
+	r *Recorder
+}
+
+func (m *recMotor) Forward() {
+	m.Motor.Forward()
+	m.r.Record(&Event{Kind: KindMotor, Op: forward})
+}
+
+func (m *recMotor) Backward() {
+	m.Motor.Backward()
+	m.r.Record(&Event{Kind: KindMotor, Op: backward})
+}
+
+func (m *recMotor) Left() {
+	m.Motor.Left()
+	m.r.Record(&Event{Kind: KindMotor, Op: left})
+}
+
+func (m *recMotor) Right() {
+	m.Motor.Right()
+	m.r.Record(&Event{Kind: KindMotor, Op: right})
+}
+
+func (m *recMotor) Stop() {
+	m.Motor.Stop()
+	m.r.Record(&Event{Kind: KindMotor, Op: stop})
+}
+
+func (m *recMotor) Speed(s uint32) {
+	m.Motor.Speed(s)
+	m.r.Record(&Event{Kind: KindMotor, Op: "speed", V: []float64{float64(s)}})
+}
+
+func (m *recMotor) Drive(left, right int) {
+	m.Motor.Drive(left, right)
+	m.r.Record(&Event{Kind: KindMotor, Op: "drive", V: []float64{float64(left), float64(right)}})
+}
+
+type recDistMeter struct {
+	dev.DistMeter
+	r *Recorder
+}
+
+func (d *recDistMeter) Dist() float64 {
+	dist := d.DistMeter.Dist()
+	d.r.Record(&Event{Kind: KindDist, V: []float64{dist}})
+	return dist
+}
+
+type recAngleMeter struct {
+	dev.AngleMeter
+	r *Recorder
+}
+
+func (a *recAngleMeter) Angles() (yaw, pitch, roll float64, err error) {
+	yaw, pitch, roll, err = a.AngleMeter.Angles()
+	e := &Event{Kind: KindAngles, Err: errString(err)}
+	if err == nil {
+		e.V = []float64{yaw, pitch, roll}
+	}
+	a.r.Record(e)
+	return
+}
+
+type recPulseCounter struct {
+	dev.PulseCounter
+	r *Recorder
+}
+
+func (p *recPulseCounter) Count1() int {
+	n := p.PulseCounter.Count1()
+	if n != 0 {
+		p.r.Record(&Event{Kind: KindEncoder, V: []float64{float64(n)}})
+	}
+	return n
+}
+
+type recLocator struct {
+	dev.Locator
+	r *Recorder
+}
+
+func (l *recLocator) Loc() (*geo.Point, error) {
+	pt, err := l.Locator.Loc()
+	e := &Event{Kind: KindGPS, Err: errString(err)}
+	if err == nil {
+		e.V = []float64{pt.Lat, pt.Lon}
+	}
+	l.r.Record(e)
+	return pt, err
+}
+
+func (l *recLocator) Fix() (*dev.GPSFix, error) {
+	fix, err := l.Locator.Fix()
+	e := &Event{Kind: KindGPS, Err: errString(err)}
+	if err == nil {
+		e.V = []float64{fix.Loc.Lat, fix.Loc.Lon, fix.HDOP, float64(fix.Sats)}
+	}
+	l.r.Record(e)
+	return fix, err
+}
+
+type recCollision struct {
+	dev.CollisionSwitch
+	r    *Recorder
+	id   int
+	mu   sync.Mutex
+	last bool
+	init bool
+}
+
+// Collided records the changes only, it is polled frequently
+func (c *recCollision) Collided() bool {
+	collided := c.CollisionSwitch.Collided()
+	c.mu.Lock()
+	changed := !c.init || collided != c.last
+	c.last, c.init = collided, true
+	c.mu.Unlock()
+	if changed {
+		v := 0.0
+		if collided {
+			v = 1
+		}
+		c.r.Record(&Event{Kind: KindCollision, ID: c.id, V: []float64{v}})
+	}
+	return collided
+}
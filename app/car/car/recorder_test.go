@@ -0,0 +1,123 @@
+package car
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/jakefau/rpi-devices/dev"
+	"github.com/stretchr/testify/assert"
+)
+
+type distMeter struct {
+	dist float64
+}
+
+func (d *distMeter) Dist() float64 {
+	return d.dist
+}
+
+func (d *distMeter) Close() {
+	return
+}
+
+func TestRecorder(t *testing.T) {
+	var buf bytes.Buffer
+	r := NewRecorder(&buf)
+	sw := &collision{}
+	cfg := r.wrap(&Config{
+		Engine:     &motor{},
+		DistMeter:  &distMeter{dist: 42},
+		Collisions: []dev.CollisionSwitch{&collision{}, sw},
+	})
+
+	r.cmd(forward)
+	cfg.Engine.Forward()
+	cfg.DistMeter.Dist()
+	// only the changes of collision switches are recorded
+	sw.set(true)
+	cfg.Collisions[1].Collided()
+	cfg.Collisions[1].Collided()
+	cfg.Engine.Drive(30, -30)
+	assert.NoError(t, r.Close())
+
+	events, err := ReadSession(&buf)
+	assert.NoError(t, err)
+	want := []*Event{
+		{Kind: KindCmd, Op: forward},
+		{Kind: KindMotor, Op: forward},
+		{Kind: KindDist, V: []float64{42}},
+		{Kind: KindCollision, ID: 1, V: []float64{1}},
+		{Kind: KindMotor, Op: "drive", V: []float64{30, -30}},
+	}
+	assert.Equal(t, len(want), len(events))
+	for i, e := range events {
+		if i > 0 {
+			assert.True(t, e.T >= events[i-1].T)
+		}
+		e.T = 0
+		assert.Equal(t, want[i], e)
+	}
+}
+
+func TestReplayer(t *testing.T) {
+	ms := time.Millisecond
+	events := []*Event{
+		{T: 0, Kind: KindDist, V: []float64{100}},
+		{T: 0, Kind: KindCmd, Op: servoahead},
+		{T: 10 * ms, Kind: KindEncoder, V: []float64{3}},
+		{T: 20 * ms, Kind: KindEncoder, V: []float64{2}},
+		{T: 30 * ms, Kind: KindGPS, V: []float64{39.9, 116.4, 1.5, 8}},
+		{T: 50 * ms, Kind: KindDist, V: []float64{30}},
+		{T: 60 * ms, Kind: KindCollision, ID: 1, V: []float64{1}},
+		{T: 80 * ms, Kind: KindGPS, V: []float64{39.8, 116.3, 2, 6}},
+		{T: 100 * ms, Kind: KindAngles, V: []float64{10, 0, 0}},
+	}
+	p := NewReplayer(events)
+	cfg := p.Config(&Config{})
+	assert.NotNil(t, cfg.Engine)
+	assert.Equal(t, 2, len(cfg.Collisions))
+
+	// the clock stops at 0 until Run
+	assert.Equal(t, 100.0, cfg.DistMeter.Dist())
+	assert.Equal(t, 0, cfg.Encoder.Count1())
+
+	c := New(cfg)
+	go c.start()
+	defer close(c.chOp)
+	p.Run(c)
+
+	assert.Equal(t, 30.0, cfg.DistMeter.Dist())
+	assert.Equal(t, 5, cfg.Encoder.Count1())
+	assert.Equal(t, 0, cfg.Encoder.Count1())
+	assert.False(t, cfg.Collisions[0].Collided())
+	assert.True(t, cfg.Collisions[1].Collided())
+	yaw, _, _, err := cfg.GY25.Angles()
+	assert.NoError(t, err)
+	assert.Equal(t, 10.0, yaw)
+
+	fix, err := cfg.GPS.Fix()
+	assert.NoError(t, err)
+	assert.Equal(t, 39.8, fix.Loc.Lat)
+	assert.Equal(t, 6, fix.Sats)
+	_, err = cfg.GPS.Fix()
+	assert.Equal(t, ErrEndOfSession, err)
+}
+
+func TestDiff(t *testing.T) {
+	a := []*Event{
+		{Kind: KindMode, Mode: ModeSelfDriving},
+		{Kind: KindDist, V: []float64{50}},
+		{Kind: KindMotor, Op: forward},
+		{Kind: KindMotor, Op: stop},
+	}
+	b := []*Event{
+		{Kind: KindMode, Mode: ModeSelfDriving},
+		{Kind: KindDist, V: []float64{20}},
+		{Kind: KindMotor, Op: forward},
+		{Kind: KindMotor, Op: backward},
+		{Kind: KindMotor, Op: stop},
+	}
+	assert.Equal(t, 0, len(Diff(a, a)))
+	assert.Equal(t, 2, len(Diff(a, b)))
+}
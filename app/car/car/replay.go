@@ -0,0 +1,329 @@
+package car
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/jakefau/rpi-devices/dev"
+	"github.com/jakefau/rpi-devices/util/geo"
+)
+
+const (
+	// the max differences reported by Diff
+	maxDiffs = 20
+)
+
+// ErrEndOfSession means all the recorded readings are replayed
+var ErrEndOfSession = errors.New("end of session")
+
+// Replayer replays a recorded session through fake devices in real time,
+// a fake device returns the last reading recorded before the current time of the session,
+// so the decision loops of a car see the same sensor data as the recorded run.
+type Replayer struct {
+	events []*Event
+
+	mu    sync.Mutex
+	start time.Time // the zero of the session clock, the clock stops at 0 until Run
+}
+
+// NewReplayer ...
+func NewReplayer(events []*Event) *Replayer {
+	return &Replayer{events: events}
+}
+
+// Config replaces the sensors in cfg with the fake devices replaying the recorded readings,
+// only the sensors recorded in the session are replaced.
+// the engine, the horn and the lights are replaced by dummy ones if they are nil.
+func (p *Replayer) Config(cfg *Config) *Config {
+	c := *cfg
+	if c.Engine == nil {
+		c.Engine = &nopMotor{}
+	}
+	if c.Horn == nil {
+		c.Horn = &nopLight{}
+	}
+	if c.Led == nil {
+		c.Led = &nopLight{}
+	}
+	if c.Light == nil {
+		c.Light = &nopLight{}
+	}
+	if s := p.stream(KindDist, -1); len(s) > 0 {
+		c.DistMeter = &replayDistMeter{p: p, s: s}
+	}
+	if s := p.stream(KindAngles, -1); len(s) > 0 {
+		c.GY25 = &replayAngleMeter{p: p, s: s}
+	}
+	if s := p.stream(KindEncoder, -1); len(s) > 0 {
+		c.Encoder = &replayPulseCounter{p: p, s: s}
+	}
+	if s := p.stream(KindGPS, -1); len(s) > 0 {
+		c.GPS = &replayLocator{p: p, s: s, last: -1}
+	}
+	n := 0
+	for _, e := range p.events {
+		if e.Kind == KindCollision && e.ID >= n {
+			n = e.ID + 1
+		}
+	}
+	if n > 0 {
+		c.Collisions = nil
+		for i := 0; i < n; i++ {
+			c.Collisions = append(c.Collisions, &replayCollision{p: p, s: p.stream(KindCollision, i)})
+		}
+	}
+	return &c
+}
+
+// Run starts the session clock, and feeds the recorded ops and destinations from the clients to the car.
+// it returns after the last event of the session.
+func (p *Replayer) Run(c *Car) {
+	p.mu.Lock()
+	p.start = time.Now()
+	p.mu.Unlock()
+
+	for _, e := range p.events {
+		if d := e.T - p.now(); d > 0 {
+			time.Sleep(d)
+		}
+		switch e.Kind {
+		case KindCmd:
+			c.Do(e.Op)
+		case KindDest:
+			if len(e.V) == 2 {
+				c.SetDest(&geo.Point{Lat: e.V[0], Lon: e.V[1]})
+			}
+		}
+	}
+}
+
+// now returns the time of the session clock
+func (p *Replayer) now() time.Duration {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.start.IsZero() {
+		return 0
+	}
+	return time.Since(p.start)
+}
+
+// stream returns the events of the kind, id < 0 means any id
+func (p *Replayer) stream(kind Kind, id int) []*Event {
+	var s []*Event
+	for _, e := range p.events {
+		if e.Kind == kind && (id < 0 || e.ID == id) {
+			s = append(s, e)
+		}
+	}
+	return s
+}
+
+// latest returns the index of the last event in s recorded before t,
+// and 0 if t is earlier than all of them.
+func latest(s []*Event, t time.Duration) int {
+	i := 0
+	for i+1 < len(s) && s[i+1].T <= t {
+		i++
+	}
+	return i
+}
+
+// Diff compares the decisions of two sessions, i.e. the ops, the mode changes and the motor commands,
+// and returns the differences. the times of the events are ignored.
+func Diff(a, b []*Event) []string {
+	da, db := decisions(a), decisions(b)
+	var diffs []string
+	n := len(da)
+	if len(db) > n {
+		n = len(db)
+	}
+	for i := 0; i < n && len(diffs) < maxDiffs; i++ {
+		var ea, eb *Event
+		if i < len(da) {
+			ea = da[i]
+		}
+		if i < len(db) {
+			eb = db[i]
+		}
+		if ea != nil && eb != nil && decision(ea) == decision(eb) {
+			continue
+		}
+		diffs = append(diffs, fmt.Sprintf("#%v: %v != %v", i, describe(ea), describe(eb)))
+	}
+	return diffs
+}
+
+func decisions(events []*Event) []*Event {
+	var d []*Event
+	for _, e := range events {
+		switch e.Kind {
+		case KindOp, KindMode, KindMotor:
+			d = append(d, e)
+		}
+	}
+	return d
+}
+
+func decision(e *Event) string {
+	return fmt.Sprintf("%v %v%v %v", e.Kind, e.Op, e.Mode, e.V)
+}
+
+func describe(e *Event) string {
+	if e == nil {
+		return "none"
+	}
+	return fmt.Sprintf("[%.3fs]%v", e.T.Seconds(), decision(e))
+}
+
+type nopMotor struct{}
+
+func (m *nopMotor) Forward()              {}
+func (m *nopMotor) Backward()             {}
+func (m *nopMotor) Left()                 {}
+func (m *nopMotor) Right()                {}
+func (m *nopMotor) Stop()                 {}
+func (m *nopMotor) Speed(s uint32)        {}
+func (m *nopMotor) Drive(left, right int) {}
+
+// nopLight is a dummy light and horn
+type nopLight struct{}
+
+func (l *nopLight) On()  {}
+func (l *nopLight) Off() {}
+
+func (l *nopLight) Blink(n int, interval int) {
+	time.Sleep(time.Duration(n*interval) * time.Millisecond)
+}
+
+func (l *nopLight) Beep(n int, interval int) {
+	time.Sleep(time.Duration(n*interval) * time.Millisecond)
+}
+
+type replayDistMeter struct {
+	p *Replayer
+	s []*Event
+}
+
+func (d *replayDistMeter) Dist() float64 {
+	e := d.s[latest(d.s, d.p.now())]
+	if len(e.V) == 0 {
+		return -1
+	}
+	return e.V[0]
+}
+
+func (d *replayDistMeter) Close() {
+	return
+}
+
+type replayAngleMeter struct {
+	p *Replayer
+	s []*Event
+}
+
+func (a *replayAngleMeter) Angles() (yaw, pitch, roll float64, err error) {
+	e := a.s[latest(a.s, a.p.now())]
+	if e.Err != "" || len(e.V) != 3 {
+		return 0, 0, 0, fmt.Errorf("recorded error: %v", e.Err)
+	}
+	return e.V[0], e.V[1], e.V[2], nil
+}
+
+func (a *replayAngleMeter) IncludedAngle(yaw, yaw2 float64) float64 {
+	return math.Abs(yawDiff(yaw, yaw2))
+}
+
+type replayPulseCounter struct {
+	p *Replayer
+	s []*Event
+
+	mu   sync.Mutex
+	next int // the index of the next event to count
+}
+
+func (c *replayPulseCounter) Start() {
+	return
+}
+
+func (c *replayPulseCounter) Stop() {
+	return
+}
+
+// Count1 returns the pulses recorded since the last call
+func (c *replayPulseCounter) Count1() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := c.p.now()
+	n := 0
+	for ; c.next < len(c.s) && c.s[c.next].T <= now; c.next++ {
+		if len(c.s[c.next].V) > 0 {
+			n += int(c.s[c.next].V[0])
+		}
+	}
+	return n
+}
+
+type replayLocator struct {
+	p *Replayer
+	s []*Event
+
+	mu   sync.Mutex
+	last int // the index of the last fix returned
+}
+
+func (l *replayLocator) Loc() (*geo.Point, error) {
+	fix, err := l.Fix()
+	if err != nil {
+		return nil, err
+	}
+	return fix.Loc, nil
+}
+
+// Fix returns the next recorded fix, and waits for it like a real gps
+func (l *replayLocator) Fix() (*dev.GPSFix, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	i := latest(l.s, l.p.now())
+	if i <= l.last {
+		i = l.last + 1
+		if i >= len(l.s) {
+			return nil, ErrEndOfSession
+		}
+		if d := l.s[i].T - l.p.now(); d > 0 {
+			time.Sleep(d)
+		}
+	}
+	l.last = i
+
+	e := l.s[i]
+	if e.Err != "" || len(e.V) < 2 {
+		return nil, fmt.Errorf("recorded error: %v", e.Err)
+	}
+	fix := &dev.GPSFix{
+		Loc:  &geo.Point{Lat: e.V[0], Lon: e.V[1]},
+		HDOP: 1,
+	}
+	if len(e.V) == 4 {
+		fix.HDOP, fix.Sats = e.V[2], int(e.V[3])
+	}
+	return fix, nil
+}
+
+type replayCollision struct {
+	p *Replayer
+	s []*Event
+}
+
+func (c *replayCollision) Collided() bool {
+	if len(c.s) == 0 {
+		return false
+	}
+	e := c.s[latest(c.s, c.p.now())]
+	if e.T > c.p.now() {
+		return false
+	}
+	return len(e.V) > 0 && e.V[0] == 1
+}
@@ -0,0 +1,293 @@
+package car
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/jakefau/rpi-devices/dev"
+)
+
+const (
+	// the interval of checking the heartbeats and the sensors
+	safetyInterval = 20 * time.Millisecond
+	// a distance older than it is ignored by the supervisor
+	distMaxAge = 300 * time.Millisecond
+	// the supervisor only trusts the distance measured in the angles of the servo
+	maxAheadAngle = 15
+)
+
+// SafetyConfig ...
+// Timeout: the motors are cut if no heartbeat is received from the active control source in the timeout, 0 disables it
+// AutoTimeout: the timeout of the auto source instead of Timeout, it must be longer than the period of the gps
+// since self-nav beats once a gps fix, Timeout is used if it's 0
+// MinDist: the motors moving forward are cut if the distance ahead is less than it in cm, 0 disables it
+type SafetyConfig struct {
+	Timeout     time.Duration
+	AutoTimeout time.Duration
+	MinDist     float64
+}
+
+// DefaultSafetyConfig ...
+func DefaultSafetyConfig() *SafetyConfig {
+	return &SafetyConfig{
+		Timeout:     1500 * time.Millisecond,
+		AutoTimeout: 3 * time.Second,
+		MinDist:     15,
+	}
+}
+
+// source is a control source of the car
+type source string
+
+const (
+	// the http and websocket clients
+	srcRemote source = "remote"
+	// the joystick over lc12s
+	srcJoystick source = "joystick"
+	// self-driving, self-tracking, speech-driving and self-nav
+	srcAuto source = "auto"
+)
+
+// supervisor wraps the engine, and cuts the motors
+// 1. if no heartbeat is received from the active control source in the timeout,
+// 2. if any collision switch is collided when the car moves forward,
+// 3. if the distance ahead is less than the min distance when the car moves forward.
+// it refuses to move forward in case 2 and 3 as well.
+// the active control source is the last one taking the control of the car.
+type supervisor struct {
+	cfg        *SafetyConfig
+	engine     dev.Motor
+	collisions []dev.CollisionSwitch
+	dist       func() (float64, bool)
+	onCut      func()
+	clock      Clock
+
+	mu      sync.Mutex
+	op      Op
+	fwd     bool   // the car is moving forward
+	hazard  string // the reason of refusing to move forward, empty means none
+	active  source
+	beat    time.Time
+	cuts    int
+	quit    chan bool
+	stopped bool
+}
+
+// newSupervisor creates a supervisor for the engine,
+// dist returns the last distance ahead in cm, and false if it is unknown.
+// onCut is called after the motors are cut.
+func newSupervisor(engine dev.Motor, cfg *SafetyConfig, collisions []dev.CollisionSwitch, dist func() (float64, bool), onCut func()) *supervisor {
+	if cfg == nil {
+		cfg = DefaultSafetyConfig()
+	}
+	return &supervisor{
+		cfg:        cfg,
+		engine:     engine,
+		collisions: collisions,
+		dist:       dist,
+		onCut:      onCut,
+		clock:      realClock{},
+		op:         stop,
+		quit:       make(chan bool),
+	}
+}
+
+// start starts watching the heartbeats and the sensors
+func (s *supervisor) start() {
+	go s.watch()
+}
+
+// close stops watching
+func (s *supervisor) close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.stopped {
+		return
+	}
+	s.stopped = true
+	close(s.quit)
+}
+
+// take makes src the active control source
+func (s *supervisor) take(src source) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.active != src {
+		log.Printf("[safety]control source: %v", src)
+	}
+	s.active = src
+	s.beat = s.clock.Now()
+}
+
+// heartbeat keeps the car moving, it is ignored if src isn't the active control source
+func (s *supervisor) heartbeat(src source) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if src == s.active {
+		s.beat = s.clock.Now()
+	}
+}
+
+// interventions returns the times the supervisor cut the motors
+func (s *supervisor) interventions() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.cuts
+}
+
+// Forward ...
+func (s *supervisor) Forward() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.hazard != "" {
+		s.cut("refused to move forward, " + s.hazard)
+		return
+	}
+	s.engine.Forward()
+	s.op, s.fwd = forward, true
+}
+
+// Backward ...
+func (s *supervisor) Backward() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.engine.Backward()
+	s.op, s.fwd = backward, false
+}
+
+// Left ...
+func (s *supervisor) Left() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.engine.Left()
+	s.op, s.fwd = left, false
+}
+
+// Right ...
+func (s *supervisor) Right() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.engine.Right()
+	s.op, s.fwd = right, false
+}
+
+// Stop ...
+func (s *supervisor) Stop() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.engine.Stop()
+	s.op, s.fwd = stop, false
+}
+
+// Speed ...
+func (s *supervisor) Speed(speed uint32) {
+	s.engine.Speed(speed)
+}
+
+// Drive ...
+func (s *supervisor) Drive(left, right int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if left+right > 0 && s.hazard != "" {
+		s.cut("refused to move forward, " + s.hazard)
+		return
+	}
+	s.engine.Drive(left, right)
+	s.op = driveOp(left, right)
+	s.fwd = s.op == forward
+}
+
+// driveOp returns the op of driving the left and right wheels in the speeds l and r,
+// the direction is from the sign of the speed of the center of the car.
+func driveOp(l, r int) Op {
+	switch {
+	case l == 0 && r == 0:
+		return stop
+	case l+r > 0:
+		return forward
+	case l+r < 0:
+		return backward
+	case l < r:
+		return left
+	default:
+		return right
+	}
+}
+
+func (s *supervisor) watch() {
+	for {
+		select {
+		case <-s.quit:
+			return
+		case <-s.clock.After(safetyInterval):
+			s.check()
+		}
+	}
+}
+
+func (s *supervisor) check() {
+	s.mu.Lock()
+	fwd := s.fwd
+	s.mu.Unlock()
+
+	// read the sensors out of the lock, they may be slow
+	hazard := s.detect(fwd)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.hazard = hazard
+	if s.op == stop {
+		return
+	}
+	if s.fwd && hazard != "" {
+		s.cut(hazard)
+		return
+	}
+	if timeout := s.timeout(); timeout > 0 && s.clock.Now().Sub(s.beat) > timeout {
+		s.cut(fmt.Sprintf("no heartbeat from %v in %v", s.active, timeout))
+	}
+}
+
+// timeout returns the timeout of the heartbeats of the active control source, 0 means no timeout
+func (s *supervisor) timeout() time.Duration {
+	if s.cfg.Timeout > 0 && s.active == srcAuto && s.cfg.AutoTimeout > 0 {
+		return s.cfg.AutoTimeout
+	}
+	return s.cfg.Timeout
+}
+
+// detect detects the collisions and the obstacles ahead,
+// the distance meter is only checked when the car moves forward.
+func (s *supervisor) detect(fwd bool) string {
+	for _, c := range s.collisions {
+		if c.Collided() {
+			return "collided"
+		}
+	}
+	if !fwd || s.cfg.MinDist <= 0 || s.dist == nil {
+		return ""
+	}
+	if d, ok := s.dist(); ok && d >= 0 && d < s.cfg.MinDist {
+		return fmt.Sprintf("obstacle ahead in %.0f cm", d)
+	}
+	return ""
+}
+
+// cut cuts the motors, the caller must hold the lock
+func (s *supervisor) cut(reason string) {
+	s.engine.Stop()
+	s.op, s.fwd = stop, false
+	s.cuts++
+	log.Printf("[safety]cut the motors: %v", reason)
+	if s.onCut != nil {
+		go s.onCut()
+	}
+}
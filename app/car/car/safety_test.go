@@ -0,0 +1,162 @@
+package car
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jakefau/rpi-devices/dev"
+	"github.com/stretchr/testify/assert"
+)
+
+type motor struct {
+	mu sync.Mutex
+	op Op
+}
+
+func (m *motor) set(op Op) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.op = op
+}
+
+func (m *motor) get() Op {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.op
+}
+
+func (m *motor) Forward()       { m.set(forward) }
+func (m *motor) Backward()      { m.set(backward) }
+func (m *motor) Left()          { m.set(left) }
+func (m *motor) Right()         { m.set(right) }
+func (m *motor) Stop()          { m.set(stop) }
+func (m *motor) Speed(s uint32) {}
+func (m *motor) Drive(l, r int) { m.set(driveOp(l, r)) }
+
+type collision struct {
+	mu       sync.Mutex
+	collided bool
+}
+
+func (c *collision) get() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.collided
+}
+
+func (c *collision) set(collided bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.collided = collided
+}
+
+func (c *collision) Collided() bool {
+	return c.get()
+}
+
+func TestSupervisor(t *testing.T) {
+	var (
+		m    = &motor{op: stop}
+		sw   = &collision{}
+		dist = 100.0
+		dmu  sync.Mutex
+	)
+	setDist := func(d float64) {
+		dmu.Lock()
+		defer dmu.Unlock()
+		dist = d
+	}
+	cfg := &SafetyConfig{Timeout: 200 * time.Millisecond, MinDist: 15}
+	s := newSupervisor(m, cfg, []dev.CollisionSwitch{sw}, func() (float64, bool) {
+		dmu.Lock()
+		defer dmu.Unlock()
+		return dist, true
+	}, nil)
+	s.start()
+	defer s.close()
+
+	// the heartbeats keep the car moving
+	s.take(srcRemote)
+	s.Forward()
+	for i := 0; i < 5; i++ {
+		time.Sleep(100 * time.Millisecond)
+		s.heartbeat(srcRemote)
+	}
+	assert.Equal(t, forward, m.get())
+	assert.Equal(t, 0, s.interventions())
+
+	// the heartbeats from other sources are ignored
+	for i := 0; i < 4; i++ {
+		time.Sleep(100 * time.Millisecond)
+		s.heartbeat(srcJoystick)
+	}
+	assert.Equal(t, stop, m.get())
+	assert.Equal(t, 1, s.interventions())
+
+	// an obstacle ahead
+	s.take(srcRemote)
+	s.Forward()
+	setDist(10)
+	time.Sleep(100 * time.Millisecond)
+	assert.Equal(t, stop, m.get())
+	assert.Equal(t, 2, s.interventions())
+	// backward is allowed
+	s.Backward()
+	time.Sleep(100 * time.Millisecond)
+	assert.Equal(t, backward, m.get())
+	s.Stop()
+	setDist(100)
+
+	// collided
+	s.take(srcRemote)
+	s.Drive(50, 50)
+	sw.set(true)
+	time.Sleep(100 * time.Millisecond)
+	assert.Equal(t, stop, m.get())
+	// refuse to move forward
+	s.Forward()
+	assert.Equal(t, stop, m.get())
+	assert.Equal(t, 4, s.interventions())
+}
+
+func TestTimeout(t *testing.T) {
+	s := newSupervisor(&motor{}, &SafetyConfig{Timeout: time.Second, AutoTimeout: 3 * time.Second}, nil, nil, nil)
+	s.take(srcRemote)
+	assert.Equal(t, time.Second, s.timeout())
+	s.take(srcAuto)
+	assert.Equal(t, 3*time.Second, s.timeout())
+
+	s = newSupervisor(&motor{}, &SafetyConfig{Timeout: time.Second}, nil, nil, nil)
+	s.take(srcAuto)
+	assert.Equal(t, time.Second, s.timeout())
+
+	s = newSupervisor(&motor{}, &SafetyConfig{AutoTimeout: 3 * time.Second}, nil, nil, nil)
+	s.take(srcAuto)
+	assert.Equal(t, time.Duration(0), s.timeout(), "disabled")
+}
+
+func TestDriveOp(t *testing.T) {
+	testCases := []struct {
+		l, r int
+		op   Op
+	}{
+		{0, 0, stop},
+		{50, 50, forward},
+		{50, 20, forward},
+		{-50, -50, backward},
+		{-50, 20, backward},
+		{-50, 50, left},
+		{50, -50, right},
+	}
+	for _, test := range testCases {
+		assert.Equal(t, test.op, driveOp(test.l, test.r))
+	}
+
+	// the supervisor reports reversing as backward
+	s := newSupervisor(&motor{op: stop}, &SafetyConfig{MinDist: 15}, nil, func() (float64, bool) { return 10, true }, nil)
+	s.Drive(-50, -50)
+	s.check()
+	assert.Equal(t, backward, s.op)
+	assert.Equal(t, 0, s.interventions())
+}
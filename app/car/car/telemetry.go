@@ -0,0 +1,207 @@
+package car
+
+import (
+	"sync"
+	"time"
+
+	"github.com/jakefau/rpi-devices/dev"
+)
+
+const (
+	// the min interval for sampling the sensors for telemetry
+	sampleInterval = 100 * time.Millisecond
+)
+
+// Mode ...
+type Mode string
+
+const (
+	// ModeManual ...
+	ModeManual Mode = "manual"
+	// ModeSelfDriving ...
+	ModeSelfDriving Mode = "selfdriving"
+	// ModeSelfTracking ...
+	ModeSelfTracking Mode = "selftracking"
+	// ModeSpeechDriving ...
+	ModeSpeechDriving Mode = "speechdriving"
+	// ModeSelfNav ...
+	ModeSelfNav Mode = "selfnav"
+)
+
+// GPSTelemetry is the last gps fix,
+// std is the std of the estimated location in meter, it is 0 if the car isn't in nav.
+type GPSTelemetry struct {
+	Lat  float64 `json:"lat"`
+	Lon  float64 `json:"lon"`
+	HDOP float64 `json:"hdop"`
+	Std  float64 `json:"std,omitempty"`
+}
+
+// Telemetry is a snapshot of the car
+// Op: the current op of the engine
+// Speed: the speed of the engine in percent
+// Dist: the last reading of the distance meter in cm, -1 means unknown
+// Yaw, Pitch, Roll: the last angles from gy-25 in degree
+// EncoderSpeed: the speed from the encoder in m/s
+// Servo: the angle of the servo in degree
+type Telemetry struct {
+	Time         time.Time     `json:"time"`
+	Op           Op            `json:"op"`
+	Mode         Mode          `json:"mode"`
+	Speed        uint32        `json:"speed"`
+	Dist         float64       `json:"dist"`
+	Yaw          float64       `json:"yaw"`
+	Pitch        float64       `json:"pitch"`
+	Roll         float64       `json:"roll"`
+	EncoderSpeed float64       `json:"encoder_speed"`
+	GPS          *GPSTelemetry `json:"gps,omitempty"`
+	Servo        int           `json:"servo"`
+}
+
+// telemetry caches the last readings of the sensors,
+// the car updates it when it reads the sensors.
+type telemetry struct {
+	mu       sync.Mutex
+	op       Op
+	dist     float64
+	distAt   time.Time
+	yaw      float64
+	pitch    float64
+	roll     float64
+	encSpeed float64
+	servo    int
+	gps      *GPSTelemetry
+	sampled  time.Time
+}
+
+// Telemetry returns a snapshot of the car.
+// the sensors are sampled when the car is in manual mode,
+// otherwise the last readings of the current mode are used.
+func (c *Car) Telemetry() *Telemetry {
+	mode := c.mode()
+	if mode == ModeManual {
+		c.sample()
+	}
+
+	c.tm.mu.Lock()
+	defer c.tm.mu.Unlock()
+	t := &Telemetry{
+		Time:         c.clock.Now(),
+		Op:           c.tm.op,
+		Mode:         mode,
+		Speed:        c.getSpeed(),
+		Dist:         c.tm.dist,
+		Yaw:          c.tm.yaw,
+		Pitch:        c.tm.pitch,
+		Roll:         c.tm.roll,
+		EncoderSpeed: c.tm.encSpeed,
+		Servo:        c.tm.servo,
+	}
+	if c.tm.gps != nil {
+		gps := *c.tm.gps
+		t.GPS = &gps
+	}
+	return t
+}
+
+func (c *Car) mode() Mode {
+	switch {
+	case c.selfdriving.get():
+		return ModeSelfDriving
+	case c.selftracking.get():
+		return ModeSelfTracking
+	case c.speechdriving.get():
+		return ModeSpeechDriving
+	case c.selfnav.get():
+		return ModeSelfNav
+	default:
+		return ModeManual
+	}
+}
+
+// sample reads the distance meter and the gy-25,
+// it is safe only if no mode is reading them.
+func (c *Car) sample() {
+	c.smu.Lock()
+	defer c.smu.Unlock()
+
+	c.tm.mu.Lock()
+	fresh := c.since(c.tm.sampled) < sampleInterval
+	c.tm.mu.Unlock()
+	if fresh {
+		return
+	}
+
+	if c.dmeter != nil {
+		c.setDist(c.dmeter.Dist())
+	}
+	if c.gy25 != nil {
+		if yaw, pitch, roll, err := c.gy25.Angles(); err == nil {
+			c.setAngles(yaw, pitch, roll)
+		}
+	}
+	c.tm.mu.Lock()
+	c.tm.sampled = c.clock.Now()
+	c.tm.mu.Unlock()
+}
+
+func (c *Car) setOp(op Op) {
+	c.tm.mu.Lock()
+	defer c.tm.mu.Unlock()
+	c.tm.op = op
+}
+
+func (c *Car) setDist(d float64) {
+	c.tm.mu.Lock()
+	defer c.tm.mu.Unlock()
+	c.tm.dist = d
+	c.tm.distAt = c.clock.Now()
+}
+
+// distAhead returns the last distance ahead for the supervisor,
+// it measures the distance if no mode is using the distance meter.
+func (c *Car) distAhead() (float64, bool) {
+	if c.dmeter == nil {
+		return 0, false
+	}
+	if m := c.mode(); m == ModeManual || m == ModeSelfNav {
+		c.smu.Lock()
+		c.tm.mu.Lock()
+		fresh := c.since(c.tm.distAt) < sampleInterval
+		c.tm.mu.Unlock()
+		if !fresh {
+			c.setDist(c.dmeter.Dist())
+		}
+		c.smu.Unlock()
+	}
+
+	c.tm.mu.Lock()
+	defer c.tm.mu.Unlock()
+	if c.since(c.tm.distAt) > distMaxAge || abs(c.tm.servo) > maxAheadAngle {
+		return 0, false
+	}
+	return c.tm.dist, true
+}
+
+func (c *Car) setAngles(yaw, pitch, roll float64) {
+	c.tm.mu.Lock()
+	defer c.tm.mu.Unlock()
+	c.tm.yaw, c.tm.pitch, c.tm.roll = yaw, pitch, roll
+}
+
+func (c *Car) setEncoderSpeed(v float64) {
+	c.tm.mu.Lock()
+	defer c.tm.mu.Unlock()
+	c.tm.encSpeed = v
+}
+
+func (c *Car) setFix(fix *dev.GPSFix, std float64) {
+	c.tm.mu.Lock()
+	defer c.tm.mu.Unlock()
+	c.tm.gps = &GPSTelemetry{
+		Lat:  fix.Loc.Lat,
+		Lon:  fix.Loc.Lon,
+		HDOP: fix.HDOP,
+		Std:  std,
+	}
+}
@@ -0,0 +1,143 @@
+package car
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"unicode"
+)
+
+// Recognizer converts the speech in a wav to text,
+// e.g. the baidu asr, or the offline keyword spotter in util/kws.
+type Recognizer interface {
+	ToText(wav string) (string, error)
+}
+
+// Grammar maps the phrases in any language to the ops of the car, e.g.
+// {"forward": ["前", "forward", "go ahead"], "stop": ["停", "stop"]}
+// the ops can be forward, backward, left, right, stop, roll, whatisit,
+// lighton, lightoff, volumeup, volumedown and sing.
+type Grammar map[Op][]string
+
+var voiceOps = []Op{
+	forward, backward, left, right, stop, roll, whatisit,
+	lighton, lightoff, volumeup, volumedown, sing,
+}
+
+// DefaultGrammar returns the grammar in chinese and english
+func DefaultGrammar() Grammar {
+	return Grammar{
+		forward:    {"前", "forward", "go ahead"},
+		backward:   {"后", "backward", "back"},
+		left:       {"左", "left"},
+		right:      {"右", "right"},
+		stop:       {"停", "stop", "halt"},
+		roll:       {"转圈", "spin", "turn around"},
+		whatisit:   {"是什么", "what is it", "what's this"},
+		lighton:    {"开灯", "light on", "lights on"},
+		lightoff:   {"关灯", "light off", "lights off"},
+		volumeup:   {"大声", "louder", "volume up"},
+		volumedown: {"小声", "quieter", "volume down"},
+		sing:       {"唱歌", "sing"},
+	}
+}
+
+// LoadGrammar loads the grammar from a json file
+func LoadGrammar(file string) (Grammar, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var g Grammar
+	if err := json.Unmarshal(data, &g); err != nil {
+		return nil, err
+	}
+	for op := range g {
+		if !isVoiceOp(op) {
+			return nil, fmt.Errorf("invalid op in grammar: %v", op)
+		}
+	}
+	return g, nil
+}
+
+// Match returns the op of the longest phrase in the text, case insensitive.
+// the phrases match whole words, e.g. "back" doesn't match "feedback",
+// and each chinese character is a word since chinese isn't separated by spaces.
+// the op first in alphabetical order wins if the phrases of two ops are equally long.
+func (g Grammar) Match(text string) (Op, bool) {
+	words := tokenize(text)
+	var (
+		op  Op
+		max int
+	)
+	for o, phrases := range g {
+		for _, p := range phrases {
+			p = strings.ToLower(strings.TrimSpace(p))
+			if p == "" || len(p) < max || (len(p) == max && o > op) {
+				continue
+			}
+			if contains(words, tokenize(p)) {
+				op, max = o, len(p)
+			}
+		}
+	}
+	return op, max > 0
+}
+
+// tokenize splits the text into the words in lower case,
+// a word is a run of letters, digits and apostrophes, or a single chinese or japanese character.
+func tokenize(text string) []string {
+	var (
+		words []string
+		word  []rune
+	)
+	flush := func() {
+		if len(word) > 0 {
+			words = append(words, string(word))
+			word = word[:0]
+		}
+	}
+	for _, r := range strings.ToLower(text) {
+		switch {
+		case unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana):
+			flush()
+			words = append(words, string(r))
+		case unicode.IsLetter(r) || unicode.IsDigit(r) || r == '\'':
+			word = append(word, r)
+		default:
+			flush()
+		}
+	}
+	flush()
+	return words
+}
+
+// contains tells whether the phrase is in the words
+func contains(words, phrase []string) bool {
+	if len(phrase) == 0 {
+		return false
+	}
+	for i := 0; i+len(phrase) <= len(words); i++ {
+		match := true
+		for j, w := range phrase {
+			if words[i+j] != w {
+				match = false
+				break
+			}
+		}
+		if match {
+			return true
+		}
+	}
+	return false
+}
+
+func isVoiceOp(op Op) bool {
+	for _, o := range voiceOps {
+		if o == op {
+			return true
+		}
+	}
+	return false
+}
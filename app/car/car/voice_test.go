@@ -0,0 +1,60 @@
+package car
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMatch(t *testing.T) {
+	g := DefaultGrammar()
+	testCases := []struct {
+		text string
+		op   Op
+		ok   bool
+	}{
+		{"向前走", forward, true},
+		{"Go ahead!", forward, true},
+		{"turn LEFT", left, true},
+		{"lights off please", lightoff, true},
+		{"what is it", whatisit, true},
+		{"关灯", lightoff, true},
+		{"forward", forward, true},
+		{"hello", "", false},
+		{"", "", false},
+		{"what's this?", whatisit, true},
+		{"go  ahead", forward, true},
+		{"我们往后退", backward, true},
+		// the phrases match whole words
+		{"thanks for the feedback", "", false},
+		{"using the camera", "", false},
+		{"stopwatch", "", false},
+		{"go back", backward, true},
+	}
+	for _, test := range testCases {
+		op, ok := g.Match(test.text)
+		assert.Equal(t, test.ok, ok, test.text)
+		assert.Equal(t, test.op, op, test.text)
+	}
+}
+
+func TestLoadGrammar(t *testing.T) {
+	dir, err := ioutil.TempDir("", "grammar")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, "grammar.json")
+	assert.NoError(t, ioutil.WriteFile(file, []byte(`{"forward": ["avanti"], "stop": ["ferma", "alt"]}`), 0644))
+	g, err := LoadGrammar(file)
+	assert.NoError(t, err)
+	op, ok := g.Match("avanti!")
+	assert.True(t, ok)
+	assert.Equal(t, forward, op)
+
+	assert.NoError(t, ioutil.WriteFile(file, []byte(`{"selfdrivingon": ["drive yourself"]}`), 0644))
+	_, err = LoadGrammar(file)
+	assert.Error(t, err)
+}
@@ -5,6 +5,7 @@ package main
 
 import (
 	"bytes"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
@@ -13,11 +14,14 @@ import (
 	"net/http"
 	"os"
 	"strings"
+	"time"
 
 	"github.com/jakefau/rpi-devices/app/car/car"
 	"github.com/jakefau/rpi-devices/dev"
 	"github.com/jakefau/rpi-devices/util"
+	"github.com/jakefau/rpi-devices/util/cv"
 	"github.com/jakefau/rpi-devices/util/geo"
+	"github.com/jakefau/rpi-devices/util/kws"
 	"github.com/stianeikeland/go-rpio"
 )
 
@@ -39,6 +43,23 @@ const (
 	pinTrig      = 21
 	pinEcho      = 26
 
+	// record the drive session for replaying it by app/carreplay
+	recordSession = true
+	sessionFile   = "session-20060102-150405.jsonl"
+
+	// speech-driving works offline with the keyword templates in kwsDir if it exists,
+	// and the voice commands are in grammarFile if it exists.
+	kwsDir      = "kws"
+	grammarFile = "grammar.json"
+
+	// objects are recognized offline by the model in dnnModel if it exists, it needs to build with -tags=gocv.
+	// the labels of the model are in dnnLabels, one label per line.
+	dnnModel  = "model.onnx"
+	dnnLabels = "labels.txt"
+
+	// self-tracking tracks the objects in the hsv profiles calibrated by cv.Stream if the file exists
+	hsvProfiles = "hsv.json"
+
 	ipPattern          = "((000.000.000.000))"
 	selfDrivingState   = "((selfdriving-state))"
 	selfTrackingState  = "((selftracking-state))"
@@ -86,6 +107,11 @@ func main() {
 		log.Printf("[carapp]failed to new a gy-25, will build a car without gy-25")
 	}
 
+	encoder := dev.NewEncoder(pinEncoder)
+	if encoder == nil {
+		log.Printf("[carapp]failed to new an encoder, will build a car without encoder")
+	}
+
 	collisionL := dev.NewCollision(pinCSwaitchL)
 	if collisionL == nil {
 		log.Printf("[carapp]failed to new a collision switch, will build a car without collision switchs")
@@ -95,7 +121,6 @@ func main() {
 	if collisionR == nil {
 		log.Printf("[carapp]failed to new a collision switch, will build a car without collision switchs")
 	}
-	collisions := []*dev.Collision{collisionL, collisionR}
 
 	horn := dev.NewBuzzer(pinBzr)
 	if horn == nil {
@@ -134,18 +159,86 @@ func main() {
 	// 	log.Printf("[carapp]failed to new a LC12S, error: %v", err)
 	// }
 
-	car := car.New(&car.Config{
-		Engine:     eng,
-		Servo:      servo,
-		GY25:       gy25,
-		Collisions: collisions,
-		Horn:       horn,
-		Led:        led,
-		Camera:     cam,
-		GPS:        gps,
-		LC12S:      lc12s,
-		DistMeter:  ult,
-	})
+	// only set the devices we have,
+	// a nil device in an interface of the config isn't nil.
+	cfg := &car.Config{
+		Engine: eng,
+		Camera: cam,
+	}
+	if lc12s != nil {
+		cfg.LC12S = lc12s
+	}
+	if servo != nil {
+		cfg.Servo = servo
+	}
+	if gy25 != nil {
+		cfg.GY25 = gy25
+	}
+	if encoder != nil {
+		cfg.Encoder = encoder
+	}
+	if collisionL != nil {
+		cfg.Collisions = append(cfg.Collisions, collisionL)
+	}
+	if collisionR != nil {
+		cfg.Collisions = append(cfg.Collisions, collisionR)
+	}
+	if horn != nil {
+		cfg.Horn = horn
+	}
+	if led != nil {
+		cfg.Led = led
+	}
+	if light != nil {
+		cfg.Light = light
+	}
+	if gps != nil {
+		cfg.GPS = gps
+	}
+	if ult != nil {
+		cfg.DistMeter = ult
+	}
+	if _, err := os.Stat(kwsDir); err == nil {
+		spotter, err := kws.NewSpotter(kwsDir)
+		if err != nil {
+			log.Printf("[carapp]failed to new a keyword spotter, will use baidu asr for speech-driving, error: %v", err)
+		} else {
+			cfg.ASR = spotter
+		}
+	}
+	if _, err := os.Stat(grammarFile); err == nil {
+		g, err := car.LoadGrammar(grammarFile)
+		if err != nil {
+			log.Printf("[carapp]failed to load grammar, will use the default grammar, error: %v", err)
+		} else {
+			cfg.Grammar = g
+		}
+	}
+	if _, err := os.Stat(dnnModel); err == nil {
+		dnn, err := cv.NewDNN(dnnModel, "", dnnLabels)
+		if err != nil {
+			log.Printf("[carapp]failed to load the model, will use baidu image recognition, error: %v", err)
+		} else {
+			cfg.Recognizer = dnn
+		}
+	}
+	if _, err := os.Stat(hsvProfiles); err == nil {
+		profiles, err := cv.LoadProfiles(hsvProfiles)
+		if err != nil {
+			log.Printf("[carapp]failed to load hsv profiles, will track a tennis, error: %v", err)
+		} else {
+			cfg.Profiles = profiles
+		}
+	}
+	if recordSession {
+		rec, err := car.CreateRecorder(time.Now().Format(sessionFile))
+		if err != nil {
+			log.Printf("[carapp]failed to create a recorder, will build a car without recording the session, error: %v", err)
+		} else {
+			cfg.Recorder = rec
+		}
+	}
+	car := car.New(cfg)
 	if car == nil {
 		log.Fatal("failed to new a car")
 		return
@@ -172,6 +265,9 @@ func main() {
 		if lc12s != nil {
 			lc12s.Close()
 		}
+		if cfg.Recorder != nil {
+			cfg.Recorder.Close()
+		}
 		rpio.Close()
 	})
 	if err := svr.start(); err != nil {
@@ -194,6 +290,8 @@ func (s *server) start() error {
 	log.Printf("[carapp]car started successfully")
 
 	http.HandleFunc("/", s.handler)
+	http.HandleFunc("/mission", s.missionHandler)
+	http.HandleFunc("/ws", s.wsHandler)
 	if err := http.ListenAndServe(":8080", nil); err != nil {
 		return err
 	}
@@ -291,16 +389,11 @@ func (s *server) handler(w http.ResponseWriter, r *http.Request) {
 		s.loadHomePage(w, r)
 	case "POST":
 		if dest := r.FormValue("dest"); dest != "" {
-			var lat, lon float64
-			n, err := fmt.Sscanf(dest, "%f,%f", &lat, &lon)
-			if err != nil || n != 2 {
+			destPt, err := parseDest(dest)
+			if err != nil {
 				log.Printf("invalid destination input: %v", dest)
 				return
 			}
-			destPt := &geo.Point{
-				Lat: lat,
-				Lon: lon,
-			}
 			log.Printf("dest: %v", destPt)
 			s.car.SetDest(destPt)
 		}
@@ -308,3 +401,63 @@ func (s *server) handler(w http.ResponseWriter, r *http.Request) {
 		s.car.Do(car.Op(op))
 	}
 }
+
+// missionHandler uploads a mission in json or gpx by POST,
+// and reports the progress of the mission by GET.
+func (s *server) missionHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "GET":
+		state, ok := s.car.MissionState()
+		if !ok {
+			http.Error(w, "no mission", http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(state); err != nil {
+			log.Printf("[carapp]failed to encode mission state, error: %v", err)
+		}
+	case "POST":
+		defer r.Body.Close()
+		// don't use FormValue, it consumes a form-urlencoded body, e.g. by curl -d
+		query := r.URL.Query()
+		parse := car.ParseMission
+		ct := r.Header.Get("Content-Type")
+		if strings.Contains(ct, "xml") || strings.Contains(ct, "gpx") || query.Get("format") == "gpx" {
+			parse = car.ParseGPX
+		}
+		m, err := parse(r.Body)
+		if err != nil {
+			log.Printf("[carapp]invalid mission, error: %v", err)
+			http.Error(w, fmt.Sprintf("invalid mission: %v", err), http.StatusBadRequest)
+			return
+		}
+		if err := s.car.SetMission(m); err != nil {
+			log.Printf("[carapp]failed to set mission, error: %v", err)
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		log.Printf("[carapp]mission %v with %v waypoints uploaded", m.Name, len(m.Waypoints))
+		if query.Get("start") == "true" {
+			s.car.Do(car.Op("selfnavon"))
+		}
+		w.WriteHeader(http.StatusCreated)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// parseDest parses a destination in "lat,lon"
+func parseDest(dest string) (*geo.Point, error) {
+	var lat, lon float64
+	n, err := fmt.Sscanf(dest, "%f,%f", &lat, &lon)
+	if err != nil {
+		return nil, err
+	}
+	if n != 2 {
+		return nil, errors.New("invalid destination")
+	}
+	return &geo.Point{
+		Lat: lat,
+		Lon: lon,
+	}, nil
+}
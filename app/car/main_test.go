@@ -1,9 +1,16 @@
 package main
 
 import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/gorilla/websocket"
 	"github.com/jakefau/rpi-devices/app/car/car"
+	"github.com/jakefau/rpi-devices/app/car/sim"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -14,3 +21,67 @@ func TestStart(t *testing.T) {
 	s := newServer(car)
 	assert.NotNil(t, s)
 }
+
+func TestParseDest(t *testing.T) {
+	pt, err := parseDest("39.955980,116.444390")
+	assert.NoError(t, err)
+	assert.Equal(t, 39.955980, pt.Lat)
+	assert.Equal(t, 116.444390, pt.Lon)
+
+	_, err = parseDest("39.955980")
+	assert.Error(t, err)
+}
+
+func TestTelemetryInterval(t *testing.T) {
+	assert.Equal(t, 500*time.Millisecond, telemetryInterval(defaultTelemetryRate))
+	assert.Equal(t, 50*time.Millisecond, telemetryInterval(100))
+	assert.Equal(t, 5*time.Second, telemetryInterval(0))
+}
+
+func TestWebSocket(t *testing.T) {
+	sm := sim.New(sim.NewRoom(4, 4), nil, sim.Vec{X: 1, Y: 1}, 0)
+	c := car.New(sm.CarConfig())
+	c.Start()
+	s := newServer(c)
+
+	svr := httptest.NewServer(http.HandlerFunc(s.wsHandler))
+	defer svr.Close()
+
+	wsURL := "ws" + strings.TrimPrefix(svr.URL, "http") + "?rate=10"
+	conn, _, err := websocket.DefaultDialer.Dial(wsURL, nil)
+	assert.NoError(t, err)
+	defer conn.Close()
+
+	var tm car.Telemetry
+	assert.NoError(t, conn.ReadJSON(&tm))
+	assert.Equal(t, car.ModeManual, tm.Mode)
+	// 3m to the north wall, minus the radius of the car
+	assert.InDelta(t, 288, tm.Dist, 1)
+
+	assert.NoError(t, conn.WriteJSON(&command{Op: "forward"}))
+	for i := 0; i < 10 && tm.Op != "forward"; i++ {
+		assert.NoError(t, conn.ReadJSON(&tm))
+	}
+	assert.Equal(t, car.Op("forward"), tm.Op)
+	assert.NoError(t, conn.WriteJSON(&command{Op: "stop"}))
+}
+
+func TestMissionHandler(t *testing.T) {
+	s := newServer(car.New(&car.Config{}))
+	svr := httptest.NewServer(http.HandlerFunc(s.missionHandler))
+	defer svr.Close()
+
+	// curl -d posts the json as a form
+	mission := `{"name":"m1","waypoints":[{"lat":39.956,"lon":116.4443}]}`
+	resp, err := http.Post(svr.URL+"?format=json", "application/x-www-form-urlencoded", strings.NewReader(mission))
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+
+	resp, err = http.Get(svr.URL)
+	assert.NoError(t, err)
+	var state car.MissionState
+	assert.NoError(t, json.NewDecoder(resp.Body).Decode(&state))
+	resp.Body.Close()
+	assert.Equal(t, "m1", state.Name)
+}
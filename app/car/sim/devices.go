@@ -0,0 +1,359 @@
+package sim
+
+import (
+	"image"
+	"math"
+	"time"
+
+	"github.com/jakefau/rpi-devices/app/car/car"
+	"github.com/jakefau/rpi-devices/dev"
+	"github.com/jakefau/rpi-devices/util/cv"
+	"github.com/jakefau/rpi-devices/util/geo"
+)
+
+const (
+	// the half beam width of the distance meter in degree
+	sonarHalfBeam = 7.5
+	// the camera of the tracker
+	imgWidth     = 600
+	imgHeight    = 600
+	camHalfFOV   = 31.0 // degree
+	camHeight    = 0.1  // meter
+	camRange     = 3.0  // meter
+	ballRadius   = 0.033
+	frameLatency = 50 * time.Millisecond
+)
+
+// CarConfig returns the config of a car with all the devices of the simulator
+func (s *Sim) CarConfig() *car.Config {
+	return &car.Config{
+		Engine:    &Engine{s: s},
+		Servo:     &Servo{s: s},
+		GY25:      &GY25{s: s},
+		Encoder:   &Encoder{s: s},
+		Horn:      &Horn{s: s},
+		Led:       &Led{s: s},
+		Light:     &Led{s: s},
+		GPS:       &GPS{s: s},
+		DistMeter: &DistMeter{s: s},
+		Collisions: []dev.CollisionSwitch{
+			&Collision{s: s, left: true},
+			&Collision{s: s, left: false},
+		},
+		Tracker: &Tracker{s: s, targets: cv.NewTargets()},
+		Clock:   s.clock,
+	}
+}
+
+// Engine implements dev.Motor
+type Engine struct {
+	s *Sim
+}
+
+func (e *Engine) set(l, r float64) {
+	e.s.mu.Lock()
+	defer e.s.mu.Unlock()
+	e.s.dirL, e.s.dirR = l, r
+	// like L298N, undo the duty cycles of Drive
+	e.s.dutyL, e.s.dutyR = e.s.speed, e.s.speed
+}
+
+// Forward ...
+func (e *Engine) Forward() {
+	e.set(1, 1)
+}
+
+// Backward ...
+func (e *Engine) Backward() {
+	e.set(-1, -1)
+}
+
+// Left ...
+func (e *Engine) Left() {
+	e.set(-1, 1)
+}
+
+// Right ...
+func (e *Engine) Right() {
+	e.set(1, -1)
+}
+
+// Stop ...
+func (e *Engine) Stop() {
+	e.set(0, 0)
+}
+
+// Speed ...
+func (e *Engine) Speed(s uint32) {
+	e.s.mu.Lock()
+	defer e.s.mu.Unlock()
+	e.s.speed = math.Min(float64(s), 100)
+	e.s.dutyL, e.s.dutyR = e.s.speed, e.s.speed
+}
+
+// Drive ...
+func (e *Engine) Drive(left, right int) {
+	e.s.mu.Lock()
+	defer e.s.mu.Unlock()
+	sign := func(v int) float64 {
+		if v < 0 {
+			return -1
+		}
+		return 1
+	}
+	e.s.dirL, e.s.dirR = sign(left), sign(right)
+	e.s.dutyL = math.Min(math.Abs(float64(left)), 100)
+	e.s.dutyR = math.Min(math.Abs(float64(right)), 100)
+}
+
+// Servo implements dev.Roller
+type Servo struct {
+	s *Sim
+}
+
+// Roll rolls the distance meter, a positive angle is on the right
+func (sv *Servo) Roll(angle int) {
+	sv.s.mu.Lock()
+	defer sv.s.mu.Unlock()
+	sv.s.servo = angle
+}
+
+// DistMeter implements dev.DistMeter
+type DistMeter struct {
+	s *Sim
+}
+
+// Dist returns the distance in cm in the direction of the servo
+func (d *DistMeter) Dist() float64 {
+	s := d.s
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	dir := s.theta - geo.Rad(float64(s.servo))
+	org := s.pos.Add(Vec{X: math.Cos(dir), Y: math.Sin(dir)}.Scale(s.cfg.Radius))
+	min := s.cfg.SonarRange
+	for _, a := range []float64{-sonarHalfBeam, 0, sonarHalfBeam} {
+		if dist := s.world.Raycast(org, dir+geo.Rad(a), s.cfg.SonarRange); dist >= 0 && dist < min {
+			min = dist
+		}
+	}
+	return min * 100
+}
+
+// Close ...
+func (d *DistMeter) Close() {
+	return
+}
+
+// GY25 implements dev.AngleMeter
+type GY25 struct {
+	s *Sim
+}
+
+// Angles returns the yaw in (-180, 180], which increases clockwise
+func (g *GY25) Angles() (float64, float64, float64, error) {
+	g.s.mu.Lock()
+	defer g.s.mu.Unlock()
+	yaw := -g.s.theta * 180 / math.Pi
+	yaw = math.Mod(yaw, 360)
+	if yaw > 180 {
+		yaw -= 360
+	} else if yaw <= -180 {
+		yaw += 360
+	}
+	return yaw, 0, 0, nil
+}
+
+// IncludedAngle ...
+func (g *GY25) IncludedAngle(yaw, yaw2 float64) float64 {
+	if yaw*yaw2 > 0 {
+		return math.Abs(yaw - yaw2)
+	}
+
+	d := math.Abs(yaw) + math.Abs(yaw2)
+	if d <= 180 {
+		return d
+	}
+	return 360 - d
+}
+
+// Encoder implements dev.PulseCounter on the left wheel
+type Encoder struct {
+	s *Sim
+}
+
+// Start ...
+func (e *Encoder) Start() {
+	e.s.mu.Lock()
+	defer e.s.mu.Unlock()
+	e.s.counting = true
+	e.s.ticks = 0
+}
+
+// Stop ...
+func (e *Encoder) Stop() {
+	e.s.mu.Lock()
+	defer e.s.mu.Unlock()
+	e.s.counting = false
+}
+
+// Count1 ...
+func (e *Encoder) Count1() int {
+	e.s.mu.Lock()
+	defer e.s.mu.Unlock()
+	if e.s.ticks >= 1 {
+		e.s.ticks--
+		return 1
+	}
+	return 0
+}
+
+// Collision implements dev.CollisionSwitch on the left or right of the front
+type Collision struct {
+	s    *Sim
+	left bool
+}
+
+// Collided ...
+func (c *Collision) Collided() bool {
+	c.s.mu.Lock()
+	defer c.s.mu.Unlock()
+	touching, a := c.s.contact()
+	if !touching {
+		return false
+	}
+	if c.left {
+		return a >= 0 && a <= math.Pi/2
+	}
+	return a < 0 && a >= -math.Pi/2
+}
+
+// GPS implements dev.Locator
+type GPS struct {
+	s *Sim
+}
+
+// Loc ...
+func (g *GPS) Loc() (*geo.Point, error) {
+	fix, err := g.Fix()
+	if err != nil {
+		return nil, err
+	}
+	return fix.Loc, nil
+}
+
+// Fix ...
+func (g *GPS) Fix() (*dev.GPSFix, error) {
+	g.s.clock.Sleep(g.s.cfg.GPSDelay)
+	g.s.mu.Lock()
+	defer g.s.mu.Unlock()
+	pos := g.s.pos.Add(Vec{X: g.s.noise(), Y: g.s.noise()})
+	return &dev.GPSFix{
+		Loc:  g.s.GeoPoint(pos),
+		HDOP: g.s.cfg.HDOP,
+		Sats: 8,
+	}, nil
+}
+
+// Horn implements dev.Beeper
+type Horn struct {
+	s *Sim
+}
+
+// Beep ...
+func (h *Horn) Beep(n int, interval int) {
+	h.s.mu.Lock()
+	h.s.beeps += n
+	h.s.mu.Unlock()
+	h.s.clock.Sleep(time.Duration(2*n*interval) * time.Millisecond)
+}
+
+// Led implements dev.Light
+type Led struct {
+	s *Sim
+}
+
+// On ...
+func (l *Led) On() {
+	l.s.mu.Lock()
+	defer l.s.mu.Unlock()
+	l.s.led = true
+}
+
+// Off ...
+func (l *Led) Off() {
+	l.s.mu.Lock()
+	defer l.s.mu.Unlock()
+	l.s.led = false
+}
+
+// Blink ...
+func (l *Led) Blink(n int, interval int) {
+	d := time.Duration(interval) * time.Millisecond
+	for i := 0; i < n; i++ {
+		l.On()
+		l.s.clock.Sleep(d)
+		l.Off()
+		l.s.clock.Sleep(d)
+	}
+}
+
+// Tracker implements car.TargetTracker, it sees the ball with a camera in front of the car
+type Tracker struct {
+	s       *Sim
+	targets *cv.Targets
+}
+
+// Track returns the ball as a target
+func (t *Tracker) Track() ([]*cv.Target, error) {
+	var blobs []*cv.Blob
+	if ok, rect := t.Locate(); ok {
+		blobs = append(blobs, &cv.Blob{
+			Profile: cv.Tennis.Name,
+			Box:     *rect,
+			Area:    float64(rect.Dx()*rect.Dy()) * math.Pi / 4,
+		})
+	}
+	return t.targets.Update(blobs, t.s.clock.Now()), nil
+}
+
+// Locate returns the bounding box of the ball in the image
+func (t *Tracker) Locate() (bool, *image.Rectangle) {
+	t.s.clock.Sleep(frameLatency)
+	s := t.s
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.world.Ball == nil {
+		return false, nil
+	}
+	v := s.world.Ball.Sub(s.pos)
+	d := v.Len()
+	if d > camRange || d < 0.01 || !s.world.Visible(s.pos, *s.world.Ball) {
+		return false, nil
+	}
+	// the angle of the ball on the right of the heading
+	a := s.theta - math.Atan2(v.Y, v.X)
+	a = math.Atan2(math.Sin(a), math.Cos(a)) * 180 / math.Pi
+	if math.Abs(a) > camHalfFOV {
+		return false, nil
+	}
+
+	// a pinhole camera, the ball on the right is on the left of the image like the real one
+	f := imgWidth / 2 / math.Tan(geo.Rad(camHalfFOV))
+	x := imgWidth/2 - f*math.Tan(geo.Rad(a))
+	y := imgHeight/2 + f*camHeight/d
+	r := f * ballRadius / d
+	rect := image.Rect(int(x-r), int(y-r), int(x+r), int(y+r))
+	return true, &rect
+}
+
+// MiddleXY ...
+func (t *Tracker) MiddleXY(rect *image.Rectangle) (x int, y int) {
+	return (rect.Min.X + rect.Max.X) / 2, (rect.Min.Y + rect.Max.Y) / 2
+}
+
+// Close ...
+func (t *Tracker) Close() {
+	return
+}
@@ -0,0 +1,275 @@
+package sim
+
+import (
+	"math"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/jakefau/rpi-devices/app/car/car"
+	"github.com/jakefau/rpi-devices/util/geo"
+	"github.com/jakefau/rpi-devices/util/nav"
+)
+
+const (
+	// the interval of simulation steps
+	stepInterval = 10 * time.Millisecond
+	// the tolerance in meter for touching a wall
+	touchDist = 0.01
+	// the min distance in meter between two points of the trail
+	trailDist = 0.05
+	maxTrail  = 4000
+)
+
+// Config ...
+// MaxSpeed: the speed of a wheel in m/s at 100% speed
+// TrackWidth: the distance between the left and right wheels in meter
+// Radius: the radius of the car body in meter
+// TickDist: the distance a wheel travels in a tick of the encoder in meter
+// SonarRange: the max range of the distance meter in meter
+// GPSNoise: the std of the gps error in meter
+// HDOP: the hdop reported by the gps
+// GPSDelay: the time for reading a gps fix
+// Origin: the geo location of (0, 0) of the world
+// Seed: the seed of the random noises
+// Speedup: the simulation and the car run Speedup times as fast as the real time, 1 if it is 0
+type Config struct {
+	MaxSpeed   float64
+	TrackWidth float64
+	Radius     float64
+	TickDist   float64
+	SonarRange float64
+	GPSNoise   float64
+	HDOP       float64
+	GPSDelay   time.Duration
+	Origin     *geo.Point
+	Seed       int64
+	Speedup    float64
+}
+
+// DefaultConfig returns the config of a car like the real one
+func DefaultConfig() *Config {
+	return &Config{
+		MaxSpeed:   1,
+		TrackWidth: 0.15,
+		Radius:     0.12,
+		TickDist:   math.Pi * 0.065 / 20,
+		SonarRange: 4,
+		GPSNoise:   0.3,
+		HDOP:       1,
+		GPSDelay:   200 * time.Millisecond,
+		Origin:     &geo.Point{Lat: 39.955993, Lon: 116.444434},
+		Seed:       1,
+		Speedup:    1,
+	}
+}
+
+// Sim simulates a differential drive car in a world
+type Sim struct {
+	cfg   *Config
+	world *World
+	proj  *nav.Projection
+	clock *clock
+
+	mu       sync.Mutex
+	rnd      *rand.Rand
+	pos      Vec
+	theta    float64 // math angle in radian, counter-clockwise from east
+	dirL     float64 // the direction of the left wheel, 1: forward, -1: backward, 0: stop
+	dirR     float64
+	dutyL    float64 // the duty cycle of the left wheel in percent
+	dutyR    float64
+	speed    float64 // the speed set by the engine, the discrete moves apply it to both wheels
+	servo    int
+	counting bool
+	ticks    float64
+	touching bool
+	crashes  int
+	odo      float64
+	beeps    int
+	led      bool
+	trail    []Vec
+
+	quit chan struct{}
+	done chan struct{}
+}
+
+// New creates a simulator with the car at pos heading to the heading,
+// heading is in degree and clockwise from north.
+func New(w *World, cfg *Config, pos Vec, heading float64) *Sim {
+	if cfg == nil {
+		cfg = DefaultConfig()
+	}
+	speedup := cfg.Speedup
+	if speedup <= 0 {
+		speedup = 1
+	}
+	return &Sim{
+		cfg:   cfg,
+		world: w,
+		proj:  nav.NewProjection(cfg.Origin),
+		clock: &clock{start: time.Now(), speedup: speedup},
+		rnd:   rand.New(rand.NewSource(cfg.Seed)),
+		pos:   pos,
+		theta: nav.Heading(heading),
+		trail: []Vec{pos},
+	}
+}
+
+// Start starts the simulation in the clock of the simulator
+func (s *Sim) Start() {
+	s.quit = make(chan struct{})
+	s.done = make(chan struct{})
+	go func() {
+		defer close(s.done)
+		ticker := time.NewTicker(s.clock.real(stepInterval))
+		defer ticker.Stop()
+		last := s.clock.Now()
+		for {
+			select {
+			case <-s.quit:
+				return
+			case <-ticker.C:
+				now := s.clock.Now()
+				s.Step(now.Sub(last).Seconds())
+				last = now
+			}
+		}
+	}()
+}
+
+// Clock returns the clock of the simulator, the car of CarConfig() runs in it
+func (s *Sim) Clock() car.Clock {
+	return s.clock
+}
+
+// Stop stops the simulation
+func (s *Sim) Stop() {
+	if s.quit == nil {
+		return
+	}
+	close(s.quit)
+	<-s.done
+	s.quit = nil
+}
+
+// Step moves the car for dt seconds
+func (s *Sim) Step(dt float64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	vl := s.dirL * s.dutyL / 100 * s.cfg.MaxSpeed
+	vr := s.dirR * s.dutyR / 100 * s.cfg.MaxSpeed
+	if s.counting {
+		// the encoder is on the left wheel, it ticks even if the car is blocked
+		s.ticks += math.Abs(vl*dt) / s.cfg.TickDist
+	}
+
+	v := (vl + vr) / 2
+	w := (vr - vl) / s.cfg.TrackWidth
+	mid := s.theta + w*dt/2
+	s.theta = math.Mod(s.theta+w*dt, 2*math.Pi)
+
+	next := s.pos.Add(Vec{X: math.Cos(mid), Y: math.Sin(mid)}.Scale(v * dt))
+	d, _ := s.world.Nearest(next)
+	cur, _ := s.world.Nearest(s.pos)
+	if d >= s.cfg.Radius || d > cur {
+		// free, or moving away from the wall
+		s.odo += next.Sub(s.pos).Len()
+		s.pos = next
+		if last := s.trail[len(s.trail)-1]; s.pos.Sub(last).Len() > trailDist && len(s.trail) < maxTrail {
+			s.trail = append(s.trail, s.pos)
+		}
+	}
+
+	touching, _ := s.contact()
+	if touching && !s.touching {
+		s.crashes++
+	}
+	s.touching = touching
+}
+
+// Pose returns the location and the heading of the car,
+// the heading is in degree and clockwise from north.
+func (s *Sim) Pose() (Vec, float64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.pos, nav.Compass(s.theta)
+}
+
+// SetPose ...
+func (s *Sim) SetPose(pos Vec, heading float64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pos = pos
+	s.theta = nav.Heading(heading)
+	s.trail = append(s.trail, pos)
+}
+
+// Crashes returns how many times the car ran into walls
+func (s *Sim) Crashes() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.crashes
+}
+
+// Odometer returns the distance the car traveled in meter
+func (s *Sim) Odometer() float64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.odo
+}
+
+// Beeps returns how many times the horn beeped
+func (s *Sim) Beeps() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.beeps
+}
+
+// GeoPoint converts a point of the world to a geo point
+func (s *Sim) GeoPoint(v Vec) *geo.Point {
+	return s.proj.ToGeo(nav.XY{X: v.X, Y: v.Y})
+}
+
+// contact tells whether the car is touching a wall, and the angle of the touching point
+// relative to the heading in radian, counter-clockwise positive.
+func (s *Sim) contact() (bool, float64) {
+	d, q := s.world.Nearest(s.pos)
+	if d > s.cfg.Radius+touchDist {
+		return false, 0
+	}
+	v := q.Sub(s.pos)
+	a := math.Atan2(v.Y, v.X) - s.theta
+	return true, math.Atan2(math.Sin(a), math.Cos(a))
+}
+
+// clock runs speedup times as fast as the real time
+type clock struct {
+	start   time.Time
+	speedup float64
+}
+
+// Now ...
+func (c *clock) Now() time.Time {
+	return c.start.Add(time.Duration(float64(time.Since(c.start)) * c.speedup))
+}
+
+// Sleep ...
+func (c *clock) Sleep(d time.Duration) {
+	time.Sleep(c.real(d))
+}
+
+// After ...
+func (c *clock) After(d time.Duration) <-chan time.Time {
+	return time.After(c.real(d))
+}
+
+// real converts a duration of the clock to the real time
+func (c *clock) real(d time.Duration) time.Duration {
+	return time.Duration(float64(d) / c.speedup)
+}
+
+func (s *Sim) noise() float64 {
+	return s.rnd.NormFloat64() * s.cfg.GPSNoise
+}
@@ -0,0 +1,285 @@
+package sim
+
+import (
+	"io/ioutil"
+	"math"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/jakefau/rpi-devices/app/car/car"
+	"github.com/jakefau/rpi-devices/util/radio"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRaycast(t *testing.T) {
+	w := NewRoom(4, 3)
+	testCases := []struct {
+		p    Vec
+		dir  float64
+		want float64
+	}{
+		{Vec{1, 1}, 0, 3},
+		{Vec{1, 1}, math.Pi / 2, 2},
+		{Vec{1, 1}, math.Pi, 1},
+		{Vec{1, 1}, -math.Pi / 2, 1},
+	}
+	for _, test := range testCases {
+		assert.InDelta(t, test.want, w.Raycast(test.p, test.dir, 10), 1e-9)
+	}
+	assert.Equal(t, -1.0, w.Raycast(Vec{1, 1}, 0, 2))
+}
+
+func TestStep(t *testing.T) {
+	s := New(NewRoom(4, 4), nil, Vec{1, 1}, 90)
+	cfg := s.CarConfig()
+
+	cfg.Engine.Speed(50)
+	cfg.Engine.Forward()
+	for i := 0; i < 100; i++ {
+		s.Step(0.01)
+	}
+	pos, heading := s.Pose()
+	assert.InDelta(t, 1.5, pos.X, 1e-6)
+	assert.InDelta(t, 1, pos.Y, 1e-6)
+	assert.InDelta(t, 90, heading, 1e-6)
+
+	// spin right
+	cfg.Engine.Right()
+	yaw, _, _, _ := cfg.GY25.Angles()
+	for i := 0; i < 1000; i++ {
+		s.Step(0.001)
+		if _, h := s.Pose(); h > 179 {
+			break
+		}
+	}
+	yaw2, _, _, _ := cfg.GY25.Angles()
+	assert.InDelta(t, 90, cfg.GY25.IncludedAngle(yaw, yaw2), 1)
+
+	// blocked by the wall on the south
+	cfg.Engine.Forward()
+	for i := 0; i < 500; i++ {
+		s.Step(0.01)
+	}
+	pos, _ = s.Pose()
+	assert.True(t, pos.Y >= s.cfg.Radius)
+	assert.Equal(t, 1, s.Crashes())
+	assert.True(t, cfg.Collisions[0].Collided() || cfg.Collisions[1].Collided())
+	assert.InDelta(t, 100-s.cfg.Radius*100, cfg.DistMeter.Dist()+100*(1-pos.Y), 1)
+}
+
+func TestEngine(t *testing.T) {
+	s := New(NewRoom(4, 4), nil, Vec{1, 1}, 90)
+	e := s.CarConfig().Engine
+	duty := func() (float64, float64) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		return s.dirL * s.dutyL, s.dirR * s.dutyR
+	}
+
+	e.Speed(40)
+	e.Drive(30, 0)
+	l, r := duty()
+	assert.Equal(t, 30.0, l)
+	assert.Equal(t, 0.0, r)
+
+	// the moves after driving run both wheels in the speed set
+	e.Forward()
+	l, r = duty()
+	assert.Equal(t, 40.0, l)
+	assert.Equal(t, 40.0, r)
+
+	e.Drive(-20, 60)
+	e.Backward()
+	l, r = duty()
+	assert.Equal(t, -40.0, l)
+	assert.Equal(t, -40.0, r)
+}
+
+func TestTracker(t *testing.T) {
+	w := NewRoom(4, 4)
+	w.Ball = &Vec{2, 2.5}
+	s := New(w, nil, Vec{2, 1}, 0)
+	tracker := s.CarConfig().Tracker
+
+	ok, rect := tracker.Locate()
+	assert.True(t, ok)
+	x, _ := tracker.MiddleXY(rect)
+	assert.InDelta(t, imgWidth/2, x, 1)
+
+	// the ball is on the right
+	s.SetPose(Vec{2, 1}, -20)
+	ok, rect = tracker.Locate()
+	assert.True(t, ok)
+	x, _ = tracker.MiddleXY(rect)
+	assert.True(t, x < 200)
+
+	// the ball is behind
+	s.SetPose(Vec{2, 1}, 180)
+	ok, _ = tracker.Locate()
+	assert.False(t, ok)
+
+	// track the ball as a target with the same id
+	tt := tracker.(car.TargetTracker)
+	s.SetPose(Vec{2, 1}, 0)
+	targets, err := tt.Track()
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(targets))
+	id := targets[0].ID
+	s.SetPose(Vec{2, 1}, -5)
+	targets, err = tt.Track()
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(targets))
+	assert.Equal(t, id, targets[0].ID)
+	// the ball moves to the left of the image
+	assert.True(t, targets[0].VX < 0)
+}
+
+func TestView(t *testing.T) {
+	s := New(NewRoom(4, 4), nil, Vec{1, 1}, 0)
+	svr := httptest.NewServer(s.Handler())
+	defer svr.Close()
+
+	resp, err := svr.Client().Get(svr.URL + "/view.png")
+	assert.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, "image/png", resp.Header.Get("Content-Type"))
+}
+
+// the tests below run the car against the simulator, 10 times as fast as the real time except the joystick
+
+// fast returns the config of a simulator running 10 times as fast as the real time
+func fast() *Config {
+	cfg := DefaultConfig()
+	cfg.Speedup = 10
+	return cfg
+}
+
+func TestSelfDriving(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skip running the car in short mode")
+	}
+	w := NewRoom(3, 3)
+	w.AddBox(1.8, 1.2, 0.4, 0.6)
+	s := New(w, fast(), Vec{0.6, 0.6}, 0)
+	s.Start()
+	defer s.Stop()
+	clock := s.Clock()
+
+	c := car.New(s.CarConfig())
+	c.Start()
+	c.Do(car.Op("selfdrivingon"))
+	clock.Sleep(20 * time.Second)
+	c.Do(car.Op("selfdrivingoff"))
+	clock.Sleep(3 * time.Second)
+
+	pos, _ := s.Pose()
+	t.Logf("odometer: %.2f m, crashes: %v, pos: %v", s.Odometer(), s.Crashes(), pos)
+	assert.True(t, s.Odometer() > 2)
+	assert.True(t, s.Crashes() <= 2)
+	assert.True(t, pos.X > 0 && pos.X < 3 && pos.Y > 0 && pos.Y < 3)
+}
+
+func TestSelfNav(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skip running the car in short mode")
+	}
+	// the car logs the tracks in the working dir
+	dir, err := ioutil.TempDir("", "carsim")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	wd, _ := os.Getwd()
+	defer os.Chdir(wd)
+	os.Chdir(dir)
+
+	w := NewRoom(20, 20)
+	s := New(w, fast(), Vec{10, 4}, 0)
+	s.Start()
+	defer s.Stop()
+	clock := s.Clock()
+
+	dest := Vec{12, 12}
+	c := car.New(s.CarConfig())
+	c.Start()
+	c.SetDest(s.GeoPoint(dest))
+	c.Do(car.Op("selfnavon"))
+
+	var state car.MissionState
+	for start := clock.Now(); clock.Now().Sub(start) < 90*time.Second; {
+		clock.Sleep(500 * time.Millisecond)
+		state, _ = c.MissionState()
+		if state.Status == car.MissionDone || state.Status == car.MissionFailed {
+			break
+		}
+	}
+	c.Do(car.Op("selfnavoff"))
+
+	pos, _ := s.Pose()
+	t.Logf("status: %v, pos: %v, odometer: %.2f m", state.Status, pos, s.Odometer())
+	assert.Equal(t, car.MissionDone, state.Status)
+	assert.True(t, pos.Sub(dest).Len() < 5)
+	assert.Equal(t, 0, s.Crashes())
+}
+
+func TestSelfTracking(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skip running the car in short mode")
+	}
+	w := NewRoom(4, 4)
+	w.Ball = &Vec{2.3, 2.5}
+	s := New(w, fast(), Vec{2, 0.8}, 0)
+	s.Start()
+	defer s.Stop()
+	clock := s.Clock()
+
+	c := car.New(s.CarConfig())
+	c.Start()
+	c.Do(car.Op("selftrackingon"))
+
+	var d float64
+	for start := clock.Now(); clock.Now().Sub(start) < 30*time.Second; {
+		clock.Sleep(500 * time.Millisecond)
+		pos, _ := s.Pose()
+		if d = pos.Sub(*w.Ball).Len(); d < 0.4 {
+			break
+		}
+	}
+	c.Do(car.Op("selftrackingoff"))
+	clock.Sleep(2 * time.Second)
+
+	t.Logf("distance to the ball: %.2f m", d)
+	assert.True(t, d < 0.4)
+}
+
+func TestJoystick(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skip running the car in short mode")
+	}
+	s := New(NewRoom(6, 6), nil, Vec{1, 3}, 90)
+	s.Start()
+	defer s.Stop()
+
+	joystick, lc12s := radio.NewLoopback()
+	cfg := s.CarConfig()
+	cfg.LC12S = lc12s
+	c := car.New(cfg)
+	c.Start()
+
+	// full throttle and a little right
+	link := radio.NewLink(joystick)
+	for i := 0; i < 20; i++ {
+		assert.NoError(t, link.SendControl(&radio.Control{X: 100, Y: 20}, false))
+		time.Sleep(100 * time.Millisecond)
+	}
+	pos, heading := s.Pose()
+	t.Logf("pos: %v, heading: %.2f", pos, heading)
+	assert.True(t, pos.X > 1.2)
+	assert.True(t, heading > 90)
+
+	// the joystick is gone, the car stops
+	time.Sleep(2 * time.Second)
+	odo := s.Odometer()
+	time.Sleep(time.Second)
+	assert.InDelta(t, odo, s.Odometer(), 1e-3)
+}
@@ -0,0 +1,126 @@
+package sim
+
+import (
+	"image"
+	"image/color"
+	"image/png"
+	"log"
+	"math"
+	"net/http"
+)
+
+const (
+	// the max size of the view in pixel
+	maxViewSize = 800
+	viewPadding = 0.2 // meter
+)
+
+const viewPage = `<html>
+<head><title>car simulator</title></head>
+<body>
+<img id="view" src="view.png">
+<script>
+setInterval(function() {
+	document.getElementById("view").src = "view.png?t=" + Date.now();
+}, 200);
+</script>
+</body>
+</html>
+`
+
+var (
+	wallColor  = color.RGBA{0, 0, 0, 255}
+	trailColor = color.RGBA{80, 140, 255, 255}
+	carColor   = color.RGBA{220, 40, 40, 255}
+	sonarColor = color.RGBA{40, 180, 40, 255}
+	ballColor  = color.RGBA{255, 160, 0, 255}
+)
+
+// Handler serves a live top-down view of the world,
+// "/" is the page and "/view.png" is the image.
+func (s *Sim) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(viewPage))
+	})
+	mux.HandleFunc("/view.png", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "image/png")
+		w.Header().Set("Cache-Control", "no-cache")
+		if err := png.Encode(w, s.Render()); err != nil {
+			log.Printf("[sim]failed to encode the view, error: %v", err)
+		}
+	})
+	return mux
+}
+
+// Render draws the world, the trail and the car from the top
+func (s *Sim) Render() *image.RGBA {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	min := Vec{X: math.Inf(1), Y: math.Inf(1)}
+	max := Vec{X: math.Inf(-1), Y: math.Inf(-1)}
+	expand := func(v Vec) {
+		min.X, min.Y = math.Min(min.X, v.X), math.Min(min.Y, v.Y)
+		max.X, max.Y = math.Max(max.X, v.X), math.Max(max.Y, v.Y)
+	}
+	for _, w := range s.world.Walls {
+		expand(w.A)
+		expand(w.B)
+	}
+	for _, p := range s.trail {
+		expand(p)
+	}
+	expand(s.pos)
+	min = min.Sub(Vec{viewPadding, viewPadding})
+	max = max.Add(Vec{viewPadding, viewPadding})
+
+	scale := maxViewSize / math.Max(max.X-min.X, max.Y-min.Y)
+	scale = math.Min(scale, 200)
+	img := image.NewRGBA(image.Rect(0, 0, int((max.X-min.X)*scale)+1, int((max.Y-min.Y)*scale)+1))
+	for i := range img.Pix {
+		img.Pix[i] = 255
+	}
+	// y of the image points to south
+	toPx := func(v Vec) (float64, float64) {
+		return (v.X - min.X) * scale, (max.Y - v.Y) * scale
+	}
+	line := func(a, b Vec, c color.Color) {
+		x0, y0 := toPx(a)
+		x1, y1 := toPx(b)
+		n := int(math.Max(math.Abs(x1-x0), math.Abs(y1-y0))) + 1
+		for i := 0; i <= n; i++ {
+			t := float64(i) / float64(n)
+			img.Set(int(x0+(x1-x0)*t), int(y0+(y1-y0)*t), c)
+		}
+	}
+	circle := func(o Vec, r float64, c color.Color) {
+		cx, cy := toPx(o)
+		rp := r * scale
+		for y := int(cy - rp); y <= int(cy+rp); y++ {
+			for x := int(cx - rp); x <= int(cx+rp); x++ {
+				if math.Hypot(float64(x)-cx, float64(y)-cy) <= rp {
+					img.Set(x, y, c)
+				}
+			}
+		}
+	}
+
+	for _, w := range s.world.Walls {
+		line(w.A, w.B, wallColor)
+	}
+	for i := 1; i < len(s.trail); i++ {
+		line(s.trail[i-1], s.trail[i], trailColor)
+	}
+	if s.world.Ball != nil {
+		circle(*s.world.Ball, math.Max(ballRadius, 2/scale), ballColor)
+	}
+	circle(s.pos, s.cfg.Radius, carColor)
+	head := Vec{X: math.Cos(s.theta), Y: math.Sin(s.theta)}
+	line(s.pos, s.pos.Add(head.Scale(s.cfg.Radius*1.5)), wallColor)
+	dir := s.theta - float64(s.servo)*math.Pi/180
+	sonar := Vec{X: math.Cos(dir), Y: math.Sin(dir)}
+	line(s.pos, s.pos.Add(sonar.Scale(s.cfg.Radius*3)), sonarColor)
+	return img
+}
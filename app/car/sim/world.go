@@ -0,0 +1,152 @@
+/*
+Package sim is a 2D software-in-the-loop simulator of the car.
+
+It simulates a differential drive car in a world with walls, and implements
+the devices of the car against the simulated world, so that the car can run
+self-driving, self-tracking and self-nav without a physical robot.
+
+The world is a plane in meter, x points to east and y points to north.
+
+	y
+	^
+	|  +--------------+
+	|  |     wall     |
+	|  |   >  car     |
+	|  |        o ball|
+	|  +--------------+
+	+---------------------> x
+*/
+package sim
+
+import (
+	"math"
+)
+
+// Vec is a point or a vector in meter
+type Vec struct {
+	X float64
+	Y float64
+}
+
+// Add ...
+func (v Vec) Add(u Vec) Vec {
+	return Vec{X: v.X + u.X, Y: v.Y + u.Y}
+}
+
+// Sub ...
+func (v Vec) Sub(u Vec) Vec {
+	return Vec{X: v.X - u.X, Y: v.Y - u.Y}
+}
+
+// Scale ...
+func (v Vec) Scale(k float64) Vec {
+	return Vec{X: v.X * k, Y: v.Y * k}
+}
+
+// Dot ...
+func (v Vec) Dot(u Vec) float64 {
+	return v.X*u.X + v.Y*u.Y
+}
+
+// Cross ...
+func (v Vec) Cross(u Vec) float64 {
+	return v.X*u.Y - v.Y*u.X
+}
+
+// Len ...
+func (v Vec) Len() float64 {
+	return math.Hypot(v.X, v.Y)
+}
+
+// Wall is a line segment from A to B
+type Wall struct {
+	A Vec
+	B Vec
+}
+
+// World ...
+type World struct {
+	Walls []Wall
+	// Ball is the object for self-tracking, nil means there isn't any ball
+	Ball *Vec
+}
+
+// NewRoom creates a world of a w*h room with the lower-left corner at (0, 0)
+func NewRoom(w, h float64) *World {
+	return &World{
+		Walls: []Wall{
+			{A: Vec{0, 0}, B: Vec{w, 0}},
+			{A: Vec{w, 0}, B: Vec{w, h}},
+			{A: Vec{w, h}, B: Vec{0, h}},
+			{A: Vec{0, h}, B: Vec{0, 0}},
+		},
+	}
+}
+
+// AddBox adds a box obstacle with the lower-left corner at (x, y)
+func (w *World) AddBox(x, y, width, height float64) {
+	w.Walls = append(w.Walls,
+		Wall{A: Vec{x, y}, B: Vec{x + width, y}},
+		Wall{A: Vec{x + width, y}, B: Vec{x + width, y + height}},
+		Wall{A: Vec{x + width, y + height}, B: Vec{x, y + height}},
+		Wall{A: Vec{x, y + height}, B: Vec{x, y}},
+	)
+}
+
+// Raycast returns the distance from p to the nearest wall along the direction in radian,
+// -1 will be returned if there isn't any wall in the range.
+func (w *World) Raycast(p Vec, dir, maxRange float64) float64 {
+	d := Vec{X: math.Cos(dir), Y: math.Sin(dir)}
+	min := -1.0
+	for _, wall := range w.Walls {
+		// p + t*d = A + s*(B-A)
+		e := wall.B.Sub(wall.A)
+		denom := d.Cross(e)
+		if math.Abs(denom) < 1e-12 {
+			continue
+		}
+		ap := wall.A.Sub(p)
+		t := ap.Cross(e) / denom
+		s := ap.Cross(d) / denom
+		if t < 0 || s < 0 || s > 1 || t > maxRange {
+			continue
+		}
+		if min < 0 || t < min {
+			min = t
+		}
+	}
+	return min
+}
+
+// Nearest returns the distance from p to the nearest wall, and the nearest point on the wall
+func (w *World) Nearest(p Vec) (float64, Vec) {
+	min := math.Inf(1)
+	var nearest Vec
+	for _, wall := range w.Walls {
+		q := closest(wall, p)
+		if d := p.Sub(q).Len(); d < min {
+			min = d
+			nearest = q
+		}
+	}
+	return min, nearest
+}
+
+// Visible tells whether the segment from p to q isn't blocked by any wall
+func (w *World) Visible(p, q Vec) bool {
+	v := q.Sub(p)
+	d := w.Raycast(p, math.Atan2(v.Y, v.X), v.Len())
+	return d < 0
+}
+
+// closest returns the closest point on the wall to p
+func closest(wall Wall, p Vec) Vec {
+	e := wall.B.Sub(wall.A)
+	l2 := e.Dot(e)
+	if l2 == 0 {
+		return wall.A
+	}
+	t := p.Sub(wall.A).Dot(e) / l2
+	t = math.Max(0, math.Min(1, t))
+	return wall.A.Add(e.Scale(t))
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/jakefau/rpi-devices/app/car/car"
+)
+
+const (
+	// the rates of telemetry in Hz
+	defaultTelemetryRate = 2.0
+	minTelemetryRate     = 0.2
+	maxTelemetryRate     = 20.0
+
+	wsWriteTimeout = 2 * time.Second
+)
+
+var upgrader = websocket.Upgrader{}
+
+// command is a message from the websocket client, e.g.
+// {"op": "forward"}, {"dest": "39.955980,116.444390", "op": "selfnavon"} or {"rate": 5}
+type command struct {
+	Op   string  `json:"op"`
+	Dest string  `json:"dest"`
+	Rate float64 `json:"rate"`
+}
+
+// wsHandler streams the telemetry of the car in json at the rate(Hz) in the query,
+// and accepts the commands from the client on the same socket.
+func (s *server) wsHandler(w http.ResponseWriter, r *http.Request) {
+	rate := defaultTelemetryRate
+	if v := r.URL.Query().Get("rate"); v != "" {
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			http.Error(w, "invalid rate", http.StatusBadRequest)
+			return
+		}
+		rate = f
+	}
+
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		log.Printf("[carapp]failed to upgrade to websocket, error: %v", err)
+		return
+	}
+	defer conn.Close()
+	log.Printf("[carapp]telemetry client %v connected", r.RemoteAddr)
+
+	chRate := make(chan float64, 1)
+	done := make(chan struct{})
+	go s.readCommands(conn, chRate, done)
+
+	ticker := time.NewTicker(telemetryInterval(rate))
+	defer func() {
+		ticker.Stop()
+	}()
+	for {
+		select {
+		case <-done:
+			log.Printf("[carapp]telemetry client %v disconnected", r.RemoteAddr)
+			return
+		case rate := <-chRate:
+			ticker.Stop()
+			ticker = time.NewTicker(telemetryInterval(rate))
+		case <-ticker.C:
+			conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+			if err := conn.WriteJSON(s.car.Telemetry()); err != nil {
+				log.Printf("[carapp]failed to send telemetry, error: %v", err)
+				return
+			}
+		}
+	}
+}
+
+func (s *server) readCommands(conn *websocket.Conn, chRate chan float64, done chan struct{}) {
+	defer close(done)
+	for {
+		var cmd command
+		if err := conn.ReadJSON(&cmd); err != nil {
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+				log.Printf("[carapp]failed to read command, error: %v", err)
+			}
+			return
+		}
+		if cmd.Dest != "" {
+			dest, err := parseDest(cmd.Dest)
+			if err != nil {
+				log.Printf("[carapp]invalid destination: %v", cmd.Dest)
+				continue
+			}
+			s.car.SetDest(dest)
+		}
+		if cmd.Op != "" {
+			s.car.Do(car.Op(cmd.Op))
+		}
+		if cmd.Rate > 0 {
+			select {
+			case chRate <- cmd.Rate:
+			default:
+				// a new rate is pending
+			}
+		}
+	}
+}
+
+func telemetryInterval(rate float64) time.Duration {
+	if rate < minTelemetryRate {
+		rate = minTelemetryRate
+	}
+	if rate > maxTelemetryRate {
+		rate = maxTelemetryRate
+	}
+	return time.Duration(float64(time.Second) / rate)
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/jakefau/rpi-devices/app/car/car"
+)
+
+const (
+	// wait for the car finishing the last decisions after the session
+	tailTime = 3 * time.Second
+)
+
+// replay a drive session recorded by the car, and diff the decisions of the replay with the recorded ones.
+// $ carreplay session-20201010-101010.jsonl
+// the replay is recorded to session-20201010-101010.jsonl.replay
+func main() {
+	if len(os.Args) != 2 {
+		fmt.Printf("usage: %v <session file>\n", os.Args[0])
+		os.Exit(1)
+	}
+	file := os.Args[1]
+	events, err := car.LoadSession(file)
+	if err != nil {
+		log.Printf("[carreplay]failed to load session, error: %v", err)
+		os.Exit(1)
+	}
+
+	rec, err := car.CreateRecorder(file + ".replay")
+	if err != nil {
+		log.Printf("[carreplay]failed to create recorder, error: %v", err)
+		os.Exit(1)
+	}
+
+	p := car.NewReplayer(events)
+	cfg := p.Config(&car.Config{})
+	cfg.Recorder = rec
+	c := car.New(cfg)
+	if err := c.Start(); err != nil {
+		log.Printf("[carreplay]failed to start the car, error: %v", err)
+		os.Exit(1)
+	}
+	p.Run(c)
+	time.Sleep(tailTime)
+	if err := rec.Close(); err != nil {
+		log.Printf("[carreplay]failed to close recorder, error: %v", err)
+		os.Exit(1)
+	}
+
+	replay, err := car.LoadSession(file + ".replay")
+	if err != nil {
+		log.Printf("[carreplay]failed to load the replay, error: %v", err)
+		os.Exit(1)
+	}
+	diffs := car.Diff(events, replay)
+	if len(diffs) == 0 {
+		fmt.Println("the replay made the same decisions")
+		return
+	}
+	fmt.Println("the replay diverged from the recorded session:")
+	for _, d := range diffs {
+		fmt.Println(d)
+	}
+}
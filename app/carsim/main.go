@@ -0,0 +1,67 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+
+	"github.com/jakefau/rpi-devices/app/car/car"
+	"github.com/jakefau/rpi-devices/app/car/sim"
+	"github.com/jakefau/rpi-devices/util"
+)
+
+// a car running in the simulator,
+// open http://localhost:8081 to watch it, and post ops like the real car, e.g.
+// $ curl -X POST -d "op=selfdrivingon" http://localhost:8081/op
+// $ curl -X POST -d "dest=12,12" http://localhost:8081/op
+// the car stops in 1.5s after a manual op like forward unless "op=heartbeat" is posted repeatedly.
+func main() {
+	s := sim.New(newWorld(), nil, sim.Vec{X: 1, Y: 1}, 0)
+	s.Start()
+
+	c := car.New(s.CarConfig())
+	if err := c.Start(); err != nil {
+		log.Printf("[carsim]failed to start the car, error: %v", err)
+		os.Exit(1)
+	}
+
+	util.WaitQuit(func() {
+		c.Stop()
+		s.Stop()
+	})
+
+	mux := http.NewServeMux()
+	mux.Handle("/", s.Handler())
+	mux.HandleFunc("/op", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if dest := r.FormValue("dest"); dest != "" {
+			var x, y float64
+			if n, err := fmt.Sscanf(dest, "%f,%f", &x, &y); err != nil || n != 2 {
+				http.Error(w, "invalid destination", http.StatusBadRequest)
+				return
+			}
+			c.SetDest(s.GeoPoint(sim.Vec{X: x, Y: y}))
+		}
+		if op := r.FormValue("op"); op != "" {
+			c.Do(car.Op(op))
+		}
+	})
+	log.Printf("[carsim]view the car at http://localhost:8081")
+	if err := http.ListenAndServe(":8081", mux); err != nil {
+		log.Printf("[carsim]failed to start http server, error: %v", err)
+		os.Exit(1)
+	}
+}
+
+// newWorld creates a 6m*6m room with two boxes and a ball
+func newWorld() *sim.World {
+	w := sim.NewRoom(6, 6)
+	w.AddBox(2, 2, 1, 0.5)
+	w.AddBox(4, 4, 0.5, 1)
+	w.Ball = &sim.Vec{X: 5, Y: 1}
+	return w
+}
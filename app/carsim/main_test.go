@@ -0,0 +1,13 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewWorld(t *testing.T) {
+	w := newWorld()
+	assert.NotNil(t, w)
+	assert.Equal(t, 12, len(w.Walls))
+}
@@ -19,6 +19,8 @@ import (
 	"github.com/jakefau/rpi-devices/dev"
 	"github.com/jakefau/rpi-devices/iot"
 	"github.com/jakefau/rpi-devices/util"
+	"github.com/jakefau/rpi-devices/util/sampler"
+	"github.com/jakefau/rpi-devices/util/schedule"
 	"github.com/stianeikeland/go-rpio"
 )
 
@@ -32,6 +34,17 @@ const (
 
 const (
 	alertCH2O = float64(0.08)
+
+	// ZE08-CH2O is on the uart shared with PMS7003 of sserver, they aren't read at the same time
+	devName       = "/dev/ttyAMA0"
+	sampleTimeout = 10 * time.Second
+	// it's sampled again in retryInterval if it failed
+	retryInterval = 5 * time.Second
+)
+
+var (
+	// the led display is turned off out of the schedule unless the ch2o is too high
+	displayHours = schedule.Daily("08:00", "20:00")
 )
 
 var bool2int = map[bool]int{
@@ -107,31 +120,40 @@ func (m *ch2oMonitor) setMode(mode util.Mode) {
 
 func (m *ch2oMonitor) detect() {
 	log.Printf("[ch2omonitor]detecting ch2o")
-	for {
-		var ch2o float64
-		var err error
-		if m.mode == util.PrdMode {
-			ch2o, err = m.sensor.Get()
-		} else {
-			ch2o, err = m.sensor.Mock()
-		}
-		if err != nil {
-			log.Printf("[ch2omonitor]failed to get ch2o, error: %v", err)
-			time.Sleep(5 * time.Second)
-			continue
-		}
-		log.Printf("[ch2omonitor]ch2o: %.4f mg/m3", ch2o)
-
-		m.chAlert <- ch2o
-		m.chCloud <- ch2o
-		m.chDisplay <- ch2o
+	read := m.sensor.Get
+	period := 60 * time.Second
+	if m.mode != util.PrdMode {
+		read = m.sensor.Mock
+		period = 15 * time.Second
+	}
+	s := sampler.New()
+	err := s.Add(&sampler.Sensor{
+		Name:    "ch2o",
+		Read:    func() (interface{}, error) { return read() },
+		Period:  period,
+		Timeout: sampleTimeout,
+		Retry:   retryInterval,
+		Bus:     devName,
+	})
+	if err != nil {
+		log.Printf("[ch2omonitor]failed to add the ch2o sensor, error: %v", err)
+		return
+	}
+	s.Subscribe(m.onReading)
+	s.Run(nil)
+}
 
-		sec := 60 * time.Second
-		if m.mode != util.PrdMode {
-			sec = 15 * time.Second
-		}
-		time.Sleep(sec)
+func (m *ch2oMonitor) onReading(r *sampler.Reading) {
+	if r.Err != nil {
+		log.Printf("[ch2omonitor]failed to get ch2o, error: %v", r.Err)
+		return
 	}
+	ch2o := r.Value.(float64)
+	log.Printf("[ch2omonitor]ch2o: %.4f mg/m3", ch2o)
+
+	m.chAlert <- ch2o
+	m.chCloud <- ch2o
+	m.chDisplay <- ch2o
 }
 
 func (m *ch2oMonitor) push() {
@@ -186,8 +208,7 @@ func (m *ch2oMonitor) display() {
 			continue
 		}
 
-		hour := time.Now().Hour()
-		if ch2o < alertCH2O && (hour >= 20 || hour < 8) {
+		if ch2o < alertCH2O && !displayHours.Active(time.Now()) {
 			// turn off oled at 20:00-08:00
 			if opened {
 				m.dsp.Close()
@@ -8,10 +8,15 @@ import (
 	"time"
 
 	"github.com/jakefau/rpi-devices/iot"
+	"github.com/jakefau/rpi-devices/util/sampler"
 )
 
 const (
 	cpuInterval = 5 * time.Minute
+	// it's sampled again in retryInterval if it failed
+	retryInterval = 30 * time.Second
+	// top takes about 6s
+	readTimeout = 30 * time.Second
 )
 
 func main() {
@@ -37,21 +42,32 @@ type cpuMonitor struct {
 // Start ...
 func (c *cpuMonitor) start() {
 	log.Printf("[cpumonitor]cpu monitor start working")
-	for {
-		f, err := c.idle()
-		if err != nil {
-			log.Printf("[cpumonitor]failed to get cpu idle, error: %v", err)
-			time.Sleep(30 * time.Second)
-			continue
-		}
+	s := sampler.New()
+	err := s.Add(&sampler.Sensor{
+		Name:    "cpu",
+		Read:    func() (interface{}, error) { return c.idle() },
+		Period:  cpuInterval,
+		Timeout: readTimeout,
+		Retry:   retryInterval,
+	})
+	if err != nil {
+		log.Printf("[cpumonitor]failed to add the cpu sensor, error: %v", err)
+		return
+	}
+	s.Subscribe(c.onReading)
+	s.Run(nil)
+}
 
-		v := &iot.Value{
-			Device: "cpu",
-			Value:  f,
-		}
-		go c.cloud.Push(v)
-		time.Sleep(cpuInterval)
+func (c *cpuMonitor) onReading(r *sampler.Reading) {
+	if r.Err != nil {
+		log.Printf("[cpumonitor]failed to get cpu idle, error: %v", r.Err)
+		return
+	}
+	v := &iot.Value{
+		Device: "cpu",
+		Value:  r.Value,
 	}
+	go c.cloud.Push(v)
 }
 
 // Idle is to get idle cpu in %
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/jakefau/rpi-devices/util/cv"
+)
+
+const (
+	// the max size of the image uploaded for enrollment
+	maxImageSize = 10 << 20
+	// the admin token in the source, it must be replaced before serving the admin api
+	placeholderToken = "your-admin-token"
+)
+
+// admin serves the api of managing the allowlist, the requests must have the header "Authorization: Bearer <token>",
+// or the query "token=<token>" for the browsers.
+//
+//	GET /members: the members
+//	POST /members: add or update the member in the json body
+//	GET /members/<id>: the member
+//	DELETE /members/<id>: remove the member and the faces of it
+//	POST /members/<id>/enroll: enroll the face in the image of the multipart form, or in a snapshot of the camera if no image
+type admin struct {
+	token     string
+	allowlist *allowlist
+	// enroller is nil if the recognizer doesn't support enrollment
+	enroller cv.Enroller
+	snapshot func() (string, error)
+}
+
+func newAdmin(token string, l *allowlist, face cv.Recognizer, snapshot func() (string, error)) *admin {
+	a := &admin{
+		token:     token,
+		allowlist: l,
+		snapshot:  snapshot,
+	}
+	if e, ok := face.(cv.Enroller); ok {
+		a.enroller = e
+	}
+	return a
+}
+
+func (a *admin) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !a.authorized(r) {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	path := strings.Trim(strings.TrimPrefix(r.URL.Path, "/members"), "/")
+	if path == "" {
+		switch r.Method {
+		case http.MethodGet:
+			writeJSON(w, a.allowlist.list())
+		case http.MethodPost:
+			a.upsert(w, r)
+		default:
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		}
+		return
+	}
+
+	parts := strings.Split(path, "/")
+	id := parts[0]
+	switch {
+	case len(parts) == 1 && r.Method == http.MethodGet:
+		m, err := a.allowlist.get(id)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		writeJSON(w, m)
+	case len(parts) == 1 && r.Method == http.MethodDelete:
+		a.remove(w, id)
+	case len(parts) == 2 && parts[1] == "enroll" && r.Method == http.MethodPost:
+		a.enroll(w, r, id)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// configured returns true if the token is set and isn't the placeholder
+func configured(token string) bool {
+	return token != "" && token != placeholderToken
+}
+
+// guard serves the request by h only if it's authorized by the token of the admin
+func (a *admin) guard(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !a.authorized(r) {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		h(w, r)
+	}
+}
+
+func (a *admin) authorized(r *http.Request) bool {
+	token := r.URL.Query().Get("token")
+	if auth := r.Header.Get("Authorization"); auth != "" {
+		token = strings.TrimPrefix(auth, "Bearer ")
+	}
+	return a.token != "" && subtle.ConstantTimeCompare([]byte(token), []byte(a.token)) == 1
+}
+
+func (a *admin) upsert(w http.ResponseWriter, r *http.Request) {
+	var m Member
+	if err := json.NewDecoder(r.Body).Decode(&m); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := a.allowlist.upsert(&m); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	log.Printf("[doordog]member %v updated", m.ID)
+	c, _ := a.allowlist.get(m.ID)
+	writeJSON(w, c)
+}
+
+func (a *admin) remove(w http.ResponseWriter, id string) {
+	m, err := a.allowlist.get(id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if a.enroller != nil && len(m.Faces) > 0 {
+		if err := a.enroller.Remove(id); err != nil {
+			log.Printf("[doordog]failed to remove the faces of %v, error: %v", id, err)
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+	}
+	if err := a.allowlist.remove(id); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	log.Printf("[doordog]member %v removed", id)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (a *admin) enroll(w http.ResponseWriter, r *http.Request, id string) {
+	if a.enroller == nil {
+		http.Error(w, "the recognizer doesn't support enrollment", http.StatusNotImplemented)
+		return
+	}
+	if _, err := a.allowlist.get(id); err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	data, err := a.image(w, r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	tmp, err := ioutil.TempFile("", "doordog-*.jpg")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer os.Remove(tmp.Name())
+	_, err = tmp.Write(data)
+	tmp.Close()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if err := a.enroller.Enroll(id, tmp.Name()); err != nil {
+		log.Printf("[doordog]failed to enroll the face of %v, error: %v", id, err)
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	if _, err := a.allowlist.addFace(id, data, time.Now()); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	log.Printf("[doordog]enrolled a face of %v", id)
+	m, _ := a.allowlist.get(id)
+	writeJSON(w, m)
+}
+
+// image returns the image uploaded in the field "image", or a snapshot of the camera if no image is uploaded
+func (a *admin) image(w http.ResponseWriter, r *http.Request) ([]byte, error) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxImageSize)
+	f, _, err := r.FormFile("image")
+	if err == nil {
+		defer f.Close()
+		return ioutil.ReadAll(f)
+	}
+	if err != http.ErrMissingFile && err != http.ErrNotMultipart {
+		return nil, err
+	}
+	img, err := a.snapshot()
+	if err != nil {
+		return nil, err
+	}
+	return ioutil.ReadFile(img)
+}
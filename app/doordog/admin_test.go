@@ -0,0 +1,203 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jakefau/rpi-devices/util/cv"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeFace struct {
+	enrolled map[string][]string
+}
+
+func (f *fakeFace) Recognize(img string) ([]*cv.Result, error) {
+	return nil, nil
+}
+
+func (f *fakeFace) Enroll(id string, img string) error {
+	data, err := ioutil.ReadFile(img)
+	if err != nil {
+		return err
+	}
+	f.enrolled[id] = append(f.enrolled[id], string(data))
+	return nil
+}
+
+func (f *fakeFace) Remove(id string) error {
+	delete(f.enrolled, id)
+	return nil
+}
+
+type plainFace struct{}
+
+func (plainFace) Recognize(img string) ([]*cv.Result, error) {
+	return nil, nil
+}
+
+func TestAdmin(t *testing.T) {
+	dir, err := ioutil.TempDir("", "doordog")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	snapshot := filepath.Join(dir, "snapshot.jpg")
+	assert.NoError(t, ioutil.WriteFile(snapshot, []byte("snapshot"), 0644))
+	upload := filepath.Join(dir, "upload.jpg")
+	assert.NoError(t, ioutil.WriteFile(upload, []byte("upload"), 0644))
+
+	l, err := newAllowlist(filepath.Join(dir, "log"))
+	assert.NoError(t, err)
+	face := &fakeFace{enrolled: map[string][]string{}}
+	adm := newAdmin("secret", l, face, func() (string, error) { return snapshot, nil })
+	srv := httptest.NewServer(adm)
+	defer srv.Close()
+
+	run := func(args ...string) (string, error) {
+		var out bytes.Buffer
+		err := runCLI(append(args, "-server", srv.URL, "-token", "secret"), &out)
+		return out.String(), err
+	}
+
+	// unauthorized
+	resp, err := http.Get(srv.URL + "/members")
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	var out bytes.Buffer
+	assert.Error(t, runCLI([]string{"members", "-server", srv.URL, "-token", "wrong"}, &out))
+
+	// add and update
+	s, err := run("add", "-id", "cleaner", "-name", "Cleaner", "-window", "tue 09:00-12:00", "-window", "fri 14:00-16:00")
+	assert.NoError(t, err)
+	assert.Equal(t, "cleaner\tCleaner\tthreshold: default\tfaces: 0\tallowed: tue 09:00-12:00; fri 14:00-16:00\n", s)
+	_, err = run("add", "-id", "p1", "-threshold", "0.7")
+	assert.NoError(t, err)
+	_, err = run("add", "-id", "p1", "-threshold", "2")
+	assert.Error(t, err)
+	_, err = run("add", "-id", "p1", "-window", "tue 9-12")
+	assert.Error(t, err)
+	_, err = run("add", "-name", "nobody")
+	assert.Error(t, err)
+
+	// update the given fields only
+	s, err = run("add", "-id", "p1", "-name", "P1")
+	assert.NoError(t, err)
+	assert.Equal(t, "p1\tP1\tthreshold: 0.70\tfaces: 0\tallowed: any time\n", s)
+	s, err = run("add", "-id", "cleaner", "-threshold", "0.6")
+	assert.NoError(t, err)
+	assert.Equal(t, "cleaner\tCleaner\tthreshold: 0.60\tfaces: 0\tallowed: tue 09:00-12:00; fri 14:00-16:00\n", s)
+	_, err = run("add", "-id", "cleaner", "-threshold", "0")
+	assert.NoError(t, err)
+
+	// enroll by an uploaded image and a snapshot
+	s, err = run("enroll", "-id", "cleaner", "-image", upload)
+	assert.NoError(t, err)
+	assert.True(t, strings.Contains(s, "faces: 1"))
+	_, err = run("enroll", "-id", "cleaner")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"upload", "snapshot"}, face.enrolled["cleaner"])
+	_, err = run("enroll", "-id", "p9")
+	assert.Error(t, err)
+
+	s, err = run("members")
+	assert.NoError(t, err)
+	assert.Equal(t, "cleaner\tCleaner\tthreshold: default\tfaces: 2\tallowed: tue 09:00-12:00; fri 14:00-16:00\n"+
+		"p1\tP1\tthreshold: 0.70\tfaces: 0\tallowed: any time\n", s)
+
+	// remove
+	s, err = run("remove", "-id", "cleaner")
+	assert.NoError(t, err)
+	assert.Equal(t, "removed cleaner\n", s)
+	assert.Equal(t, 0, len(face.enrolled))
+	_, err = run("remove", "-id", "cleaner")
+	assert.Error(t, err)
+	assert.Equal(t, 1, len(l.list()))
+
+	// the recognizer doesn't support enrollment
+	adm2 := newAdmin("secret", l, plainFace{}, nil)
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodPost, "/members/p1/enroll", nil)
+	r.Header.Set("Authorization", "Bearer secret")
+	adm2.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusNotImplemented, w.Code)
+
+	_, err = run("unknown")
+	assert.Error(t, err)
+}
+
+func TestConfigured(t *testing.T) {
+	assert.False(t, configured(""))
+	assert.False(t, configured(placeholderToken))
+	assert.True(t, configured("secret"))
+}
+
+func TestGuard(t *testing.T) {
+	adm := newAdmin("secret", nil, plainFace{}, nil)
+	h := adm.guard(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("photo"))
+	})
+
+	testCases := []struct {
+		desc   string
+		target string
+		auth   string
+		code   int
+	}{
+		{"no token", "/photos/a.jpg", "", http.StatusUnauthorized},
+		{"wrong token", "/photos/a.jpg", "Bearer wrong", http.StatusUnauthorized},
+		{"wrong token in query", "/photos/a.jpg?token=wrong", "", http.StatusUnauthorized},
+		{"token in header", "/photos/a.jpg", "Bearer secret", http.StatusOK},
+		{"token in query", "/photos/a.jpg?token=secret", "", http.StatusOK},
+		{"the header goes first", "/photos/a.jpg?token=secret", "Bearer wrong", http.StatusUnauthorized},
+	}
+	for _, test := range testCases {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, test.target, nil)
+		if test.auth != "" {
+			r.Header.Set("Authorization", test.auth)
+		}
+		h(w, r)
+		assert.Equal(t, test.code, w.Code, test.desc)
+	}
+
+	// no token configured
+	w := httptest.NewRecorder()
+	newAdmin("", nil, plainFace{}, nil).guard(nil)(w, httptest.NewRequest(http.MethodGet, "/events?token=", nil))
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
+
+func TestParseWindow(t *testing.T) {
+	testCases := []struct {
+		desc  string
+		s     string
+		days  []string
+		start string
+		end   string
+		err   bool
+	}{
+		{desc: "days", s: "Tue,thu 09:00-12:00", days: []string{"tue", "thu"}, start: "09:00", end: "12:00"},
+		{desc: "every day", s: "22:00-06:00", start: "22:00", end: "06:00"},
+		{desc: "bad day", s: "tues 09:00-12:00", err: true},
+		{desc: "bad time", s: "tue 9-12", err: true},
+		{desc: "no end", s: "tue 09:00", err: true},
+		{desc: "empty", s: "", err: true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			r, err := parseWindow(tc.s)
+			if tc.err {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.days, r.Days)
+			assert.Equal(t, tc.start, r.Start)
+			assert.Equal(t, tc.end, r.End)
+		})
+	}
+}
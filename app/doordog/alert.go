@@ -0,0 +1,317 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/jakefau/rpi-devices/util/notify"
+)
+
+// state is the state in the lifecycle of an alert, raised -> notified -> acknowledged -> resolved.
+// an alert can be resolved without being notified or acknowledged.
+type state string
+
+const (
+	raised       state = "raised"
+	notified     state = "notified"
+	acknowledged state = "acknowledged"
+	resolved     state = "resolved"
+)
+
+const (
+	alertsFile = "alerts.json"
+	eventsFile = "events.json"
+)
+
+var (
+	errNoAlert = errors.New("no alert to acknowledge")
+)
+
+// Event is a person seen at the door, Photo is the file name of the photo in the log directory.
+// Alert is the id of the alert raised by the event, it's 0 for the allowed persons.
+type Event struct {
+	Time  time.Time `json:"time"`
+	Who   string    `json:"who"`
+	Score float64   `json:"score"`
+	Photo string    `json:"photo"`
+	Alert int       `json:"alert"`
+}
+
+// Alert ...
+type Alert struct {
+	ID       int       `json:"id"`
+	State    state     `json:"state"`
+	Who      string    `json:"who"`
+	Photo    string    `json:"photo"`
+	Raised   time.Time `json:"raised"`
+	LastSeen time.Time `json:"last_seen"`
+	// Steps are the names of the escalation steps done
+	Steps   []string  `json:"steps"`
+	AckedBy string    `json:"acked_by"`
+	Acked   time.Time `json:"acked"`
+	Closed  time.Time `json:"resolved"`
+}
+
+// step is a step of escalation, the message is sent by the notifier if the alert isn't acknowledged after the duration.
+// the photo is attached if attach is true.
+type step struct {
+	name     string
+	after    time.Duration
+	notifier notify.Notifier
+	attach   bool
+}
+
+// alerts keeps the lifecycle of the alerts and the log of the events.
+// there is one alert going on at most, the persons seen during it are added to it,
+// and it's resolved if nobody is seen in quiet.
+type alerts struct {
+	dir   string
+	steps []*step
+	quiet time.Duration
+	// ackURL is sent in the messages for acknowledging remotely
+	ackURL string
+
+	mu     sync.Mutex
+	cur    *Alert
+	alerts []*Alert
+	events []*Event
+}
+
+func newAlerts(dir string, steps []*step, quiet time.Duration) (*alerts, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	as := &alerts{
+		dir:   dir,
+		steps: steps,
+		quiet: quiet,
+	}
+	if err := loadJSON(filepath.Join(dir, alertsFile), &as.alerts); err != nil {
+		return nil, err
+	}
+	if err := loadJSON(filepath.Join(dir, eventsFile), &as.events); err != nil {
+		return nil, err
+	}
+	// the alerts going on when exiting are resolved
+	for _, a := range as.alerts {
+		if a.State != resolved {
+			a.State = resolved
+			a.Closed = a.LastSeen
+		}
+	}
+	return as, nil
+}
+
+// see logs a person seen with the photo, and raises an alert if the person isn't allowed
+func (as *alerts) see(who string, score float64, photo string, allowed bool, now time.Time) *Event {
+	name, err := as.savePhoto(photo, now)
+	if err != nil {
+		log.Printf("[doordog]failed to save photo, error: %v", err)
+	}
+
+	as.mu.Lock()
+	defer as.mu.Unlock()
+	e := &Event{
+		Time:  now,
+		Who:   who,
+		Score: score,
+		Photo: name,
+	}
+	if !allowed {
+		if as.cur == nil {
+			as.cur = &Alert{
+				ID:     len(as.alerts) + 1,
+				State:  raised,
+				Who:    who,
+				Photo:  name,
+				Raised: now,
+				Steps:  []string{},
+			}
+			as.alerts = append(as.alerts, as.cur)
+			log.Printf("[doordog]alert %v raised, it is %v", as.cur.ID, who)
+		}
+		as.cur.LastSeen = now
+		e.Alert = as.cur.ID
+	}
+	as.events = append(as.events, e)
+	as.save()
+	return e
+}
+
+// keep keeps the alert going on, as the person is still there
+func (as *alerts) keep(now time.Time) {
+	as.mu.Lock()
+	defer as.mu.Unlock()
+	if as.cur != nil && now.After(as.cur.LastSeen) {
+		as.cur.LastSeen = now
+	}
+}
+
+// ack acknowledges the alert going on, the escalation stops
+func (as *alerts) ack(by string, now time.Time) error {
+	as.mu.Lock()
+	defer as.mu.Unlock()
+	a := as.cur
+	if a == nil || a.State == acknowledged {
+		return errNoAlert
+	}
+	a.State = acknowledged
+	a.AckedBy = by
+	a.Acked = now
+	as.save()
+	log.Printf("[doordog]alert %v acknowledged by %v", a.ID, by)
+	return nil
+}
+
+// tick escalates the alert going on, or resolves it if nobody is seen in quiet
+func (as *alerts) tick(now time.Time) {
+	as.mu.Lock()
+	defer as.mu.Unlock()
+	a := as.cur
+	if a == nil {
+		return
+	}
+	if now.Sub(a.LastSeen) >= as.quiet {
+		a.State = resolved
+		a.Closed = now
+		as.cur = nil
+		as.save()
+		log.Printf("[doordog]alert %v resolved", a.ID)
+		return
+	}
+	if a.State == acknowledged {
+		return
+	}
+	escalated := false
+	for _, s := range as.steps[len(a.Steps):] {
+		if now.Sub(a.Raised) < s.after {
+			break
+		}
+		a.Steps = append(a.Steps, s.name)
+		a.State = notified
+		escalated = true
+		go as.send(s, as.message(a, s))
+		log.Printf("[doordog]alert %v escalated: %v", a.ID, s.name)
+	}
+	if escalated {
+		as.save()
+	}
+}
+
+// beeping returns true if the buzzer should beep, it beeps until the alert is acknowledged or resolved
+func (as *alerts) beeping() bool {
+	as.mu.Lock()
+	defer as.mu.Unlock()
+	return as.cur != nil && as.cur.State != acknowledged
+}
+
+// list returns the alerts, the latest first
+func (as *alerts) list() []*Alert {
+	as.mu.Lock()
+	defer as.mu.Unlock()
+	list := []*Alert{}
+	for i := len(as.alerts) - 1; i >= 0; i-- {
+		c := *as.alerts[i]
+		list = append(list, &c)
+	}
+	return list
+}
+
+// eventsOf returns the events of the alert, or all of the events if id is 0, the latest first
+func (as *alerts) eventsOf(id int) []*Event {
+	as.mu.Lock()
+	defer as.mu.Unlock()
+	list := []*Event{}
+	for i := len(as.events) - 1; i >= 0; i-- {
+		if e := as.events[i]; id == 0 || e.Alert == id {
+			c := *e
+			list = append(list, &c)
+		}
+	}
+	return list
+}
+
+func (as *alerts) message(a *Alert, s *step) *notify.Message {
+	body := fmt.Sprintf("It is %v at the door at %v.", a.Who, a.Raised.Format("15:04:05"))
+	if as.ackURL != "" {
+		body += fmt.Sprintf(" Acknowledge it on %v.", as.ackURL)
+	}
+	m := &notify.Message{
+		Title:    fmt.Sprintf("Doordog alert %v: somebody entered your room", a.ID),
+		Body:     body,
+		Priority: notify.High,
+		Key:      fmt.Sprintf("alert-%v-%v", a.ID, s.name),
+	}
+	if s.attach && a.Photo != "" {
+		data, err := ioutil.ReadFile(filepath.Join(as.dir, a.Photo))
+		if err == nil {
+			m.Attachments = []*notify.Attachment{{Name: a.Photo, ContentType: "image/jpeg", Data: data}}
+		}
+	}
+	return m
+}
+
+func (as *alerts) send(s *step, m *notify.Message) {
+	if err := s.notifier.Notify(m); err != nil {
+		log.Printf("[doordog]failed to notify by %v, error: %v", s.name, err)
+	}
+}
+
+// savePhoto copies the photo to the log directory, and returns the file name
+func (as *alerts) savePhoto(photo string, now time.Time) (string, error) {
+	if photo == "" {
+		return "", nil
+	}
+	data, err := ioutil.ReadFile(photo)
+	if err != nil {
+		return "", err
+	}
+	name := now.Format("20060102-150405.000") + filepath.Ext(photo)
+	if err := ioutil.WriteFile(filepath.Join(as.dir, name), data, 0644); err != nil {
+		return "", err
+	}
+	return name, nil
+}
+
+// save saves the alerts and the events, it must be called with the lock
+func (as *alerts) save() {
+	if err := saveJSON(filepath.Join(as.dir, alertsFile), as.alerts); err != nil {
+		log.Printf("[doordog]failed to save alerts, error: %v", err)
+	}
+	if err := saveJSON(filepath.Join(as.dir, eventsFile), as.events); err != nil {
+		log.Printf("[doordog]failed to save events, error: %v", err)
+	}
+}
+
+func loadJSON(file string, v interface{}) error {
+	data, err := ioutil.ReadFile(file)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("failed to load %v, error: %v", file, err)
+	}
+	return nil
+}
+
+func saveJSON(file string, v interface{}) error {
+	data, err := json.MarshalIndent(v, "", "    ")
+	if err != nil {
+		return err
+	}
+	tmp := file + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, file)
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jakefau/rpi-devices/util/notify"
+	"github.com/stretchr/testify/assert"
+)
+
+type recorder struct {
+	mu       sync.Mutex
+	messages []*notify.Message
+}
+
+func (r *recorder) Notify(m *notify.Message) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.messages = append(r.messages, m)
+	return nil
+}
+
+func (r *recorder) sent() []*notify.Message {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]*notify.Message(nil), r.messages...)
+}
+
+func TestAlerts(t *testing.T) {
+	dir, err := ioutil.TempDir("", "doordog")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	photo := filepath.Join(dir, "cam.jpg")
+	assert.NoError(t, ioutil.WriteFile(photo, []byte("jpeg"), 0644))
+
+	push, email := &recorder{}, &recorder{}
+	steps := []*step{
+		{name: "push", after: 10 * time.Second, notifier: push},
+		{name: "email", after: 40 * time.Second, notifier: email, attach: true},
+	}
+	logDir := filepath.Join(dir, "log")
+	as, err := newAlerts(logDir, steps, time.Minute)
+	assert.NoError(t, err)
+	t0 := time.Date(2020, 1, 2, 3, 4, 5, 0, time.Local)
+
+	// an allowed person is logged only
+	as.see("p1", 0.9, photo, true, t0)
+	assert.False(t, as.beeping())
+	assert.Equal(t, 0, len(as.list()))
+
+	// raised
+	e := as.see("unknow", 0, photo, false, t0.Add(time.Second))
+	assert.Equal(t, 1, e.Alert)
+	assert.True(t, as.beeping())
+	data, err := ioutil.ReadFile(filepath.Join(logDir, e.Photo))
+	assert.NoError(t, err)
+	assert.Equal(t, "jpeg", string(data))
+	as.tick(t0.Add(5 * time.Second))
+	assert.Equal(t, raised, as.list()[0].State)
+
+	// escalated to push, and then to email with the photo
+	as.tick(t0.Add(12 * time.Second))
+	assert.Equal(t, notified, as.list()[0].State)
+	assert.Equal(t, []string{"push"}, as.list()[0].Steps)
+	as.see("p9", 0.8, photo, false, t0.Add(30*time.Second))
+	as.tick(t0.Add(45 * time.Second))
+	assert.Equal(t, []string{"push", "email"}, as.list()[0].Steps)
+	time.Sleep(10 * time.Millisecond)
+	assert.Equal(t, 1, len(push.sent()))
+	assert.Equal(t, 0, len(push.sent()[0].Attachments))
+	assert.Equal(t, 1, len(email.sent()))
+	assert.Equal(t, []byte("jpeg"), email.sent()[0].Attachments[0].Data)
+
+	// acknowledged
+	assert.NoError(t, as.ack("web", t0.Add(50*time.Second)))
+	assert.Equal(t, errNoAlert, as.ack("button", t0.Add(51*time.Second)))
+	assert.False(t, as.beeping())
+	a := as.list()[0]
+	assert.Equal(t, acknowledged, a.State)
+	assert.Equal(t, "web", a.AckedBy)
+
+	// resolved after nobody is seen in a minute since the last one
+	as.tick(t0.Add(80 * time.Second))
+	assert.Equal(t, acknowledged, as.list()[0].State)
+	as.tick(t0.Add(90 * time.Second))
+	assert.Equal(t, resolved, as.list()[0].State)
+	assert.Equal(t, errNoAlert, as.ack("button", t0.Add(91*time.Second)))
+
+	// a new alert, resolved without acknowledgement
+	as.see("unknow", 0, "", false, t0.Add(100*time.Second))
+	as.tick(t0.Add(115 * time.Second))
+	as.tick(t0.Add(200 * time.Second))
+	list := as.list()
+	assert.Equal(t, 2, len(list))
+	assert.Equal(t, 2, list[0].ID)
+	assert.Equal(t, resolved, list[0].State)
+	assert.Equal(t, []string{"push"}, list[0].Steps)
+
+	assert.Equal(t, 4, len(as.eventsOf(0)))
+	events := as.eventsOf(1)
+	assert.Equal(t, 2, len(events))
+	assert.Equal(t, "p9", events[0].Who)
+
+	// loaded from the log
+	as2, err := newAlerts(logDir, steps, time.Minute)
+	assert.NoError(t, err)
+	loaded := as2.list()
+	assert.Equal(t, 2, len(loaded))
+	for i, a := range loaded {
+		assert.Equal(t, list[i].ID, a.ID)
+		assert.Equal(t, list[i].State, a.State)
+		assert.Equal(t, list[i].Steps, a.Steps)
+		assert.True(t, list[i].Closed.Equal(a.Closed))
+	}
+	assert.Equal(t, 4, len(as2.eventsOf(0)))
+
+	// kept going on while the person is there
+	as.see("unknow", 0, "", false, t0.Add(300*time.Second))
+	as.keep(t0.Add(350 * time.Second))
+	as.tick(t0.Add(380 * time.Second))
+	assert.NotEqual(t, resolved, as.list()[0].State)
+	as.tick(t0.Add(410 * time.Second))
+	assert.Equal(t, resolved, as.list()[0].State)
+}
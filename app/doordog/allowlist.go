@@ -0,0 +1,199 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jakefau/rpi-devices/util/cv"
+	"github.com/jakefau/rpi-devices/util/schedule"
+)
+
+const (
+	allowlistFile = "allowlist.json"
+	facesDir      = "faces"
+)
+
+var (
+	errNoMember = errors.New("no such member")
+)
+
+// Member is a person in the allowlist, ID is the label of the person in the recognizer.
+// the person is recognized if the score isn't less than Threshold, minFaceScore is used if it's 0,
+// and the person is allowed in the Windows only, or at any time if there are no windows.
+type Member struct {
+	ID        string          `json:"id"`
+	Name      string          `json:"name"`
+	Threshold float64         `json:"threshold,omitempty"`
+	Windows   []schedule.Rule `json:"windows,omitempty"`
+	// Faces are the file names of the faces enrolled, they're kept in the faces directory
+	Faces []string `json:"faces,omitempty"`
+}
+
+// allowlist keeps the members in the file
+type allowlist struct {
+	dir string
+
+	mu      sync.Mutex
+	members map[string]*Member
+}
+
+func newAllowlist(dir string) (*allowlist, error) {
+	if err := os.MkdirAll(filepath.Join(dir, facesDir), 0755); err != nil {
+		return nil, err
+	}
+	var members []*Member
+	if err := loadJSON(filepath.Join(dir, allowlistFile), &members); err != nil {
+		return nil, err
+	}
+	l := &allowlist{
+		dir:     dir,
+		members: map[string]*Member{},
+	}
+	for _, m := range members {
+		l.members[m.ID] = m
+	}
+	return l, nil
+}
+
+// validate validates the member
+func (m *Member) validate() error {
+	if m.ID == "" || strings.ContainsAny(m.ID, "/\\") {
+		return fmt.Errorf("invalid id: %q", m.ID)
+	}
+	if m.Threshold < 0 || m.Threshold > 1 {
+		return fmt.Errorf("invalid threshold: %v", m.Threshold)
+	}
+	return (&schedule.Schedule{Rules: m.Windows}).Validate()
+}
+
+// threshold returns the min score of the member
+func (m *Member) threshold() float64 {
+	if m.Threshold > 0 {
+		return m.Threshold
+	}
+	return minFaceScore
+}
+
+// allowedAt returns true if the member is allowed at t
+func (m *Member) allowedAt(t time.Time) bool {
+	if len(m.Windows) == 0 {
+		return true
+	}
+	return (&schedule.Schedule{Rules: m.Windows}).Active(t)
+}
+
+// displayName returns the name of the member, or the id if it has no name
+func (m *Member) displayName() string {
+	if m.Name != "" {
+		return m.Name
+	}
+	return m.ID
+}
+
+// list returns the members sorted by id
+func (l *allowlist) list() []*Member {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	list := []*Member{}
+	for _, m := range l.members {
+		c := *m
+		list = append(list, &c)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+	return list
+}
+
+// get returns a copy of the member
+func (l *allowlist) get(id string) (*Member, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	m, ok := l.members[id]
+	if !ok {
+		return nil, errNoMember
+	}
+	c := *m
+	return &c, nil
+}
+
+// upsert adds the member or updates the name, the threshold and the windows of it, the faces are kept.
+func (l *allowlist) upsert(m *Member) error {
+	if err := m.validate(); err != nil {
+		return err
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	c := *m
+	c.Faces = nil
+	if old, ok := l.members[m.ID]; ok {
+		c.Faces = old.Faces
+	}
+	l.members[m.ID] = &c
+	return l.save()
+}
+
+// remove removes the member and the faces of it
+func (l *allowlist) remove(id string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	m, ok := l.members[id]
+	if !ok {
+		return errNoMember
+	}
+	for _, f := range m.Faces {
+		os.Remove(filepath.Join(l.dir, facesDir, f))
+	}
+	delete(l.members, id)
+	return l.save()
+}
+
+// addFace keeps the face enrolled for the member, and returns the file name of it
+func (l *allowlist) addFace(id string, data []byte, now time.Time) (string, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	m, ok := l.members[id]
+	if !ok {
+		return "", errNoMember
+	}
+	name := fmt.Sprintf("%v-%v.jpg", id, now.Format("20060102-150405.000"))
+	if err := ioutil.WriteFile(filepath.Join(l.dir, facesDir, name), data, 0644); err != nil {
+		return "", err
+	}
+	m.Faces = append(m.Faces, name)
+	return name, l.save()
+}
+
+// match finds the member in the results of recognition.
+// it returns the name of the member and whether the member is allowed at now,
+// or the label of the best result and false if no member is matched.
+func (l *allowlist) match(results []*cv.Result, now time.Time) (who string, score float64, allowed bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, r := range results {
+		m, ok := l.members[r.Label]
+		if !ok || r.Score < m.threshold() {
+			continue
+		}
+		return m.displayName(), r.Score, m.allowedAt(now)
+	}
+	if best := cv.Best(results, minFaceScore); best != nil {
+		return best.Label, best.Score, false
+	}
+	return "unknow", 0, false
+}
+
+// save saves the members, it must be called with the lock
+func (l *allowlist) save() error {
+	list := []*Member{}
+	for _, m := range l.members {
+		list = append(list, m)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+	return saveJSON(filepath.Join(l.dir, allowlistFile), list)
+}
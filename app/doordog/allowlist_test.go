@@ -0,0 +1,128 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/jakefau/rpi-devices/util/cv"
+	"github.com/jakefau/rpi-devices/util/schedule"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAllowlist(t *testing.T) {
+	dir, err := ioutil.TempDir("", "doordog")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	l, err := newAllowlist(dir)
+	assert.NoError(t, err)
+	assert.NoError(t, l.upsert(&Member{ID: "p1", Name: "Alice"}))
+	assert.NoError(t, l.upsert(&Member{
+		ID:        "cleaner",
+		Name:      "Cleaner",
+		Threshold: 0.8,
+		Windows:   []schedule.Rule{{Days: []string{"tue"}, Start: "09:00", End: "12:00"}},
+	}))
+	assert.Error(t, l.upsert(&Member{ID: ""}))
+	assert.Error(t, l.upsert(&Member{ID: "../p2"}))
+	assert.Error(t, l.upsert(&Member{ID: "p2", Threshold: 1.5}))
+	assert.Error(t, l.upsert(&Member{ID: "p2", Windows: []schedule.Rule{{Days: []string{"tues"}, Start: "09:00", End: "12:00"}}}))
+
+	// 2020-01-07 is a tuesday
+	tue10 := time.Date(2020, 1, 7, 10, 0, 0, 0, time.Local)
+	tue13 := time.Date(2020, 1, 7, 13, 0, 0, 0, time.Local)
+	testCases := []struct {
+		desc    string
+		results []*cv.Result
+		now     time.Time
+		who     string
+		allowed bool
+	}{
+		{
+			desc:    "member without windows",
+			results: []*cv.Result{{Label: "p1", Score: 0.6}},
+			now:     tue13,
+			who:     "Alice",
+			allowed: true,
+		},
+		{
+			desc:    "member in the window",
+			results: []*cv.Result{{Label: "cleaner", Score: 0.9}},
+			now:     tue10,
+			who:     "Cleaner",
+			allowed: true,
+		},
+		{
+			desc:    "member out of the window",
+			results: []*cv.Result{{Label: "cleaner", Score: 0.9}},
+			now:     tue13,
+			who:     "Cleaner",
+			allowed: false,
+		},
+		{
+			desc:    "below the threshold of the member",
+			results: []*cv.Result{{Label: "cleaner", Score: 0.7}},
+			now:     tue10,
+			who:     "cleaner",
+			allowed: false,
+		},
+		{
+			desc:    "below the default threshold",
+			results: []*cv.Result{{Label: "p1", Score: 0.4}},
+			now:     tue10,
+			who:     "unknow",
+			allowed: false,
+		},
+		{
+			desc:    "not a member",
+			results: []*cv.Result{{Label: "p9", Score: 0.9}},
+			now:     tue10,
+			who:     "p9",
+			allowed: false,
+		},
+		{
+			desc:    "a member in the results",
+			results: []*cv.Result{{Label: "p9", Score: 0.9}, {Label: "p1", Score: 0.6}},
+			now:     tue10,
+			who:     "Alice",
+			allowed: true,
+		},
+		{
+			desc:    "nobody",
+			results: nil,
+			now:     tue10,
+			who:     "unknow",
+			allowed: false,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			who, _, allowed := l.match(tc.results, tc.now)
+			assert.Equal(t, tc.who, who)
+			assert.Equal(t, tc.allowed, allowed)
+		})
+	}
+
+	// the faces are kept when updating, and removed with the member
+	face, err := l.addFace("p1", []byte("jpeg"), tue10)
+	assert.NoError(t, err)
+	_, err = l.addFace("p9", []byte("jpeg"), tue10)
+	assert.Equal(t, errNoMember, err)
+	assert.NoError(t, l.upsert(&Member{ID: "p1", Name: "Alice B"}))
+	m, err := l.get("p1")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{face}, m.Faces)
+
+	l2, err := newAllowlist(dir)
+	assert.NoError(t, err)
+	assert.Equal(t, l.list(), l2.list())
+
+	assert.NoError(t, l.remove("p1"))
+	assert.Equal(t, errNoMember, l.remove("p1"))
+	_, err = os.Stat(filepath.Join(dir, facesDir, face))
+	assert.True(t, os.IsNotExist(err))
+	assert.Equal(t, 1, len(l.list()))
+}
@@ -0,0 +1,270 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/jakefau/rpi-devices/util/schedule"
+)
+
+const usage = `usage: doordog [command] [flags]
+
+run the doordog without a command, or manage the allowlist of a running doordog by the commands:
+
+	members                  list the members
+	add -id <id> [-name <name>] [-threshold <score>] [-window "tue,thu 09:00-12:00"]...
+	                         add or update a member, it's allowed in the windows only if any are given,
+	                         the fields not given are kept if the member exists
+	remove -id <id>          remove a member and the faces of it
+	enroll -id <id> [-image <file>]
+	                         enroll the face in the image, or in a snapshot of the camera if no image
+
+the flags of all commands:
+
+	-server <url>            the doordog, default http://127.0.0.1:8080
+	-token <token>           the admin token
+`
+
+// windows is a flag of the windows, it can be given more than once
+type windows []schedule.Rule
+
+func (ws *windows) String() string {
+	var s []string
+	for _, w := range *ws {
+		span := w.Start + "-" + w.End
+		if len(w.Days) > 0 {
+			span = strings.Join(w.Days, ",") + " " + span
+		}
+		s = append(s, span)
+	}
+	return strings.Join(s, "; ")
+}
+
+func (ws *windows) Set(s string) error {
+	w, err := parseWindow(s)
+	if err != nil {
+		return err
+	}
+	*ws = append(*ws, w)
+	return nil
+}
+
+// parseWindow parses a window like "tue,thu 09:00-12:00", or "09:00-12:00" for every day
+func parseWindow(s string) (schedule.Rule, error) {
+	var r schedule.Rule
+	fields := strings.Fields(s)
+	if len(fields) == 0 || len(fields) > 2 {
+		return r, fmt.Errorf("invalid window: %q", s)
+	}
+	if len(fields) == 2 {
+		r.Days = strings.Split(strings.ToLower(fields[0]), ",")
+	}
+	span := strings.Split(fields[len(fields)-1], "-")
+	if len(span) != 2 {
+		return r, fmt.Errorf("invalid window: %q", s)
+	}
+	r.Start, r.End = span[0], span[1]
+	if err := (&schedule.Schedule{Rules: []schedule.Rule{r}}).Validate(); err != nil {
+		return r, fmt.Errorf("invalid window: %q, error: %v", s, err)
+	}
+	return r, nil
+}
+
+// statusError is the error status returned by the admin api
+type statusError struct {
+	code int
+	msg  string
+}
+
+func (e *statusError) Error() string {
+	return e.msg
+}
+
+// client calls the admin api of a running doordog
+type client struct {
+	server string
+	token  string
+}
+
+func (c *client) do(method, path, contentType string, body io.Reader, v interface{}) error {
+	req, err := http.NewRequest(method, c.server+path, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.token)
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		msg, _ := ioutil.ReadAll(resp.Body)
+		return &statusError{
+			code: resp.StatusCode,
+			msg:  fmt.Sprintf("%v: %v", resp.Status, strings.TrimSpace(string(msg))),
+		}
+	}
+	if v == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// runCLI runs the command in args, the results are written to out
+func runCLI(args []string, out io.Writer) error {
+	if len(args) == 0 {
+		return errors.New(usage)
+	}
+	cmd := args[0]
+	fs := flag.NewFlagSet(cmd, flag.ContinueOnError)
+	fs.SetOutput(ioutil.Discard)
+	c := &client{}
+	fs.StringVar(&c.server, "server", "http://127.0.0.1"+host, "")
+	fs.StringVar(&c.token, "token", adminToken, "")
+	var (
+		m     Member
+		ws    windows
+		image string
+	)
+	switch cmd {
+	case "members", "remove":
+	case "add":
+		fs.StringVar(&m.Name, "name", "", "")
+		fs.Float64Var(&m.Threshold, "threshold", 0, "")
+		fs.Var(&ws, "window", "")
+	case "enroll":
+		fs.StringVar(&image, "image", "", "")
+	default:
+		return fmt.Errorf("unknown command: %v\n\n%v", cmd, usage)
+	}
+	if cmd != "members" {
+		fs.StringVar(&m.ID, "id", "", "")
+	}
+	if err := fs.Parse(args[1:]); err != nil {
+		return fmt.Errorf("%v\n\n%v", err, usage)
+	}
+	if cmd != "members" && m.ID == "" {
+		return fmt.Errorf("-id is required\n\n%v", usage)
+	}
+	m.Windows = ws
+
+	switch cmd {
+	case "members":
+		var list []*Member
+		if err := c.do(http.MethodGet, "/members", "", nil, &list); err != nil {
+			return err
+		}
+		for _, m := range list {
+			printMember(out, m)
+		}
+	case "add":
+		if err := c.merge(fs, &m); err != nil {
+			return err
+		}
+		data, err := json.Marshal(&m)
+		if err != nil {
+			return err
+		}
+		var r Member
+		if err := c.do(http.MethodPost, "/members", "application/json", bytes.NewReader(data), &r); err != nil {
+			return err
+		}
+		printMember(out, &r)
+	case "remove":
+		if err := c.do(http.MethodDelete, "/members/"+url.PathEscape(m.ID), "", nil, nil); err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "removed %v\n", m.ID)
+	case "enroll":
+		var (
+			body        bytes.Buffer
+			contentType string
+		)
+		if image != "" {
+			data, err := ioutil.ReadFile(image)
+			if err != nil {
+				return err
+			}
+			mw := multipart.NewWriter(&body)
+			fw, err := mw.CreateFormFile("image", filepath.Base(image))
+			if err != nil {
+				return err
+			}
+			fw.Write(data)
+			mw.Close()
+			contentType = mw.FormDataContentType()
+		}
+		var r Member
+		if err := c.do(http.MethodPost, "/members/"+url.PathEscape(m.ID)+"/enroll", contentType, &body, &r); err != nil {
+			return err
+		}
+		printMember(out, &r)
+	}
+	return nil
+}
+
+// merge keeps the fields of the existing member which aren't given by the flags
+func (c *client) merge(fs *flag.FlagSet, m *Member) error {
+	var old Member
+	err := c.do(http.MethodGet, "/members/"+url.PathEscape(m.ID), "", nil, &old)
+	if se, ok := err.(*statusError); ok && se.code == http.StatusNotFound {
+		// a new member
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	given := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) {
+		given[f.Name] = true
+	})
+	if !given["name"] {
+		m.Name = old.Name
+	}
+	if !given["threshold"] {
+		m.Threshold = old.Threshold
+	}
+	if !given["window"] {
+		m.Windows = old.Windows
+	}
+	return nil
+}
+
+func printMember(out io.Writer, m *Member) {
+	threshold := "default"
+	if m.Threshold > 0 {
+		threshold = fmt.Sprintf("%.2f", m.Threshold)
+	}
+	ws := windows(m.Windows)
+	when := ws.String()
+	if when == "" {
+		when = "any time"
+	}
+	fmt.Fprintf(out, "%v\t%v\tthreshold: %v\tfaces: %v\tallowed: %v\n", m.ID, m.displayName(), threshold, len(m.Faces), when)
+}
+
+// cli runs the command in the args of the process if any, and returns false if there is no command
+func cli() bool {
+	if len(os.Args) < 2 {
+		return false
+	}
+	if err := runCLI(os.Args[1:], os.Stdout); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	return true
+}
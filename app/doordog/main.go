@@ -1,20 +1,38 @@
 /*
 Doordog helps you watch your doors.
 When somebody entries your room, you will be alerted by a beeping buzzer and a blinking led.
+The presence of a person is detected by fusing the ultrasonic distance meter, the infrared sensor,
+the voice detector and the shaking sensor on the door, and the face is recognized once a visit.
+If the alert isn't acknowledged by the button or on the web page, it's escalated to a push notification,
+and then an email with the photo.
+
+The persons in the allowlist don't raise alerts in their time windows, e.g. a cleaner allowed on Tue 09:00-12:00.
+The allowlist and the faces of the members are managed by the admin api, or by the commands of doordog, e.g.
+
+	doordog add -id cleaner -name "Cleaner" -threshold 0.7 -window "tue 09:00-12:00"
+	doordog enroll -id cleaner -image cleaner.jpg
+	doordog members
+	doordog remove -id cleaner
 */
 
 package main
 
 import (
+	"encoding/json"
+	"fmt"
+	"html"
 	"log"
 	"net/http"
 	"net/url"
+	"path/filepath"
+	"strconv"
 	"time"
 
 	"github.com/jakefau/rpi-devices/dev"
 	"github.com/jakefau/rpi-devices/util"
-	"github.com/shanghuiyang/face-recognizer/face"
-	"github.com/shanghuiyang/go-speech/oauth"
+	"github.com/jakefau/rpi-devices/util/cv"
+	"github.com/jakefau/rpi-devices/util/notify"
+	"github.com/jakefau/rpi-devices/util/presence"
 	"github.com/stianeikeland/go-rpio"
 )
 
@@ -24,33 +42,50 @@ const (
 	pinBtn  = 7
 	pinBzr  = 17
 	pinLed  = 23
+	pinIR   = 24
+	pinMic  = 25
+	pinSW   = 8
 
 	ifttAPI = "your-iftt-api"
+
+	smtpHost      = "smtp.xxx.com"
+	smtpPort      = 25
+	emailAddr     = "your-email@xxx.com"
+	emailPassword = "your-email-password"
+	notifyTo      = "youremail@xxx.com"
 )
 
 const (
-	// the time of keeping alert in second
+	// the time of keeping alert in second, the alert is resolved if nobody is seen in it
 	alertTime = 60
 	// the distance of triggering alert in cm
 	alertDist = 80
+	// the times of trying to recognize the face in a visit if it fails
+	maxTries = 3
+	// the alert is escalated to a push notification, and then an email with the photo if it isn't acknowledged
+	pushAfter  = 10 * time.Second
+	emailAfter = 40 * time.Second
 
 	groupID = "mygroup"
+	// the min score of a face recognized, it can be overridden by the threshold of a member
+	minFaceScore = 0.5
 
 	baiduFaceRecognitionAppKey    = "your_face_app_key"
 	baiduFaceRecognitionSecretKey = "your_face_secret_key"
-)
 
-var (
-	allowlist = []string{
-		"p1",
-		"p2",
-		"p3",
-		"p4",
-		"p5",
-	}
+	// the alerts and the events with the photos are logged in logDir, and served on host
+	logDir = "doordog"
+	host   = ":8080"
+
+	// the token of the admin api, the admin api and the web page are disabled until it's replaced
+	adminToken = placeholderToken
 )
 
 func main() {
+	if cli() {
+		return
+	}
+
 	if err := rpio.Open(); err != nil {
 		log.Fatalf("[doordog]failed to open rpio, error: %v", err)
 		return
@@ -66,11 +101,56 @@ func main() {
 		log.Printf("[doordog]failed to new a HCSR04")
 		return
 	}
+	// need to warm-up the ultrasonic distance meter first
+	dist.Dist()
+	time.Sleep(500 * time.Millisecond)
 
-	auth := oauth.New(baiduFaceRecognitionAppKey, baiduFaceRecognitionSecretKey, oauth.NewCacheMan())
-	f := face.New(auth)
+	cfg := presence.DefaultConfig()
+	cfg.Near = alertDist
+	ir := dev.NewInfrared(pinIR)
+	mic := dev.NewVoiceDetector(pinMic)
+	sw := dev.NewSW420(pinSW)
+	p := presence.New(dist, cfg,
+		&presence.Input{Name: "infrared", Sensor: ir, Weight: 0.4, Hold: 3 * time.Second},
+		&presence.Input{Name: "voice", Sensor: mic, Weight: 0.15, Hold: 2 * time.Second},
+		&presence.Input{Name: "door", Sensor: presence.SensorFunc(sw.Shaked), Weight: 0.3, Hold: 5 * time.Second},
+	)
+
+	f := cv.NewBaiduFace(baiduFaceRecognitionAppKey, baiduFaceRecognitionSecretKey, groupID)
+
+	// the ifttt webhook takes value1~value3
+	ifttt := notify.NewWebhook(ifttAPI)
+	ifttt.Format = func(m *notify.Message) ([]byte, error) {
+		return json.Marshal(map[string]string{
+			"value1": m.Title,
+			"value2": m.Body,
+		})
+	}
+	emailCfg := &util.EmailConfig{
+		SMTP:     smtpHost,
+		SMTPPort: smtpPort,
+		Address:  emailAddr,
+		Password: emailPassword,
+	}
+	steps := []*step{
+		{name: "push", after: pushAfter, notifier: ifttt},
+		{name: "email", after: emailAfter, notifier: notify.NewSMTP(emailCfg, notifyTo), attach: true},
+	}
+	as, err := newAlerts(logDir, steps, alertTime*time.Second)
+	if err != nil {
+		log.Printf("[doordog]failed to load the alerts, error: %v", err)
+		return
+	}
+	if ip := util.GetIP(); ip != "" {
+		as.ackURL = fmt.Sprintf("http://%v%v", ip, host)
+	}
+	l, err := newAllowlist(logDir)
+	if err != nil {
+		log.Printf("[doordog]failed to load the allowlist, error: %v", err)
+		return
+	}
 
-	dog := newDoordog(cam, dist, bzr, led, btn, f)
+	dog := newDoordog(cam, p, bzr, led, btn, f, as, l)
 	util.WaitQuit(func() {
 		dog.stop()
 		rpio.Close()
@@ -79,26 +159,26 @@ func main() {
 }
 
 type doordog struct {
-	cam      *dev.Camera
-	dist     *dev.HCSR04
-	buzzer   *dev.Buzzer
-	led      *dev.Led
-	button   *dev.Button
-	face     *face.Face
-	alerting bool
-	chAlert  chan bool
+	cam       *dev.Camera
+	presence  *presence.Detector
+	buzzer    *dev.Buzzer
+	led       *dev.Led
+	button    *dev.Button
+	face      cv.Recognizer
+	alerts    *alerts
+	allowlist *allowlist
 }
 
-func newDoordog(cam *dev.Camera, dist *dev.HCSR04, buzzer *dev.Buzzer, led *dev.Led, btn *dev.Button, face *face.Face) *doordog {
+func newDoordog(cam *dev.Camera, p *presence.Detector, buzzer *dev.Buzzer, led *dev.Led, btn *dev.Button, face cv.Recognizer, as *alerts, l *allowlist) *doordog {
 	return &doordog{
-		cam:      cam,
-		dist:     dist,
-		buzzer:   buzzer,
-		led:      led,
-		button:   btn,
-		face:     face,
-		alerting: false,
-		chAlert:  make(chan bool, 4),
+		cam:       cam,
+		presence:  p,
+		buzzer:    buzzer,
+		led:       led,
+		button:    btn,
+		face:      face,
+		alerts:    as,
+		allowlist: l,
 	}
 }
 
@@ -106,71 +186,54 @@ func (d *doordog) start() {
 	log.Printf("[doordog]start to service")
 	go d.alert()
 	go d.stopAlert()
-	d.detect()
-
+	go d.serve()
+	d.presence.Run(nil, d.onPresence)
 }
 
-func (d *doordog) detect() {
-	// need to warm-up the ultrasonic distance meter first
-	d.dist.Dist()
-	time.Sleep(500 * time.Millisecond)
+func (d *doordog) onPresence(e *presence.Event) {
+	log.Printf("[doordog]%v, visit: %v, confidence: %.2f, distance: %.2fcm, by: %v", e.Kind, e.Visit, e.Confidence, e.Dist, e.Sources)
+	if e.Kind == presence.Enter {
+		go d.visit()
+	}
+}
 
-	t := 300 * time.Millisecond
-	for {
-		time.Sleep(t)
-		dist := d.dist.Dist()
-		if dist < 10 {
-			log.Printf("[doordog]bad data from distant meter, distance = %.2fcm", dist)
-			continue
+// visit recognizes the face once a visit, it tries again if it fails while the person is still there,
+// and the person is taken as unknow if it fails at last.
+func (d *doordog) visit() {
+	for i := 0; i < maxTries; i++ {
+		now := time.Now()
+		who, score, allowed, photo, err := d.RecoginzeFace(now)
+		if err == nil {
+			log.Printf("[doordog]it is %v, allowed: %v", who, allowed)
+			d.alerts.see(who, score, photo, allowed, now)
+			return
 		}
-
-		detected := (dist < alertDist)
-		if detected {
-			log.Printf("[doordog]detected objects, distance = %.2fcm", dist)
-			who, err := d.RecoginzeFace()
-			if err != nil {
-				continue
-			}
-
-			log.Printf("[doordog]it is %v", who)
-			if allowed(who) {
-				continue
-			}
-
-			d.chAlert <- detected
-			continue
+		if !d.presence.Status().Present {
+			break
 		}
+		time.Sleep(1 * time.Second)
 	}
+	d.alerts.see("unknow", 0, "", false, time.Now())
 }
 
+// alert escalates the alerts, and beeps until the alert is acknowledged or resolved.
+// the alert keeps going on while the person is there.
 func (d *doordog) alert() {
-	trigTime := time.Now()
-	go func() {
-		for {
-			if d.alerting {
-				go d.buzzer.Beep(1, 200)
-				go d.led.Blink(1, 200)
-			}
-			time.Sleep(1 * time.Second)
-		}
-	}()
-
-	for detected := range d.chAlert {
-		if detected {
-			go ifttt()
-			d.alerting = true
-			trigTime = time.Now()
-			continue
+	for {
+		if d.presence.Status().Present {
+			d.alerts.keep(time.Now())
 		}
-		timeout := time.Now().Sub(trigTime).Seconds() > alertTime
-		if timeout && d.alerting {
-			log.Printf("[doordog]timeout, stop alert")
-			d.alerting = false
+		d.alerts.tick(time.Now())
+		if d.alerts.beeping() {
+			go d.buzzer.Beep(1, 200)
+			go d.led.Blink(1, 200)
 		}
+		time.Sleep(1 * time.Second)
 	}
 }
 
-func (d *doordog) RecoginzeFace() (name string, err error) {
+// RecoginzeFace takes a photo, recognizes the face in it, and checks if the person is allowed at now
+func (d *doordog) RecoginzeFace(now time.Time) (name string, score float64, allowed bool, photo string, err error) {
 	imgf, e := d.cam.TakePhoto()
 	if e != nil {
 		log.Printf("[doordog]failed to take phote, error: %v", e)
@@ -178,25 +241,16 @@ func (d *doordog) RecoginzeFace() (name string, err error) {
 		return
 	}
 
-	users, e := d.face.Recognize(imgf, groupID)
+	results, e := d.face.Recognize(imgf)
 	if e != nil {
 		log.Printf("[doordog]failed to recognize the image, error: %v", e)
 		name, err = "unknow", e
 		return
 	}
 
-	if len(users) == 0 {
-		name, err = "unknow", nil
-		return
-	}
-
-	log.Printf("who: %v", *(users[0]))
-	if users[0].Score > 50 {
-		return users[0].UserID, nil
-	}
-
-	name, err = "unknow", nil
-	return
+	name, score, allowed = d.allowlist.match(results, now)
+	log.Printf("who: %v, score: %.2f", name, score)
+	return name, score, allowed, imgf, nil
 }
 
 func (d *doordog) stopAlert() {
@@ -204,9 +258,7 @@ func (d *doordog) stopAlert() {
 		pressed := d.button.Pressed()
 		if pressed {
 			log.Printf("[doordog]the button was pressed")
-			if d.alerting {
-				d.alerting = false
-			}
+			d.alerts.ack("button", time.Now())
 			// make a dalay detecting
 			time.Sleep(1 * time.Second)
 			continue
@@ -215,25 +267,99 @@ func (d *doordog) stopAlert() {
 	}
 }
 
-func ifttt() {
-	resp, err := http.PostForm(ifttAPI, url.Values{})
-	if err != nil {
-		log.Printf("failed to request to ifttt, error: %v", err)
+// serve serves the web page of the alerts:
+//
+//	/: the page of the alerts
+//	/alerts: the alerts in json
+//	/events?alert=<id>: the persons seen in json, of the alert if the id is given
+//	/ack: POST to acknowledge the alert going on
+//	/presence: the state of the presence detection in json
+//	/photos/<file>: the photos
+//	/members: the admin api of the allowlist, see admin
+//
+// all of them need the admin token, open the page by /?token=<token> in the browsers.
+func (d *doordog) serve() {
+	token := adminToken
+	if !configured(token) {
+		log.Printf("[doordog]the admin token isn't configured, the admin api and the web page are disabled")
+		token = ""
+	}
+	adm := newAdmin(token, d.allowlist, d.face, d.cam.TakePhoto)
+	if token != "" {
+		http.Handle("/members", adm)
+		http.Handle("/members/", adm)
+	}
+	http.HandleFunc("/", adm.guard(d.pageHandler))
+	http.HandleFunc("/alerts", adm.guard(func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, d.alerts.list())
+	}))
+	http.HandleFunc("/events", adm.guard(func(w http.ResponseWriter, r *http.Request) {
+		id, _ := strconv.Atoi(r.FormValue("alert"))
+		writeJSON(w, d.alerts.eventsOf(id))
+	}))
+	http.HandleFunc("/ack", adm.guard(d.ackHandler))
+	http.HandleFunc("/presence", adm.guard(func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, d.presence.Status())
+	}))
+	http.HandleFunc("/photos/", adm.guard(func(w http.ResponseWriter, r *http.Request) {
+		name := filepath.Base(r.URL.Path)
+		if filepath.Ext(name) == ".json" {
+			http.NotFound(w, r)
+			return
+		}
+		http.ServeFile(w, r, filepath.Join(logDir, name))
+	}))
+	if err := http.ListenAndServe(host, nil); err != nil {
+		log.Printf("[doordog]failed to listen and serve, error: %v", err)
+	}
+}
+
+func (d *doordog) ackHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
-	defer resp.Body.Close()
+	by := r.FormValue("by")
+	if by == "" {
+		by = "web"
+	}
+	if err := d.alerts.ack(by, time.Now()); err != nil {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	http.Redirect(w, r, "/"+tokenQuery(r), http.StatusSeeOther)
 }
 
-func (d *doordog) stop() {
-	d.buzzer.Off()
-	d.led.Off()
+func (d *doordog) pageHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	fmt.Fprintf(w, "<!DOCTYPE html><html><head><meta charset=\"utf-8\"><title>Doordog</title></head><body>")
+	// the links carry the token which the page is opened by
+	q := html.EscapeString(tokenQuery(r))
+	fmt.Fprintf(w, "<form method=\"POST\" action=\"/ack%v\"><button>Acknowledge</button></form><table>", q)
+	for _, a := range d.alerts.list() {
+		fmt.Fprintf(w, "<tr><td>%v</td><td>%v</td><td>%v</td><td>%v</td><td>%v</td><td><img src=\"/photos/%v%v\" width=\"160\"></td></tr>",
+			a.ID, a.Raised.Format("2006-01-02 15:04:05"), a.State, html.EscapeString(a.Who), html.EscapeString(a.AckedBy), url.PathEscape(a.Photo), q)
+	}
+	fmt.Fprintf(w, "</table></body></html>")
 }
 
-func allowed(user string) bool {
-	for _, u := range allowlist {
-		if u == user {
-			return true
-		}
+// tokenQuery returns the query of the token in the request, e.g. "?token=xxx", or "" if there is no token in the query
+func tokenQuery(r *http.Request) string {
+	token := r.URL.Query().Get("token")
+	if token == "" {
+		return ""
 	}
-	return false
+	return "?" + url.Values{"token": {token}}.Encode()
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("[doordog]failed to write response, error: %v", err)
+	}
+}
+
+func (d *doordog) stop() {
+	d.buzzer.Off()
+	d.led.Off()
 }
@@ -1,16 +1,15 @@
 package main
 
 import (
-	"encoding/json"
 	"fmt"
-	"io/ioutil"
 	"log"
-	"net/http"
 	"time"
 
 	"github.com/jakefau/rpi-devices/dev"
 	"github.com/jakefau/rpi-devices/iot"
 	"github.com/jakefau/rpi-devices/util"
+	"github.com/jakefau/rpi-devices/util/schedule"
+	"github.com/jakefau/rpi-devices/util/sensors"
 	"github.com/stianeikeland/go-rpio"
 )
 
@@ -18,6 +17,14 @@ const (
 	dioPin  = 9
 	rclkPin = 10
 	sclkPin = 11
+
+	// the sensor server providing the temperature and pm2.5
+	sserver = "http://localhost:8000"
+)
+
+var (
+	// the led display is turned off out of the schedule
+	displayHours = schedule.Daily("08:00", "20:00")
 )
 
 type data struct {
@@ -26,19 +33,10 @@ type data struct {
 	value interface{}
 }
 
-type tempResponse struct {
-	Temp     float32 `json:"temp"`
-	ErrorMsg string  `json:"error_msg"`
-}
-
-type pm25Response struct {
-	PM25     uint16 `json:"pm25"`
-	ErrorMsg string `json:"error_msg"`
-}
-
 type homeAsst struct {
 	dsp       *dev.LedDisplay
 	cloud     iot.Cloud
+	sensors   *sensors.Client
 	chDisplay chan *data // for disploying on oled
 	chCloud   chan *data // for pushing to iot cloud
 	// chAlert   chan *data // for alerting
@@ -71,6 +69,7 @@ func newHomeAsst(dsp *dev.LedDisplay, cloud iot.Cloud) *homeAsst {
 	return &homeAsst{
 		dsp:       dsp,
 		cloud:     cloud,
+		sensors:   sensors.NewClient(sserver),
 		chDisplay: make(chan *data, 4),
 		chCloud:   make(chan *data, 4),
 		// chAlert:   make(chan *value, 4),
@@ -84,46 +83,38 @@ func (h *homeAsst) start() {
 	h.getData()
 }
 
+// getData watches the temperature and pm2.5 pushed by the sensor server
 func (h *homeAsst) getData() {
-	for {
-		go func() {
-			t, err := h.getTemp()
-			if err != nil {
-				log.Printf("[homeasst]failed to get temperature, error: %v", err)
-				time.Sleep(5 * time.Second)
-				return
-			}
+	h.sensors.Watch(nil, func(e *sensors.Event) {
+		if e.Error != "" {
+			log.Printf("[homeasst]failed to get %v, error: %v", e.Sensor, e.Error)
+			return
+		}
+		var d *data
+		switch e.Sensor {
+		case "temp":
+			t := float32(e.Value)
 			log.Printf("[homeasst]temp: %v", t)
-			d := &data{
+			d = &data{
 				name:  "temp",
 				text:  fmt.Sprintf("%.1f", t),
 				value: t,
 			}
-			h.chDisplay <- d
-			h.chCloud <- d
-		}()
-
-		go func() {
-			pm25, err := h.getPM25()
-			if err != nil {
-				log.Printf("[homeasst]failed to get pm2.5, error: %v", err)
-				time.Sleep(5 * time.Second)
-				return
-			}
+		case "pm25":
+			pm25 := uint16(e.Value)
 			log.Printf("[homeasst]pm2.5: %v", pm25)
-
-			d := &data{
+			d = &data{
 				name:  "pm2.5",
 				text:  fmt.Sprintf("%v", pm25),
 				value: pm25,
 			}
-			h.chDisplay <- d
-			h.chCloud <- d
-			// h.chAlert <- v
-		}()
-
-		time.Sleep(60 * time.Second)
-	}
+		default:
+			return
+		}
+		h.chDisplay <- d
+		h.chCloud <- d
+		// h.chAlert <- v
+	}, "temp", "pm25")
 }
 
 func (h *homeAsst) display() {
@@ -143,8 +134,7 @@ func (h *homeAsst) display() {
 			continue
 		}
 
-		hour := time.Now().Hour()
-		if hour >= 20 || hour < 8 {
+		if !displayHours.Active(time.Now()) {
 			// turn off led display at 20:00-08:00
 			if opened {
 				h.dsp.Close()
@@ -202,51 +192,3 @@ func (h *homeAsst) push() {
 func (h *homeAsst) stop() {
 	h.dsp.Close()
 }
-
-func (h *homeAsst) getTemp() (float32, error) {
-	resp, err := http.Get("http://localhost:8000/temp")
-	if err != nil {
-		return 0, fmt.Errorf("failed to get temp from sensers server, status: %v, err: %v", resp.Status, err)
-	}
-	defer resp.Body.Close()
-
-	body, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		return 0, fmt.Errorf("failed to read resp body, err: %v", err)
-	}
-
-	var tempResp tempResponse
-	if err := json.Unmarshal(body, &tempResp); err != nil {
-		return 0, fmt.Errorf("failed to unmarshal resp, err: %v", err)
-	}
-
-	if tempResp.ErrorMsg != "" {
-		return 0, fmt.Errorf("failed to get temp from sensers server, status: %v, err msg: %v", resp.Status, tempResp.ErrorMsg)
-	}
-
-	return tempResp.Temp, nil
-}
-
-func (h *homeAsst) getPM25() (uint16, error) {
-	resp, err := http.Get("http://localhost:8000/pm25")
-	if err != nil {
-		return 0, fmt.Errorf("failed to get pm2.5 from sensers server, status: %v, err: %v", resp.Status, err)
-	}
-	defer resp.Body.Close()
-
-	body, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		return 0, fmt.Errorf("failed to read resp body, err: %v", err)
-	}
-
-	var pm25Resp pm25Response
-	if err := json.Unmarshal(body, &pm25Resp); err != nil {
-		return 0, fmt.Errorf("failed to unmarshal resp, err: %v", err)
-	}
-
-	if pm25Resp.ErrorMsg != "" {
-		return 0, fmt.Errorf("failed to get pm2.5 from sensers server, status: %v, err msg: %v", resp.Status, pm25Resp.ErrorMsg)
-	}
-
-	return pm25Resp.PM25, nil
-}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"errors"
 	"io/ioutil"
 	"log"
 	"os"
@@ -8,9 +9,9 @@ import (
 
 	"github.com/jakefau/rpi-devices/dev"
 	"github.com/jakefau/rpi-devices/util"
+	"github.com/jakefau/rpi-devices/util/cv"
 	"github.com/shanghuiyang/go-speech/oauth"
 	"github.com/shanghuiyang/go-speech/speech"
-	"github.com/shanghuiyang/image-recognizer/recognizer"
 )
 
 const (
@@ -24,22 +25,27 @@ const (
 
 	baiduImgRecognitionAppKey    = "your_image_recognition_app_key"
 	baiduImgRecognitionSecretKey = "your_image_recognition_secrect_key"
+
+	// recognize objects offline by the model in dnnModel if it exists, it needs to build with -tags=gocv.
+	// the labels of the model are in dnnLabels, one label per line.
+	dnnModel  = "model.onnx"
+	dnnLabels = "labels.txt"
+	minScore  = 0.3
 )
 
 var (
 	asr  *speech.ASR
 	tts  *speech.TTS
-	imgr *recognizer.Recognizer
+	imgr cv.Recognizer
 	cam  *dev.Camera
 )
 
 func main() {
 
 	speechAuth := oauth.New(baiduSpeechAppKey, baiduSpeechSecretKey, oauth.NewCacheMan())
-	imageAuth := oauth.New(baiduImgRecognitionAppKey, baiduImgRecognitionSecretKey, oauth.NewCacheMan())
 	asr = speech.NewASR(speechAuth)
 	tts = speech.NewTTS(speechAuth)
-	imgr = recognizer.New(imageAuth)
+	imgr = newRecognizer()
 	cam = dev.NewCamera()
 
 	for {
@@ -75,12 +81,27 @@ func main() {
 	}
 }
 
+func newRecognizer() cv.Recognizer {
+	if _, err := os.Stat(dnnModel); err == nil {
+		dnn, err := cv.NewDNN(dnnModel, "", dnnLabels)
+		if err == nil {
+			return dnn
+		}
+		log.Printf("[imgr]failed to load the model, will use baidu image recognition, error: %v", err)
+	}
+	return cv.NewBaiduObject(baiduImgRecognitionAppKey, baiduImgRecognitionSecretKey)
+}
+
 func recognize(image string) (string, error) {
-	name, err := imgr.Recognize(image)
+	results, err := imgr.Recognize(image)
 	if err != nil {
 		return "", err
 	}
-	return name, nil
+	best := cv.Best(results, minScore)
+	if best == nil {
+		return "", errors.New("nothing recognized")
+	}
+	return best.Label, nil
 }
 
 func tospeech(text string) (string, error) {
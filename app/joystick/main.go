@@ -8,6 +8,7 @@ import (
 
 	"github.com/jakefau/rpi-devices/dev"
 	"github.com/jakefau/rpi-devices/util"
+	"github.com/jakefau/rpi-devices/util/radio"
 	"github.com/stianeikeland/go-rpio"
 )
 
@@ -20,6 +21,9 @@ const (
 	homeX   = 2.43
 	homeY   = 2.56
 	homeBuf = 0.15
+
+	sendInterval      = 50 * time.Millisecond
+	heartbeatInterval = 200 * time.Millisecond
 )
 
 func main() {
@@ -48,76 +52,78 @@ func main() {
 
 	l.Wakeup()
 
-	var curOp, curSpeed byte
+	link := radio.NewLink(l)
+	var (
+		cur     radio.Control
+		pressed bool
+		sent    time.Time
+	)
 	for {
-		time.Sleep(200 * time.Millisecond)
-		op, speed, err := getOpAndSpeed(j)
+		time.Sleep(sendInterval)
+		ctl, err := getControl(j)
 		if err != nil {
 			continue
 		}
-		if op == curOp && speed == curSpeed {
+
+		// the button is sent only when it is pressed, and must be acknowledged
+		btn := ctl.Button
+		ctl.Button = btn && !pressed
+		pressed = btn
+		if ctl.Button {
+			log.Printf("button pressed")
+			if err := link.SendControl(ctl, true); err != nil {
+				log.Printf("failed to send button, error: %v", err)
+			}
+			sent = time.Now()
 			continue
 		}
-		data := (op << 4) | speed
-		log.Printf("op: %v, speed: %v, data: %v", op, speed, data)
 
-		if err := l.Send([]byte{data}); err != nil {
-			log.Printf("lc12s failed to send data, error: %v", err)
+		if *ctl == cur {
+			if time.Since(sent) >= heartbeatInterval {
+				if err := link.Heartbeat(); err != nil {
+					log.Printf("failed to send heartbeat, error: %v", err)
+				}
+				sent = time.Now()
+			}
 			continue
 		}
-		curOp, curSpeed = op, speed
+		log.Printf("x: %v, y: %v", ctl.X, ctl.Y)
+		if err := link.SendControl(ctl, false); err != nil {
+			log.Printf("failed to send control, error: %v", err)
+			continue
+		}
+		cur, sent = *ctl, time.Now()
 	}
 }
 
-func getOpAndSpeed(j *dev.Joystick) (op, speed byte, err error) {
-	op, speed = 0, 0
-	err = nil
-
+// getControl maps the voltages of the joystick to a control,
+// pushing the stick away from you is forward, and pushing it to the right is right.
+func getControl(j *dev.Joystick) (*radio.Control, error) {
 	x := j.X()
 	y := j.Y()
 	z := j.Z()
-	// log.Printf("x: %.2f, y: %.2f, z: %v", x, y, z)
-
-	if z == 1 {
-		op = 5 // self-driving
-		speed = 0
-		return
-	}
 
 	dx := x - homeX
 	dy := y - homeY
-
-	absdx, absdy := math.Abs(dx), math.Abs(dy)
-	// log.Printf("x: %.2f, y: %.2f, z: %v, dx: %.2f, dy: %.2f", x, y, z, absdx, absdy)
-	// return
-
-	if absdx < homeBuf && absdy < homeBuf {
-		// home
-		return
-	}
-
-	if absdx > 1 && absdy > 1 {
+	if math.Abs(dx) > homeX+homeBuf || math.Abs(dy) > homeY+homeBuf {
 		// invalid data
-		log.Printf("invalid data, absdx: %v, absdy: %v", absdx, absdy)
-		err = errors.New("invalid data")
-		return
+		log.Printf("invalid data, dx: %.2f, dy: %.2f", dx, dy)
+		return nil, errors.New("invalid data")
 	}
 
-	speed = 3
-	if absdx > absdy {
-		op = 1 // forward
-		if dx > 0 {
-			op = 2 // backward
-		}
-		if absdx > 2.40 {
-			speed = 4
-		}
-		return
-	}
+	return &radio.Control{
+		X:      scale(-dx, homeX),
+		Y:      scale(-dy, homeY),
+		Button: z == 1,
+	}, nil
+}
 
-	op = 4 // right
-	if dy > 0 {
-		op = 3 // left
+// scale scales the offset from home to [-100, 100], the offset in homeBuf is 0
+func scale(d, max float64) int8 {
+	if math.Abs(d) < homeBuf {
+		return 0
 	}
-	return
+	v := d / max * 100
+	v = math.Max(-100, math.Min(100, v))
+	return int8(v)
 }
@@ -8,10 +8,14 @@ import (
 	"time"
 
 	"github.com/jakefau/rpi-devices/iot"
+	"github.com/jakefau/rpi-devices/util/sampler"
 )
 
 const (
 	memoryInterval = 10 * time.Minute
+	// it's sampled again in retryInterval if it failed
+	retryInterval = 30 * time.Second
+	readTimeout   = 10 * time.Second
 )
 
 func main() {
@@ -37,20 +41,32 @@ type memMonitor struct {
 
 func (m *memMonitor) start() {
 	log.Printf("[memmonitor]start working")
-	for {
-		f, err := m.free()
-		if err != nil {
-			log.Printf("[memmonitor]failed to get free memory, error: %v", err)
-			time.Sleep(30 * time.Second)
-			continue
-		}
-		v := &iot.Value{
-			Device: "memory",
-			Value:  f,
-		}
-		go m.cloud.Push(v)
-		time.Sleep(memoryInterval)
+	s := sampler.New()
+	err := s.Add(&sampler.Sensor{
+		Name:    "memory",
+		Read:    func() (interface{}, error) { return m.free() },
+		Period:  memoryInterval,
+		Timeout: readTimeout,
+		Retry:   retryInterval,
+	})
+	if err != nil {
+		log.Printf("[memmonitor]failed to add the memory sensor, error: %v", err)
+		return
+	}
+	s.Subscribe(m.onReading)
+	s.Run(nil)
+}
+
+func (m *memMonitor) onReading(r *sampler.Reading) {
+	if r.Err != nil {
+		log.Printf("[memmonitor]failed to get free memory, error: %v", r.Err)
+		return
+	}
+	v := &iot.Value{
+		Device: "memory",
+		Value:  r.Value,
 	}
+	go m.cloud.Push(v)
 }
 
 // Free is to get free memory in MB
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/jakefau/rpi-devices/util/sensors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAPI(t *testing.T) {
+	temps := []float64{20, 22, 21}
+	var pmErr error
+	s := newServer(
+		withSource("ds18b20", time.Minute, func() ([]float64, error) {
+			v := temps[0]
+			temps = temps[1:]
+			return []float64{v}, nil
+		}, newSensor("temp", "Temperature", "°C", time.Hour)),
+		withSource("pms7003", time.Minute, func() ([]float64, error) {
+			return []float64{35, 50}, pmErr
+		},
+			newSensor("pm25", "PM2.5", "μg/m³", time.Hour),
+			newSensor("pm10", "PM10", "μg/m³", time.Hour),
+		),
+	)
+	now := time.Now().Truncate(time.Second)
+	// the first readings are out of the window after the last ones
+	for _, ago := range []time.Duration{100, 50, 10} {
+		for _, src := range s.sources {
+			src.sample(now.Add(-ago * time.Minute))
+		}
+	}
+	pmErr = errors.New("timeout")
+	s.sources[1].sample(now.Add(-5 * time.Minute))
+	srv := httptest.NewServer(s.handler())
+	defer srv.Close()
+
+	get := func(path, etag string, v interface{}) *http.Response {
+		req, err := http.NewRequest(http.MethodGet, srv.URL+path, nil)
+		assert.NoError(t, err)
+		if etag != "" {
+			req.Header.Set("If-None-Match", etag)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		assert.NoError(t, err)
+		defer resp.Body.Close()
+		if v != nil && resp.StatusCode != http.StatusNotModified {
+			assert.NoError(t, json.NewDecoder(resp.Body).Decode(v))
+		}
+		return resp
+	}
+
+	var list []*sensors.Sensor
+	resp := get("/api/v1/sensors", "", &list)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, 3, len(list))
+	assert.Equal(t, "temp", list[0].ID)
+	assert.Equal(t, 21.0, list[0].Latest.Value)
+	assert.Equal(t, 60, list[0].Period)
+	assert.Equal(t, "pm10", list[2].ID)
+	assert.Equal(t, "μg/m³", list[2].Unit)
+	assert.Equal(t, "timeout", list[2].Error)
+	assert.Equal(t, 50.0, list[2].Latest.Value)
+
+	// etag
+	var temp sensors.Sensor
+	resp = get("/api/v1/sensors/temp", "", &temp)
+	assert.Equal(t, "ds18b20", temp.Device)
+	etag := resp.Header.Get("ETag")
+	assert.NotEqual(t, "", etag)
+	resp = get("/api/v1/sensors/temp", etag, nil)
+	assert.Equal(t, http.StatusNotModified, resp.StatusCode)
+	resp = get("/api/v1/sensors/pm25", etag, nil)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	// history and stats
+	var history []sensors.Reading
+	get("/api/v1/sensors/temp/history", "", &history)
+	assert.Equal(t, 2, len(history))
+	assert.Equal(t, 22.0, history[0].Value)
+	get("/api/v1/sensors/temp/history?since=30m", "", &history)
+	assert.Equal(t, 1, len(history))
+	until := now.Add(-30 * time.Minute).Format(time.RFC3339)
+	get("/api/v1/sensors/temp/history?since=2h&until="+until, "", &history)
+	assert.Equal(t, 1, len(history))
+	assert.Equal(t, 22.0, history[0].Value)
+
+	var stats sensors.Stats
+	get("/api/v1/sensors/temp/stats", "", &stats)
+	assert.Equal(t, 2, stats.Count)
+	assert.Equal(t, 21.0, stats.Min)
+	assert.Equal(t, 22.0, stats.Max)
+	assert.Equal(t, 21.5, stats.Avg)
+	get("/api/v1/sensors/pm25/stats?since=1m", "", &stats)
+	assert.Equal(t, 0, stats.Count)
+
+	// errors
+	var e errorResponse
+	resp = get("/api/v1/sensors/co2", "", &e)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	assert.Equal(t, "no such sensor: co2", e.ErrorMsg)
+	resp = get("/api/v1/sensors/temp/history?since=yesterday", "", &e)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	resp = get("/api/v1/sensors/temp/foo", "", &e)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	// openapi
+	var doc map[string]interface{}
+	resp = get("/api/v1/openapi.json", "", &doc)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "3.0.3", doc["openapi"])
+
+	// the old api
+	var tr tempResponse
+	get("/temp", "", &tr)
+	assert.Equal(t, float32(21), tr.Temp)
+	var pr pm25Response
+	resp = get("/pm25", "", &pr)
+	assert.Equal(t, http.StatusInternalServerError, resp.StatusCode)
+	assert.Equal(t, "failed to get pm25, error: timeout", pr.ErrorMsg)
+}
@@ -0,0 +1,226 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jakefau/rpi-devices/util/sensors"
+)
+
+const (
+	// the latest events are kept for resuming
+	eventsKept = 1000
+	// the comment sent for keeping the connection alive
+	heartbeat = 15 * time.Second
+	// the delay of reconnecting told to the clients in ms
+	retryMs = 3000
+	// the max time of waiting in a long-poll
+	maxPollTimeout = 60 * time.Second
+)
+
+// hub publishes the events of sampling to the subscribers, and keeps the latest events for resuming
+type hub struct {
+	size int
+
+	mu     sync.Mutex
+	seq    int64
+	events []*sensors.Event
+	subs   map[chan struct{}]bool
+}
+
+func newHub(size int) *hub {
+	return &hub{
+		size: size,
+		subs: map[chan struct{}]bool{},
+	}
+}
+
+// publish gives the event an id, and notifies the subscribers
+func (h *hub) publish(e *sensors.Event) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.seq++
+	e.ID = h.seq
+	h.events = append(h.events, e)
+	if len(h.events) > h.size {
+		h.events = append(h.events[:0], h.events[len(h.events)-h.size:]...)
+	}
+	for ch := range h.subs {
+		select {
+		case ch <- struct{}{}:
+		default:
+			// it has been notified
+		}
+	}
+}
+
+// subscribe returns a channel notified when there are new events, cancel must be called when it's done
+func (h *hub) subscribe() (ch chan struct{}, cancel func()) {
+	ch = make(chan struct{}, 1)
+	h.mu.Lock()
+	h.subs[ch] = true
+	h.mu.Unlock()
+	return ch, func() {
+		h.mu.Lock()
+		delete(h.subs, ch)
+		h.mu.Unlock()
+	}
+}
+
+// after returns the events of the sensors after the id, all sensors if ids is empty.
+// it returns the latest event of each sensor instead if the id is 0, or it can't be resumed from,
+// e.g. the events after it are dropped, or the server is restarted.
+func (h *hub) after(id int64, ids map[string]bool) []*sensors.Event {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	match := func(e *sensors.Event) bool {
+		return len(ids) == 0 || ids[e.Sensor]
+	}
+	list := []*sensors.Event{}
+	if id > 0 && id <= h.seq && (len(h.events) == 0 || id >= h.events[0].ID-1) {
+		for _, e := range h.events {
+			if e.ID > id && match(e) {
+				list = append(list, e)
+			}
+		}
+		return list
+	}
+
+	latest := map[string]bool{}
+	for i := len(h.events) - 1; i >= 0; i-- {
+		e := h.events[i]
+		if !match(e) || latest[e.Sensor] {
+			continue
+		}
+		latest[e.Sensor] = true
+		list = append([]*sensors.Event{e}, list...)
+	}
+	return list
+}
+
+// eventsHandler pushes the events by server-sent events, it resumes from the id in the header Last-Event-ID
+func (s *sserver) eventsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		s.fail(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		s.fail(w, http.StatusInternalServerError, "streaming isn't supported")
+		return
+	}
+	ids, err := s.filter(r.FormValue("sensors"))
+	if err != nil {
+		s.fail(w, http.StatusNotFound, "%v", err)
+		return
+	}
+	last, _ := strconv.ParseInt(r.Header.Get("Last-Event-ID"), 10, 64)
+
+	ch, cancel := s.hub.subscribe()
+	defer cancel()
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	fmt.Fprintf(w, "retry: %v\n\n", retryMs)
+	flusher.Flush()
+
+	ticker := time.NewTicker(heartbeat)
+	defer ticker.Stop()
+	for {
+		for _, e := range s.hub.after(last, ids) {
+			data, err := json.Marshal(e)
+			if err != nil {
+				log.Printf("[sensors]failed to marshal the event, error: %v", err)
+				continue
+			}
+			if _, err := fmt.Fprintf(w, "id: %v\nevent: reading\ndata: %s\n\n", e.ID, data); err != nil {
+				return
+			}
+			last = e.ID
+		}
+		flusher.Flush()
+
+		select {
+		case <-r.Context().Done():
+			return
+		case <-ch:
+		case <-ticker.C:
+			if _, err := fmt.Fprintf(w, ": ping\n\n"); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// pollHandler responds the events after the id in "after", it waits for them in "timeout" if there are none
+func (s *sserver) pollHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		s.fail(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	ids, err := s.filter(r.FormValue("sensors"))
+	if err != nil {
+		s.fail(w, http.StatusNotFound, "%v", err)
+		return
+	}
+	var after int64
+	if v := r.FormValue("after"); v != "" {
+		if after, err = strconv.ParseInt(v, 10, 64); err != nil {
+			s.fail(w, http.StatusBadRequest, "invalid after: %v", v)
+			return
+		}
+	}
+	timeout := 30 * time.Second
+	if v := r.FormValue("timeout"); v != "" {
+		if timeout, err = time.ParseDuration(v); err != nil {
+			s.fail(w, http.StatusBadRequest, "invalid timeout: %v", v)
+			return
+		}
+	}
+	if timeout > maxPollTimeout {
+		timeout = maxPollTimeout
+	}
+
+	ch, cancel := s.hub.subscribe()
+	defer cancel()
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	for {
+		events := s.hub.after(after, ids)
+		if len(events) > 0 {
+			w.Header().Set("Content-Type", "application/json")
+			s.response(w, events, http.StatusOK)
+			return
+		}
+		select {
+		case <-ch:
+		case <-timer.C:
+			w.Header().Set("Content-Type", "application/json")
+			s.response(w, events, http.StatusOK)
+			return
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+// filter returns the set of the sensors in a list like "temp,pm25", or nil for all sensors
+func (s *sserver) filter(list string) (map[string]bool, error) {
+	if list == "" {
+		return nil, nil
+	}
+	ids := map[string]bool{}
+	for _, id := range strings.Split(list, ",") {
+		if _, ok := s.sensors[id]; !ok {
+			return nil, fmt.Errorf("no such sensor: %v", id)
+		}
+		ids[id] = true
+	}
+	return ids, nil
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jakefau/rpi-devices/util/sensors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHub(t *testing.T) {
+	h := newHub(4)
+	now := time.Now()
+	for _, id := range []string{"temp", "pm25", "temp", "pm10", "temp", "pm25"} {
+		h.publish(&sensors.Event{Sensor: id, Time: now})
+	}
+	ids := func(events []*sensors.Event) []int64 {
+		list := []int64{}
+		for _, e := range events {
+			list = append(list, e.ID)
+		}
+		return list
+	}
+	testCases := []struct {
+		desc    string
+		after   int64
+		sensors map[string]bool
+		ids     []int64
+	}{
+		{desc: "latest of each sensor", after: 0, ids: []int64{4, 5, 6}},
+		{desc: "latest of temp", after: 0, sensors: map[string]bool{"temp": true}, ids: []int64{5}},
+		{desc: "resume", after: 3, ids: []int64{4, 5, 6}},
+		{desc: "resume temp", after: 2, sensors: map[string]bool{"temp": true}, ids: []int64{3, 5}},
+		{desc: "up to date", after: 6, ids: []int64{}},
+		{desc: "dropped", after: 1, ids: []int64{4, 5, 6}},
+		{desc: "restarted", after: 100, ids: []int64{4, 5, 6}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			assert.Equal(t, tc.ids, ids(h.after(tc.after, tc.sensors)))
+		})
+	}
+}
+
+func TestEvents(t *testing.T) {
+	temp := 20.0
+	s := newServer(
+		withSource("ds18b20", time.Minute, func() ([]float64, error) {
+			temp++
+			return []float64{temp}, nil
+		}, newSensor("temp", "Temperature", "°C", time.Hour)),
+		withSource("pms7003", time.Minute, func() ([]float64, error) {
+			return []float64{35, 50}, nil
+		},
+			newSensor("pm25", "PM2.5", "μg/m³", time.Hour),
+			newSensor("pm10", "PM10", "μg/m³", time.Hour),
+		),
+	)
+	for _, src := range s.sources {
+		src.sample(time.Now())
+	}
+	s.sources[0].sample(time.Now())
+	srv := httptest.NewServer(s.handler())
+	defer srv.Close()
+
+	// server-sent events, resumed from event 1
+	req, err := http.NewRequest(http.MethodGet, srv.URL+"/api/v1/events?sensors=temp,pm25", nil)
+	assert.NoError(t, err)
+	req.Header.Set("Last-Event-ID", "1")
+	resp, err := http.DefaultClient.Do(req)
+	assert.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+	scanner := bufio.NewScanner(resp.Body)
+	next := func() *sensors.Event {
+		for scanner.Scan() {
+			line := scanner.Text()
+			if !strings.HasPrefix(line, "data: ") {
+				continue
+			}
+			var e sensors.Event
+			assert.NoError(t, json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &e))
+			return &e
+		}
+		return nil
+	}
+	e := next()
+	assert.Equal(t, int64(2), e.ID)
+	assert.Equal(t, "pm25", e.Sensor)
+	e = next()
+	assert.Equal(t, int64(4), e.ID)
+	assert.Equal(t, 22.0, e.Value)
+
+	// pushed as it's sampled
+	s.sources[0].sample(time.Now())
+	e = next()
+	assert.Equal(t, int64(5), e.ID)
+	assert.Equal(t, 23.0, e.Value)
+
+	// long-poll
+	var events []*sensors.Event
+	resp2, err := http.Get(srv.URL + "/api/v1/events/poll")
+	assert.NoError(t, err)
+	assert.NoError(t, json.NewDecoder(resp2.Body).Decode(&events))
+	resp2.Body.Close()
+	assert.Equal(t, 3, len(events))
+
+	resp2, err = http.Get(srv.URL + "/api/v1/events/poll?after=5&timeout=50ms")
+	assert.NoError(t, err)
+	assert.NoError(t, json.NewDecoder(resp2.Body).Decode(&events))
+	resp2.Body.Close()
+	assert.Equal(t, 0, len(events))
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		s.sources[1].sample(time.Now())
+	}()
+	resp2, err = http.Get(srv.URL + "/api/v1/events/poll?after=5&sensors=pm10")
+	assert.NoError(t, err)
+	assert.NoError(t, json.NewDecoder(resp2.Body).Decode(&events))
+	resp2.Body.Close()
+	assert.Equal(t, 1, len(events))
+	assert.Equal(t, "pm10", events[0].Sensor)
+
+	resp2, err = http.Get(srv.URL + "/api/v1/events?sensors=co2")
+	assert.NoError(t, err)
+	resp2.Body.Close()
+	assert.Equal(t, http.StatusNotFound, resp2.StatusCode)
+}
@@ -1,24 +1,59 @@
 /*
-sserver is a sensor server which provide data from all kinds of sensors
+sserver is a sensor server which provide data from all kinds of sensors.
+
+The devices are sampled in their own periods by util/sampler, and the readings are kept in a history window in memory.
+Every sensor is served by the api:
+
+	GET /api/v1/sensors: all of the sensors with the latest readings
+	GET /api/v1/sensors/{id}: the sensor with the latest reading
+	GET /api/v1/sensors/{id}/history?since=1h&until=: the readings in the period
+	GET /api/v1/sensors/{id}/stats?since=1h&until=: the min, max and avg of the readings in the period
+	GET /api/v1/events?sensors=temp,pm25: the server-sent events of the readings as they're sampled
+	GET /api/v1/events/poll?sensors=temp,pm25&after=<id>&timeout=30s: long-poll the events after the id
+	GET /api/v1/openapi.json: the openapi document of the api
+
+since and until are a time in RFC3339, or a duration before now like "30m".
+The responses have ETags, a request with If-None-Match gets 304 Not Modified if nothing changes.
+The events begin with the latest one of each sensor, and they're resumed from the header Last-Event-ID after reconnecting.
+All of the clients share the same sampling, see util/sensors for the client.
+/temp and /pm25 are kept for the old clients.
 */
 
 package main
 
 import (
+	"crypto/sha1"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
+	"strings"
+	"time"
 
 	"github.com/jakefau/rpi-devices/dev"
 	"github.com/jakefau/rpi-devices/util"
+	"github.com/jakefau/rpi-devices/util/sampler"
+	"github.com/jakefau/rpi-devices/util/sensors"
 	"github.com/stianeikeland/go-rpio"
 )
 
 const (
 	devName = "/dev/ttyAMA0"
 	baud    = 9600
+
+	host = ":8000"
+	// the readings are kept in historyWindow
+	historyWindow = 24 * time.Hour
+	tempPeriod    = 30 * time.Second
+	pmPeriod      = 60 * time.Second
+	// the devices are sampled in their periods plus a random delay in sampleJitter,
+	// and a reading fails if the device doesn't respond in sampleTimeout
+	sampleJitter  = 2 * time.Second
+	sampleTimeout = 10 * time.Second
+
+	apiPrefix = "/api/v1"
 )
 
 type (
@@ -26,8 +61,11 @@ type (
 )
 
 type sserver struct {
-	ds18b20 *dev.DS18B20
-	pms7003 *dev.PMS7003
+	sources []*source
+	sensors map[string]*sensor
+	// ids are the ids of the sensors in the order of registering
+	ids []string
+	hub *hub
 }
 
 type tempResponse struct {
@@ -40,6 +78,10 @@ type pm25Response struct {
 	ErrorMsg string `json:"error_msg"`
 }
 
+type errorResponse struct {
+	ErrorMsg string `json:"error_msg"`
+}
+
 func main() {
 	if err := rpio.Open(); err != nil {
 		log.Fatalf("[sensors]failed to open rpio, error: %v", err)
@@ -79,19 +121,64 @@ func main() {
 }
 
 func withDS18B20(d *dev.DS18B20) option {
+	return withSource("ds18b20", tempPeriod, func() ([]float64, error) {
+		t, err := d.GetTemperature()
+		if err != nil {
+			return nil, err
+		}
+		return []float64{float64(t)}, nil
+	}, newSensor("temp", "Temperature", "°C", historyWindow))
+}
+
+func withPMS7003(p *dev.PMS7003) option {
+	return onBus(devName, withSource("pms7003", pmPeriod, func() ([]float64, error) {
+		pm25, pm10, err := p.Get()
+		if err != nil {
+			return nil, err
+		}
+		return []float64{float64(pm25), float64(pm10)}, nil
+	},
+		newSensor("pm25", "PM2.5", "μg/m³", historyWindow),
+		newSensor("pm10", "PM10", "μg/m³", historyWindow),
+	))
+}
+
+// withSource adds a device sampled in every period, read returns the values of the sensors in order
+func withSource(device string, period time.Duration, read func() ([]float64, error), list ...*sensor) option {
 	return func(s *sserver) {
-		s.ds18b20 = d
+		for _, sr := range list {
+			sr.info.Device = device
+			sr.info.Period = int(period / time.Second)
+			s.sensors[sr.info.ID] = sr
+			s.ids = append(s.ids, sr.info.ID)
+		}
+		s.sources = append(s.sources, &source{
+			device:  device,
+			period:  period,
+			sensors: list,
+			read:    read,
+			publish: s.hub.publish,
+		})
 	}
 }
 
-func withPMS7003(p *dev.PMS7003) option {
+// onBus puts the devices added by opt on the bus, e.g. the uart of PMS7003,
+// it's shared with ZE08-CH2O of ch2omonitor, the sampler locks the bus across the processes
+func onBus(bus string, opt option) option {
 	return func(s *sserver) {
-		s.pms7003 = p
+		n := len(s.sources)
+		opt(s)
+		for _, src := range s.sources[n:] {
+			src.bus = bus
+		}
 	}
 }
 
 func newServer(opts ...option) *sserver {
-	s := &sserver{}
+	s := &sserver{
+		sensors: map[string]*sensor{},
+		hub:     newHub(eventsKept),
+	}
 	for _, opt := range opts {
 		opt(s)
 	}
@@ -100,14 +187,32 @@ func newServer(opts ...option) *sserver {
 
 func (s *sserver) start() error {
 	log.Printf("[sensors]start service")
-	http.HandleFunc("/temp", s.tempHandler)
-	http.HandleFunc("/pm25", s.pm25Handler)
-	if err := http.ListenAndServe(":8000", nil); err != nil {
+	sp := sampler.New()
+	for _, src := range s.sources {
+		if err := sp.Add(src.sampled()); err != nil {
+			return err
+		}
+		sp.Subscribe(src.onReading, src.device)
+	}
+	go sp.Run(nil)
+	if err := http.ListenAndServe(host, s.handler()); err != nil {
 		return err
 	}
 	return nil
 }
 
+func (s *sserver) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/temp", s.tempHandler)
+	mux.HandleFunc("/pm25", s.pm25Handler)
+	mux.HandleFunc(apiPrefix+"/openapi.json", s.openapiHandler)
+	mux.HandleFunc(apiPrefix+"/sensors", s.sensorsHandler)
+	mux.HandleFunc(apiPrefix+"/sensors/", s.sensorHandler)
+	mux.HandleFunc(apiPrefix+"/events", s.eventsHandler)
+	mux.HandleFunc(apiPrefix+"/events/poll", s.pollHandler)
+	return mux
+}
+
 func (s *sserver) response(w http.ResponseWriter, resp interface{}, statusCode int) error {
 	w.WriteHeader(statusCode)
 	data, err := json.Marshal(resp)
@@ -122,52 +227,147 @@ func (s *sserver) response(w http.ResponseWriter, resp interface{}, statusCode i
 	return nil
 }
 
-func (s *sserver) tempHandler(w http.ResponseWriter, r *http.Request) {
-	log.Printf("[sensors]%v %v", r.Method, r.URL.Path)
-	if s.ds18b20 == nil {
-		resp := &tempResponse{
-			ErrorMsg: "invaild ds18b20 sensor",
+// cached responds with an etag of the response, and responds 304 if the etag matches If-None-Match
+func (s *sserver) cached(w http.ResponseWriter, r *http.Request, resp interface{}) error {
+	data, err := json.Marshal(resp)
+	if err != nil {
+		log.Printf("[sensors]failed to marshal the response, error: %v", err)
+		return err
+	}
+	sum := sha1.Sum(data)
+	etag := `"` + hex.EncodeToString(sum[:8]) + `"`
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", "no-cache")
+	for _, t := range strings.Split(r.Header.Get("If-None-Match"), ",") {
+		if t = strings.TrimSpace(t); t == etag || t == "*" {
+			w.WriteHeader(http.StatusNotModified)
+			return nil
 		}
-		s.response(w, resp, http.StatusInternalServerError)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if _, err := w.Write(data); err != nil {
+		log.Printf("[sensors]failed to write data to http.ResponseWriter, error: %v", err)
+		return err
+	}
+	return nil
+}
+
+func (s *sserver) fail(w http.ResponseWriter, statusCode int, format string, a ...interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	s.response(w, &errorResponse{ErrorMsg: fmt.Sprintf(format, a...)}, statusCode)
+}
+
+func (s *sserver) sensorsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		s.fail(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	list := []*sensors.Sensor{}
+	for _, id := range s.ids {
+		list = append(list, s.sensors[id].get())
+	}
+	s.cached(w, r, list)
+}
+
+func (s *sserver) sensorHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		s.fail(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, apiPrefix+"/sensors/"), "/")
+	sr, ok := s.sensors[parts[0]]
+	if !ok || len(parts) > 2 {
+		s.fail(w, http.StatusNotFound, "no such sensor: %v", parts[0])
 		return
 	}
+	if len(parts) == 1 {
+		s.cached(w, r, sr.get())
+		return
+	}
+
+	now := time.Now()
+	from, err := parseTime(r.FormValue("since"), now, now.Add(-sr.window))
+	if err != nil {
+		s.fail(w, http.StatusBadRequest, "invalid since: %v", err)
+		return
+	}
+	to, err := parseTime(r.FormValue("until"), now, now)
+	if err != nil {
+		s.fail(w, http.StatusBadRequest, "invalid until: %v", err)
+		return
+	}
+	switch parts[1] {
+	case "history":
+		s.cached(w, r, sr.history(from, to))
+	case "stats":
+		s.cached(w, r, sr.stats(from, to))
+	default:
+		s.fail(w, http.StatusNotFound, "not found: %v", r.URL.Path)
+	}
+}
+
+func (s *sserver) openapiHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Write([]byte(openapi))
+}
+
+// parseTime parses a time in RFC3339, or a duration before now like "30m", it returns def if s is empty
+func parseTime(s string, now, def time.Time) (time.Time, error) {
+	if s == "" {
+		return def, nil
+	}
+	if d, err := time.ParseDuration(s); err == nil {
+		return now.Add(-d), nil
+	}
+	return time.Parse(time.RFC3339, s)
+}
+
+// latest returns the latest reading of the sensor, or an error if it's missing or failed
+func (s *sserver) latest(id string) (*sensors.Reading, error) {
+	sr, ok := s.sensors[id]
+	if !ok {
+		return nil, fmt.Errorf("invaild %v sensor", id)
+	}
+	info := sr.get()
+	if info.Error != "" {
+		return nil, fmt.Errorf("failed to get %v, error: %v", id, info.Error)
+	}
+	if info.Latest == nil {
+		return nil, fmt.Errorf("no reading of %v yet", id)
+	}
+	return info.Latest, nil
+}
 
-	t, err := s.ds18b20.GetTemperature()
+func (s *sserver) tempHandler(w http.ResponseWriter, r *http.Request) {
+	log.Printf("[sensors]%v %v", r.Method, r.URL.Path)
+	t, err := s.latest("temp")
 	if err != nil {
 		resp := &tempResponse{
-			ErrorMsg: fmt.Sprintf("failed to get temp, error: %v", err),
+			ErrorMsg: err.Error(),
 		}
 		s.response(w, resp, http.StatusInternalServerError)
 		return
 	}
 
 	resp := &tempResponse{
-		Temp: t,
+		Temp: float32(t.Value),
 	}
 	s.response(w, resp, http.StatusOK)
 }
 
 func (s *sserver) pm25Handler(w http.ResponseWriter, r *http.Request) {
 	log.Printf("[sensors]%v %v", r.Method, r.URL.Path)
-	if s.pms7003 == nil {
-		resp := &pm25Response{
-			ErrorMsg: "invaild pms7003 sensor",
-		}
-		s.response(w, resp, http.StatusInternalServerError)
-		return
-	}
-
-	pm25, _, err := s.pms7003.Get()
+	pm25, err := s.latest("pm25")
 	if err != nil {
 		resp := &pm25Response{
-			ErrorMsg: fmt.Sprintf("failed to get pm2.5, error: %v", err),
+			ErrorMsg: err.Error(),
 		}
 		s.response(w, resp, http.StatusInternalServerError)
 		return
 	}
 
 	resp := &pm25Response{
-		PM25: pm25,
+		PM25: uint16(pm25.Value),
 	}
 	s.response(w, resp, http.StatusOK)
 }
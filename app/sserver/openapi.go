@@ -0,0 +1,194 @@
+package main
+
+// openapi is the openapi document of the api
+const openapi = `{
+  "openapi": "3.0.3",
+  "info": {
+    "title": "sserver",
+    "description": "The sensor server of rpi-devices, it serves the readings of the sensors.",
+    "version": "1.0.0"
+  },
+  "servers": [{"url": "/api/v1"}],
+  "paths": {
+    "/sensors": {
+      "get": {
+        "summary": "List the sensors with the latest readings",
+        "responses": {
+          "200": {
+            "description": "The sensors",
+            "headers": {"ETag": {"$ref": "#/components/headers/ETag"}},
+            "content": {"application/json": {"schema": {"type": "array", "items": {"$ref": "#/components/schemas/Sensor"}}}}
+          },
+          "304": {"description": "Not modified since the ETag in If-None-Match"}
+        }
+      }
+    },
+    "/sensors/{id}": {
+      "parameters": [{"$ref": "#/components/parameters/ID"}],
+      "get": {
+        "summary": "Get a sensor with the latest reading",
+        "responses": {
+          "200": {
+            "description": "The sensor",
+            "headers": {"ETag": {"$ref": "#/components/headers/ETag"}},
+            "content": {"application/json": {"schema": {"$ref": "#/components/schemas/Sensor"}}}
+          },
+          "304": {"description": "Not modified since the ETag in If-None-Match"},
+          "404": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/sensors/{id}/history": {
+      "parameters": [
+        {"$ref": "#/components/parameters/ID"},
+        {"$ref": "#/components/parameters/Since"},
+        {"$ref": "#/components/parameters/Until"}
+      ],
+      "get": {
+        "summary": "Get the readings of a sensor in a period, the oldest first",
+        "responses": {
+          "200": {
+            "description": "The readings",
+            "headers": {"ETag": {"$ref": "#/components/headers/ETag"}},
+            "content": {"application/json": {"schema": {"type": "array", "items": {"$ref": "#/components/schemas/Reading"}}}}
+          },
+          "304": {"description": "Not modified since the ETag in If-None-Match"},
+          "400": {"$ref": "#/components/responses/Error"},
+          "404": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/sensors/{id}/stats": {
+      "parameters": [
+        {"$ref": "#/components/parameters/ID"},
+        {"$ref": "#/components/parameters/Since"},
+        {"$ref": "#/components/parameters/Until"}
+      ],
+      "get": {
+        "summary": "Get the min, max and avg of the readings of a sensor in a period",
+        "responses": {
+          "200": {
+            "description": "The statistics",
+            "headers": {"ETag": {"$ref": "#/components/headers/ETag"}},
+            "content": {"application/json": {"schema": {"$ref": "#/components/schemas/Stats"}}}
+          },
+          "304": {"description": "Not modified since the ETag in If-None-Match"},
+          "400": {"$ref": "#/components/responses/Error"},
+          "404": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/events": {
+      "parameters": [{"$ref": "#/components/parameters/Sensors"}],
+      "get": {
+        "summary": "Push the events of the readings as they're sampled by server-sent events",
+        "description": "The events begin with the latest one of each sensor, or the ones after the id in Last-Event-ID. Each event is named reading, and its data is an Event in json.",
+        "parameters": [
+          {"name": "Last-Event-ID", "in": "header", "description": "The id of the last event received", "schema": {"type": "integer"}}
+        ],
+        "responses": {
+          "200": {"description": "The events", "content": {"text/event-stream": {"schema": {"type": "string"}}}},
+          "404": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/events/poll": {
+      "parameters": [{"$ref": "#/components/parameters/Sensors"}],
+      "get": {
+        "summary": "Long-poll the events",
+        "parameters": [
+          {"name": "after", "in": "query", "description": "The id of the last event received, the latest event of each sensor is returned if it's 0", "schema": {"type": "integer"}},
+          {"name": "timeout", "in": "query", "description": "The time of waiting for the events, 30s in default and 60s at most", "schema": {"type": "string"}, "example": "30s"}
+        ],
+        "responses": {
+          "200": {
+            "description": "The events, it's empty if there are no events in the timeout",
+            "content": {"application/json": {"schema": {"type": "array", "items": {"$ref": "#/components/schemas/Event"}}}}
+          },
+          "400": {"$ref": "#/components/responses/Error"},
+          "404": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    }
+  },
+  "components": {
+    "parameters": {
+      "ID": {"name": "id", "in": "path", "required": true, "schema": {"type": "string"}, "example": "temp"},
+      "Sensors": {
+        "name": "sensors", "in": "query",
+        "description": "The ids of the sensors separated by commas, all of the sensors in default.",
+        "schema": {"type": "string"}, "example": "temp,pm25"
+      },
+      "Since": {
+        "name": "since", "in": "query",
+        "description": "A time in RFC3339, or a duration before now like 30m. The start of the history window in default.",
+        "schema": {"type": "string"}, "example": "1h"
+      },
+      "Until": {
+        "name": "until", "in": "query",
+        "description": "A time in RFC3339, or a duration before now like 30m. Now in default.",
+        "schema": {"type": "string"}
+      }
+    },
+    "headers": {
+      "ETag": {"description": "The tag of the response for If-None-Match", "schema": {"type": "string"}}
+    },
+    "responses": {
+      "Error": {
+        "description": "An error",
+        "content": {"application/json": {"schema": {"$ref": "#/components/schemas/Error"}}}
+      }
+    },
+    "schemas": {
+      "Reading": {
+        "type": "object",
+        "properties": {
+          "value": {"type": "number"},
+          "time": {"type": "string", "format": "date-time"}
+        }
+      },
+      "Sensor": {
+        "type": "object",
+        "properties": {
+          "id": {"type": "string", "example": "temp"},
+          "name": {"type": "string", "example": "Temperature"},
+          "unit": {"type": "string", "example": "°C"},
+          "device": {"type": "string", "example": "ds18b20"},
+          "period": {"type": "integer", "description": "The sampling period in seconds"},
+          "latest": {"$ref": "#/components/schemas/Reading"},
+          "error": {"type": "string", "description": "The error of the last sampling if it failed"}
+        }
+      },
+      "Stats": {
+        "type": "object",
+        "properties": {
+          "id": {"type": "string"},
+          "unit": {"type": "string"},
+          "from": {"type": "string", "format": "date-time"},
+          "to": {"type": "string", "format": "date-time"},
+          "count": {"type": "integer"},
+          "min": {"type": "number"},
+          "max": {"type": "number"},
+          "avg": {"type": "number"}
+        }
+      },
+      "Event": {
+        "type": "object",
+        "properties": {
+          "id": {"type": "integer", "description": "It increases by one for every event"},
+          "sensor": {"type": "string"},
+          "value": {"type": "number"},
+          "time": {"type": "string", "format": "date-time"},
+          "error": {"type": "string", "description": "The error of the sampling if it failed"}
+        }
+      },
+      "Error": {
+        "type": "object",
+        "properties": {
+          "error_msg": {"type": "string"}
+        }
+      }
+    }
+  }
+}
+`
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"github.com/jakefau/rpi-devices/util/sampler"
+	"github.com/jakefau/rpi-devices/util/sensors"
+)
+
+// sensor keeps the readings of a sensor in the history window
+type sensor struct {
+	info   sensors.Sensor
+	window time.Duration
+
+	mu       sync.Mutex
+	readings []sensors.Reading
+	err      string
+}
+
+func newSensor(id, name, unit string, window time.Duration) *sensor {
+	return &sensor{
+		info: sensors.Sensor{
+			ID:   id,
+			Name: name,
+			Unit: unit,
+		},
+		window: window,
+	}
+}
+
+func (s *sensor) add(r sensors.Reading) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.readings = append(s.readings, r)
+	s.err = ""
+	// drop the readings out of the window
+	i := 0
+	for i < len(s.readings) && r.Time.Sub(s.readings[i].Time) > s.window {
+		i++
+	}
+	if i > 0 {
+		s.readings = append(s.readings[:0], s.readings[i:]...)
+	}
+}
+
+func (s *sensor) fail(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.err = err.Error()
+}
+
+// get returns the sensor with the latest reading
+func (s *sensor) get() *sensors.Sensor {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	info := s.info
+	if n := len(s.readings); n > 0 {
+		r := s.readings[n-1]
+		info.Latest = &r
+	}
+	info.Error = s.err
+	return &info
+}
+
+// history returns the readings in [from, to], the oldest first
+func (s *sensor) history(from, to time.Time) []sensors.Reading {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	list := []sensors.Reading{}
+	for _, r := range s.readings {
+		if r.Time.Before(from) || r.Time.After(to) {
+			continue
+		}
+		list = append(list, r)
+	}
+	return list
+}
+
+// stats returns the min, max and avg of the readings in [from, to]
+func (s *sensor) stats(from, to time.Time) *sensors.Stats {
+	st := &sensors.Stats{
+		ID:   s.info.ID,
+		Unit: s.info.Unit,
+		From: from,
+		To:   to,
+	}
+	sum := 0.0
+	for _, r := range s.history(from, to) {
+		if st.Count == 0 || r.Value < st.Min {
+			st.Min = r.Value
+		}
+		if st.Count == 0 || r.Value > st.Max {
+			st.Max = r.Value
+		}
+		sum += r.Value
+		st.Count++
+	}
+	if st.Count > 0 {
+		st.Avg = sum / float64(st.Count)
+	}
+	return st
+}
+
+// source is a device sampled in every period, it gives the values of one or more sensors at a time
+type source struct {
+	device string
+	period time.Duration
+	// bus is the bus of the device, the devices on the same bus are never read at the same time
+	bus     string
+	sensors []*sensor
+	// read returns the values in the order of the sensors
+	read func() ([]float64, error)
+	// publish publishes the event of each sensor sampled
+	publish func(e *sensors.Event)
+}
+
+// sample reads the device and records the values
+func (src *source) sample(now time.Time) {
+	values, err := src.read()
+	src.record(now, values, err)
+}
+
+// record records the values read at now, or the error if the reading failed
+func (src *source) record(now time.Time, values []float64, err error) {
+	if err == nil && len(values) != len(src.sensors) {
+		log.Printf("[sensors]%v gave %v values for %v sensors", src.device, len(values), len(src.sensors))
+		return
+	}
+	for i, s := range src.sensors {
+		e := &sensors.Event{Sensor: s.info.ID, Time: now}
+		if err != nil {
+			s.fail(err)
+			e.Error = err.Error()
+		} else {
+			s.add(sensors.Reading{Value: values[i], Time: now})
+			e.Value = values[i]
+		}
+		if src.publish != nil {
+			src.publish(e)
+		}
+	}
+	if err != nil {
+		log.Printf("[sensors]failed to read %v, error: %v", src.device, err)
+	}
+}
+
+// sampled returns the device as a sensor of the sampler
+func (src *source) sampled() *sampler.Sensor {
+	return &sampler.Sensor{
+		Name:    src.device,
+		Read:    func() (interface{}, error) { return src.read() },
+		Period:  src.period,
+		Jitter:  sampleJitter,
+		Timeout: sampleTimeout,
+		Bus:     src.bus,
+	}
+}
+
+// onReading records the reading of the device from the sampler
+func (src *source) onReading(r *sampler.Reading) {
+	values, _ := r.Value.([]float64)
+	src.record(r.Time, values, r.Err)
+}
@@ -1,14 +1,15 @@
 package main
 
 import (
-	"fmt"
 	"log"
-	"os/exec"
+	"strings"
 	"time"
 
 	"github.com/jakefau/rpi-devices/dev"
 	"github.com/jakefau/rpi-devices/iot"
 	"github.com/jakefau/rpi-devices/util"
+	"github.com/jakefau/rpi-devices/util/notify"
+	"github.com/jakefau/rpi-devices/util/sampler"
 	"github.com/stianeikeland/go-rpio"
 )
 
@@ -17,6 +18,20 @@ const (
 	lowTemperatureWarning  = 18
 	highTemperatureWarning = 30
 	intervalTime           = 1 * time.Minute
+	readTimeout            = 10 * time.Second
+)
+
+const (
+	smtpHost      = "smtp.xxx.com"
+	smtpPort      = 25
+	emailAddr     = "your-email@xxx.com"
+	emailPassword = "your-email-password"
+	notifyTo      = "youremail@xxx.com"
+)
+
+const (
+	warningTitle = `{{.Level}} Temperature Warning: {{printf "%.2f" .Temp}} C`
+	warningBody  = `The temperature is {{printf "%.2f" .Temp}} C at {{.Time.Format "15:04"}}, out of {{.Low}} ~ {{.High}} C.`
 )
 
 func main() {
@@ -47,10 +62,25 @@ func main() {
 		return
 	}
 
+	emailCfg := &util.EmailConfig{
+		SMTP:     smtpHost,
+		SMTPPort: smtpPort,
+		Address:  emailAddr,
+		Password: emailPassword,
+	}
+	warning, err := notify.NewTemplate(warningTitle, warningBody, notify.High)
+	if err != nil {
+		log.Printf("[tempmonitor]failed to parse the template of warning, error: %v", err)
+		return
+	}
+
 	monitor := tempMonitor{
 		temp:  temp,
 		cloud: cloud,
 		led:   led,
+		// warn twice an hour at most, and once for the same level in half an hour
+		notifier: notify.NewLimiter(notify.NewSMTP(emailCfg, notifyTo), 2, time.Hour, 30*time.Minute),
+		warning:  warning,
 	}
 
 	util.WaitQuit(func() {
@@ -61,47 +91,65 @@ func main() {
 }
 
 type tempMonitor struct {
-	temp  *dev.DS18B20
-	led   *dev.Led
-	cloud iot.Cloud
+	temp     *dev.DS18B20
+	led      *dev.Led
+	cloud    iot.Cloud
+	notifier notify.Notifier
+	warning  *notify.Template
 }
 
 func (m *tempMonitor) start() {
-	for {
-		time.Sleep(intervalTime)
-		c, err := m.temp.GetTemperature()
-		if err != nil {
-			log.Printf("[tempmonitor]failed to get temperature, error: %v", err)
-			continue
-		}
-
-		v := &iot.Value{
-			Device: "temperature",
-			Value:  c,
-		}
-		go m.cloud.Push(v)
-		go m.led.Blink(5, 500)
-
-		if c <= lowTemperatureWarning || c >= highTemperatureWarning {
-			go m.notitfy(c)
-		}
+	s := sampler.New()
+	err := s.Add(&sampler.Sensor{
+		Name:    "temperature",
+		Read:    func() (interface{}, error) { return m.temp.GetTemperature() },
+		Period:  intervalTime,
+		Timeout: readTimeout,
+	})
+	if err != nil {
+		log.Printf("[tempmonitor]failed to add the temperature sensor, error: %v", err)
+		return
 	}
+	s.Subscribe(m.onReading)
+	s.Run(nil)
 }
 
-func (m *tempMonitor) notitfy(temperatue float32) {
-	_, err := exec.LookPath("mutt")
-	if err != nil {
-		log.Printf("[tempmonitor]need to install mutt for email notification")
+func (m *tempMonitor) onReading(r *sampler.Reading) {
+	if r.Err != nil {
+		log.Printf("[tempmonitor]failed to get temperature, error: %v", r.Err)
 		return
 	}
-	subject := "Low Temperature Warning"
+	c := r.Value.(float32)
+	v := &iot.Value{
+		Device: "temperature",
+		Value:  c,
+	}
+	go m.cloud.Push(v)
+	go m.led.Blink(5, 500)
+
+	if c <= lowTemperatureWarning || c >= highTemperatureWarning {
+		go m.notitfy(c)
+	}
+}
+
+func (m *tempMonitor) notitfy(temperatue float32) {
+	level := "Low"
 	if temperatue >= highTemperatureWarning {
-		subject = "High Temperature Warning"
+		level = "High"
+	}
+	msg, err := m.warning.Render(map[string]interface{}{
+		"Level": level,
+		"Temp":  temperatue,
+		"Time":  time.Now(),
+		"Low":   lowTemperatureWarning,
+		"High":  highTemperatureWarning,
+	})
+	if err != nil {
+		log.Printf("[tempmonitor]failed to render the warning, error: %v", err)
+		return
 	}
-	subject = fmt.Sprintf("%v: %.2f C", subject, temperatue)
-	cmd := exec.Command("mutt", "-s", subject, "youremail@xxx.com")
-	if err := cmd.Run(); err != nil {
-		log.Printf("[tempmonitor]failed to send email")
+	msg.Key = strings.ToLower(level)
+	if err := m.notifier.Notify(msg); err != nil && err != notify.ErrDuplicated && err != notify.ErrLimited {
+		log.Printf("[tempmonitor]failed to send the warning, error: %v", err)
 	}
-	return
 }
@@ -11,24 +11,23 @@ import (
 	"strings"
 
 	"github.com/jakefau/rpi-devices/util"
-	"github.com/shanghuiyang/go-speech/oauth"
-	"github.com/shanghuiyang/go-speech/speech"
+	"github.com/jakefau/rpi-devices/util/tts"
 )
 
 const (
 	baiduSpeechAppKey    = "your_speech_app_key"
 	baiduSpeechSecretKey = "your_speech_secret_key"
-	ttsWav               = "tts.wav"
+	ttsCacheDir          = "tts-cache"
 	ipPattern            = "((000.000.000.000))"
 )
 
 type ttsServer struct {
-	tts         *speech.TTS
+	queue       *tts.Queue
 	pageContext []byte
 }
 
 func main() {
-	s := newTTSServer(baiduSpeechAppKey, baiduSpeechSecretKey)
+	s := newTTSServer(baiduSpeechAppKey, baiduSpeechSecretKey, ttsCacheDir)
 	util.WaitQuit(func() {})
 	if err := s.start(); err != nil {
 		log.Printf("[tts]failed to start car server, error: %v", err)
@@ -37,11 +36,16 @@ func main() {
 	os.Exit(0)
 }
 
-func newTTSServer(appKey, secretKey string) *ttsServer {
-	auth := oauth.New(appKey, secretKey, oauth.NewCacheMan())
-	tts := speech.NewTTS(auth)
+// newTTSServer creates the server speaking by baidu, the speeches are cached in cacheDir
+func newTTSServer(appKey, secretKey, cacheDir string) *ttsServer {
+	cache, err := tts.NewCache(cacheDir)
+	if err != nil {
+		log.Printf("[tts]failed to create the cache, speak without cache, error: %v", err)
+		cache = nil
+	}
+	engine := tts.NewBaidu(appKey, secretKey)
 	return &ttsServer{
-		tts: tts,
+		queue: tts.NewQueue(engine, cache, util.PlaybackDevice),
 	}
 }
 
@@ -92,43 +96,33 @@ func (s *ttsServer) handler(w http.ResponseWriter, r *http.Request) {
 		w.Write(s.pageContext)
 	case "POST":
 		txt := r.FormValue("text")
-		log.Printf("[tts]receive text: %v", txt)
-		go s.playText(txt)
+		prio := priority(r.FormValue("priority"))
+		log.Printf("[tts]receive text: %v, priority: %v", txt, prio)
+		go s.playText(txt, prio)
+
+	}
+}
 
+// priority parses the priority of the text, "alert", "normal" or "chatter", the default is normal.
+func priority(p string) tts.Priority {
+	switch p {
+	case "alert":
+		return tts.Alert
+	case "chatter":
+		return tts.Chatter
+	default:
+		return tts.Normal
 	}
 }
 
-func (s *ttsServer) playText(text string) error {
+func (s *ttsServer) playText(text string, prio tts.Priority) error {
 	if text == "" {
 		return nil
 	}
-	log.Printf("[tts]converting text to speech...")
-	wav, err := s.toSpeech(text)
-	if err != nil {
-		log.Printf("[tts]failed to convert test to speech, error: %v", err)
-		return err
-	}
-	log.Printf("[tts]converted in success")
-
-	log.Printf("[tts]playing wav...")
-	if err := util.PlayWav(wav); err != nil {
-		log.Printf("[tts]failed to play wav: %v, error: %v", wav, err)
+	if err := s.queue.Say(text, prio).Wait(); err != nil {
+		log.Printf("[tts]failed to play text: %v, error: %v", text, err)
 		return err
 	}
 	log.Printf("[tts]played in success")
 	return nil
 }
-
-func (s *ttsServer) toSpeech(text string) (string, error) {
-	data, err := s.tts.ToSpeech(text)
-	if err != nil {
-		log.Printf("[tts]failed to convert text to speech, error: %v", err)
-		return "", err
-	}
-
-	if err := ioutil.WriteFile(ttsWav, data, 0644); err != nil {
-		log.Printf("[tts]failed to save %v, error: %v", ttsWav, err)
-		return "", err
-	}
-	return ttsWav, nil
-}
@@ -1,12 +1,36 @@
 package main
 
 import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"testing"
 
+	"github.com/jakefau/rpi-devices/util/tts"
 	"github.com/stretchr/testify/assert"
 )
 
 func TestStart(t *testing.T) {
-	s := newTTSServer("app_key", "secret_key")
+	dir, err := ioutil.TempDir("", "tts")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	s := newTTSServer("app_key", "secret_key", filepath.Join(dir, "tts-cache"))
 	assert.NotNil(t, s)
 }
+
+func TestPriority(t *testing.T) {
+	testCases := []struct {
+		p    string
+		prio tts.Priority
+	}{
+		{"alert", tts.Alert},
+		{"normal", tts.Normal},
+		{"chatter", tts.Chatter},
+		{"", tts.Normal},
+		{"xxx", tts.Normal},
+	}
+	for _, test := range testCases {
+		assert.Equal(t, test.prio, priority(test.p), test.p)
+	}
+}
@@ -2,18 +2,27 @@ package main
 
 import (
 	"bytes"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"image"
 	"io"
 	"io/ioutil"
 	"log"
 	"net/http"
-	"os/exec"
+	"net/http/httputil"
+	"net/url"
+	"os"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/jakefau/rpi-devices/dev"
 	"github.com/jakefau/rpi-devices/util"
+	"github.com/jakefau/rpi-devices/util/motion"
+	"github.com/jakefau/rpi-devices/util/pantilt"
+	"github.com/jakefau/rpi-devices/util/schedule"
 	"github.com/stianeikeland/go-rpio"
 )
 
@@ -37,7 +46,7 @@ const (
     			</span>
 				~~~~~~~~~~~~~~~<br>
 				&nbsp;&ensp;Out of Service<br>
-				&nbsp;&emsp;20:00 ~ 9:00<br>
+				&nbsp;&emsp;Back at %v<br>
 				~~~~~~~~~~~~~~~<br>
 			</h1>
 		</html>
@@ -53,12 +62,56 @@ var (
 )
 
 var (
+	// the configs of the motion daemon, it's used only if vmonitor is built without open cv
 	motionConfs = map[mode]string{
 		normalMode: "/home/pi/motion_conf/normal_mode.conf",
 		babyMode:   "/home/pi/motion_conf/baby_mode.conf",
 	}
 )
 
+const (
+	// the live stream of the motion daemon, it's proxied on /video/
+	daemonStream = "http://127.0.0.1:8081"
+	motionDir    = "/home/pi/motion"
+)
+
+const (
+	// the step of the left, right, up and down ops
+	opStep      = 15
+	presetsFile = "presets.json"
+	// the patrol going on is saved in patrolFile, and resumed after restarting
+	patrolFile = "patrol.json"
+	// the default dwell of patrolling at each preset
+	patrolDwell = 30 * time.Second
+	// the schedule of the service in normal mode, see util/schedule for the format
+	scheduleFile = "schedule.json"
+)
+
+var (
+	// it's in service at 09:00~20:00 if there isn't a schedule file
+	defaultSchedule = schedule.Daily("09:00", "20:00")
+)
+
+// pantiltConfig returns the config of the pan-tilt, the limits are the ones of the holder
+func pantiltConfig() *pantilt.Config {
+	cfg := pantilt.DefaultConfig()
+	cfg.PanMin, cfg.PanMax = -90, 75
+	cfg.TiltMin, cfg.TiltMax = -30, 90
+	return cfg
+}
+
+// motionConfig returns the config of motion detection in the mode
+func motionConfig(m mode) *motion.Config {
+	cfg := motion.DefaultConfig()
+	cfg.Dir = motionDir
+	if m == babyMode {
+		// a sleeping baby only moves slightly
+		cfg.Sensitivity = 0.8
+		cfg.PostEvent = 10 * time.Second
+	}
+	return cfg
+}
+
 func main() {
 	if err := rpio.Open(); err != nil {
 		log.Fatalf("[vmonitor]failed to open rpio, error: %v", err)
@@ -109,33 +162,56 @@ func main() {
 }
 
 type videoServer struct {
-	hServo *dev.SG90
-	vServo *dev.SG90
 	led    *dev.Led
 	buzzer *dev.Buzzer
 	button *dev.Button
 
+	pt          *pantilt.PanTilt
+	schedule    *schedule.Schedule
 	mode        mode
 	inServing   bool
-	hAngle      int
-	vAngle      int
-	chAlert     chan int
+	chAlert     chan int // the latest count of the viewers
 	pageContext []byte
+	viewers     *viewers
+	daemon      http.Handler
+
+	mu            sync.Mutex
+	monitor       *motion.Monitor
+	motionHandler http.Handler
 }
 
 func newVideoServer(hServo, vServo *dev.SG90, led *dev.Led, buzzer *dev.Buzzer, button *dev.Button) *videoServer {
 	v := &videoServer{
-		hServo: hServo,
-		vServo: vServo,
 		led:    led,
 		buzzer: buzzer,
 		button: button,
 
+		pt:        pantilt.New(hServo, vServo, pantiltConfig()),
+		schedule:  loadSchedule(),
 		mode:      normalMode,
 		inServing: true,
-		hAngle:    0,
-		vAngle:    0,
-		chAlert:   make(chan int, 16),
+		chAlert:   make(chan int, 1),
+		viewers:   newViewers(),
+	}
+	daemon, _ := url.Parse(daemonStream)
+	v.daemon = &httputil.ReverseProxy{
+		Director: func(r *http.Request) {
+			r.URL.Scheme = daemon.Scheme
+			r.URL.Host = daemon.Host
+		},
+		FlushInterval: 100 * time.Millisecond,
+	}
+	v.viewers.onJoin = func(viewer *Viewer, n int) {
+		log.Printf("[vmonitor]viewer %v joined from %v, %v viewers", viewer.ID, viewer.IP, n)
+		v.notifyViewers(n)
+	}
+	v.viewers.onLeave = func(viewer *Viewer, n int) {
+		log.Printf("[vmonitor]viewer %v left after %v, sent %v bytes, %v viewers",
+			viewer.ID, time.Since(viewer.Start).Round(time.Second), viewer.Bytes, n)
+		v.notifyViewers(n)
+	}
+	if err := v.pt.LoadPresets(presetsFile); err != nil {
+		log.Printf("[vmonitor]failed to load presets, error: %v", err)
 	}
 
 	if err := v.restartMotion(); err != nil {
@@ -144,11 +220,26 @@ func newVideoServer(hServo, vServo *dev.SG90, led *dev.Led, buzzer *dev.Buzzer,
 	return v
 }
 
+// loadSchedule loads the schedule from the schedule file, or uses the default one
+func loadSchedule() *schedule.Schedule {
+	s, err := schedule.Load(scheduleFile)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Printf("[vmonitor]failed to load schedule, use the default one, error: %v", err)
+		}
+		return defaultSchedule
+	}
+	return s
+}
+
 func (v *videoServer) start() {
-	go v.hServo.Roll(v.hAngle)
-	go v.vServo.Roll(v.vAngle)
+	go func() {
+		v.pt.Reset()
+		if err := v.pt.LoadPatrol(patrolFile); err != nil {
+			log.Printf("[vmonitor]failed to resume patrol, error: %v", err)
+		}
+	}()
 	go v.alert()
-	go v.detectConnecting()
 	go v.detectServing()
 	go v.detectingMode()
 
@@ -158,6 +249,9 @@ func (v *videoServer) start() {
 	}
 
 	http.HandleFunc("/", v.handler)
+	http.HandleFunc("/pantilt", v.pantiltHandler)
+	http.Handle("/video/", http.StripPrefix("/video", http.HandlerFunc(v.videoHandler)))
+	http.HandleFunc("/viewers", v.viewersHandler)
 	err := http.ListenAndServe(":8080", nil)
 	if err != nil {
 		log.Fatal("ListenAndServe: ", err.Error())
@@ -215,7 +309,11 @@ func (v *videoServer) handler(w http.ResponseWriter, r *http.Request) {
 
 func (v *videoServer) homePageHandler(w http.ResponseWriter, r *http.Request) {
 	if v.outOfService() && v.mode == normalMode {
-		w.Write([]byte(pageOutOfService))
+		back := "unknown"
+		if next, _, ok := v.schedule.Next(time.Now()); ok {
+			back = next.Format("Mon 15:04")
+		}
+		fmt.Fprintf(w, pageOutOfService, back)
 		return
 	}
 	w.Write(v.pageContext)
@@ -240,51 +338,100 @@ func (v *videoServer) do(op string) {
 
 func (v *videoServer) stop() {
 	v.led.Off()
-	close(v.chAlert)
 }
 
 func (v *videoServer) left() {
 	log.Printf("[vmonitor]op: left")
-	angle := v.hAngle - 15
-	if angle < -90 {
-		return
-	}
-	v.hAngle = angle
-	log.Printf("[vmonitor]servo: %v", angle)
-	v.hServo.Roll(angle)
+	log.Printf("[vmonitor]servo: %v", v.pt.Move(-opStep, 0))
 }
 
 func (v *videoServer) right() {
 	log.Printf("[vmonitor]op: right")
-	angle := v.hAngle + 15
-	if angle > 75 {
-		return
-	}
-	v.hAngle = angle
-	log.Printf("[vmonitor]servo: %v", angle)
-	v.hServo.Roll(angle)
+	log.Printf("[vmonitor]servo: %v", v.pt.Move(opStep, 0))
 }
 
 func (v *videoServer) up() {
 	log.Printf("[vmonitor]op: up")
-	angle := v.vAngle + 15
-	if angle > 90 {
-		return
-	}
-	v.vAngle = angle
-	log.Printf("[vmonitor]servo: %v", angle)
-	v.vServo.Roll(angle)
+	log.Printf("[vmonitor]servo: %v", v.pt.Move(0, opStep))
 }
 
 func (v *videoServer) down() {
 	log.Printf("[vmonitor]op: down")
-	angle := v.vAngle - 15
-	if angle < -30 {
+	log.Printf("[vmonitor]servo: %v", v.pt.Move(0, -opStep))
+}
+
+// pantiltHandler returns the status of the pan-tilt on GET, and controls it on POST by op:
+//
+//	goto: move to pan and tilt
+//	preset: move to the preset of name
+//	save: save the current position as the preset of name
+//	delete: delete the preset of name
+//	patrol: patrol the presets in route separated by comma, and dwell seconds at each of them
+//	stop: stop patrolling
+//	track: turn on the auto-track mode if on is true, or turn it off
+func (v *videoServer) pantiltHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method == "POST" {
+		if err := v.doPantilt(r); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v.pt.Status())
+}
+
+func (v *videoServer) doPantilt(r *http.Request) error {
+	op := r.FormValue("op")
+	name := r.FormValue("name")
+	log.Printf("[vmonitor]pantilt op: %v", op)
+	switch op {
+	case "goto":
+		pan, err := strconv.Atoi(r.FormValue("pan"))
+		if err != nil {
+			return errors.New("invalid pan")
+		}
+		tilt, err := strconv.Atoi(r.FormValue("tilt"))
+		if err != nil {
+			return errors.New("invalid tilt")
+		}
+		go v.pt.MoveTo(pantilt.Position{Pan: pan, Tilt: tilt})
+	case "preset":
+		if _, err := v.pt.GotoPreset(name); err != nil {
+			return err
+		}
+	case "save":
+		return v.pt.SavePreset(name)
+	case "delete":
+		return v.pt.DeletePreset(name)
+	case "patrol":
+		dwell := patrolDwell
+		if s := r.FormValue("dwell"); s != "" {
+			sec, err := strconv.Atoi(s)
+			if err != nil || sec <= 0 {
+				return errors.New("invalid dwell")
+			}
+			dwell = time.Duration(sec) * time.Second
+		}
+		return v.pt.Patrol(strings.Split(r.FormValue("route"), ","), dwell)
+	case "stop":
+		v.pt.StopPatrol()
+	case "track":
+		v.pt.SetTracking(r.FormValue("on") == "true")
+	default:
+		return fmt.Errorf("invalid operator: %v", op)
+	}
+	return nil
+}
+
+// track follows the motion in auto-track mode, the motion of more than half of the frame is ignored,
+// since it's the move of the camera or the change of the light mostly.
+func (v *videoServer) track(f *motion.Frame, bounds image.Rectangle) {
+	if bounds.Dx()*bounds.Dy()*2 > f.Width*f.Height {
 		return
 	}
-	v.vAngle = angle
-	log.Printf("[vmonitor]servo: %v", angle)
-	v.vServo.Roll(angle)
+	if v.pt.Track(bounds, image.Point{X: f.Width, Y: f.Height}, f.Time) {
+		log.Printf("[vmonitor]track motion in %v, servo: %v", bounds, v.pt.Position())
+	}
 }
 
 func (v *videoServer) beep(n int, interval int) {
@@ -295,28 +442,28 @@ func (v *videoServer) beep(n int, interval int) {
 	v.buzzer.Beep(n, interval)
 }
 
-func (v *videoServer) detectConnecting() {
+// notifyViewers notifies the alert of the latest count of the viewers,
+// it replaces the count which hasn't been consumed yet, and never blocks.
+func (v *videoServer) notifyViewers(n int) {
 	for {
-		time.Sleep(5 * time.Second)
-		n, err := v.getConCount()
-		if err != nil {
-			log.Printf("[vmonitor]failed to get users count, err: %v", err)
-			continue
+		select {
+		case v.chAlert <- n:
+			return
+		default:
+		}
+		select {
+		case <-v.chAlert:
+		default:
 		}
-		v.chAlert <- n
 	}
 }
 
 func (v *videoServer) alert() {
 	conCount := 0
 	for {
-		if v.mode == babyMode {
-			time.Sleep(1 * time.Second)
-			continue
-		}
 		select {
 		case n := <-v.chAlert:
-			if n > conCount {
+			if n > conCount && v.mode != babyMode {
 				// there are new connections, give an alert
 				go v.beep(2, 100)
 			}
@@ -324,59 +471,40 @@ func (v *videoServer) alert() {
 		default:
 			// do nothing
 		}
-		if conCount > 0 {
+		if conCount > 0 && v.mode != babyMode {
 			v.led.Blink(1, 1000)
 		}
 		time.Sleep(1 * time.Second)
 	}
 }
 
-// getConCount is get the count of connecting to the server
-func (v *videoServer) getConCount() (int, error) {
-	cmd := `netstat -nat|grep -i "127.0.0.1:8081"|wc -l`
-	out, err := exec.Command("bash", "-c", cmd).CombinedOutput()
-	if err != nil {
-		return 0, err
-	}
-	var count int
-	str := string(out)
-	if n, err := fmt.Sscanf(str, "%d\n", &count); n != 1 || err != nil {
-		return 0, fmt.Errorf("failed to parse the output of netstat")
-	}
-	return count, nil
-}
-
+// detectServing starts and stops motion at the boundaries of the schedule
 func (v *videoServer) detectServing() {
-	for {
-		time.Sleep(15 * time.Second)
-		if v.mode == babyMode {
-			// keep serving in baby monitor mode
-			continue
-		}
-		if v.outOfService() {
-			if v.inServing {
-				log.Printf("[vmonitor]out of service, stop motion")
-				util.StopMotion()
-				v.inServing = false
-			}
-			continue
-		}
+	v.schedule.Run(nil, v.setServing)
+}
 
-		if !v.inServing {
-			log.Printf("[vmonitor]in service time, start motion")
-			util.StartMotion(motionConfs[v.mode])
-			v.inServing = true
+func (v *videoServer) setServing(active bool) {
+	if v.mode == babyMode {
+		// keep serving in baby monitor mode
+		return
+	}
+	if !active && v.inServing {
+		log.Printf("[vmonitor]out of service, stop motion")
+		v.stopMotion()
+		v.inServing = false
+		return
+	}
+	if active && !v.inServing {
+		log.Printf("[vmonitor]in service time, start motion")
+		if err := v.startMotion(); err != nil {
+			log.Printf("[vmonitor]failed to start motion, error: %v", err)
 		}
+		v.inServing = true
 	}
 }
 
 func (v *videoServer) outOfService() bool {
-	hour := time.Now().Hour()
-	if hour >= 20 || hour < 9 {
-		// out of service at 20:00~09:00
-		return true
-	}
-	return false
+	return !v.schedule.Active(time.Now())
 }
 
 func (v *videoServer) detectingMode() {
@@ -419,10 +547,15 @@ func (v *videoServer) detectingMode() {
 }
 
 func (v *videoServer) restartMotion() error {
-	if err := util.StopMotion(); err != nil {
+	if err := v.stopMotion(); err != nil {
 		return err
 	}
-	if err := util.StartMotion(motionConfs[v.mode]); err != nil {
+	if v.mode == normalMode && v.outOfService() {
+		log.Printf("[vmonitor]out of service, don't start motion")
+		v.inServing = false
+		return nil
+	}
+	if err := v.startMotion(); err != nil {
 		return err
 	}
 	if v.mode == normalMode {
@@ -430,3 +563,69 @@ func (v *videoServer) restartMotion() error {
 	}
 	return nil
 }
+
+// startMotion starts detecting motion in go, or starts the motion daemon if vmonitor is built without open cv
+func (v *videoServer) startMotion() error {
+	if !motion.Available() {
+		log.Printf("[vmonitor]built without open cv, use the motion daemon")
+		return util.StartMotion(motionConfs[v.mode])
+	}
+	m, err := motion.New(motionConfig(v.mode))
+	if err != nil {
+		return err
+	}
+	m.OnEvent = func(e *motion.Event) {
+		log.Printf("[vmonitor]motion in %v, recorded in %v", e.Zones, e.Clip)
+	}
+	m.OnMotion = func(f *motion.Frame, bounds image.Rectangle) {
+		go v.track(f, bounds)
+	}
+	if err := m.Start(); err != nil {
+		return err
+	}
+
+	v.mu.Lock()
+	v.monitor = m
+	v.motionHandler = m.Handler()
+	v.mu.Unlock()
+	return nil
+}
+
+func (v *videoServer) stopMotion() error {
+	v.mu.Lock()
+	m := v.monitor
+	v.monitor, v.motionHandler = nil, nil
+	v.mu.Unlock()
+	if !motion.Available() {
+		return util.StopMotion()
+	}
+	if m != nil {
+		m.Stop()
+	}
+	return nil
+}
+
+// videoHandler serves the live stream on /video/, and the snapshot and the events on /video/snapshot and /video/events
+// if detecting motion in go, or proxies the stream of the motion daemon.
+// the requests of the live stream are tracked as the sessions of the viewers.
+func (v *videoServer) videoHandler(w http.ResponseWriter, r *http.Request) {
+	v.mu.Lock()
+	h := v.motionHandler
+	v.mu.Unlock()
+	if h == nil {
+		if motion.Available() {
+			http.Error(w, "out of service", http.StatusServiceUnavailable)
+			return
+		}
+		h = v.daemon
+	}
+	if r.URL.Path == "/" || r.URL.Path == "" {
+		h = v.viewers.wrap(h)
+	}
+	h.ServeHTTP(w, r)
+}
+
+func (v *videoServer) viewersHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v.viewers.list())
+}
@@ -10,3 +10,12 @@ func TestStart(t *testing.T) {
 	v := &videoServer{}
 	assert.NotNil(t, v)
 }
+
+func TestNotifyViewers(t *testing.T) {
+	v := &videoServer{chAlert: make(chan int, 1)}
+	for _, n := range []int{1, 2, 3, 2} {
+		v.notifyViewers(n)
+	}
+	assert.Equal(t, 2, <-v.chAlert)
+	assert.Len(t, v.chAlert, 0)
+}
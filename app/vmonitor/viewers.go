@@ -0,0 +1,138 @@
+package main
+
+import (
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Viewer is a session of watching the live stream
+type Viewer struct {
+	ID    int       `json:"id"`
+	IP    string    `json:"ip"`
+	Start time.Time `json:"start"`
+	Bytes int64     `json:"bytes"`
+}
+
+// viewers tracks the sessions of the live stream
+type viewers struct {
+	// onJoin and onLeave are called with the viewer and the count of the viewers after joining or leaving
+	onJoin  func(v *Viewer, n int)
+	onLeave func(v *Viewer, n int)
+
+	mu       sync.Mutex
+	nextID   int
+	sessions map[int]*Viewer
+}
+
+func newViewers() *viewers {
+	return &viewers{
+		nextID:   1,
+		sessions: map[int]*Viewer{},
+	}
+}
+
+// wrap tracks the requests to h as the sessions of viewers
+func (vs *viewers) wrap(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		v := vs.join(clientIP(r), time.Now())
+		defer vs.leave(v)
+		h.ServeHTTP(&countingWriter{ResponseWriter: w, vs: vs, v: v}, r)
+	})
+}
+
+func (vs *viewers) join(ip string, now time.Time) *Viewer {
+	vs.mu.Lock()
+	v := &Viewer{
+		ID:    vs.nextID,
+		IP:    ip,
+		Start: now,
+	}
+	vs.nextID++
+	vs.sessions[v.ID] = v
+	n := len(vs.sessions)
+	c := *v
+	vs.mu.Unlock()
+
+	if vs.onJoin != nil {
+		vs.onJoin(&c, n)
+	}
+	return v
+}
+
+func (vs *viewers) leave(v *Viewer) {
+	vs.mu.Lock()
+	delete(vs.sessions, v.ID)
+	n := len(vs.sessions)
+	c := *v
+	vs.mu.Unlock()
+
+	if vs.onLeave != nil {
+		vs.onLeave(&c, n)
+	}
+}
+
+func (vs *viewers) add(v *Viewer, n int) {
+	vs.mu.Lock()
+	defer vs.mu.Unlock()
+	v.Bytes += int64(n)
+}
+
+// list returns the viewers watching, the earliest first
+func (vs *viewers) list() []*Viewer {
+	vs.mu.Lock()
+	defer vs.mu.Unlock()
+	list := []*Viewer{}
+	for _, v := range vs.sessions {
+		c := *v
+		list = append(list, &c)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].ID < list[j].ID
+	})
+	return list
+}
+
+func (vs *viewers) count() int {
+	vs.mu.Lock()
+	defer vs.mu.Unlock()
+	return len(vs.sessions)
+}
+
+// countingWriter counts the bytes sent to the viewer
+type countingWriter struct {
+	http.ResponseWriter
+	vs *viewers
+	v  *Viewer
+}
+
+func (w *countingWriter) Write(b []byte) (int, error) {
+	n, err := w.ResponseWriter.Write(b)
+	w.vs.add(w.v, n)
+	return n, err
+}
+
+// Flush flushes the frames of the stream to the viewer
+func (w *countingWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// clientIP returns the ip of the client, the one forwarded by the proxy first
+func clientIP(r *http.Request) string {
+	if ip := r.Header.Get("X-Real-IP"); ip != "" {
+		return ip
+	}
+	if fwd := r.Header.Get("X-Forwarded-For"); fwd != "" {
+		return strings.TrimSpace(strings.Split(fwd, ",")[0])
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestViewers(t *testing.T) {
+	vs := newViewers()
+	var joined, left []int
+	vs.onJoin = func(v *Viewer, n int) {
+		joined = append(joined, n)
+	}
+	vs.onLeave = func(v *Viewer, n int) {
+		left = append(left, n)
+	}
+
+	var watching []*Viewer
+	h := vs.wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("frame"))
+		watching = vs.list()
+		w.Write([]byte("frame"))
+	}))
+
+	testCases := []struct {
+		desc   string
+		header map[string]string
+		ip     string
+	}{
+		{
+			desc: "direct",
+			ip:   "192.0.2.1",
+		},
+		{
+			desc:   "real ip",
+			header: map[string]string{"X-Real-IP": "10.0.0.2"},
+			ip:     "10.0.0.2",
+		},
+		{
+			desc:   "forwarded",
+			header: map[string]string{"X-Forwarded-For": "10.0.0.3, 127.0.0.1"},
+			ip:     "10.0.0.3",
+		},
+	}
+	for i, test := range testCases {
+		r := httptest.NewRequest("GET", "/", nil)
+		for k, v := range test.header {
+			r.Header.Set(k, v)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+
+		body, _ := ioutil.ReadAll(w.Body)
+		assert.Equal(t, "frameframe", string(body), test.desc)
+		assert.Equal(t, 1, len(watching), test.desc)
+		assert.Equal(t, i+1, watching[0].ID, test.desc)
+		assert.Equal(t, test.ip, watching[0].IP, test.desc)
+		assert.Equal(t, int64(5), watching[0].Bytes, test.desc)
+		assert.Equal(t, 0, vs.count(), test.desc)
+	}
+	assert.Equal(t, []int{1, 1, 1}, joined)
+	assert.Equal(t, []int{0, 0, 0}, left)
+	assert.Equal(t, []*Viewer{}, vs.list())
+
+	// the bytes are counted
+	v := vs.join("10.0.0.4", time.Now())
+	vs.add(v, 100)
+	vs.add(v, 20)
+	assert.Equal(t, int64(120), vs.list()[0].Bytes)
+	vs.leave(v)
+	assert.Equal(t, 0, vs.count())
+}
@@ -1,6 +1,10 @@
 package dev
 
 import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
 	"os/exec"
 )
 
@@ -11,6 +15,8 @@ const (
 // Camera ...
 type Camera struct {
 	// steering *SG90
+	url  string
+	file string
 }
 
 // NewCamera ...
@@ -18,6 +24,16 @@ func NewCamera() *Camera {
 	return &Camera{}
 }
 
+// NewHTTPCamera creates a camera taking photos from the url serving snapshots in jpeg,
+// e.g. http://<ip>:8080/video/snapshot of app/vmonitor built with gocv, the photo will be saved to the file.
+// it falls back to the motion daemon like NewCamera if the url fails, e.g. vmonitor isn't running or is out of service.
+func NewHTTPCamera(url, file string) *Camera {
+	return &Camera{
+		url:  url,
+		file: file,
+	}
+}
+
 // TakePhoto take a photo using motion service.
 // in default, the created photo file will be in folder: /var/lib/motion
 // you can change the directory in the config of motion.
@@ -29,6 +45,13 @@ func NewCamera() *Camera {
 // snapshot_filename lastsnap.jpg
 // -----------------------------------------
 func (c *Camera) TakePhoto() (string, error) {
+	if c.url != "" {
+		file, err := c.download()
+		if err == nil {
+			return file, nil
+		}
+		log.Printf("[camera]failed to take photo from %v, take it by motion, error: %v", c.url, err)
+	}
 	// curl -s -o /dev/null http://localhost:8088/0/action/snapshot
 	cmd := exec.Command("curl", "-s", "-o", "/dev/null", "http://localhost:8088/0/action/snapshot")
 	_, err := cmd.CombinedOutput()
@@ -37,3 +60,22 @@ func (c *Camera) TakePhoto() (string, error) {
 	}
 	return imageFile, nil
 }
+
+func (c *Camera) download() (string, error) {
+	resp, err := http.Get(c.url)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("failed to take photo, status: %v", resp.Status)
+	}
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	if err := ioutil.WriteFile(c.file, data, 0644); err != nil {
+		return "", err
+	}
+	return c.file, nil
+}
@@ -1,5 +1,9 @@
 package dev
 
+import (
+	"github.com/jakefau/rpi-devices/util/geo"
+)
+
 const (
 	// voice speed in cm/s
 	voiceSpeed = 34000.0
@@ -21,6 +25,66 @@ type DistMeter interface {
 	Close()
 }
 
+// Motor is the engine of a car, e.g. L298N
+type Motor interface {
+	Forward()
+	Backward()
+	Left()
+	Right()
+	Stop()
+	Speed(s uint32)
+	Drive(left, right int)
+}
+
+// AngleMeter measures the yaw, pitch and roll in degree, e.g. GY25
+type AngleMeter interface {
+	Angles() (yaw, pitch, roll float64, err error)
+	IncludedAngle(yaw, yaw2 float64) float64
+}
+
+// PulseCounter counts the pulses of a wheel, e.g. Encoder
+type PulseCounter interface {
+	Start()
+	Stop()
+	Count1() int
+}
+
+// CollisionSwitch ...
+type CollisionSwitch interface {
+	Collided() bool
+}
+
+// Locator reports the location, e.g. GPS
+type Locator interface {
+	Loc() (*geo.Point, error)
+	Fix() (*GPSFix, error)
+}
+
+// Roller rolls to an angle in degree, e.g. SG90
+type Roller interface {
+	Roll(angle int)
+}
+
+// Beeper ...
+type Beeper interface {
+	Beep(n int, interval int)
+}
+
+// Light ...
+type Light interface {
+	On()
+	Off()
+	Blink(n int, interval int)
+}
+
+// Radio is a serial radio, e.g. LC12S
+type Radio interface {
+	Send(data []byte) error
+	Receive() ([]byte, error)
+	Wakeup()
+	Sleep()
+}
+
 // US100Config ...
 type US100Config struct {
 	Mode  ComMode
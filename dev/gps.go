@@ -74,6 +74,10 @@ const (
 	gpsRMC = "$GPRMC"
 	// Recommended Minimum Specific Data from GPS & Beidou/China
 	gpsAndBdRMC = "$GNRMC"
+	// Fix Data from GPS
+	gpsGGA = "$GPGGA"
+	// Fix Data from GPS & Beidou/China
+	gpsAndBdGGA = "$GNGGA"
 )
 
 var (
@@ -94,55 +98,114 @@ func NewGPS(dev string, baud int) *GPS {
 	return g
 }
 
+// GPSFix is a location fix with the quality of it
+// HDOP: horizontal dilution of precision, the smaller the better
+// Sats: the number of satellites in use
+type GPSFix struct {
+	Loc  *geo.Point
+	HDOP float64
+	Sats int
+}
+
 // Loc ...
 func (g *GPS) Loc() (*geo.Point, error) {
-	if err := g.port.Flush(); err != nil {
+	loc, err := g.readLine(gpsRMC, gpsAndBdRMC)
+	if err != nil {
+		return nil, err
+	}
+	items := strings.Split(loc, ",")
+	if len(items) < 7 {
+		return nil, fmt.Errorf("bad data from gps device")
+	}
+	return parseLatLon(items[3], items[4], items[5], items[6])
+}
+
+// Fix returns the location with the hdop and the number of satellites
+func (g *GPS) Fix() (*GPSFix, error) {
+	gga, err := g.readLine(gpsGGA, gpsAndBdGGA)
+	if err != nil {
+		return nil, err
+	}
+	items := strings.Split(gga, ",")
+	if len(items) < 9 {
+		return nil, fmt.Errorf("bad data from gps device")
+	}
+	// fix quality: 0 = invalid
+	if items[6] == "" || items[6] == "0" {
+		return nil, fmt.Errorf("gps isn't fixed")
+	}
+	pt, err := parseLatLon(items[2], items[3], items[4], items[5])
+	if err != nil {
 		return nil, err
 	}
+	fix := &GPSFix{Loc: pt}
+	if _, err := fmt.Sscanf(items[7], "%d", &fix.Sats); err != nil {
+		return nil, fmt.Errorf("failed to parse satellites, %v", err)
+	}
+	if _, err := fmt.Sscanf(items[8], "%f", &fix.HDOP); err != nil {
+		return nil, fmt.Errorf("failed to parse hdop, %v", err)
+	}
+	return fix, nil
+}
+
+// Close ...
+func (g *GPS) Close() {
+	g.port.Close()
+}
+
+func (g *GPS) open(dev string, baud int) error {
+	c := &serial.Config{Name: dev, Baud: baud}
+	p, err := serial.OpenPort(c)
+	if err != nil {
+		return err
+	}
+	g.port = p
+	return nil
+}
+
+// readLine reads the first line of any of the sentences from the gps device
+func (g *GPS) readLine(sentences ...string) (string, error) {
+	if err := g.port.Flush(); err != nil {
+		return "", err
+	}
 	a := 0
 	for a < 512 {
 		n, err := g.port.Read(buf[a:])
 		if err != nil {
-			return nil, err
+			return "", err
 		}
 		a += n
 	}
 	r := bufio.NewReader(bytes.NewReader(buf[:a]))
-	loc := ""
 	for {
 		line, err := r.ReadString('\n')
 		if err == io.EOF {
 			break
 		}
-		line = strings.Trim(line, " \t\n")
-		if strings.Contains(line, gpsRMC) || strings.Contains(line, gpsAndBdRMC) {
-			loc = line
-			break
+		line = strings.Trim(line, " \t\r\n")
+		for _, s := range sentences {
+			if strings.Contains(line, s) {
+				return line, nil
+			}
 		}
 	}
+	return "", fmt.Errorf("failed to read %v from gps device", sentences)
+}
 
-	if loc == "" {
-		return nil, fmt.Errorf("failed to read location from gps device")
-	}
-	items := strings.Split(loc, ",")
-	if len(items) < 7 {
-		return nil, fmt.Errorf("bad data from gps device")
-	}
-
+// parseLatLon parses the lat & lon in ddmm.mmmm format of nmea
+func parseLatLon(lat, northOrSouth, lon, eastOrWest string) (*geo.Point, error) {
 	var pt geo.Point
-	if _, err := fmt.Sscanf(items[3], "%f", &pt.Lat); err != nil {
+	if _, err := fmt.Sscanf(lat, "%f", &pt.Lat); err != nil {
 		return nil, fmt.Errorf("failed to parse lat, %v", err)
 	}
-	northOrSouth := ""
-	if _, err := fmt.Sscanf(items[4], "%s", &northOrSouth); err != nil {
-		return nil, fmt.Errorf("failed to parse north or south, %v", err)
+	if northOrSouth == "" {
+		return nil, fmt.Errorf("failed to parse north or south")
 	}
-	if _, err := fmt.Sscanf(items[5], "%f", &pt.Lon); err != nil {
+	if _, err := fmt.Sscanf(lon, "%f", &pt.Lon); err != nil {
 		return nil, fmt.Errorf("failed to parse lon, %v", err)
 	}
-	eastOrWest := ""
-	if _, err := fmt.Sscanf(items[6], "%s", &eastOrWest); err != nil {
-		return nil, fmt.Errorf("failed to parse east or west, %v", err)
+	if eastOrWest == "" {
+		return nil, fmt.Errorf("failed to parse east or west")
 	}
 	if northOrSouth == "S" {
 		pt.Lat = pt.Lat * (-1)
@@ -160,18 +223,3 @@ func (g *GPS) Loc() (*geo.Point, error) {
 
 	return &pt, nil
 }
-
-// Close ...
-func (g *GPS) Close() {
-	g.port.Close()
-}
-
-func (g *GPS) open(dev string, baud int) error {
-	c := &serial.Config{Name: dev, Baud: baud}
-	p, err := serial.OpenPort(c)
-	if err != nil {
-		return err
-	}
-	g.port = p
-	return nil
-}
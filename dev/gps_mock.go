@@ -6,14 +6,22 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"strings"
 
 	"github.com/jakefau/rpi-devices/util/geo"
 )
 
-// MockGPS ...
+const (
+	// the hdop of the points without hdop in the csv
+	mockHDOP = 1.0
+)
+
+// MockGPS replays the points in a csv file,
+// the csv has the columns "timestamp,lat,lon" and an optional "hdop" column.
 type MockGPS struct {
 	index  int
 	points []*geo.Point
+	hdops  []float64
 }
 
 // NewMockGPS ...
@@ -27,6 +35,15 @@ func NewMockGPS(csv string) *MockGPS {
 
 // Loc ...
 func (m *MockGPS) Loc() (*geo.Point, error) {
+	fix, err := m.Fix()
+	if err != nil {
+		return nil, err
+	}
+	return fix.Loc, nil
+}
+
+// Fix ...
+func (m *MockGPS) Fix() (*GPSFix, error) {
 	n := len(m.points)
 	if n == 0 {
 		return nil, errors.New("without data")
@@ -34,9 +51,12 @@ func (m *MockGPS) Loc() (*geo.Point, error) {
 	if m.index >= len(m.points) {
 		m.index = 0
 	}
-	pt := m.points[m.index]
+	fix := &GPSFix{
+		Loc:  m.points[m.index],
+		HDOP: m.hdops[m.index],
+	}
 	m.index++
-	return pt, nil
+	return fix, nil
 }
 
 // Close ...
@@ -49,25 +69,52 @@ func (m *MockGPS) open(csv string) error {
 	if err != nil {
 		return err
 	}
+	defer file.Close()
 
 	reader := bufio.NewReader(file)
+	hdopCol := -1
 	for {
 		line, err := reader.ReadString('\n')
 		if err == io.EOF {
 			break
 		}
-		var timestamp string
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		items := strings.Split(line, ",")
+		if items[0] == "timestamp" {
+			// the header
+			for i, name := range items {
+				if name == "hdop" {
+					hdopCol = i
+				}
+			}
+			continue
+		}
+		if len(items) < 3 {
+			return fmt.Errorf("bad line: %v", line)
+		}
 		var lat, lon float64
-		if _, err := fmt.Sscanf(line, "%19s,%f,%f\n", &timestamp, &lat, &lon); err != nil {
+		if _, err := fmt.Sscanf(items[1], "%f", &lat); err != nil {
 			return err
 		}
+		if _, err := fmt.Sscanf(items[2], "%f", &lon); err != nil {
+			return err
+		}
+		hdop := mockHDOP
+		if hdopCol > 0 && hdopCol < len(items) && items[hdopCol] != "" {
+			if _, err := fmt.Sscanf(items[hdopCol], "%f", &hdop); err != nil {
+				return err
+			}
+		}
 		pt := &geo.Point{
 			Lat: lat,
 			Lon: lon,
 		}
 		m.points = append(m.points, pt)
+		m.hdops = append(m.hdops, hdop)
 	}
-	file.Close()
 	m.index = 0
 
 	return nil
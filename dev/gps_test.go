@@ -0,0 +1,71 @@
+package dev
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseLatLon(t *testing.T) {
+	testCases := []struct {
+		lat, ns, lon, ew string
+		wantLat, wantLon float64
+		wantErr          bool
+	}{
+		{"3958.0090", "N", "11622.5545", "E", 39.966817, 116.375908, false},
+		{"3958.0090", "S", "11622.5545", "W", -39.966817, -116.375908, false},
+		{"", "N", "11622.5545", "E", 0, 0, true},
+		{"3958.0090", "", "11622.5545", "E", 0, 0, true},
+	}
+	for _, test := range testCases {
+		pt, err := parseLatLon(test.lat, test.ns, test.lon, test.ew)
+		if test.wantErr {
+			assert.Error(t, err)
+			continue
+		}
+		assert.NoError(t, err)
+		assert.InDelta(t, test.wantLat, pt.Lat, 1e-6)
+		assert.InDelta(t, test.wantLon, pt.Lon, 1e-6)
+	}
+}
+
+func TestMockGPSFix(t *testing.T) {
+	gps := NewMockGPS("./test/gps.csv")
+	assert.NotNil(t, gps)
+
+	fix, err := gps.Fix()
+	assert.NoError(t, err)
+	assert.InDelta(t, 39.966816, fix.Loc.Lat, 1e-6)
+	assert.InDelta(t, 116.375908, fix.Loc.Lon, 1e-6)
+	assert.Equal(t, mockHDOP, fix.HDOP)
+
+	for i := 0; i < 9; i++ {
+		_, err := gps.Loc()
+		assert.NoError(t, err)
+	}
+	// replay from the beginning
+	pt, err := gps.Loc()
+	assert.NoError(t, err)
+	assert.InDelta(t, 39.966816, pt.Lat, 1e-6)
+}
+
+func TestMockGPSHDOP(t *testing.T) {
+	f, err := ioutil.TempFile("", "gps*.csv")
+	assert.NoError(t, err)
+	defer os.Remove(f.Name())
+	f.WriteString("timestamp,lat,lon,hdop\n")
+	f.WriteString("2019-08-21T20:43:20,39.966816,116.375908,2.5\n")
+	f.WriteString("2019-08-21T20:43:26,39.966846,116.376984,\n")
+	f.Close()
+
+	gps := NewMockGPS(f.Name())
+	assert.NotNil(t, gps)
+	fix, err := gps.Fix()
+	assert.NoError(t, err)
+	assert.Equal(t, 2.5, fix.HDOP)
+	fix, err = gps.Fix()
+	assert.NoError(t, err)
+	assert.Equal(t, mockHDOP, fix.HDOP)
+}
@@ -43,6 +43,9 @@ type L298N struct {
 	in4 rpio.Pin
 	ena rpio.Pin
 	enb rpio.Pin
+	// the speed set by Speed, Drive changes the duty cycles of the enables,
+	// so the moves apply it again to both of them
+	speed uint32
 }
 
 // NewL298N ...
@@ -77,6 +80,7 @@ func (l *L298N) Forward() {
 	l.in2.Low()
 	l.in3.High()
 	l.in4.Low()
+	l.enable()
 }
 
 // Backward ...
@@ -85,6 +89,7 @@ func (l *L298N) Backward() {
 	l.in2.High()
 	l.in3.Low()
 	l.in4.High()
+	l.enable()
 }
 
 // Left ...
@@ -93,6 +98,7 @@ func (l *L298N) Left() {
 	l.in2.High()
 	l.in3.High()
 	l.in4.Low()
+	l.enable()
 }
 
 // Right ...
@@ -101,6 +107,7 @@ func (l *L298N) Right() {
 	l.in2.Low()
 	l.in3.Low()
 	l.in4.High()
+	l.enable()
 }
 
 // Stop ...
@@ -111,10 +118,47 @@ func (l *L298N) Stop() {
 	l.in4.Low()
 }
 
+// Drive drives the left motor(A) and the right motor(B) in different speeds.
+// speed: [-100, 100], a negative speed means moving backward.
+// it can be used for steering continuously like a differential drive.
+func (l *L298N) Drive(left, right int) {
+	l.drive(l.in1, l.in2, l.ena, left)
+	l.drive(l.in3, l.in4, l.enb, right)
+}
+
 // Speed ...
 func (l *L298N) Speed(s uint32) {
+	l.speed = s
 	l.ena.DutyCycle(0, 100)
 	l.enb.DutyCycle(0, 100)
 	l.ena.DutyCycle(s, 100)
 	l.enb.DutyCycle(s, 100)
 }
+
+// enable applies the speed to both motors, e.g. after Drive
+func (l *L298N) enable() {
+	l.ena.DutyCycle(l.speed, 100)
+	l.enb.DutyCycle(l.speed, 100)
+}
+
+func (l *L298N) drive(in1, in2, en rpio.Pin, speed int) {
+	if speed > 100 {
+		speed = 100
+	}
+	if speed < -100 {
+		speed = -100
+	}
+	switch {
+	case speed > 0:
+		in1.High()
+		in2.Low()
+	case speed < 0:
+		in1.Low()
+		in2.High()
+		speed = -speed
+	default:
+		in1.Low()
+		in2.Low()
+	}
+	en.DutyCycle(uint32(speed), 100)
+}
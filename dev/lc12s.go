@@ -31,6 +31,7 @@ package dev
 import (
 	"fmt"
 	"io"
+	"time"
 
 	"github.com/stianeikeland/go-rpio"
 	"github.com/tarm/serial"
@@ -38,6 +39,8 @@ import (
 
 const (
 	bufsz = 128
+	// Receive returns empty data if nothing is received in the timeout
+	lc12sReadTimeout = 100 * time.Millisecond
 )
 
 // LC12S ...
@@ -73,12 +76,9 @@ func (l *LC12S) Send(data []byte) error {
 	return nil
 }
 
-// Receive ...
+// Receive receives the data in the buffer of the serial port,
+// empty data will be returned if nothing is received in 100ms.
 func (l *LC12S) Receive() ([]byte, error) {
-	if err := l.port.Flush(); err != nil {
-		return nil, err
-	}
-
 	var buf [bufsz]byte
 	n, err := l.port.Read(buf[:])
 	if err == io.EOF {
@@ -110,8 +110,9 @@ func (l *LC12S) Close() {
 
 func (l *LC12S) open(dev string, baud int) error {
 	c := &serial.Config{
-		Name: dev,
-		Baud: baud,
+		Name:        dev,
+		Baud:        baud,
+		ReadTimeout: lc12sReadTimeout,
 	}
 	port, err := serial.OpenPort(c)
 	if err != nil {
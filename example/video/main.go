@@ -14,6 +14,8 @@ import (
 
 const (
 	host = "0.0.0.0:8088"
+	// the hsv profiles calibrated on http://<host>/calibrate
+	profiles = "hsv.json"
 )
 
 var stream *cv.Stream
@@ -37,6 +39,7 @@ func main() {
 	defer cam.Close()
 
 	stream = cv.NewStream(cam, host)
+	stream.Calibrate(profiles)
 	stream.Start()
 
 	os.Exit(0)
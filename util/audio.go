@@ -3,64 +3,103 @@ package util
 import (
 	"fmt"
 	"os/exec"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/jakefau/rpi-devices/util/audio"
 )
 
-// PlayWav plays wav audio using aplay
+var (
+	// PlaybackDevice is the sound card for playing
+	PlaybackDevice audio.Device = audio.NewCard("default")
+	// CaptureDevice is the sound card for recording, e.g. a usb micro-phone,
+	// use commond "$arecord -l" for viewing card number and device number like 1,0
+	CaptureDevice audio.Device = audio.NewCard("plughw:1,0")
+
+	amu       sync.Mutex
+	playbacks = map[*audio.Playback]bool{}
+	mp3s      = map[*exec.Cmd]bool{}
+)
+
+// PlayWav plays wav audio on PlaybackDevice, it returns after playing or being stopped by StopWav
 func PlayWav(wav string) error {
-	cmd := exec.Command("aplay", wav)
-	if _, err := cmd.CombinedOutput(); err != nil {
+	p, err := audio.PlayFile(PlaybackDevice, wav)
+	if err != nil {
 		return err
 	}
-	return nil
+	amu.Lock()
+	playbacks[p] = true
+	amu.Unlock()
+
+	err = p.Wait()
+
+	amu.Lock()
+	delete(playbacks, p)
+	amu.Unlock()
+	return err
 }
 
-// StopWav stops to play wav
+// StopWav stops the wavs played by PlayWav
 func StopWav() error {
-	cmd := "sudo killall aplay"
-	if _, err := exec.Command("bash", "-c", cmd).CombinedOutput(); err != nil {
-		return err
+	amu.Lock()
+	defer amu.Unlock()
+	for p := range playbacks {
+		p.Stop()
 	}
 	return nil
 }
 
 // PlayMp3 play mp3 audio using mpg123
-// you need to install mpg123 first
+// you need to install mpg123 first, util/audio doesn't decode mp3.
+// mp3 can be a pattern of the files, e.g. ./music/*.mp3
 func PlayMp3(mp3 string) error {
-	cmd := "mpg123 -Z -q " + mp3
-	if _, err := exec.Command("bash", "-c", cmd).CombinedOutput(); err != nil {
+	files, err := filepath.Glob(mp3)
+	if err != nil {
 		return err
 	}
-	return nil
+	if len(files) == 0 {
+		return fmt.Errorf("no mp3 found: %v", mp3)
+	}
+	// run mpg123 without a shell, so it's the process stopped by StopMp3
+	cmd := exec.Command("mpg123", append([]string{"-Z", "-q"}, files...)...)
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	amu.Lock()
+	mp3s[cmd] = true
+	amu.Unlock()
+
+	err = cmd.Wait()
+
+	amu.Lock()
+	delete(mp3s, cmd)
+	amu.Unlock()
+	return err
 }
 
-// StopMp3 stops to play mp3
+// StopMp3 stops the mp3s played by PlayMp3
 func StopMp3() error {
-	cmd := "sudo killall mpg123"
-	if _, err := exec.Command("bash", "-c", cmd).CombinedOutput(); err != nil {
-		return err
+	amu.Lock()
+	defer amu.Unlock()
+	for cmd := range mp3s {
+		if err := cmd.Process.Kill(); err != nil {
+			return err
+		}
 	}
 	return nil
 }
 
-// Record records voice using arecord
-// you need to setup a micro-phone and set it as default device
-// arecord usage:
-// -D:			device, use commond "$arecord -l" for viewing card number and device number like 1,0
-// -d 3:		3 seconds
-// -t wav:		wav type
-// -r 16000:	Rate 16000 Hz
-// -c 1:		1 channel
-// -f S16_LE:	Signed 16 bit Little Endian
+// Record records voice in 16k mono from CaptureDevice, and saves it to a wav file
 func Record(sec int, saveTo string) error {
-	cmd := fmt.Sprintf(`sudo arecord -D "plughw:1,0" -d %v -t wav -r 16000 -c 1 -f S16_LE %v`, sec, saveTo)
-	_, err := exec.Command("bash", "-c", cmd).CombinedOutput()
+	b, err := audio.Record(CaptureDevice, audio.Voice, time.Duration(sec)*time.Second)
 	if err != nil {
 		return err
 	}
-	return nil
+	return audio.WriteFile(saveTo, b)
 }
 
-// SetVolume sets the volume using amixer
+// SetVolume sets the volume using amixer, util/audio doesn't control the mixer
 func SetVolume(v int) error {
 	// amixer -M set PCM 20%
 	cmd := exec.Command("amixer", "-M", "set", "PCM", fmt.Sprintf("%v%%", v))
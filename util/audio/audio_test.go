@@ -0,0 +1,157 @@
+package audio
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// tone creates a buffer of a 440hz tone with silence before and after it
+func tone(f Format, silence, sound time.Duration, amp float64) *Buffer {
+	b := &Buffer{Format: f}
+	n := f.bytesOf(silence) / f.frameBytes()
+	m := f.bytesOf(sound) / f.frameBytes()
+	for i := 0; i < n+m+n; i++ {
+		v := 0.0
+		if i >= n && i < n+m {
+			v = amp * math.Sin(2*math.Pi*440*float64(i)/float64(f.Rate))
+		}
+		for c := 0; c < f.Channels; c++ {
+			b.Samples = append(b.Samples, int16(v*32767))
+		}
+	}
+	return b
+}
+
+func TestEncode(t *testing.T) {
+	b := tone(Format{Rate: 8000, Channels: 2}, 0, 100*time.Millisecond, 0.5)
+	var buf bytes.Buffer
+	assert.NoError(t, Encode(&buf, b))
+	assert.Equal(t, 44+2*len(b.Samples), buf.Len())
+
+	b2, err := Decode(&buf)
+	assert.NoError(t, err)
+	assert.Equal(t, b, b2)
+	assert.Equal(t, 100*time.Millisecond, b2.Duration())
+	assert.Equal(t, 800, len(b2.Mono()))
+
+	_, err = Decode(bytes.NewReader([]byte("RIFF....WAVX")))
+	assert.Error(t, err)
+
+	// 8-bit pcm
+	buf.Reset()
+	assert.NoError(t, Encode(&buf, b))
+	data := buf.Bytes()
+	data[34] = 8
+	_, err = Decode(bytes.NewReader(data))
+	assert.True(t, errors.Is(err, ErrUnsupported))
+}
+
+func TestPlay(t *testing.T) {
+	dir, err := ioutil.TempDir("", "audio")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	d := NewFakeDevice("", dir)
+	b := tone(Voice, 0, 200*time.Millisecond, 0.5)
+	assert.NoError(t, Play(d, b).Wait())
+	assert.Equal(t, 1, len(d.Played()))
+	assert.Equal(t, b, d.Played()[0])
+	played, err := ReadFile(filepath.Join(dir, "played-1.wav"))
+	assert.NoError(t, err)
+	assert.Equal(t, b, played)
+
+	// stop playing
+	d.Realtime = true
+	p := Play(d, tone(Voice, 0, 2*time.Second, 0.5))
+	time.Sleep(200 * time.Millisecond)
+	p.Stop()
+	select {
+	case <-p.Done():
+	case <-time.After(time.Second):
+		t.Fatal("failed to stop playing")
+	}
+	assert.Equal(t, ErrStopped, p.Wait())
+	assert.True(t, d.Played()[1].Duration() < time.Second)
+}
+
+func TestRecord(t *testing.T) {
+	dir, err := ioutil.TempDir("", "audio")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	in := filepath.Join(dir, "in.wav")
+	assert.NoError(t, WriteFile(in, tone(Voice, 0, time.Second, 0.5)))
+	d := NewFakeDevice(in, "")
+
+	// record for a while
+	b, err := Record(d, Voice, 300*time.Millisecond)
+	assert.NoError(t, err)
+	assert.Equal(t, 300*time.Millisecond, b.Duration())
+
+	// record to the end of the input
+	b, err = Record(d, Voice, 5*time.Second)
+	assert.NoError(t, err)
+	assert.Equal(t, time.Second, b.Duration())
+
+	// stop recording
+	d.In = ""
+	d.Realtime = true
+	r := Start(d, Voice, 0)
+	time.Sleep(200 * time.Millisecond)
+	r.Stop()
+	b, err = r.Wait()
+	assert.NoError(t, err)
+	assert.True(t, b.Duration() > 100*time.Millisecond && b.Duration() < time.Second)
+
+	// a wrong format
+	d.In = in
+	_, err = Record(d, Format{Rate: 44100, Channels: 2}, time.Second)
+	assert.Error(t, err)
+}
+
+func TestVAD(t *testing.T) {
+	vad := NewVAD()
+	testCases := []struct {
+		desc  string
+		buf   *Buffer
+		voice bool
+		min   time.Duration
+		max   time.Duration
+	}{
+		{
+			desc:  "a tone in silence",
+			buf:   tone(Voice, 500*time.Millisecond, 400*time.Millisecond, 0.3),
+			voice: true,
+			min:   400 * time.Millisecond,
+			max:   650 * time.Millisecond,
+		},
+		{
+			desc:  "silence",
+			buf:   tone(Voice, 500*time.Millisecond, 0, 0),
+			voice: false,
+		},
+		{
+			desc:  "silence not in whole frames",
+			buf:   &Buffer{Format: Voice, Samples: make([]int16, 1001)},
+			voice: false,
+		},
+		{
+			desc:  "a tone only",
+			buf:   tone(Voice, 0, 400*time.Millisecond, 0.3),
+			voice: false,
+		},
+	}
+	for _, test := range testCases {
+		assert.Equal(t, test.voice, vad.HasVoice(test.buf), test.desc)
+		d := vad.Trim(test.buf).Duration()
+		assert.True(t, d >= test.min && d <= test.max, test.desc)
+	}
+}
@@ -0,0 +1,303 @@
+package audio
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"sync"
+	"time"
+)
+
+const (
+	// the length of a chunk written to or read from a device
+	chunkTime = 50 * time.Millisecond
+)
+
+// ErrStopped means the playback or recording is stopped
+var ErrStopped = errors.New("stopped")
+
+// Device is a sound card
+type Device interface {
+	// Play opens a stream to play pcm in the format, closing the stream drains it
+	Play(f Format) (io.WriteCloser, error)
+	// Capture opens a stream to capture pcm in the format, closing the stream stops capturing
+	Capture(f Format) (io.ReadCloser, error)
+}
+
+// Card is a sound card of alsa, e.g. "default" or "plughw:1,0" for a usb sound card,
+// use "$ aplay -l" and "$ arecord -l" to list the cards.
+// the pcm is streamed through a pipe of aplay or arecord owned by the stream,
+// so stopping a stream never affects the other streams or processes.
+// it needs alsa-utils, opening the pcm of alsa in process isn't supported.
+type Card struct {
+	Name string
+}
+
+// NewCard ...
+func NewCard(name string) *Card {
+	return &Card{Name: name}
+}
+
+// Play ...
+func (c *Card) Play(f Format) (io.WriteCloser, error) {
+	cmd := exec.Command("aplay", c.args(f)...)
+	w, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	return &playStream{WriteCloser: w, cmd: cmd}, nil
+}
+
+// Capture ...
+func (c *Card) Capture(f Format) (io.ReadCloser, error) {
+	cmd := exec.Command("arecord", c.args(f)...)
+	r, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	return &captureStream{ReadCloser: r, cmd: cmd}, nil
+}
+
+// playFile plays a wav file by aplay, aplay decodes the formats which Decode doesn't support
+func (c *Card) playFile(file string) (*Playback, error) {
+	cmd := exec.Command("aplay", "-q", "-D", c.Name, file)
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	p := &Playback{done: make(chan bool), kill: cmd.Process.Kill}
+	go func() {
+		err := cmd.Wait()
+		if p.isStopped() {
+			err = ErrStopped
+		}
+		p.err = err
+		close(p.done)
+	}()
+	return p, nil
+}
+
+func (c *Card) args(f Format) []string {
+	return []string{
+		"-q",
+		"-D", c.Name,
+		"-t", "raw",
+		"-f", "S16_LE",
+		"-r", fmt.Sprintf("%v", f.Rate),
+		"-c", fmt.Sprintf("%v", f.Channels),
+		"-",
+	}
+}
+
+type playStream struct {
+	io.WriteCloser
+	cmd *exec.Cmd
+}
+
+// Close closes the pipe, and waits for playing the pcm in the pipe
+func (s *playStream) Close() error {
+	s.WriteCloser.Close()
+	return s.cmd.Wait()
+}
+
+type captureStream struct {
+	io.ReadCloser
+	cmd *exec.Cmd
+}
+
+// Close stops capturing
+func (s *captureStream) Close() error {
+	s.cmd.Process.Kill()
+	s.cmd.Wait()
+	return nil
+}
+
+// Playback is a buffer being played
+type Playback struct {
+	mu      sync.Mutex
+	stopped bool
+	// kill kills aplay playing a file
+	kill func() error
+	done chan bool
+	err  error
+}
+
+// Play plays the buffer in background
+func Play(d Device, b *Buffer) *Playback {
+	p := &Playback{done: make(chan bool)}
+	go func() {
+		p.err = p.play(d, b)
+		close(p.done)
+	}()
+	return p
+}
+
+// PlayFile plays a wav file in background.
+// a wav which isn't 16-bit pcm, e.g. 8-bit or 24-bit, is played by aplay itself if d is a Card,
+// and the playback still stops only its own aplay.
+func PlayFile(d Device, file string) (*Playback, error) {
+	b, err := ReadFile(file)
+	if errors.Is(err, ErrUnsupported) {
+		if c, ok := d.(*Card); ok {
+			return c.playFile(file)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return Play(d, b), nil
+}
+
+// Stop stops playing, the pcm written to the device may be played for a while
+func (p *Playback) Stop() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.stopped = true
+	if p.kill != nil {
+		p.kill()
+	}
+}
+
+// Wait waits for the end of playing, ErrStopped will be returned if it is stopped
+func (p *Playback) Wait() error {
+	<-p.done
+	return p.err
+}
+
+// Done ...
+func (p *Playback) Done() <-chan bool {
+	return p.done
+}
+
+func (p *Playback) isStopped() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.stopped
+}
+
+func (p *Playback) play(d Device, b *Buffer) error {
+	w, err := d.Play(b.Format)
+	if err != nil {
+		return err
+	}
+	data := b.Bytes()
+	chunk := b.bytesOf(chunkTime)
+	for i := 0; i < len(data); i += chunk {
+		if p.isStopped() {
+			w.Close()
+			return ErrStopped
+		}
+		end := i + chunk
+		if end > len(data) {
+			end = len(data)
+		}
+		if _, err := w.Write(data[i:end]); err != nil {
+			w.Close()
+			return err
+		}
+	}
+	return w.Close()
+}
+
+// Recording is a recording in progress
+type Recording struct {
+	mu      sync.Mutex
+	buf     *Buffer
+	stopped bool
+	done    chan bool
+	err     error
+}
+
+// Start starts recording in background until it is stopped or the max duration, 0 means no limit
+func Start(d Device, f Format, max time.Duration) *Recording {
+	r := &Recording{
+		buf:  &Buffer{Format: f},
+		done: make(chan bool),
+	}
+	go func() {
+		r.err = r.record(d, f, max)
+		close(r.done)
+	}()
+	return r
+}
+
+// Record records for the duration
+func Record(d Device, f Format, dur time.Duration) (*Buffer, error) {
+	return Start(d, f, dur).Wait()
+}
+
+// Stop stops recording
+func (r *Recording) Stop() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.stopped = true
+}
+
+// Wait waits for the end of recording, and returns the pcm recorded
+func (r *Recording) Wait() (*Buffer, error) {
+	<-r.done
+	return r.Buffer(), r.err
+}
+
+// Buffer returns a copy of the pcm recorded so far
+func (r *Recording) Buffer() *Buffer {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return &Buffer{
+		Format:  r.buf.Format,
+		Samples: append([]int16{}, r.buf.Samples...),
+	}
+}
+
+func (r *Recording) record(d Device, f Format, max time.Duration) error {
+	rd, err := d.Capture(f)
+	if err != nil {
+		return err
+	}
+	defer rd.Close()
+
+	var (
+		want  = -1 // the bytes to record, -1 means no limit
+		total = 0
+		buf   = make([]byte, f.bytesOf(chunkTime))
+		odd   []byte
+	)
+	if max > 0 {
+		want = f.bytesOf(max)
+	}
+	for want < 0 || total < want {
+		r.mu.Lock()
+		stopped := r.stopped
+		r.mu.Unlock()
+		if stopped {
+			return nil
+		}
+
+		n, err := rd.Read(buf)
+		if want >= 0 && total+n > want {
+			n = want - total
+		}
+		total += n
+		data := append(odd, buf[:n]...)
+		odd = nil
+		if len(data)%2 == 1 {
+			odd = []byte{data[len(data)-1]}
+		}
+		r.mu.Lock()
+		r.buf.appendBytes(data)
+		r.mu.Unlock()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
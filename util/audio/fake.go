@@ -0,0 +1,116 @@
+package audio
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// FakeDevice is a sound card backed by files for testing,
+// it captures the pcm from the wav In, and saves the pcm played to played-<n>.wav in the directory Out.
+// In and Out are optional, it captures silence without In, and only keeps the pcm played in memory without Out.
+// Realtime makes it capture and play at the rate of the format like a real card.
+type FakeDevice struct {
+	In       string
+	Out      string
+	Realtime bool
+
+	mu     sync.Mutex
+	played []*Buffer
+}
+
+// NewFakeDevice ...
+func NewFakeDevice(in, out string) *FakeDevice {
+	return &FakeDevice{In: in, Out: out}
+}
+
+// Played returns the buffers played
+func (d *FakeDevice) Played() []*Buffer {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return append([]*Buffer{}, d.played...)
+}
+
+// Play ...
+func (d *FakeDevice) Play(f Format) (io.WriteCloser, error) {
+	return &fakePlayStream{d: d, f: f}, nil
+}
+
+// Capture ...
+func (d *FakeDevice) Capture(f Format) (io.ReadCloser, error) {
+	if d.In == "" {
+		return &fakeCaptureStream{r: &silence{}, f: f, realtime: d.Realtime}, nil
+	}
+	b, err := ReadFile(d.In)
+	if err != nil {
+		return nil, err
+	}
+	if b.Format != f {
+		return nil, fmt.Errorf("the format of %v is %+v, but %+v is wanted", d.In, b.Format, f)
+	}
+	return &fakeCaptureStream{r: bytes.NewReader(b.Bytes()), f: f, realtime: d.Realtime}, nil
+}
+
+type fakePlayStream struct {
+	d   *FakeDevice
+	f   Format
+	buf bytes.Buffer
+}
+
+func (s *fakePlayStream) Write(data []byte) (int, error) {
+	if s.d.Realtime {
+		time.Sleep(duration(s.f, len(data)))
+	}
+	return s.buf.Write(data)
+}
+
+func (s *fakePlayStream) Close() error {
+	b := &Buffer{Format: s.f}
+	b.appendBytes(s.buf.Bytes())
+
+	s.d.mu.Lock()
+	s.d.played = append(s.d.played, b)
+	n := len(s.d.played)
+	s.d.mu.Unlock()
+
+	if s.d.Out == "" {
+		return nil
+	}
+	return WriteFile(filepath.Join(s.d.Out, fmt.Sprintf("played-%v.wav", n)), b)
+}
+
+type fakeCaptureStream struct {
+	r        io.Reader
+	f        Format
+	realtime bool
+}
+
+func (s *fakeCaptureStream) Read(data []byte) (int, error) {
+	n, err := s.r.Read(data)
+	if s.realtime {
+		time.Sleep(duration(s.f, n))
+	}
+	return n, err
+}
+
+func (s *fakeCaptureStream) Close() error {
+	return nil
+}
+
+// silence is an endless stream of silence
+type silence struct{}
+
+func (s *silence) Read(data []byte) (int, error) {
+	for i := range data {
+		data[i] = 0
+	}
+	return len(data), nil
+}
+
+// duration returns the duration of n bytes of pcm
+func duration(f Format, n int) time.Duration {
+	return time.Duration(n/f.frameBytes()) * time.Second / time.Duration(f.Rate)
+}
@@ -0,0 +1,119 @@
+package audio
+
+import (
+	"math"
+	"sort"
+	"time"
+)
+
+// VAD is an energy-based voice activity detector,
+// a frame is voiced if its energy is higher than the noise floor by Threshold.
+// Frame: the length of a frame
+// Threshold: in dB
+// Floor: the min noise floor in dBFS, it keeps the detector from triggering on a silent recording
+// Hangover: the time a voice lasts after the energy drops, it keeps the tails of words
+type VAD struct {
+	Frame     time.Duration
+	Threshold float64
+	Floor     float64
+	Hangover  time.Duration
+}
+
+// NewVAD creates a vad for speech
+func NewVAD() *VAD {
+	return &VAD{
+		Frame:     20 * time.Millisecond,
+		Threshold: 12,
+		Floor:     -60,
+		Hangover:  200 * time.Millisecond,
+	}
+}
+
+// Voiced returns whether each frame of the buffer is voiced
+func (v *VAD) Voiced(b *Buffer) []bool {
+	energies := v.energies(b)
+	if len(energies) == 0 {
+		return nil
+	}
+
+	// the noise floor is the 10th percentile of the energies
+	sorted := append([]float64{}, energies...)
+	sort.Float64s(sorted)
+	floor := math.Max(sorted[len(sorted)/10], v.Floor)
+
+	hang := int(v.Hangover / v.Frame)
+	voiced := make([]bool, len(energies))
+	last := -hang - 1 // the last frame above the threshold
+	for i, e := range energies {
+		if e > floor+v.Threshold {
+			last = i
+		}
+		voiced[i] = i-last <= hang
+	}
+	return voiced
+}
+
+// Trim trims the silence at both ends, an empty buffer will be returned if it's all silence
+func (v *VAD) Trim(b *Buffer) *Buffer {
+	voiced := v.Voiced(b)
+	i, j := 0, len(voiced)
+	for i < j && !voiced[i] {
+		i++
+	}
+	for j > i && !voiced[j-1] {
+		j--
+	}
+	if i == j {
+		return &Buffer{Format: b.Format, Samples: []int16{}}
+	}
+	n := v.frameSamples(b)
+	start, end := i*n, j*n
+	if j == len(voiced) {
+		// the last frame may be shorter
+		end = len(b.Samples)
+	}
+	if start > len(b.Samples) {
+		start = len(b.Samples)
+	}
+	return &Buffer{
+		Format:  b.Format,
+		Samples: append([]int16{}, b.Samples[start:end]...),
+	}
+}
+
+// HasVoice tells whether there is any voice in the buffer
+func (v *VAD) HasVoice(b *Buffer) bool {
+	for _, voiced := range v.Voiced(b) {
+		if voiced {
+			return true
+		}
+	}
+	return false
+}
+
+// frameSamples is the samples of all the channels in a frame
+func (v *VAD) frameSamples(b *Buffer) int {
+	return int(int64(b.Rate)*int64(v.Frame)/int64(time.Second)) * b.Channels
+}
+
+// energies returns the energies of the frames in dBFS
+func (v *VAD) energies(b *Buffer) []float64 {
+	n := v.frameSamples(b)
+	if n == 0 {
+		return nil
+	}
+	var energies []float64
+	for i := 0; i < len(b.Samples); i += n {
+		end := i + n
+		if end > len(b.Samples) {
+			end = len(b.Samples)
+		}
+		sum := 0.0
+		for _, s := range b.Samples[i:end] {
+			f := float64(s) / 32768
+			sum += f * f
+		}
+		energies = append(energies, 10*math.Log10(sum/float64(end-i)+1e-12))
+	}
+	return energies
+}
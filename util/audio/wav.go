@@ -0,0 +1,186 @@
+/*
+Package audio is an audio pipeline based on process handles: wav encoding and decoding,
+playing and recording pcm through a sound card, and voice activity detection.
+
+It isn't alsa-free. The pcm is encoded, decoded, buffered and trimmed in process,
+but a Card streams it through aplay and arecord of alsa-utils, and every playback or recording
+owns its process and stops it by the handle, so nothing is stopped by killall.
+Opening the pcm of alsa in process, by the ioctls of /dev/snd or by cgo and libasound, isn't implemented.
+
+Only 16-bit signed little-endian pcm is decoded, which is what the usb sound cards of a pi use,
+PlayFile hands the other wavs to aplay on a Card.
+*/
+package audio
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"time"
+)
+
+// Format is the format of pcm
+type Format struct {
+	Rate     int
+	Channels int
+}
+
+// Voice is the format for speech recognition, 16k mono
+var Voice = Format{Rate: 16000, Channels: 1}
+
+// frameBytes is the bytes of a frame, i.e. one sample of every channel
+func (f Format) frameBytes() int {
+	return 2 * f.Channels
+}
+
+// bytesOf returns the bytes of pcm in the duration
+func (f Format) bytesOf(d time.Duration) int {
+	return f.frameBytes() * int(int64(f.Rate)*int64(d)/int64(time.Second))
+}
+
+// Buffer is pcm in memory, the samples of the channels are interleaved
+type Buffer struct {
+	Format
+	Samples []int16
+}
+
+// Duration ...
+func (b *Buffer) Duration() time.Duration {
+	if b.Rate == 0 || b.Channels == 0 {
+		return 0
+	}
+	frames := len(b.Samples) / b.Channels
+	return time.Duration(frames) * time.Second / time.Duration(b.Rate)
+}
+
+// Mono returns the samples of the first channel in [-1, 1]
+func (b *Buffer) Mono() []float64 {
+	if b.Channels == 0 {
+		return nil
+	}
+	s := make([]float64, 0, len(b.Samples)/b.Channels)
+	for i := 0; i < len(b.Samples); i += b.Channels {
+		s = append(s, float64(b.Samples[i])/32768)
+	}
+	return s
+}
+
+// Bytes returns the pcm in bytes
+func (b *Buffer) Bytes() []byte {
+	data := make([]byte, 2*len(b.Samples))
+	for i, v := range b.Samples {
+		binary.LittleEndian.PutUint16(data[2*i:], uint16(v))
+	}
+	return data
+}
+
+// appendBytes appends the pcm in bytes, an odd byte at the end is ignored
+func (b *Buffer) appendBytes(data []byte) {
+	for i := 0; i+2 <= len(data); i += 2 {
+		b.Samples = append(b.Samples, int16(binary.LittleEndian.Uint16(data[i:])))
+	}
+}
+
+// ErrUnsupported means the wav is valid but isn't 16-bit pcm
+var ErrUnsupported = errors.New("unsupported wav")
+
+// Decode decodes a wav
+func Decode(r io.Reader) (*Buffer, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < 12 || string(data[0:4]) != "RIFF" || string(data[8:12]) != "WAVE" {
+		return nil, errors.New("not a wav")
+	}
+
+	var (
+		b    = &Buffer{}
+		bits int
+		pcm  []byte
+	)
+	for p := 12; p+8 <= len(data); {
+		id := string(data[p : p+4])
+		size := int(binary.LittleEndian.Uint32(data[p+4 : p+8]))
+		p += 8
+		if p+size > len(data) {
+			// arecord writes a wrong size when it is killed, read the rest
+			size = len(data) - p
+		}
+		chunk := data[p : p+size]
+		switch id {
+		case "fmt ":
+			if size < 16 {
+				return nil, errors.New("invalid fmt chunk")
+			}
+			if format := binary.LittleEndian.Uint16(chunk[0:2]); format != 1 {
+				return nil, fmt.Errorf("%w: format %v, only pcm is supported", ErrUnsupported, format)
+			}
+			b.Channels = int(binary.LittleEndian.Uint16(chunk[2:4]))
+			b.Rate = int(binary.LittleEndian.Uint32(chunk[4:8]))
+			bits = int(binary.LittleEndian.Uint16(chunk[14:16]))
+		case "data":
+			pcm = chunk
+		}
+		// chunks are word aligned
+		p += size + size%2
+	}
+	if b.Channels == 0 || pcm == nil {
+		return nil, errors.New("invalid wav")
+	}
+	if bits != 16 {
+		return nil, fmt.Errorf("%w: %v bits per sample, only 16 is supported", ErrUnsupported, bits)
+	}
+	b.appendBytes(pcm)
+	return b, nil
+}
+
+// Encode encodes the buffer in wav
+func Encode(w io.Writer, b *Buffer) error {
+	size := 2 * len(b.Samples)
+	var h bytes.Buffer
+	h.WriteString("RIFF")
+	binary.Write(&h, binary.LittleEndian, uint32(36+size))
+	h.WriteString("WAVEfmt ")
+	binary.Write(&h, binary.LittleEndian, uint32(16))
+	binary.Write(&h, binary.LittleEndian, uint16(1))
+	binary.Write(&h, binary.LittleEndian, uint16(b.Channels))
+	binary.Write(&h, binary.LittleEndian, uint32(b.Rate))
+	binary.Write(&h, binary.LittleEndian, uint32(b.Rate*b.frameBytes()))
+	binary.Write(&h, binary.LittleEndian, uint16(b.frameBytes()))
+	binary.Write(&h, binary.LittleEndian, uint16(16))
+	h.WriteString("data")
+	binary.Write(&h, binary.LittleEndian, uint32(size))
+	if _, err := w.Write(h.Bytes()); err != nil {
+		return err
+	}
+	_, err := w.Write(b.Bytes())
+	return err
+}
+
+// ReadFile reads a wav file
+func ReadFile(file string) (*Buffer, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return Decode(f)
+}
+
+// WriteFile writes the buffer to a wav file
+func WriteFile(file string, b *Buffer) error {
+	f, err := os.Create(file)
+	if err != nil {
+		return err
+	}
+	if err := Encode(f, b); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,94 @@
+// +build gocv
+
+package cv
+
+import (
+	"errors"
+	"fmt"
+	"image"
+
+	"gocv.io/x/gocv"
+)
+
+// DNN recognizes objects by a local deep neural network model using open cv,
+// it works offline. both classification models (e.g. mobilenet, squeezenet) and
+// ssd detection models (e.g. mobilenet-ssd) are supported.
+//
+// Size, Scale, Mean and SwapRB are how the image is turned into the input blob of the model,
+// they depend on the model, e.g. 224x224, 1/255, (0, 0, 0) and true for most onnx classification models,
+// and 300x300, 1/127.5, (127.5, 127.5, 127.5) and false for the caffe mobilenet-ssd.
+// Threshold is the min score of the results.
+type DNN struct {
+	Size      image.Point
+	Scale     float64
+	Mean      gocv.Scalar
+	SwapRB    bool
+	Threshold float64
+
+	net    gocv.Net
+	labels []string
+}
+
+// NewDNN loads the model, e.g. model.onnx, or model.caffemodel with the config model.prototxt.
+// config is optional for the models without a separate config,
+// labels is the file of the labels of the classes, one label per line, it's optional too.
+func NewDNN(model, config, labels string) (*DNN, error) {
+	var lbs []string
+	if labels != "" {
+		var err error
+		lbs, err = LoadLabels(labels)
+		if err != nil {
+			return nil, err
+		}
+	}
+	net := gocv.ReadNet(model, config)
+	if net.Empty() {
+		return nil, fmt.Errorf("failed to load the model %v", model)
+	}
+	return &DNN{
+		Size:      image.Point{X: 224, Y: 224},
+		Scale:     1.0 / 255,
+		SwapRB:    true,
+		Threshold: 0.3,
+		net:       net,
+		labels:    lbs,
+	}, nil
+}
+
+// Recognize ...
+func (d *DNN) Recognize(img string) ([]*Result, error) {
+	mat := gocv.IMRead(img, gocv.IMReadColor)
+	if mat.Empty() {
+		return nil, fmt.Errorf("failed to read image %v", img)
+	}
+	defer mat.Close()
+	return d.RecognizeMat(mat)
+}
+
+// RecognizeMat recognizes the objects in the image in BGR, e.g. a frame of the camera
+func (d *DNN) RecognizeMat(mat gocv.Mat) ([]*Result, error) {
+	blob := gocv.BlobFromImage(mat, d.Scale, d.Size, d.Mean, d.SwapRB, false)
+	defer blob.Close()
+
+	d.net.SetInput(blob, "")
+	out := d.net.Forward("")
+	defer out.Close()
+	if out.Empty() {
+		return nil, errors.New("empty outputs")
+	}
+
+	outputs, err := out.DataPtrFloat32()
+	if err != nil {
+		return nil, err
+	}
+	size := out.Size()
+	if len(size) == 4 && size[3] == 7 {
+		return detect(outputs, mat.Cols(), mat.Rows(), d.labels, d.Threshold), nil
+	}
+	return classify(outputs, d.labels, d.Threshold), nil
+}
+
+// Close ...
+func (d *DNN) Close() {
+	d.net.Close()
+}
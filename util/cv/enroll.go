@@ -0,0 +1,125 @@
+package cv
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	baiduAPI = "https://aip.baidubce.com"
+)
+
+// Enroller enrolls the faces of the persons into a recognizer, it's implemented by the recognizers of faces
+type Enroller interface {
+	// Enroll adds the face in the image file to the person of the id
+	Enroll(id string, img string) error
+	// Remove removes all of the faces of the person
+	Remove(id string) error
+}
+
+// baiduToken is the access token of the baidu ai open platform
+type baiduToken struct {
+	api       string
+	appKey    string
+	secretKey string
+
+	mu      sync.Mutex
+	token   string
+	expires time.Time
+}
+
+func (t *baiduToken) get() (string, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.token != "" && time.Now().Before(t.expires) {
+		return t.token, nil
+	}
+
+	form := url.Values{
+		"grant_type":    {"client_credentials"},
+		"client_id":     {t.appKey},
+		"client_secret": {t.secretKey},
+	}
+	resp, err := http.PostForm(t.api+"/oauth/2.0/token", form)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	var r struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int64  `json:"expires_in"`
+		Error       string `json:"error_description"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&r); err != nil {
+		return "", err
+	}
+	if r.AccessToken == "" {
+		return "", fmt.Errorf("failed to get token, error: %v", r.Error)
+	}
+	t.token = r.AccessToken
+	// refresh it a minute before expiring
+	t.expires = time.Now().Add(time.Duration(r.ExpiresIn-60) * time.Second)
+	return t.token, nil
+}
+
+// faceset calls the api of the face set of baidu face recognition
+func (b *BaiduFace) faceset(method string, req map[string]string) error {
+	token, err := b.token.get()
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+	u := fmt.Sprintf("%v/rest/2.0/face/v3/faceset/user/%v?access_token=%v", b.token.api, method, url.QueryEscape(token))
+	resp, err := http.Post(u, "application/json", strings.NewReader(string(data)))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	var r struct {
+		ErrorCode int    `json:"error_code"`
+		ErrorMsg  string `json:"error_msg"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&r); err != nil {
+		return err
+	}
+	if r.ErrorCode != 0 {
+		return fmt.Errorf("failed to %v user, error: %v %v", method, r.ErrorCode, r.ErrorMsg)
+	}
+	return nil
+}
+
+// Enroll adds the face to the user of the id in the group
+func (b *BaiduFace) Enroll(id string, img string) error {
+	if id == "" {
+		return errors.New("empty id")
+	}
+	data, err := ioutil.ReadFile(img)
+	if err != nil {
+		return err
+	}
+	return b.faceset("add", map[string]string{
+		"image":      base64.StdEncoding.EncodeToString(data),
+		"image_type": "BASE64",
+		"group_id":   b.group,
+		"user_id":    id,
+	})
+}
+
+// Remove removes the user of the id from the group
+func (b *BaiduFace) Remove(id string) error {
+	return b.faceset("delete", map[string]string{
+		"group_id": b.group,
+		"user_id":  id,
+	})
+}
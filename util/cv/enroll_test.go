@@ -0,0 +1,72 @@
+package cv
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBaiduEnroll(t *testing.T) {
+	tokens := 0
+	var (
+		paths []string
+		reqs  []map[string]string
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/oauth/2.0/token" {
+			tokens++
+			assert.Equal(t, "client_credentials", r.FormValue("grant_type"))
+			assert.Equal(t, "key", r.FormValue("client_id"))
+			assert.Equal(t, "secret", r.FormValue("client_secret"))
+			fmt.Fprint(w, `{"access_token":"tok","expires_in":2592000}`)
+			return
+		}
+		assert.Equal(t, "tok", r.URL.Query().Get("access_token"))
+		var req map[string]string
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		paths = append(paths, r.URL.Path)
+		reqs = append(reqs, req)
+		if req["user_id"] == "nobody" {
+			fmt.Fprint(w, `{"error_code":223103,"error_msg":"user is not exist"}`)
+			return
+		}
+		fmt.Fprint(w, `{"error_code":0,"error_msg":"SUCCESS"}`)
+	}))
+	defer srv.Close()
+
+	dir, err := ioutil.TempDir("", "enroll")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	img := filepath.Join(dir, "face.jpg")
+	assert.NoError(t, ioutil.WriteFile(img, []byte("jpeg"), 0644))
+
+	b := NewBaiduFace("key", "secret", "mygroup")
+	b.token.api = srv.URL
+	var e Enroller = b
+
+	assert.NoError(t, e.Enroll("p1", img))
+	assert.NoError(t, e.Remove("p1"))
+	assert.Error(t, e.Remove("nobody"))
+	assert.Error(t, e.Enroll("", img))
+	assert.Error(t, e.Enroll("p1", filepath.Join(dir, "none.jpg")))
+
+	assert.Equal(t, 1, tokens)
+	assert.Equal(t, []string{
+		"/rest/2.0/face/v3/faceset/user/add",
+		"/rest/2.0/face/v3/faceset/user/delete",
+		"/rest/2.0/face/v3/faceset/user/delete",
+	}, paths)
+	assert.Equal(t, base64.StdEncoding.EncodeToString([]byte("jpeg")), reqs[0]["image"])
+	assert.Equal(t, "BASE64", reqs[0]["image_type"])
+	assert.Equal(t, "mygroup", reqs[0]["group_id"])
+	assert.Equal(t, "p1", reqs[0]["user_id"])
+	assert.Equal(t, map[string]string{"group_id": "mygroup", "user_id": "p1"}, reqs[1])
+}
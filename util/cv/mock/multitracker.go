@@ -0,0 +1,36 @@
+package mock
+
+import (
+	"errors"
+	"image"
+
+	"github.com/jakefau/rpi-devices/util/cv"
+)
+
+// MultiTracker ...
+type MultiTracker struct{}
+
+// NewMultiTracker ...
+func NewMultiTracker(profiles ...cv.HSV) (*MultiTracker, error) {
+	return nil, errors.New("not implement")
+}
+
+// Track ...
+func (t *MultiTracker) Track() ([]*cv.Target, error) {
+	return nil, errors.New("not implement")
+}
+
+// Locate ...
+func (t *MultiTracker) Locate() (bool, *image.Rectangle) {
+	return false, nil
+}
+
+// MiddleXY ...
+func (t *MultiTracker) MiddleXY(rect *image.Rectangle) (x int, y int) {
+	return 0, 0
+}
+
+// Close ...
+func (t *MultiTracker) Close() {
+	return
+}
@@ -13,6 +13,11 @@ func NewTracker(lh, ls, lv, hh, hs, hv float64) (*Tracker, error) {
 	return nil, errors.New("not implement")
 }
 
+// LoadTracker ...
+func LoadTracker(profiles, name string) (*Tracker, error) {
+	return nil, errors.New("not implement")
+}
+
 // Locate ...
 func (t *Tracker) Locate() (bool, *image.Rectangle) {
 	return false, nil
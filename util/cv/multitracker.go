@@ -0,0 +1,124 @@
+// +build gocv
+
+package cv
+
+import (
+	"errors"
+	"image"
+	"time"
+
+	"gocv.io/x/gocv"
+)
+
+// MultiTracker tracks the objects in the colors of the hsv profiles in the view of the camera
+type MultiTracker struct {
+	// MinArea is the min area of the contour of an object in pixels
+	MinArea float64
+
+	targets  *Targets
+	profiles []HSV
+	cam      *gocv.VideoCapture
+
+	size image.Point
+	blur image.Point
+
+	img    gocv.Mat
+	mask   gocv.Mat
+	frame  gocv.Mat
+	hsv    gocv.Mat
+	kernel gocv.Mat
+}
+
+// NewMultiTracker ...
+func NewMultiTracker(profiles ...HSV) (*MultiTracker, error) {
+	if len(profiles) == 0 {
+		return nil, errors.New("no hsv profiles")
+	}
+	cam, err := gocv.OpenVideoCapture(0)
+	if err != nil {
+		return nil, err
+	}
+	return &MultiTracker{
+		MinArea:  200,
+		targets:  NewTargets(),
+		profiles: profiles,
+		cam:      cam,
+		size:     image.Point{X: 600, Y: 600},
+		blur:     image.Point{X: 11, Y: 11},
+		img:      gocv.NewMat(),
+		mask:     gocv.NewMat(),
+		frame:    gocv.NewMat(),
+		hsv:      gocv.NewMat(),
+		kernel:   gocv.NewMat(),
+	}, nil
+}
+
+// Targets returns the tracker of the targets for tuning the matching
+func (t *MultiTracker) Targets() *Targets {
+	return t.targets
+}
+
+// Track reads a frame from the camera, and returns the targets found in it, the largest first.
+func (t *MultiTracker) Track() ([]*Target, error) {
+	t.cam.Grab(6)
+	if !t.cam.Read(&t.img) {
+		return nil, errors.New("failed to read from camera")
+	}
+	now := time.Now()
+	gocv.Flip(t.img, &t.img, 1)
+	gocv.Resize(t.img, &t.img, t.size, 0, 0, gocv.InterpolationLinear)
+	return t.targets.Update(t.Detect(t.img), now), nil
+}
+
+// Detect returns the blobs in the frame in BGR
+func (t *MultiTracker) Detect(img gocv.Mat) []*Blob {
+	gocv.GaussianBlur(img, &t.frame, t.blur, 0, 0, gocv.BorderReflect101)
+	gocv.CvtColor(t.frame, &t.hsv, gocv.ColorBGRToHSV)
+
+	var blobs []*Blob
+	for _, p := range t.profiles {
+		low := gocv.Scalar{Val1: p.Low[0], Val2: p.Low[1], Val3: p.Low[2]}
+		high := gocv.Scalar{Val1: p.High[0], Val2: p.High[1], Val3: p.High[2]}
+		gocv.InRangeWithScalar(t.hsv, low, high, &t.mask)
+		gocv.Erode(t.mask, &t.mask, t.kernel)
+		gocv.Dilate(t.mask, &t.mask, t.kernel)
+		cnts := gocv.FindContours(t.mask, gocv.RetrievalExternal, gocv.ChainApproxSimple)
+		for _, cnt := range cnts {
+			a := gocv.ContourArea(cnt)
+			if a < t.MinArea {
+				continue
+			}
+			blobs = append(blobs, &Blob{
+				Profile: p.Name,
+				Box:     gocv.BoundingRect(cnt),
+				Area:    a,
+			})
+		}
+	}
+	return blobs
+}
+
+// Locate returns the box of the largest target, it makes the multi-tracker work as a single tracker.
+func (t *MultiTracker) Locate() (bool, *image.Rectangle) {
+	targets, err := t.Track()
+	if err != nil || len(targets) == 0 {
+		return false, nil
+	}
+	r := targets[0].Box
+	return true, &r
+}
+
+// MiddleXY ...
+func (t *MultiTracker) MiddleXY(rect *image.Rectangle) (x int, y int) {
+	return (rect.Max.X-rect.Min.X)/2 + rect.Min.X, (rect.Max.Y-rect.Min.Y)/2 + rect.Min.Y
+}
+
+// Close ...
+func (t *MultiTracker) Close() {
+	t.cam.Close()
+	t.img.Close()
+	t.mask.Close()
+	t.frame.Close()
+	t.hsv.Close()
+	t.kernel.Close()
+}
@@ -0,0 +1,31 @@
+// +build !gocv
+
+package cv
+
+import (
+	"errors"
+	"image"
+)
+
+// DNN is unavailable without open cv, build with -tags=gocv to use it.
+type DNN struct {
+	Size      image.Point
+	Scale     float64
+	SwapRB    bool
+	Threshold float64
+}
+
+// NewDNN ...
+func NewDNN(model, config, labels string) (*DNN, error) {
+	return nil, errors.New("not implement, build with -tags=gocv")
+}
+
+// Recognize ...
+func (d *DNN) Recognize(img string) ([]*Result, error) {
+	return nil, errors.New("not implement, build with -tags=gocv")
+}
+
+// Close ...
+func (d *DNN) Close() {
+	return
+}
@@ -0,0 +1,157 @@
+package cv
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"io/ioutil"
+	"math"
+	"net/url"
+	"os"
+	"strconv"
+)
+
+// the max of h, s and v in open cv
+var hsvMax = [3]float64{179, 255, 255}
+
+// the max radius of the square sampled by clicking on an object
+const maxSampleRadius = 50
+
+// LoadProfiles loads the hsv profiles saved in the json file
+func LoadProfiles(file string) ([]HSV, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var profiles []HSV
+	if err := json.Unmarshal(data, &profiles); err != nil {
+		return nil, err
+	}
+	for _, p := range profiles {
+		if err := p.Validate(); err != nil {
+			return nil, err
+		}
+	}
+	return profiles, nil
+}
+
+// LoadProfile loads the hsv profile with the name from the json file
+func LoadProfile(file, name string) (HSV, error) {
+	profiles, err := LoadProfiles(file)
+	if err != nil {
+		return HSV{}, err
+	}
+	for _, p := range profiles {
+		if p.Name == name {
+			return p, nil
+		}
+	}
+	return HSV{}, fmt.Errorf("profile %v not found in %v", name, file)
+}
+
+// SaveProfile saves the profile to the json file,
+// the profile with the same name is replaced, and the file is created if it doesn't exist.
+func SaveProfile(file string, p HSV) error {
+	if p.Name == "" {
+		return errors.New("a profile must have a name")
+	}
+	if err := p.Validate(); err != nil {
+		return err
+	}
+	profiles, err := LoadProfiles(file)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	replaced := false
+	for i := range profiles {
+		if profiles[i].Name == p.Name {
+			profiles[i] = p
+			replaced = true
+		}
+	}
+	if !replaced {
+		profiles = append(profiles, p)
+	}
+	data, err := json.MarshalIndent(profiles, "", "    ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(file, data, 0644)
+}
+
+// Validate checks if the ranges are valid
+func (p HSV) Validate() error {
+	for i := 0; i < 3; i++ {
+		if p.Low[i] < 0 || p.High[i] > hsvMax[i] || p.Low[i] > p.High[i] {
+			return fmt.Errorf("invalid hsv range of %v: %v-%v", p.Name, p.Low, p.High)
+		}
+	}
+	return nil
+}
+
+// SampleHSV derives a hsv range from the pixels in hsv sampled by clicking on an object,
+// the range covers the mean -/+ 2 std of the samples and the margin, and is clamped to the valid ranges.
+// the hue of red wraps around 0 and 179, so the range of red is hard to derive by sampling.
+func SampleHSV(name string, pixels [][3]float64, margin [3]float64) (HSV, error) {
+	if len(pixels) == 0 {
+		return HSV{}, fmt.Errorf("no samples")
+	}
+	p := HSV{Name: name}
+	n := float64(len(pixels))
+	for i := 0; i < 3; i++ {
+		mean := 0.0
+		for _, px := range pixels {
+			mean += px[i]
+		}
+		mean /= n
+		v := 0.0
+		for _, px := range pixels {
+			v += (px[i] - mean) * (px[i] - mean)
+		}
+		std := math.Sqrt(v / n)
+		p.Low[i] = math.Max(0, math.Floor(mean-2*std-margin[i]))
+		p.High[i] = math.Min(hsvMax[i], math.Ceil(mean+2*std+margin[i]))
+	}
+	return p, nil
+}
+
+// sampleRect returns the square of radius r around (x, y) clipped to a frame of cols x rows,
+// r is clamped to maxSampleRadius, and the rect is empty if the square is out of the frame.
+func sampleRect(x, y, r, cols, rows int) image.Rectangle {
+	if r > maxSampleRadius {
+		r = maxSampleRadius
+	}
+	return image.Rect(x-r, y-r, x+r+1, y+r+1).Intersect(image.Rect(0, 0, cols, rows))
+}
+
+// ParseHSV parses the hsv range from the form values lh, ls, lv, hh, hs and hv,
+// the values missing keep the ones of the default.
+func ParseHSV(form url.Values, def HSV) (HSV, error) {
+	p := def
+	keys := [2][3]string{{"lh", "ls", "lv"}, {"hh", "hs", "hv"}}
+	for i := 0; i < 2; i++ {
+		for j := 0; j < 3; j++ {
+			s := form.Get(keys[i][j])
+			if s == "" {
+				continue
+			}
+			v, err := strconv.ParseFloat(s, 64)
+			if err != nil {
+				return HSV{}, fmt.Errorf("invalid %v: %v", keys[i][j], s)
+			}
+			if i == 0 {
+				p.Low[j] = v
+			} else {
+				p.High[j] = v
+			}
+		}
+	}
+	if name := form.Get("name"); name != "" {
+		p.Name = name
+	}
+	if err := p.Validate(); err != nil {
+		return HSV{}, err
+	}
+	return p, nil
+}
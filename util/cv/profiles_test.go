@@ -0,0 +1,126 @@
+package cv
+
+import (
+	"image"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProfiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cv")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "hsv.json")
+
+	_, err = LoadProfiles(file)
+	assert.True(t, os.IsNotExist(err))
+
+	red := HSV{Name: "red", Low: [3]float64{0, 100, 100}, High: [3]float64{10, 255, 255}}
+	assert.NoError(t, SaveProfile(file, Tennis))
+	assert.NoError(t, SaveProfile(file, red))
+	red.High[0] = 8
+	assert.NoError(t, SaveProfile(file, red))
+	assert.Error(t, SaveProfile(file, HSV{Low: [3]float64{0, 0, 0}}))
+	assert.Error(t, SaveProfile(file, HSV{Name: "bad", Low: [3]float64{50, 0, 0}, High: [3]float64{40, 255, 255}}))
+
+	profiles, err := LoadProfiles(file)
+	assert.NoError(t, err)
+	assert.Equal(t, []HSV{Tennis, red}, profiles)
+
+	p, err := LoadProfile(file, "red")
+	assert.NoError(t, err)
+	assert.Equal(t, red, p)
+	_, err = LoadProfile(file, "blue")
+	assert.Error(t, err)
+}
+
+func TestSampleHSV(t *testing.T) {
+	pixels := [][3]float64{
+		{40, 150, 200},
+		{42, 160, 210},
+		{44, 170, 220},
+	}
+	p, err := SampleHSV("ball", pixels, [3]float64{5, 30, 30})
+	assert.NoError(t, err)
+	// std: 1.63, 8.16, 8.16
+	assert.Equal(t, HSV{
+		Name: "ball",
+		Low:  [3]float64{33, 113, 163},
+		High: [3]float64{51, 207, 255},
+	}, p)
+
+	// clamped
+	p, err = SampleHSV("dark", [][3]float64{{2, 10, 5}}, [3]float64{5, 30, 30})
+	assert.NoError(t, err)
+	assert.Equal(t, [3]float64{0, 0, 0}, p.Low)
+	assert.Equal(t, [3]float64{7, 40, 35}, p.High)
+
+	_, err = SampleHSV("none", nil, [3]float64{})
+	assert.Error(t, err)
+}
+
+func TestSampleRect(t *testing.T) {
+	testCases := []struct {
+		desc       string
+		x, y, r    int
+		rect       image.Rectangle
+		cols, rows int
+	}{
+		{"inside", 100, 100, 5, image.Rect(95, 95, 106, 106), 600, 600},
+		{"a pixel", 10, 10, 0, image.Rect(10, 10, 11, 11), 600, 600},
+		{"clipped at the corner", 2, 598, 5, image.Rect(0, 593, 8, 600), 600, 600},
+		{"clamped", 300, 300, 1000000000, image.Rect(250, 250, 351, 351), 600, 600},
+		{"out of the frame", -100, 100, 5, image.Rectangle{}, 600, 600},
+		{"no frame", 0, 0, 5, image.Rectangle{}, 0, 0},
+	}
+	for _, test := range testCases {
+		rect := sampleRect(test.x, test.y, test.r, test.cols, test.rows)
+		assert.Equal(t, test.rect, rect, test.desc)
+	}
+}
+
+func TestParseHSV(t *testing.T) {
+	testCases := []struct {
+		desc  string
+		query string
+		hsv   HSV
+		err   bool
+	}{
+		{
+			desc:  "all",
+			query: "lh=1&ls=2&lv=3&hh=4&hs=5&hv=6&name=x",
+			hsv:   HSV{Name: "x", Low: [3]float64{1, 2, 3}, High: [3]float64{4, 5, 6}},
+		},
+		{
+			desc:  "partial",
+			query: "lh=40",
+			hsv:   HSV{Name: "tennis", Low: [3]float64{40, 108, 138}, High: [3]float64{61, 255, 255}},
+		},
+		{
+			desc:  "not a number",
+			query: "lh=x",
+			err:   true,
+		},
+		{
+			desc:  "out of range",
+			query: "hh=200",
+			err:   true,
+		},
+	}
+	for _, test := range testCases {
+		form, err := url.ParseQuery(test.query)
+		assert.NoError(t, err)
+		p, err := ParseHSV(form, Tennis)
+		if test.err {
+			assert.Error(t, err, test.desc)
+			continue
+		}
+		assert.NoError(t, err, test.desc)
+		assert.Equal(t, test.hsv, p, test.desc)
+	}
+}
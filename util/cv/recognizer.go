@@ -0,0 +1,210 @@
+package cv
+
+import (
+	"bufio"
+	"image"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/shanghuiyang/face-recognizer/face"
+	"github.com/shanghuiyang/go-speech/oauth"
+	"github.com/shanghuiyang/image-recognizer/recognizer"
+)
+
+// Result is an object recognized in an image.
+// Score is the confidence in [0, 1],
+// Box is the bounding box of the object, it's empty if the recognizer doesn't locate objects.
+type Result struct {
+	Label string
+	Score float64
+	Box   image.Rectangle
+}
+
+// Recognizer recognizes the objects in an image
+type Recognizer interface {
+	// Recognize returns the objects in the image file, the most confident first.
+	Recognize(img string) ([]*Result, error)
+}
+
+// Best returns the most confident result with a score not less than min, nil if no one is.
+func Best(results []*Result, min float64) *Result {
+	var best *Result
+	for _, r := range results {
+		if r.Score < min {
+			continue
+		}
+		if best == nil || r.Score > best.Score {
+			best = r
+		}
+	}
+	return best
+}
+
+// BaiduObject recognizes objects by baidu image recognition.
+// it only returns the name of the most likely object without score and box,
+// so the score is always 1.
+type BaiduObject struct {
+	imgr *recognizer.Recognizer
+}
+
+// NewBaiduObject ...
+func NewBaiduObject(appKey, secretKey string) *BaiduObject {
+	auth := oauth.New(appKey, secretKey, oauth.NewCacheMan())
+	return &BaiduObject{imgr: recognizer.New(auth)}
+}
+
+// Recognize ...
+func (b *BaiduObject) Recognize(img string) ([]*Result, error) {
+	name, err := b.imgr.Recognize(img)
+	if err != nil {
+		return nil, err
+	}
+	if name == "" {
+		return nil, nil
+	}
+	return []*Result{{Label: name, Score: 1}}, nil
+}
+
+// BaiduFace recognizes the faces registered in the group of baidu face recognition,
+// the label of the result is the user id. the faces are enrolled into the group by Enroll.
+type BaiduFace struct {
+	face  *face.Face
+	group string
+	token *baiduToken
+}
+
+// NewBaiduFace ...
+func NewBaiduFace(appKey, secretKey, group string) *BaiduFace {
+	auth := oauth.New(appKey, secretKey, oauth.NewCacheMan())
+	return &BaiduFace{
+		face:  face.New(auth),
+		group: group,
+		token: &baiduToken{
+			api:       baiduAPI,
+			appKey:    appKey,
+			secretKey: secretKey,
+		},
+	}
+}
+
+// Recognize ...
+func (b *BaiduFace) Recognize(img string) ([]*Result, error) {
+	users, err := b.face.Recognize(img, b.group)
+	if err != nil {
+		return nil, err
+	}
+	var results []*Result
+	for _, u := range users {
+		results = append(results, &Result{
+			Label: u.UserID,
+			// baidu scores in [0, 100]
+			Score: u.Score / 100,
+		})
+	}
+	sortResults(results)
+	return results, nil
+}
+
+// LoadLabels loads the labels of a model, one label per line
+func LoadLabels(file string) ([]string, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var labels []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		labels = append(labels, strings.TrimSpace(scanner.Text()))
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return labels, nil
+}
+
+func label(labels []string, id int) string {
+	if id >= 0 && id < len(labels) && labels[id] != "" {
+		return labels[id]
+	}
+	return "#" + strconv.Itoa(id)
+}
+
+// classify turns the outputs of a classification model into results with scores not less than min,
+// the outputs are scaled by softmax if they aren't probabilities.
+func classify(outputs []float32, labels []string, min float64) []*Result {
+	probs := make([]float64, len(outputs))
+	sum, isProb := 0.0, true
+	for i, v := range outputs {
+		probs[i] = float64(v)
+		sum += probs[i]
+		if v < 0 || v > 1 {
+			isProb = false
+		}
+	}
+	if !isProb || math.Abs(sum-1) > 0.01 {
+		softmax(probs)
+	}
+
+	var results []*Result
+	for i, p := range probs {
+		if p < min {
+			continue
+		}
+		results = append(results, &Result{Label: label(labels, i), Score: p})
+	}
+	sortResults(results)
+	return results
+}
+
+func softmax(x []float64) {
+	max := math.Inf(-1)
+	for _, v := range x {
+		max = math.Max(max, v)
+	}
+	sum := 0.0
+	for i, v := range x {
+		x[i] = math.Exp(v - max)
+		sum += x[i]
+	}
+	for i := range x {
+		x[i] /= sum
+	}
+}
+
+// detect turns the outputs of a ssd detection model into results with scores not less than min.
+// the outputs are [1, 1, N, 7], every detection is [image id, class id, score, left, top, right, bottom],
+// the coordinates are relative to the width and height of the image.
+func detect(outputs []float32, width, height int, labels []string, min float64) []*Result {
+	var results []*Result
+	for i := 0; i+7 <= len(outputs); i += 7 {
+		d := outputs[i : i+7]
+		score := float64(d[2])
+		if score < min {
+			continue
+		}
+		box := image.Rect(
+			int(float64(d[3])*float64(width)),
+			int(float64(d[4])*float64(height)),
+			int(float64(d[5])*float64(width)),
+			int(float64(d[6])*float64(height)),
+		).Intersect(image.Rect(0, 0, width, height))
+		results = append(results, &Result{
+			Label: label(labels, int(d[1])),
+			Score: score,
+			Box:   box,
+		})
+	}
+	sortResults(results)
+	return results
+}
+
+func sortResults(results []*Result) {
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].Score > results[j].Score
+	})
+}
@@ -0,0 +1,93 @@
+package cv
+
+import (
+	"image"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClassify(t *testing.T) {
+	labels := []string{"cat", "dog", "bird"}
+	testCases := []struct {
+		desc    string
+		outputs []float32
+		min     float64
+		labels  []string
+		scores  []float64
+	}{
+		{
+			desc:    "probabilities",
+			outputs: []float32{0.2, 0.7, 0.1},
+			min:     0.15,
+			labels:  []string{"dog", "cat"},
+			scores:  []float64{0.7, 0.2},
+		},
+		{
+			desc:    "logits",
+			outputs: []float32{0, 2, 0},
+			min:     0.5,
+			labels:  []string{"dog"},
+			scores:  []float64{0.787},
+		},
+		{
+			desc:    "nothing confident",
+			outputs: []float32{0.3, 0.3, 0.4},
+			min:     0.5,
+		},
+		{
+			desc:    "no label",
+			outputs: []float32{0, 0, 0, 1},
+			min:     0.5,
+			labels:  []string{"#3"},
+			scores:  []float64{1},
+		},
+	}
+	for _, test := range testCases {
+		results := classify(test.outputs, labels, test.min)
+		assert.Equal(t, len(test.labels), len(results), test.desc)
+		for i, r := range results {
+			assert.Equal(t, test.labels[i], r.Label, test.desc)
+			assert.InDelta(t, test.scores[i], r.Score, 0.001, test.desc)
+			assert.True(t, r.Box.Empty(), test.desc)
+		}
+	}
+}
+
+func TestDetect(t *testing.T) {
+	labels := []string{"background", "person", "car"}
+	outputs := []float32{
+		0, 2, 0.6, 0.5, 0.5, 1.0, 1.2,
+		0, 1, 0.9, 0.1, 0.2, 0.3, 0.4,
+		0, 1, 0.2, 0, 0, 1, 1,
+	}
+	results := detect(outputs, 200, 100, labels, 0.5)
+	assert.Equal(t, 2, len(results))
+	assert.Equal(t, &Result{Label: "person", Score: float64(float32(0.9)), Box: image.Rect(20, 20, 60, 40)}, results[0])
+	// the box is clipped by the image
+	assert.Equal(t, &Result{Label: "car", Score: float64(float32(0.6)), Box: image.Rect(100, 50, 200, 100)}, results[1])
+
+	assert.Equal(t, results[0], Best(results, 0.5))
+	assert.Nil(t, Best(results, 0.95))
+	assert.Nil(t, Best(nil, 0))
+}
+
+func TestLoadLabels(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cv")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, "labels.txt")
+	assert.NoError(t, ioutil.WriteFile(file, []byte("cat\n dog \n\nbird\n"), 0644))
+	labels, err := LoadLabels(file)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"cat", "dog", "", "bird"}, labels)
+	assert.Equal(t, "#2", label(labels, 2))
+	assert.Equal(t, "bird", label(labels, 3))
+
+	_, err = LoadLabels(filepath.Join(dir, "xxx.txt"))
+	assert.Error(t, err)
+}
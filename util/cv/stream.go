@@ -1,37 +1,77 @@
+// +build gocv
+
 package cv
 
 import (
+	"encoding/json"
+	"errors"
 	"image"
 	"image/color"
 	"log"
 	"net/http"
+	"strconv"
+	"sync"
 
 	"github.com/hybridgroup/mjpeg"
 	"gocv.io/x/gocv"
 )
 
+var (
+	// the margin of the hsv range derived by sampling
+	sampleMargin = [3]float64{5, 30, 30}
+)
+
 // Stream ...
 type Stream struct {
-	host                   string
-	tracked                bool
-	lh, ls, lv, hh, hs, hv float64
-	cam                    *gocv.VideoCapture
-	stream                 *mjpeg.Stream
+	host    string
+	tracked bool
+	cam     *gocv.VideoCapture
+	stream  *mjpeg.Stream
+
+	mu      sync.Mutex
+	profile HSV
+
+	// calibration
+	profiles string
+	calib    *mjpeg.Stream
+	lastHSV  gocv.Mat
 }
 
 // NewStream ...
 func NewStream(cam *gocv.VideoCapture, host string) *Stream {
 	return &Stream{
-		host:   host,
-		cam:    cam,
-		stream: mjpeg.NewStream(),
+		host:    host,
+		cam:     cam,
+		stream:  mjpeg.NewStream(),
+		profile: Tennis,
 	}
 }
 
+// Calibrate enables the calibration of the hsv, the named profiles are saved to the json file,
+// which can be loaded by LoadProfile for the trackers. it must be called before Start.
+//
+//	/calibrate: the page of calibration
+//	/calibrate/video: the frame and the thresholded mask side by side
+//	/calibrate/hsv: GET the current hsv, POST lh, ls, lv, hh, hs and hv to update it
+//	/calibrate/sample: POST x, y and r to derive the hsv from the pixels around (x, y) of the frame
+//	/calibrate/profiles: GET the profiles saved, POST name to save the current hsv as a profile
+func (s *Stream) Calibrate(profiles string) {
+	s.profiles = profiles
+	s.calib = mjpeg.NewStream()
+	s.lastHSV = gocv.NewMat()
+}
+
 // Start ...
 func (s *Stream) Start() {
 	go func() {
 		http.Handle("/video", s.stream)
+		if s.calib != nil {
+			http.HandleFunc("/calibrate", s.calibratePage)
+			http.Handle("/calibrate/video", s.calib)
+			http.HandleFunc("/calibrate/hsv", s.hsvHandler)
+			http.HandleFunc("/calibrate/sample", s.sampleHandler)
+			http.HandleFunc("/calibrate/profiles", s.profilesHandler)
+		}
 		if err := http.ListenAndServe(s.host, nil); err != nil {
 			log.Printf("[stream]failed to listen and serve, err: %v", err)
 			return
@@ -39,14 +79,35 @@ func (s *Stream) Start() {
 	}()
 
 	img := gocv.NewMat()
+	hsv := gocv.NewMat()
+	mask := gocv.NewMat()
+	mask3 := gocv.NewMat()
+	both := gocv.NewMat()
 	defer img.Close()
+	defer hsv.Close()
+	defer mask.Close()
+	defer mask3.Close()
+	defer both.Close()
 	for true {
 		s.cam.Grab(6)
 		if !s.cam.Read(&img) {
 			continue
 		}
+		if s.tracked || s.calib != nil {
+			s.threshold(&img, &hsv, &mask)
+		}
 		if s.tracked {
-			s.track(&img)
+			s.track(&img, &mask)
+		}
+		if s.calib != nil {
+			s.mu.Lock()
+			hsv.CopyTo(&s.lastHSV)
+			s.mu.Unlock()
+			gocv.CvtColor(mask, &mask3, gocv.ColorGrayToBGR)
+			gocv.Hconcat(img, mask3, &both)
+			if buf, err := gocv.IMEncode(".jpg", both); err == nil {
+				s.calib.UpdateJPEG(buf)
+			}
 		}
 		buf, err := gocv.IMEncode(".jpg", img)
 		if err != nil {
@@ -62,41 +123,52 @@ func (s *Stream) Tracked(enabled bool) {
 }
 
 func (s *Stream) SetHSV(lh, ls, lv, hh, hs, hv float64) {
-	s.lh = lh
-	s.ls = ls
-	s.lv = lv
-	s.hh = hh
-	s.hs = hs
-	s.hv = hv
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.profile.Low = [3]float64{lh, ls, lv}
+	s.profile.High = [3]float64{hh, hs, hv}
 }
 
-func (s *Stream) track(img *gocv.Mat) {
-	rcolor := color.RGBA{G: 255, A: 255}
-	lhsv := gocv.Scalar{Val1: s.lh, Val2: s.ls, Val3: s.lv}
-	hhsv := gocv.Scalar{Val1: s.hh, Val2: s.hs, Val3: s.hv}
+// SetProfile sets the hsv for tracking
+func (s *Stream) SetProfile(p HSV) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.profile = p
+}
+
+// Profile returns the current hsv
+func (s *Stream) Profile() HSV {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.profile
+}
+
+// threshold resizes the image, and thresholds it by the hsv into the mask
+func (s *Stream) threshold(img, hsv, mask *gocv.Mat) {
+	p := s.Profile()
+	lhsv := gocv.Scalar{Val1: p.Low[0], Val2: p.Low[1], Val3: p.Low[2]}
+	hhsv := gocv.Scalar{Val1: p.High[0], Val2: p.High[1], Val3: p.High[2]}
 
 	size := image.Point{X: 600, Y: 600}
 	blur := image.Point{X: 11, Y: 11}
 
-	mask := gocv.NewMat()
 	frame := gocv.NewMat()
-	hsv := gocv.NewMat()
 	kernel := gocv.NewMat()
-
-	defer mask.Close()
 	defer frame.Close()
-	defer hsv.Close()
 	defer kernel.Close()
 
 	gocv.Flip(*img, img, 1)
 	gocv.Resize(*img, img, size, 0, 0, gocv.InterpolationLinear)
 	gocv.GaussianBlur(*img, &frame, blur, 0, 0, gocv.BorderReflect101)
-	gocv.CvtColor(frame, &hsv, gocv.ColorBGRToHSV)
-	gocv.InRangeWithScalar(hsv, lhsv, hhsv, &mask)
-	gocv.Erode(mask, &mask, kernel)
-	gocv.Dilate(mask, &mask, kernel)
+	gocv.CvtColor(frame, hsv, gocv.ColorBGRToHSV)
+	gocv.InRangeWithScalar(*hsv, lhsv, hhsv, mask)
+	gocv.Erode(*mask, mask, kernel)
+	gocv.Dilate(*mask, mask, kernel)
+}
 
-	cnt := bestContour(&mask, 200)
+func (s *Stream) track(img, mask *gocv.Mat) {
+	rcolor := color.RGBA{G: 255, A: 255}
+	cnt := bestContour(mask, 200)
 	if len(cnt) == 0 {
 		return
 	}
@@ -107,6 +179,106 @@ func (s *Stream) track(img *gocv.Mat) {
 
 }
 
+// sample derives the hsv from the pixels in the square of radius r around (x, y) of the last frame
+func (s *Stream) sample(name string, x, y, r int) (HSV, error) {
+	s.mu.Lock()
+	var pixels [][3]float64
+	rect := sampleRect(x, y, r, s.lastHSV.Cols(), s.lastHSV.Rows())
+	for row := rect.Min.Y; row < rect.Max.Y; row++ {
+		for col := rect.Min.X; col < rect.Max.X; col++ {
+			v := s.lastHSV.GetVecbAt(row, col)
+			pixels = append(pixels, [3]float64{float64(v[0]), float64(v[1]), float64(v[2])})
+		}
+	}
+	s.mu.Unlock()
+
+	if len(pixels) == 0 {
+		return HSV{}, errors.New("out of the frame")
+	}
+	return SampleHSV(name, pixels, sampleMargin)
+}
+
+func (s *Stream) calibratePage(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write([]byte(calibrateHTML))
+}
+
+func (s *Stream) hsvHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodPost {
+		r.ParseForm()
+		p, err := ParseHSV(r.Form, s.Profile())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		s.SetProfile(p)
+	}
+	writeJSON(w, s.Profile())
+}
+
+func (s *Stream) sampleHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	x, err := strconv.Atoi(r.FormValue("x"))
+	if err != nil {
+		http.Error(w, "invalid x", http.StatusBadRequest)
+		return
+	}
+	y, err := strconv.Atoi(r.FormValue("y"))
+	if err != nil {
+		http.Error(w, "invalid y", http.StatusBadRequest)
+		return
+	}
+	radius := 5
+	if v := r.FormValue("r"); v != "" {
+		if radius, err = strconv.Atoi(v); err != nil || radius < 0 {
+			http.Error(w, "invalid r", http.StatusBadRequest)
+			return
+		}
+		if radius > maxSampleRadius {
+			// the frame is locked while sampling
+			radius = maxSampleRadius
+		}
+	}
+	p, err := s.sample(s.Profile().Name, x, y, radius)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	log.Printf("[stream]sampled hsv at (%v, %v): %v-%v", x, y, p.Low, p.High)
+	s.SetProfile(p)
+	writeJSON(w, p)
+}
+
+func (s *Stream) profilesHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodPost {
+		p := s.Profile()
+		if name := r.FormValue("name"); name != "" {
+			p.Name = name
+		}
+		if err := SaveProfile(s.profiles, p); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		s.SetProfile(p)
+		log.Printf("[stream]saved profile %v: %v-%v", p.Name, p.Low, p.High)
+	}
+	profiles, err := LoadProfiles(s.profiles)
+	if err != nil {
+		profiles = []HSV{}
+	}
+	writeJSON(w, profiles)
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("[stream]failed to write response, err: %v", err)
+	}
+}
+
 func bestContour(frame *gocv.Mat, minArea float64) []image.Point {
 	cnts := gocv.FindContours(*frame, gocv.RetrievalExternal, gocv.ChainApproxSimple)
 	var (
@@ -121,3 +293,80 @@ func bestContour(frame *gocv.Mat, minArea float64) []image.Point {
 	}
 	return bestCnt
 }
+
+const calibrateHTML = `<!DOCTYPE html>
+<html>
+<head>
+    <meta charset="utf-8">
+    <title>hsv calibration</title>
+    <style>
+        body { font-family: sans-serif; }
+        img { cursor: crosshair; }
+        label { display: inline-block; width: 30px; }
+        input[type=range] { width: 400px; }
+    </style>
+</head>
+<body>
+    <p>click on the object in the frame (left) to sample its color, and tune the range until only the object is white in the mask (right).</p>
+    <img id="video" src="/calibrate/video">
+    <div id="sliders"></div>
+    <p>
+        <input id="name" placeholder="profile name">
+        <button onclick="save()">save</button>
+        <span id="saved"></span>
+    </p>
+    <script>
+        var keys = [["lh", 179], ["ls", 255], ["lv", 255], ["hh", 179], ["hs", 255], ["hv", 255]];
+        var sliders = document.getElementById("sliders");
+        keys.forEach(function (k) {
+            sliders.innerHTML += '<div><label>' + k[0] + '</label><input type="range" id="' + k[0] + '" min="0" max="' + k[1] + '" oninput="update()"> <span id="' + k[0] + '-v"></span></div>';
+        });
+
+        function show(p) {
+            var v = p.low.concat(p.high);
+            keys.forEach(function (k, i) {
+                document.getElementById(k[0]).value = v[i];
+                document.getElementById(k[0] + "-v").innerText = v[i];
+            });
+            if (p.name) {
+                document.getElementById("name").value = p.name;
+            }
+        }
+
+        function post(url, params) {
+            return fetch(url, { method: "POST", body: new URLSearchParams(params) }).then(function (resp) {
+                if (!resp.ok) {
+                    return resp.text().then(function (t) { throw new Error(t); });
+                }
+                return resp.json();
+            });
+        }
+
+        function update() {
+            var params = {};
+            keys.forEach(function (k) { params[k[0]] = document.getElementById(k[0]).value; });
+            post("/calibrate/hsv", params).then(show).catch(function (e) { console.log(e); });
+        }
+
+        function save() {
+            post("/calibrate/profiles", { name: document.getElementById("name").value }).then(function (profiles) {
+                document.getElementById("saved").innerText = "saved " + profiles.length + " profiles";
+            }).catch(function (e) { alert(e.message); });
+        }
+
+        document.getElementById("video").onclick = function (e) {
+            var img = e.target;
+            // the frame is the left half
+            var x = Math.round(e.offsetX * img.naturalWidth / img.width);
+            var y = Math.round(e.offsetY * img.naturalHeight / img.height);
+            if (x >= img.naturalWidth / 2) {
+                return;
+            }
+            post("/calibrate/sample", { x: x, y: y }).then(show).catch(function (e) { console.log(e); });
+        };
+
+        fetch("/calibrate/hsv").then(function (resp) { return resp.json(); }).then(show);
+    </script>
+</body>
+</html>
+`
@@ -0,0 +1,226 @@
+package cv
+
+import (
+	"image"
+	"math"
+	"sort"
+	"time"
+)
+
+// HSV is a named color range in hsv for tracking objects in the color.
+// the ranges of h, s and v are [0, 180), [0, 255] and [0, 255] as in open cv.
+type HSV struct {
+	Name string     `json:"name"`
+	Low  [3]float64 `json:"low"`
+	High [3]float64 `json:"high"`
+}
+
+var (
+	// Tennis is the hsv of a tennis
+	Tennis = HSV{
+		Name: "tennis",
+		Low:  [3]float64{33, 108, 138},
+		High: [3]float64{61, 255, 255},
+	}
+)
+
+// Blob is a region in the color of a profile found in a frame
+type Blob struct {
+	Profile string
+	Box     image.Rectangle
+	Area    float64
+}
+
+// Target is an object tracked across frames.
+// ID is unique and persistent while the target is tracked,
+// X and Y are the centroid, VX and VY are the velocity in pixels per second.
+type Target struct {
+	ID      int
+	Profile string
+	Box     image.Rectangle
+	Area    float64
+	X, Y    float64
+	VX, VY  float64
+	// Seen is the number of frames the target was found in
+	Seen int
+	// Missed is the number of frames the target is lost in since it was found last time
+	Missed int
+
+	last time.Time
+}
+
+// Match is the way matching the blobs to the targets
+type Match int
+
+const (
+	// MatchCentroid matches the blob with the nearest centroid
+	MatchCentroid Match = iota
+	// MatchIoU matches the blob with the largest intersection over union of the boxes
+	MatchIoU
+)
+
+// Targets tracks the blobs of frames as targets with persistent ids.
+// a blob only matches the targets of the same profile.
+// Match is the way matching the blobs,
+// MaxDist is the max distance in pixels between the centroids of a blob and its target for MatchCentroid,
+// MinIoU is the min iou of a blob and its target for MatchIoU,
+// MaxMissed is the max frames a target can be lost in before it is dropped.
+type Targets struct {
+	Match     Match
+	MaxDist   float64
+	MinIoU    float64
+	MaxMissed int
+
+	targets []*Target
+	nextID  int
+}
+
+// NewTargets ...
+func NewTargets() *Targets {
+	return &Targets{
+		Match:     MatchCentroid,
+		MaxDist:   100,
+		MinIoU:    0.3,
+		MaxMissed: 5,
+		nextID:    1,
+	}
+}
+
+// Update tracks the blobs found in a frame at the time,
+// and returns the targets found in the frame, the largest first.
+func (ts *Targets) Update(blobs []*Blob, now time.Time) []*Target {
+	type pair struct {
+		t, b int
+		cost float64
+	}
+	var pairs []pair
+	for i, t := range ts.targets {
+		for j, b := range blobs {
+			if t.Profile != b.Profile {
+				continue
+			}
+			if cost, ok := ts.cost(t, b); ok {
+				pairs = append(pairs, pair{t: i, b: j, cost: cost})
+			}
+		}
+	}
+	// match the best pairs first
+	sort.SliceStable(pairs, func(i, j int) bool {
+		return pairs[i].cost < pairs[j].cost
+	})
+	tmatched := make([]bool, len(ts.targets))
+	bmatched := make([]bool, len(blobs))
+	for _, p := range pairs {
+		if tmatched[p.t] || bmatched[p.b] {
+			continue
+		}
+		tmatched[p.t], bmatched[p.b] = true, true
+		ts.targets[p.t].update(blobs[p.b], now)
+	}
+
+	var (
+		alive []*Target
+		found []*Target
+	)
+	for i, t := range ts.targets {
+		if tmatched[i] {
+			alive = append(alive, t)
+			found = append(found, t)
+			continue
+		}
+		t.Missed++
+		if t.Missed <= ts.MaxMissed {
+			alive = append(alive, t)
+		}
+	}
+	for j, b := range blobs {
+		if bmatched[j] {
+			continue
+		}
+		t := &Target{ID: ts.nextID, Profile: b.Profile}
+		ts.nextID++
+		t.update(b, now)
+		alive = append(alive, t)
+		found = append(found, t)
+	}
+	ts.targets = alive
+
+	sort.SliceStable(found, func(i, j int) bool {
+		return found[i].Area > found[j].Area
+	})
+	return copyTargets(found)
+}
+
+// Get returns the target with the id, nil if it isn't tracked anymore
+func (ts *Targets) Get(id int) *Target {
+	for _, t := range ts.targets {
+		if t.ID == id {
+			c := *t
+			return &c
+		}
+	}
+	return nil
+}
+
+func (ts *Targets) cost(t *Target, b *Blob) (float64, bool) {
+	if ts.Match == MatchIoU {
+		iou := IoU(t.Box, b.Box)
+		return 1 - iou, iou >= ts.MinIoU
+	}
+	x, y := centroid(b.Box)
+	d := math.Hypot(x-t.X, y-t.Y)
+	return d, d <= ts.MaxDist
+}
+
+func (t *Target) update(b *Blob, now time.Time) {
+	x, y := centroid(b.Box)
+	if t.Seen > 0 {
+		if dt := now.Sub(t.last).Seconds(); dt > 0 {
+			// smooth the velocity
+			const alpha = 0.5
+			vx, vy := (x-t.X)/dt, (y-t.Y)/dt
+			if t.Seen == 1 {
+				t.VX, t.VY = vx, vy
+			} else {
+				t.VX = alpha*vx + (1-alpha)*t.VX
+				t.VY = alpha*vy + (1-alpha)*t.VY
+			}
+		}
+	}
+	t.Box = b.Box
+	t.Area = b.Area
+	t.X, t.Y = x, y
+	t.Seen++
+	t.Missed = 0
+	t.last = now
+}
+
+// IoU returns the intersection over union of two boxes
+func IoU(a, b image.Rectangle) float64 {
+	i := area(a.Intersect(b))
+	u := area(a) + area(b) - i
+	if u == 0 {
+		return 0
+	}
+	return i / u
+}
+
+func area(r image.Rectangle) float64 {
+	if r.Empty() {
+		return 0
+	}
+	return float64(r.Dx() * r.Dy())
+}
+
+func centroid(r image.Rectangle) (float64, float64) {
+	return float64(r.Min.X+r.Max.X) / 2, float64(r.Min.Y+r.Max.Y) / 2
+}
+
+func copyTargets(targets []*Target) []*Target {
+	var cp []*Target
+	for _, t := range targets {
+		c := *t
+		cp = append(cp, &c)
+	}
+	return cp
+}
@@ -0,0 +1,97 @@
+package cv
+
+import (
+	"image"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func blob(profile string, x, y, r int) *Blob {
+	return &Blob{
+		Profile: profile,
+		Box:     image.Rect(x-r, y-r, x+r, y+r),
+		Area:    float64(4 * r * r),
+	}
+}
+
+func TestTargets(t *testing.T) {
+	for _, m := range []Match{MatchCentroid, MatchIoU} {
+		ts := NewTargets()
+		ts.Match = m
+		ts.MaxMissed = 1
+		now := time.Now()
+		frame := func(blobs ...*Blob) []*Target {
+			now = now.Add(100 * time.Millisecond)
+			return ts.Update(blobs, now)
+		}
+
+		// two balls and a cube
+		targets := frame(blob("ball", 100, 100, 20), blob("ball", 300, 100, 30), blob("cube", 110, 100, 20))
+		assert.Equal(t, 3, len(targets))
+		assert.Equal(t, 2, targets[0].ID)
+		ids := map[string]int{}
+		for _, tg := range targets {
+			ids[tg.Profile+tg.Box.String()] = tg.ID
+		}
+		assert.Equal(t, map[string]int{
+			"ball(80,80)-(120,120)":  1,
+			"ball(270,70)-(330,130)": 2,
+			"cube(90,80)-(130,120)":  3,
+		}, ids)
+
+		// the balls move right 10px per frame, the cube stays
+		targets = frame(blob("ball", 110, 100, 20), blob("ball", 310, 100, 30), blob("cube", 110, 100, 20))
+		assert.Equal(t, 3, len(targets))
+		for _, tg := range targets {
+			switch tg.ID {
+			case 1, 2:
+				assert.InDelta(t, 100, tg.VX, 0.001)
+			case 3:
+				assert.Equal(t, "cube", tg.Profile)
+				assert.InDelta(t, 0, tg.VX, 0.001)
+			default:
+				t.Errorf("unexpected target %v", tg.ID)
+			}
+			assert.InDelta(t, 0, tg.VY, 0.001)
+			assert.Equal(t, 2, tg.Seen)
+		}
+
+		// ball 1 is lost for a frame, and found again
+		targets = frame(blob("ball", 320, 100, 30), blob("cube", 110, 100, 20))
+		assert.Equal(t, 2, len(targets))
+		assert.Equal(t, 1, ts.Get(1).Missed)
+		targets = frame(blob("ball", 125, 100, 20), blob("ball", 330, 100, 30), blob("cube", 110, 100, 20))
+		assert.Equal(t, 3, len(targets))
+		assert.NotNil(t, ts.Get(1))
+		assert.Equal(t, 0, ts.Get(1).Missed)
+
+		// lost for 2 frames, it's dropped
+		frame(blob("ball", 340, 100, 30))
+		frame(blob("ball", 350, 100, 30))
+		assert.Nil(t, ts.Get(1))
+		assert.Nil(t, ts.Get(3))
+
+		// a new one far away gets a new id
+		targets = frame(blob("ball", 360, 100, 30), blob("ball", 500, 500, 20))
+		assert.Equal(t, 2, len(targets))
+		assert.Equal(t, 2, targets[0].ID)
+		assert.Equal(t, 4, targets[1].ID)
+	}
+}
+
+func TestIoU(t *testing.T) {
+	testCases := []struct {
+		a, b image.Rectangle
+		iou  float64
+	}{
+		{image.Rect(0, 0, 10, 10), image.Rect(0, 0, 10, 10), 1},
+		{image.Rect(0, 0, 10, 10), image.Rect(5, 0, 15, 10), 1.0 / 3},
+		{image.Rect(0, 0, 10, 10), image.Rect(20, 20, 30, 30), 0},
+		{image.Rectangle{}, image.Rectangle{}, 0},
+	}
+	for _, test := range testCases {
+		assert.InDelta(t, test.iou, IoU(test.a, test.b), 1e-9)
+	}
+}
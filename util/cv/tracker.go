@@ -1,3 +1,5 @@
+// +build gocv
+
 package cv
 
 import (
@@ -42,6 +44,15 @@ func NewTracker(lh, ls, lv, hh, hs, hv float64) (*Tracker, error) {
 	}, nil
 }
 
+// LoadTracker creates a tracker with the hsv profile of the name saved by the calibration of Stream
+func LoadTracker(profiles, name string) (*Tracker, error) {
+	p, err := LoadProfile(profiles, name)
+	if err != nil {
+		return nil, err
+	}
+	return NewTracker(p.Low[0], p.Low[1], p.Low[2], p.High[0], p.High[1], p.High[2])
+}
+
 // Locate ...
 func (t *Tracker) Locate() (bool, *image.Rectangle) {
 	t.cam.Grab(6)
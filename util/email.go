@@ -3,6 +3,7 @@ package util
 import (
 	"fmt"
 	"net/smtp"
+	"strings"
 )
 
 // EmailConfig ...
@@ -46,7 +47,7 @@ func NewEmail(cfg *EmailConfig) *Email {
 
 // Send ...
 func (e *Email) Send(info *EmailInfo) error {
-	msg := fmt.Sprintf("From: %v\nTo: %v\nSubject: %v\n\n%v", e.Address, info.To, info.Subject, info.Body)
+	msg := fmt.Sprintf("From: %v\r\nTo: %v\r\nSubject: %v\r\n\r\n%v", e.Address, strings.Join(info.To, ", "), info.Subject, info.Body)
 	err := smtp.SendMail(fmt.Sprintf("%v:%v", e.SMTP, e.SMTPPort),
 		smtp.PlainAuth("", e.Address, e.Password, e.SMTP),
 		e.Address, info.To, []byte(msg))
@@ -91,3 +91,14 @@ func Side(a, b, p *Point) OnSide {
 	}
 	return MiddleSide
 }
+
+// Bearing calculates the bearing from point a to point b,
+// the bearing is in degree [0, 360), clockwise from north.
+func Bearing(a, b *Point) float64 {
+	lat1, lat2 := Rad(a.Lat), Rad(b.Lat)
+	dlon := Rad(b.Lon - a.Lon)
+	y := math.Sin(dlon) * math.Cos(lat2)
+	x := math.Cos(lat1)*math.Sin(lat2) - math.Sin(lat1)*math.Cos(lat2)*math.Cos(dlon)
+	d := math.Atan2(y, x) * 180 / math.Pi
+	return math.Mod(d+360, 360)
+}
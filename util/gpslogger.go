@@ -12,10 +12,17 @@ const (
 	timeFormat = "2006-01-02T15:04:05"
 )
 
+// gpsRecord is a point with the std of it in meter,
+// a negative std means the std is unknown.
+type gpsRecord struct {
+	pt  *geo.Point
+	std float64
+}
+
 // GPSLogger ...
 type GPSLogger struct {
 	f        *os.File
-	chPoints chan *geo.Point
+	chPoints chan *gpsRecord
 }
 
 // NewGPSLogger ...
@@ -25,29 +32,38 @@ func NewGPSLogger() *GPSLogger {
 	if err != nil {
 		return nil
 	}
-	f.WriteString("timestamp,lat,lon\n")
+	f.WriteString("timestamp,lat,lon,std\n")
 	t := &GPSLogger{
 		f:        f,
-		chPoints: make(chan *geo.Point, 32),
+		chPoints: make(chan *gpsRecord, 32),
 	}
 	go t.start()
 	return t
 }
 
 func (l *GPSLogger) start() {
-	for pt := range l.chPoints {
+	for r := range l.chPoints {
 		tm := time.Now().Format(timeFormat)
-		line := fmt.Sprintf("%v,%.6f,%.6f\n", tm, pt.Lat, pt.Lon)
+		std := ""
+		if r.std >= 0 {
+			std = fmt.Sprintf("%.2f", r.std)
+		}
+		line := fmt.Sprintf("%v,%.6f,%.6f,%v\n", tm, r.pt.Lat, r.pt.Lon, std)
 		l.f.WriteString(line)
 	}
 }
 
 // AddPoint ...
 func (l *GPSLogger) AddPoint(pt *geo.Point) {
+	l.AddEstimate(pt, -1)
+}
+
+// AddEstimate adds an estimated point with its std in meter
+func (l *GPSLogger) AddEstimate(pt *geo.Point, std float64) {
 	if pt == nil {
 		return
 	}
-	l.chPoints <- pt
+	l.chPoints <- &gpsRecord{pt: pt, std: std}
 }
 
 // Close ...
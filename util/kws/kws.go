@@ -0,0 +1,128 @@
+/*
+Package kws is an offline keyword spotter,
+it matches the speech with the recorded templates of the keywords using MFCC features and DTW.
+
+The templates are wavs in the directories named by the keywords, e.g.
+
+	kws/
+	├── forward/
+	│   ├── 1.wav
+	│   └── 2.wav
+	└── stop/
+	    └── 1.wav
+
+Record every keyword 2~3 times with the micro-phone of the device for better accuracy,
+the wavs must be 16-bit pcm, e.g. recorded by util/audio.
+*/
+package kws
+
+import (
+	"errors"
+	"io/ioutil"
+	"log"
+	"math"
+	"path/filepath"
+	"strings"
+
+	"github.com/jakefau/rpi-devices/util/audio"
+)
+
+const (
+	// DefaultThreshold is the max distance of a keyword matching a template
+	DefaultThreshold = 12.0
+)
+
+type template struct {
+	keyword string
+	feats   [][]float64
+}
+
+// Spotter spots the keywords in the speech
+type Spotter struct {
+	// Threshold is the max distance of a keyword matching a template,
+	// the speech doesn't match any keyword if the distances to all the templates are larger than it.
+	Threshold float64
+
+	templates []*template
+}
+
+// NewSpotter creates a spotter with the templates in the directory
+func NewSpotter(dir string) (*Spotter, error) {
+	s := &Spotter{Threshold: DefaultThreshold}
+	dirs, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, d := range dirs {
+		if !d.IsDir() {
+			continue
+		}
+		wavs, err := filepath.Glob(filepath.Join(dir, d.Name(), "*.wav"))
+		if err != nil {
+			return nil, err
+		}
+		for _, wav := range wavs {
+			if err := s.AddTemplate(d.Name(), wav); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if len(s.templates) == 0 {
+		return nil, errors.New("no templates")
+	}
+	log.Printf("[kws]loaded %v templates", len(s.templates))
+	return s, nil
+}
+
+// AddTemplate adds a template of the keyword
+func (s *Spotter) AddTemplate(keyword, wav string) error {
+	feats, err := features(wav)
+	if err != nil {
+		return err
+	}
+	if len(feats) == 0 {
+		return errors.New("empty template: " + wav)
+	}
+	s.templates = append(s.templates, &template{
+		keyword: strings.ToLower(keyword),
+		feats:   feats,
+	})
+	return nil
+}
+
+// Spot returns the keyword best matching the speech in the wav and the distance,
+// the keyword is empty if nothing matches.
+func (s *Spotter) Spot(wav string) (string, float64, error) {
+	feats, err := features(wav)
+	if err != nil {
+		return "", 0, err
+	}
+	keyword, min := "", math.Inf(1)
+	for _, t := range s.templates {
+		if d := dtw(feats, t.feats); d < min {
+			keyword, min = t.keyword, d
+		}
+	}
+	if min > s.Threshold {
+		return "", min, nil
+	}
+	return keyword, min, nil
+}
+
+// ToText returns the keyword spotted in the wav, it implements the speech recognizer of the car
+func (s *Spotter) ToText(wav string) (string, error) {
+	keyword, d, err := s.Spot(wav)
+	if err != nil {
+		return "", err
+	}
+	log.Printf("[kws]keyword: %q, distance: %.2f", keyword, d)
+	return keyword, nil
+}
+
+func features(wav string) ([][]float64, error) {
+	b, err := audio.ReadFile(wav)
+	if err != nil {
+		return nil, err
+	}
+	return mfcc(b.Mono(), b.Rate), nil
+}
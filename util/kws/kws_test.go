@@ -0,0 +1,114 @@
+package kws
+
+import (
+	"io/ioutil"
+	"math"
+	"math/cmplx"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/jakefau/rpi-devices/util/audio"
+	"github.com/stretchr/testify/assert"
+)
+
+const rate = 16000
+
+// word synthesizes a word sweeping from f0 to f1 in sec seconds, with 0.2s silence at both ends
+func word(f0, f1, sec, amp, noise float64, seed int64) []float64 {
+	rnd := rand.New(rand.NewSource(seed))
+	pad := int(0.2 * rate)
+	n := int(sec * rate)
+	samples := make([]float64, n+2*pad)
+	phase := 0.0
+	for i := range samples {
+		samples[i] = noise * rnd.NormFloat64()
+		if i < pad || i >= pad+n {
+			continue
+		}
+		f := f0 + (f1-f0)*float64(i-pad)/float64(n)
+		phase += 2 * math.Pi * f / rate
+		samples[i] += amp * (math.Sin(phase) + 0.5*math.Sin(2*phase))
+	}
+	return samples
+}
+
+func writeWav(t *testing.T, file string, samples []float64) {
+	b := &audio.Buffer{Format: audio.Voice}
+	for _, v := range samples {
+		v = math.Max(-1, math.Min(1, v))
+		b.Samples = append(b.Samples, int16(v*32767))
+	}
+	assert.NoError(t, os.MkdirAll(filepath.Dir(file), 0755))
+	assert.NoError(t, audio.WriteFile(file, b))
+}
+
+func TestFFT(t *testing.T) {
+	x := make([]complex128, 8)
+	for i := range x {
+		x[i] = complex(math.Cos(2*math.Pi*float64(i)/8), 0)
+	}
+	fft(x)
+	for i, v := range x {
+		want := 0.0
+		if i == 1 || i == 7 {
+			want = 4
+		}
+		assert.InDelta(t, want, cmplx.Abs(v), 1e-9)
+	}
+}
+
+func TestSpot(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kws")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	// the templates
+	writeWav(t, filepath.Join(dir, "forward", "1.wav"), word(300, 1500, 0.5, 0.3, 0.01, 1))
+	writeWav(t, filepath.Join(dir, "forward", "2.wav"), word(300, 1500, 0.45, 0.4, 0.01, 2))
+	writeWav(t, filepath.Join(dir, "stop", "1.wav"), word(1500, 300, 0.5, 0.3, 0.01, 3))
+	writeWav(t, filepath.Join(dir, "left", "1.wav"), word(600, 600, 0.4, 0.3, 0.01, 4))
+	s, err := NewSpotter(dir)
+	assert.NoError(t, err)
+
+	testCases := []struct {
+		desc    string
+		samples []float64
+		keyword string
+	}{
+		{
+			desc:    "forward, slower and louder",
+			samples: word(300, 1500, 0.6, 0.6, 0.02, 10),
+			keyword: "forward",
+		},
+		{
+			desc:    "stop, faster and quieter",
+			samples: word(1500, 300, 0.4, 0.1, 0.005, 11),
+			keyword: "stop",
+		},
+		{
+			desc:    "left",
+			samples: word(600, 600, 0.5, 0.3, 0.02, 12),
+			keyword: "left",
+		},
+		{
+			desc:    "an unknown word",
+			samples: word(2500, 3500, 0.5, 0.3, 0.01, 13),
+			keyword: "",
+		},
+		{
+			desc:    "noise",
+			samples: word(0, 0, 0, 0, 0.1, 14),
+			keyword: "",
+		},
+	}
+	for i, test := range testCases {
+		wav := filepath.Join(dir, "query", string(rune('a'+i))+".wav")
+		writeWav(t, wav, test.samples)
+		keyword, d, err := s.Spot(wav)
+		assert.NoError(t, err)
+		t.Logf("%v: %q, distance: %.2f", test.desc, keyword, d)
+		assert.Equal(t, test.keyword, keyword, test.desc)
+	}
+}
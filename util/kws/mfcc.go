@@ -0,0 +1,211 @@
+package kws
+
+import (
+	"math"
+	"math/cmplx"
+)
+
+const (
+	frameTime   = 0.025 // second
+	hopTime     = 0.010 // second
+	preEmphasis = 0.97
+	numFilters  = 26
+	numCoeffs   = 13
+	// the frames quieter than the loudest frame by silenceDB are trimmed from both ends
+	silenceDB = 30
+)
+
+// mfcc computes the mel-frequency cepstral coefficients of the samples frame by frame,
+// the silence at both ends is trimmed, and the mean of each coefficient is removed.
+func mfcc(samples []float64, rate int) [][]float64 {
+	frameLen := int(frameTime * float64(rate))
+	hop := int(hopTime * float64(rate))
+	if frameLen == 0 || hop == 0 || len(samples) < frameLen {
+		return nil
+	}
+	nfft := 1
+	for nfft < frameLen {
+		nfft *= 2
+	}
+
+	// pre-emphasis
+	x := make([]float64, len(samples))
+	x[0] = samples[0]
+	for i := 1; i < len(samples); i++ {
+		x[i] = samples[i] - preEmphasis*samples[i-1]
+	}
+
+	filters := melFilters(nfft, rate)
+	var (
+		feats    [][]float64
+		energies []float64
+	)
+	buf := make([]complex128, nfft)
+	for start := 0; start+frameLen <= len(x); start += hop {
+		energy := 0.0
+		for i := range buf {
+			buf[i] = 0
+		}
+		for i := 0; i < frameLen; i++ {
+			v := x[start+i]
+			energy += v * v
+			// hamming window
+			w := 0.54 - 0.46*math.Cos(2*math.Pi*float64(i)/float64(frameLen-1))
+			buf[i] = complex(v*w, 0)
+		}
+		fft(buf)
+
+		power := make([]float64, nfft/2+1)
+		for i := range power {
+			a := cmplx.Abs(buf[i])
+			power[i] = a * a / float64(nfft)
+		}
+		logMel := make([]float64, numFilters)
+		for m, f := range filters {
+			e := 0.0
+			for k, w := range f {
+				e += w * power[k]
+			}
+			logMel[m] = math.Log(e + 1e-10)
+		}
+		feats = append(feats, dct(logMel, numCoeffs))
+		energies = append(energies, 10*math.Log10(energy+1e-10))
+	}
+	return normalize(trim(feats, energies))
+}
+
+// trim trims the silent frames at both ends
+func trim(feats [][]float64, energies []float64) [][]float64 {
+	max := math.Inf(-1)
+	for _, e := range energies {
+		max = math.Max(max, e)
+	}
+	i, j := 0, len(feats)
+	for i < j && energies[i] < max-silenceDB {
+		i++
+	}
+	for j > i && energies[j-1] < max-silenceDB {
+		j--
+	}
+	return feats[i:j]
+}
+
+// normalize removes the mean of each coefficient, which is the channel, e.g. the micro-phone
+func normalize(feats [][]float64) [][]float64 {
+	if len(feats) == 0 {
+		return feats
+	}
+	mean := make([]float64, len(feats[0]))
+	for _, f := range feats {
+		for i, v := range f {
+			mean[i] += v
+		}
+	}
+	for i := range mean {
+		mean[i] /= float64(len(feats))
+	}
+	for _, f := range feats {
+		for i := range f {
+			f[i] -= mean[i]
+		}
+	}
+	return feats
+}
+
+// melFilters creates the triangular filters in mel scale, a filter is the weights of the fft bins
+func melFilters(nfft, rate int) [][]float64 {
+	mel := func(hz float64) float64 { return 2595 * math.Log10(1+hz/700) }
+	hz := func(m float64) float64 { return 700 * (math.Pow(10, m/2595) - 1) }
+
+	lo, hi := mel(0), mel(float64(rate)/2)
+	bins := make([]int, numFilters+2)
+	for i := range bins {
+		m := lo + (hi-lo)*float64(i)/float64(numFilters+1)
+		bins[i] = int(math.Floor(float64(nfft+1) * hz(m) / float64(rate)))
+	}
+
+	filters := make([][]float64, numFilters)
+	for m := 1; m <= numFilters; m++ {
+		f := make([]float64, nfft/2+1)
+		for k := bins[m-1]; k < bins[m]; k++ {
+			f[k] = float64(k-bins[m-1]) / float64(bins[m]-bins[m-1])
+		}
+		for k := bins[m]; k < bins[m+1]; k++ {
+			f[k] = float64(bins[m+1]-k) / float64(bins[m+1]-bins[m])
+		}
+		filters[m-1] = f
+	}
+	return filters
+}
+
+// dct is the type-II discrete cosine transform, only the first n coefficients are computed
+func dct(x []float64, n int) []float64 {
+	y := make([]float64, n)
+	for k := 0; k < n; k++ {
+		s := 0.0
+		for i, v := range x {
+			s += v * math.Cos(math.Pi*float64(k)*(float64(i)+0.5)/float64(len(x)))
+		}
+		y[k] = s
+	}
+	return y
+}
+
+// fft is the in-place radix-2 fast fourier transform, len(x) must be a power of 2
+func fft(x []complex128) {
+	n := len(x)
+	// bit reversal
+	for i, j := 1, 0; i < n; i++ {
+		bit := n >> 1
+		for ; j&bit != 0; bit >>= 1 {
+			j ^= bit
+		}
+		j ^= bit
+		if i < j {
+			x[i], x[j] = x[j], x[i]
+		}
+	}
+	for size := 2; size <= n; size <<= 1 {
+		w := cmplx.Exp(complex(0, -2*math.Pi/float64(size)))
+		for start := 0; start < n; start += size {
+			wk := complex(1, 0)
+			for k := 0; k < size/2; k++ {
+				a, b := x[start+k], wk*x[start+k+size/2]
+				x[start+k], x[start+k+size/2] = a+b, a-b
+				wk *= w
+			}
+		}
+	}
+}
+
+// dtw returns the distance of two sequences of features by dynamic time warping,
+// it is normalized by the length of the sequences.
+func dtw(a, b [][]float64) float64 {
+	n, m := len(a), len(b)
+	if n == 0 || m == 0 {
+		return math.Inf(1)
+	}
+	prev := make([]float64, m+1)
+	cur := make([]float64, m+1)
+	for j := 1; j <= m; j++ {
+		prev[j] = math.Inf(1)
+	}
+	for i := 1; i <= n; i++ {
+		cur[0] = math.Inf(1)
+		for j := 1; j <= m; j++ {
+			d := dist(a[i-1], b[j-1])
+			cur[j] = d + math.Min(prev[j-1], math.Min(prev[j], cur[j-1]))
+		}
+		prev, cur = cur, prev
+	}
+	return prev[m] / float64(n+m)
+}
+
+func dist(a, b []float64) float64 {
+	s := 0.0
+	for i := range a {
+		d := a[i] - b[i]
+		s += d * d
+	}
+	return math.Sqrt(s)
+}
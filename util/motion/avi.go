@@ -0,0 +1,203 @@
+package motion
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+// the offsets of the fields patched when closing the avi
+const (
+	offRIFFSize    = 4
+	offTotalFrames = 48
+	offAvihBufSize = 60
+	offStrhLength  = 140
+	offStrhBufSize = 144
+	offMoviSize    = 216
+	offMovi        = 220
+
+	aviKeyFrame = 0x10
+	aviHasIndex = 0x10
+)
+
+type aviIndex struct {
+	offset uint32
+	size   uint32
+}
+
+// AVI writes the jpeg frames to an avi of motion jpeg
+type AVI struct {
+	w      io.WriteSeeker
+	width  int
+	height int
+	fps    int
+
+	pos     int64
+	index   []aviIndex
+	maxSize uint32
+	err     error
+}
+
+// NewAVI creates an avi writing to w
+func NewAVI(w io.WriteSeeker, width, height, fps int) (*AVI, error) {
+	if fps <= 0 {
+		return nil, errors.New("invalid fps")
+	}
+	a := &AVI{
+		w:      w,
+		width:  width,
+		height: height,
+		fps:    fps,
+	}
+	a.writeHeader()
+	if a.err != nil {
+		return nil, a.err
+	}
+	return a, nil
+}
+
+// WriteFrame writes a jpeg frame
+func (a *AVI) WriteFrame(jpeg []byte) error {
+	size := uint32(len(jpeg))
+	a.index = append(a.index, aviIndex{
+		offset: uint32(a.pos - offMovi),
+		size:   size,
+	})
+	if size > a.maxSize {
+		a.maxSize = size
+	}
+	a.fourcc("00dc")
+	a.u32(size)
+	a.write(jpeg)
+	if size%2 == 1 {
+		a.write([]byte{0})
+	}
+	return a.err
+}
+
+// Frames returns the number of frames written
+func (a *AVI) Frames() int {
+	return len(a.index)
+}
+
+// Close writes the index and patches the header, it doesn't close the underlying writer
+func (a *AVI) Close() error {
+	moviEnd := a.pos
+	a.fourcc("idx1")
+	a.u32(uint32(16 * len(a.index)))
+	for _, idx := range a.index {
+		a.fourcc("00dc")
+		a.u32(aviKeyFrame)
+		a.u32(idx.offset)
+		a.u32(idx.size)
+	}
+	end := a.pos
+
+	a.patch(offRIFFSize, uint32(end-8))
+	a.patch(offTotalFrames, uint32(len(a.index)))
+	a.patch(offAvihBufSize, a.maxSize)
+	a.patch(offStrhLength, uint32(len(a.index)))
+	a.patch(offStrhBufSize, a.maxSize)
+	a.patch(offMoviSize, uint32(moviEnd-offMovi))
+	if a.err == nil {
+		_, a.err = a.w.Seek(end, io.SeekStart)
+	}
+	return a.err
+}
+
+func (a *AVI) writeHeader() {
+	w, h := uint32(a.width), uint32(a.height)
+	a.fourcc("RIFF")
+	a.u32(0) // patched
+	a.fourcc("AVI ")
+
+	a.fourcc("LIST")
+	a.u32(192)
+	a.fourcc("hdrl")
+
+	// the main header
+	a.fourcc("avih")
+	a.u32(56)
+	a.u32(uint32(1000000 / a.fps)) // micro seconds per frame
+	a.u32(0)                       // max bytes per second
+	a.u32(0)                       // padding granularity
+	a.u32(aviHasIndex)             // flags
+	a.u32(0)                       // total frames, patched
+	a.u32(0)                       // initial frames
+	a.u32(1)                       // streams
+	a.u32(0)                       // suggested buffer size, patched
+	a.u32(w)
+	a.u32(h)
+	a.write(make([]byte, 16)) // reserved
+
+	a.fourcc("LIST")
+	a.u32(116)
+	a.fourcc("strl")
+
+	// the stream header
+	a.fourcc("strh")
+	a.u32(56)
+	a.fourcc("vids")
+	a.fourcc("MJPG")
+	a.u32(0)                // flags
+	a.u32(0)                // priority and language
+	a.u32(0)                // initial frames
+	a.u32(1)                // scale
+	a.u32(uint32(a.fps))    // rate
+	a.u32(0)                // start
+	a.u32(0)                // length, patched
+	a.u32(0)                // suggested buffer size, patched
+	a.u32(0xFFFFFFFF)       // quality
+	a.u32(0)                // sample size
+	a.u32(0)                // frame left and top
+	a.u32(w&0xFFFF | h<<16) // frame right and bottom
+
+	// the stream format
+	a.fourcc("strf")
+	a.u32(40)
+	a.u32(40)
+	a.u32(w)
+	a.u32(h)
+	a.u32(1 | 24<<16) // planes and bit count
+	a.fourcc("MJPG")
+	a.u32(w * h * 3)
+	a.u32(0)
+	a.u32(0)
+	a.u32(0)
+	a.u32(0)
+
+	a.fourcc("LIST")
+	a.u32(0) // patched
+	a.fourcc("movi")
+}
+
+func (a *AVI) fourcc(s string) {
+	a.write([]byte(s))
+}
+
+func (a *AVI) u32(v uint32) {
+	var b [4]byte
+	binary.LittleEndian.PutUint32(b[:], v)
+	a.write(b[:])
+}
+
+func (a *AVI) write(b []byte) {
+	if a.err != nil {
+		return
+	}
+	n, err := a.w.Write(b)
+	a.pos += int64(n)
+	a.err = err
+}
+
+func (a *AVI) patch(off int64, v uint32) {
+	if a.err != nil {
+		return
+	}
+	if _, a.err = a.w.Seek(off, io.SeekStart); a.err != nil {
+		return
+	}
+	var b [4]byte
+	binary.LittleEndian.PutUint32(b[:], v)
+	_, a.err = a.w.Write(b[:])
+}
@@ -0,0 +1,71 @@
+// +build gocv
+
+package motion
+
+import (
+	"image"
+	"time"
+
+	"gocv.io/x/gocv"
+)
+
+const canCapture = true
+
+// capture captures the frames from the camera, and detects the motion by MOG2 background subtraction
+func (m *Monitor) capture(quit chan bool) error {
+	cam, err := gocv.OpenVideoCapture(m.cfg.Device)
+	if err != nil {
+		return err
+	}
+	defer cam.Close()
+
+	mog := gocv.NewBackgroundSubtractorMOG2()
+	defer mog.Close()
+
+	img := gocv.NewMat()
+	frame := gocv.NewMat()
+	fg := gocv.NewMat()
+	kernel := gocv.GetStructuringElement(gocv.MorphRect, image.Point{X: 3, Y: 3})
+	defer img.Close()
+	defer frame.Close()
+	defer fg.Close()
+	defer kernel.Close()
+
+	size := image.Point{X: m.cfg.Width, Y: m.cfg.Height}
+	interval := time.Second / time.Duration(m.cfg.FPS)
+	for {
+		select {
+		case <-quit:
+			return nil
+		default:
+			// do nothing
+		}
+
+		start := time.Now()
+		if !cam.Read(&img) || img.Empty() {
+			time.Sleep(interval)
+			continue
+		}
+		gocv.Resize(img, &frame, size, 0, 0, gocv.InterpolationLinear)
+		mog.Apply(frame, &fg)
+		// the shadows are 127 in the mask of MOG2, drop them
+		gocv.Threshold(fg, &fg, 200, 255, gocv.ThresholdBinary)
+		gocv.Erode(fg, &fg, kernel)
+		gocv.Dilate(fg, &fg, kernel)
+
+		buf, err := gocv.IMEncode(".jpg", frame)
+		if err != nil {
+			continue
+		}
+		m.Feed(&Frame{
+			Time:   start,
+			JPEG:   buf,
+			Mask:   fg.ToBytes(),
+			Width:  m.cfg.Width,
+			Height: m.cfg.Height,
+		})
+		if d := interval - time.Since(start); d > 0 {
+			time.Sleep(d)
+		}
+	}
+}
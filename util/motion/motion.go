@@ -0,0 +1,426 @@
+/*
+Package motion detects motion in the view of the camera by background subtraction using open cv,
+and records the events as motion jpeg avi clips with a json index, it replaces the motion daemon.
+
+The frames before and after an event are recorded in the clip too,
+the live stream, the last snapshot and the clips are served by the http handler of the monitor.
+Capturing from the camera needs to build with -tags=gocv.
+*/
+package motion
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/hybridgroup/mjpeg"
+)
+
+const (
+	indexFile = "index.json"
+)
+
+var (
+	// ErrNoCV means the monitor can't capture from the camera without open cv
+	ErrNoCV = errors.New("can't capture without open cv, build with -tags=gocv")
+)
+
+// Zone is a region of the frame watched for motion, in the pixels of the frame resized
+type Zone struct {
+	Name string          `json:"name"`
+	Rect image.Rectangle `json:"rect"`
+}
+
+// Config is the config of a monitor.
+// Zones are the regions watched, the whole frame is watched if it is empty.
+// Sensitivity is in [0, 1], the higher the smaller motion triggers an event.
+// PreEvent and PostEvent are the durations recorded before and after the motion,
+// and an event is cut into clips of MaxEvent at most.
+// Dir is the directory of the clips and the index.
+type Config struct {
+	Device      int
+	Width       int
+	Height      int
+	FPS         int
+	Zones       []Zone
+	Sensitivity float64
+	PreEvent    time.Duration
+	PostEvent   time.Duration
+	MaxEvent    time.Duration
+	Dir         string
+}
+
+// DefaultConfig ...
+func DefaultConfig() *Config {
+	return &Config{
+		Device:      0,
+		Width:       640,
+		Height:      480,
+		FPS:         10,
+		Sensitivity: 0.5,
+		PreEvent:    2 * time.Second,
+		PostEvent:   3 * time.Second,
+		MaxEvent:    60 * time.Second,
+		Dir:         "motion",
+	}
+}
+
+// Frame is a frame of the camera, Mask is the foreground mask of the frame in bytes, 0 for the background.
+type Frame struct {
+	Time   time.Time
+	JPEG   []byte
+	Mask   []byte
+	Width  int
+	Height int
+}
+
+// Event is a motion event recorded in Clip, and Snapshot is the frame when the motion was detected.
+// Clip and Snapshot are the file names in the directory of the monitor.
+type Event struct {
+	ID       int       `json:"id"`
+	Start    time.Time `json:"start"`
+	End      time.Time `json:"end"`
+	Zones    []string  `json:"zones"`
+	Frames   int       `json:"frames"`
+	Clip     string    `json:"clip"`
+	Snapshot string    `json:"snapshot"`
+}
+
+type recording struct {
+	event      *Event
+	file       *os.File
+	avi        *AVI
+	lastMotion time.Time
+}
+
+// Monitor detects the motion of the frames, and records the events
+type Monitor struct {
+	// OnEvent is called when an event is recorded, set it before Start
+	OnEvent func(e *Event)
+	// OnMotion is called with the bounds of the motion in the frame when motion is detected, set it before Start
+	OnMotion func(f *Frame, bounds image.Rectangle)
+
+	cfg    *Config
+	stream *mjpeg.Stream
+
+	mu     sync.Mutex
+	last   []byte
+	pre    []*Frame
+	rec    *recording
+	events []*Event
+	nextID int
+	quit   chan bool
+	done   chan bool
+}
+
+// Available returns true if the monitor can capture from the camera, it's built with open cv
+func Available() bool {
+	return canCapture
+}
+
+// New creates a monitor, the events recorded before are loaded from the index in the directory
+func New(cfg *Config) (*Monitor, error) {
+	if cfg.FPS <= 0 {
+		return nil, errors.New("invalid fps")
+	}
+	if err := os.MkdirAll(cfg.Dir, 0755); err != nil {
+		return nil, err
+	}
+	m := &Monitor{
+		cfg:    cfg,
+		stream: mjpeg.NewStream(),
+		nextID: 1,
+	}
+	data, err := ioutil.ReadFile(filepath.Join(cfg.Dir, indexFile))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if err == nil {
+		if err := json.Unmarshal(data, &m.events); err != nil {
+			return nil, fmt.Errorf("failed to load %v, error: %v", indexFile, err)
+		}
+	}
+	for _, e := range m.events {
+		if e.ID >= m.nextID {
+			m.nextID = e.ID + 1
+		}
+	}
+	return m, nil
+}
+
+// Start starts capturing from the camera
+func (m *Monitor) Start() error {
+	if !canCapture {
+		return ErrNoCV
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.quit != nil {
+		return errors.New("started already")
+	}
+	m.quit = make(chan bool)
+	m.done = make(chan bool)
+	go func(quit, done chan bool) {
+		defer close(done)
+		if err := m.capture(quit); err != nil {
+			log.Printf("[motion]failed to capture, error: %v", err)
+		}
+	}(m.quit, m.done)
+	return nil
+}
+
+// Stop stops capturing, and finishes the event being recorded
+func (m *Monitor) Stop() {
+	m.mu.Lock()
+	quit, done := m.quit, m.done
+	m.quit, m.done = nil, nil
+	m.mu.Unlock()
+	if quit != nil {
+		close(quit)
+		<-done
+	}
+
+	m.mu.Lock()
+	e := m.finish(time.Now())
+	m.mu.Unlock()
+	m.notify(e)
+}
+
+// Feed detects the motion of the frame, and records it if an event is going on
+func (m *Monitor) Feed(f *Frame) {
+	zones := Detect(f.Mask, f.Width, f.Height, m.cfg.Zones, m.cfg.Sensitivity)
+	m.stream.UpdateJPEG(f.JPEG)
+
+	m.mu.Lock()
+	m.last = f.JPEG
+	var e *Event
+	if m.rec == nil {
+		m.pre = append(m.pre, f)
+		for len(m.pre) > 0 && f.Time.Sub(m.pre[0].Time) > m.cfg.PreEvent {
+			m.pre = m.pre[1:]
+		}
+		if len(zones) > 0 {
+			if err := m.begin(f, zones); err != nil {
+				log.Printf("[motion]failed to record event, error: %v", err)
+			}
+		}
+	} else {
+		r := m.rec
+		if err := r.avi.WriteFrame(f.JPEG); err != nil {
+			log.Printf("[motion]failed to write frame, error: %v", err)
+		}
+		if len(zones) > 0 {
+			r.lastMotion = f.Time
+			r.event.Zones = merge(r.event.Zones, zones)
+		}
+		if f.Time.Sub(r.lastMotion) >= m.cfg.PostEvent || f.Time.Sub(r.event.Start) >= m.cfg.MaxEvent {
+			e = m.finish(f.Time)
+		}
+	}
+	m.mu.Unlock()
+	m.notify(e)
+	if len(zones) > 0 && m.OnMotion != nil {
+		m.OnMotion(f, Bounds(f.Mask, f.Width, f.Height))
+	}
+}
+
+// Snapshot returns the last frame in jpeg, nil if there isn't any frame yet
+func (m *Monitor) Snapshot() []byte {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.last
+}
+
+// Events returns the events recorded, the earliest first
+func (m *Monitor) Events() []*Event {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	events := make([]*Event, len(m.events))
+	for i, e := range m.events {
+		c := *e
+		events[i] = &c
+	}
+	return events
+}
+
+// Handler serves the live stream on /, the last snapshot on /snapshot,
+// the index of the events on /events, and the clips and the snapshots of the events on /events/<file>.
+func (m *Monitor) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle("/", m.stream)
+	mux.HandleFunc("/snapshot", func(w http.ResponseWriter, r *http.Request) {
+		img := m.Snapshot()
+		if img == nil {
+			http.Error(w, "no frame yet", http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("Content-Type", "image/jpeg")
+		w.Write(img)
+	})
+	mux.HandleFunc("/events", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(m.Events())
+	})
+	mux.HandleFunc("/events/", func(w http.ResponseWriter, r *http.Request) {
+		name := filepath.Base(r.URL.Path)
+		if name == indexFile {
+			http.NotFound(w, r)
+			return
+		}
+		http.ServeFile(w, r, filepath.Join(m.cfg.Dir, name))
+	})
+	return mux
+}
+
+// begin begins recording an event with the frames before it
+func (m *Monitor) begin(f *Frame, zones []string) error {
+	name := fmt.Sprintf("%v-%v", f.Time.Format("20060102-150405"), m.nextID)
+	file, err := os.Create(filepath.Join(m.cfg.Dir, name+".avi"))
+	if err != nil {
+		return err
+	}
+	avi, err := NewAVI(file, f.Width, f.Height, m.cfg.FPS)
+	if err != nil {
+		file.Close()
+		return err
+	}
+	if err := ioutil.WriteFile(filepath.Join(m.cfg.Dir, name+".jpg"), f.JPEG, 0644); err != nil {
+		log.Printf("[motion]failed to save snapshot, error: %v", err)
+	}
+	for _, p := range m.pre {
+		if err := avi.WriteFrame(p.JPEG); err != nil {
+			log.Printf("[motion]failed to write frame, error: %v", err)
+		}
+	}
+	m.pre = nil
+	m.rec = &recording{
+		event: &Event{
+			ID:       m.nextID,
+			Start:    f.Time,
+			Zones:    zones,
+			Clip:     name + ".avi",
+			Snapshot: name + ".jpg",
+		},
+		file:       file,
+		avi:        avi,
+		lastMotion: f.Time,
+	}
+	m.nextID++
+	log.Printf("[motion]motion detected in %v, recording %v", zones, name)
+	return nil
+}
+
+// finish finishes the event being recorded, and returns it
+func (m *Monitor) finish(t time.Time) *Event {
+	r := m.rec
+	if r == nil {
+		return nil
+	}
+	m.rec = nil
+	if err := r.avi.Close(); err != nil {
+		log.Printf("[motion]failed to close clip %v, error: %v", r.event.Clip, err)
+	}
+	r.file.Close()
+	r.event.End = t
+	r.event.Frames = r.avi.Frames()
+	m.events = append(m.events, r.event)
+	if err := m.saveIndex(); err != nil {
+		log.Printf("[motion]failed to save index, error: %v", err)
+	}
+	log.Printf("[motion]recorded %v, %v frames", r.event.Clip, r.event.Frames)
+	c := *r.event
+	return &c
+}
+
+func (m *Monitor) notify(e *Event) {
+	if e != nil && m.OnEvent != nil {
+		m.OnEvent(e)
+	}
+}
+
+func (m *Monitor) saveIndex() error {
+	data, err := json.MarshalIndent(m.events, "", "    ")
+	if err != nil {
+		return err
+	}
+	file := filepath.Join(m.cfg.Dir, indexFile)
+	tmp := file + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, file)
+}
+
+// Detect returns the names of the zones with motion in the foreground mask,
+// a zone has motion if the ratio of the foreground pixels in it is more than the threshold by the sensitivity.
+// the whole frame is a zone named "all" if zones is empty.
+func Detect(mask []byte, width, height int, zones []Zone, sensitivity float64) []string {
+	if len(mask) < width*height {
+		return nil
+	}
+	frame := image.Rect(0, 0, width, height)
+	if len(zones) == 0 {
+		zones = []Zone{{Name: "all", Rect: frame}}
+	}
+	threshold := 0.001 + 0.1*(1-sensitivity)
+
+	var moved []string
+	for _, z := range zones {
+		r := z.Rect.Intersect(frame)
+		if r.Empty() {
+			continue
+		}
+		n := 0
+		for y := r.Min.Y; y < r.Max.Y; y++ {
+			for _, v := range mask[y*width+r.Min.X : y*width+r.Max.X] {
+				if v != 0 {
+					n++
+				}
+			}
+		}
+		if float64(n)/float64(r.Dx()*r.Dy()) > threshold {
+			moved = append(moved, z.Name)
+		}
+	}
+	return moved
+}
+
+// Bounds returns the bounding rectangle of the foreground in the mask, it's empty if there isn't any foreground
+func Bounds(mask []byte, width, height int) image.Rectangle {
+	if len(mask) < width*height {
+		return image.Rectangle{}
+	}
+	var r image.Rectangle
+	for y := 0; y < height; y++ {
+		for x, v := range mask[y*width : (y+1)*width] {
+			if v != 0 {
+				r = r.Union(image.Rect(x, y, x+1, y+1))
+			}
+		}
+	}
+	return r
+}
+
+func merge(a, b []string) []string {
+	for _, s := range b {
+		found := false
+		for _, t := range a {
+			if s == t {
+				found = true
+				break
+			}
+		}
+		if !found {
+			a = append(a, s)
+		}
+	}
+	return a
+}
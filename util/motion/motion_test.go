@@ -0,0 +1,287 @@
+package motion
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"image"
+	"image/jpeg"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	width  = 40
+	height = 30
+)
+
+func jpegOf(t *testing.T, gray uint8) []byte {
+	img := image.NewGray(image.Rect(0, 0, width, height))
+	for i := range img.Pix {
+		img.Pix[i] = gray
+	}
+	var buf bytes.Buffer
+	assert.NoError(t, jpeg.Encode(&buf, img, nil))
+	return buf.Bytes()
+}
+
+// maskOf returns a mask with the foreground in the rect
+func maskOf(r image.Rectangle) []byte {
+	mask := make([]byte, width*height)
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			mask[y*width+x] = 255
+		}
+	}
+	return mask
+}
+
+// readAVI returns the total frames in the header and the frames in the movi list
+func readAVI(t *testing.T, data []byte) (int, [][]byte) {
+	assert.Equal(t, "RIFF", string(data[0:4]))
+	assert.Equal(t, len(data)-8, int(binary.LittleEndian.Uint32(data[4:8])))
+	assert.Equal(t, "AVI ", string(data[8:12]))
+	assert.Equal(t, "vidsMJPG", string(data[108:116]))
+	total := int(binary.LittleEndian.Uint32(data[offTotalFrames:]))
+	assert.Equal(t, total, int(binary.LittleEndian.Uint32(data[offStrhLength:])))
+
+	moviSize := int(binary.LittleEndian.Uint32(data[offMoviSize:]))
+	var frames [][]byte
+	for pos := offMovi + 4; pos < offMovi+moviSize; {
+		assert.Equal(t, "00dc", string(data[pos:pos+4]))
+		size := int(binary.LittleEndian.Uint32(data[pos+4:]))
+		frames = append(frames, data[pos+8:pos+8+size])
+		pos += 8 + size + size%2
+	}
+	idx := offMovi + moviSize
+	assert.Equal(t, "idx1", string(data[idx:idx+4]))
+	assert.Equal(t, 16*len(frames), int(binary.LittleEndian.Uint32(data[idx+4:])))
+	return total, frames
+}
+
+func TestAVI(t *testing.T) {
+	f, err := ioutil.TempFile("", "motion-*.avi")
+	assert.NoError(t, err)
+	defer os.Remove(f.Name())
+
+	avi, err := NewAVI(f, width, height, 10)
+	assert.NoError(t, err)
+	written := [][]byte{jpegOf(t, 0), {1, 2, 3}, jpegOf(t, 255)}
+	for _, frame := range written {
+		assert.NoError(t, avi.WriteFrame(frame))
+	}
+	assert.NoError(t, avi.Close())
+	assert.NoError(t, f.Close())
+
+	data, err := ioutil.ReadFile(f.Name())
+	assert.NoError(t, err)
+	total, frames := readAVI(t, data)
+	assert.Equal(t, 3, total)
+	assert.Equal(t, written, frames)
+
+	_, err = NewAVI(f, width, height, 0)
+	assert.Error(t, err)
+}
+
+func TestDetect(t *testing.T) {
+	zones := []Zone{
+		{Name: "door", Rect: image.Rect(0, 0, 20, 30)},
+		{Name: "window", Rect: image.Rect(20, 0, 40, 30)},
+	}
+	testCases := []struct {
+		desc        string
+		mask        []byte
+		zones       []Zone
+		sensitivity float64
+		moved       []string
+	}{
+		{
+			desc:        "nothing",
+			mask:        maskOf(image.Rectangle{}),
+			zones:       zones,
+			sensitivity: 0.5,
+			moved:       nil,
+		},
+		{
+			desc:        "in the door",
+			mask:        maskOf(image.Rect(5, 5, 15, 15)),
+			zones:       zones,
+			sensitivity: 0.5,
+			moved:       []string{"door"},
+		},
+		{
+			desc:        "in both",
+			mask:        maskOf(image.Rect(10, 5, 30, 15)),
+			zones:       zones,
+			sensitivity: 0.5,
+			moved:       []string{"door", "window"},
+		},
+		{
+			desc:        "too small",
+			mask:        maskOf(image.Rect(5, 5, 7, 7)),
+			zones:       zones,
+			sensitivity: 0.5,
+			moved:       nil,
+		},
+		{
+			desc:        "small but sensitive",
+			mask:        maskOf(image.Rect(5, 5, 7, 7)),
+			zones:       zones,
+			sensitivity: 0.99,
+			moved:       []string{"door"},
+		},
+		{
+			desc:        "the whole frame",
+			mask:        maskOf(image.Rect(5, 5, 15, 15)),
+			sensitivity: 0.5,
+			moved:       []string{"all"},
+		},
+		{
+			desc:        "a bad mask",
+			mask:        []byte{255},
+			sensitivity: 0.5,
+			moved:       nil,
+		},
+	}
+	for _, test := range testCases {
+		assert.Equal(t, test.moved, Detect(test.mask, width, height, test.zones, test.sensitivity), test.desc)
+	}
+}
+
+func TestBounds(t *testing.T) {
+	testCases := []struct {
+		desc   string
+		mask   []byte
+		bounds image.Rectangle
+	}{
+		{
+			desc:   "nothing",
+			mask:   maskOf(image.Rectangle{}),
+			bounds: image.Rectangle{},
+		},
+		{
+			desc:   "a square",
+			mask:   maskOf(image.Rect(5, 6, 15, 16)),
+			bounds: image.Rect(5, 6, 15, 16),
+		},
+		{
+			desc:   "a bad mask",
+			mask:   []byte{255},
+			bounds: image.Rectangle{},
+		},
+	}
+	for _, test := range testCases {
+		assert.Equal(t, test.bounds, Bounds(test.mask, width, height), test.desc)
+	}
+}
+
+func TestMonitor(t *testing.T) {
+	dir, err := ioutil.TempDir("", "motion")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	cfg := DefaultConfig()
+	cfg.Dir = dir
+	cfg.PreEvent = 300 * time.Millisecond
+	cfg.PostEvent = 500 * time.Millisecond
+	m, err := New(cfg)
+	assert.NoError(t, err)
+	var events []*Event
+	m.OnEvent = func(e *Event) {
+		events = append(events, e)
+	}
+	var bounds []image.Rectangle
+	m.OnMotion = func(f *Frame, b image.Rectangle) {
+		bounds = append(bounds, b)
+	}
+
+	// motion in frame 10~12
+	t0 := time.Date(2020, 1, 2, 3, 4, 5, 0, time.Local)
+	still := maskOf(image.Rectangle{})
+	moving := maskOf(image.Rect(0, 0, 20, 20))
+	for i := 0; i < 20; i++ {
+		mask := still
+		if i >= 10 && i <= 12 {
+			mask = moving
+		}
+		m.Feed(&Frame{
+			Time:   t0.Add(time.Duration(i) * 100 * time.Millisecond),
+			JPEG:   jpegOf(t, uint8(i*10)),
+			Mask:   mask,
+			Width:  width,
+			Height: height,
+		})
+	}
+	assert.Equal(t, jpegOf(t, 190), m.Snapshot())
+	assert.Equal(t, []image.Rectangle{image.Rect(0, 0, 20, 20), image.Rect(0, 0, 20, 20), image.Rect(0, 0, 20, 20)}, bounds)
+
+	// 3 frames before the motion, and 5 frames after it
+	assert.Equal(t, 1, len(events))
+	e := events[0]
+	assert.Equal(t, &Event{
+		ID:       1,
+		Start:    t0.Add(time.Second),
+		End:      t0.Add(1700 * time.Millisecond),
+		Zones:    []string{"all"},
+		Frames:   11,
+		Clip:     "20200102-030406-1.avi",
+		Snapshot: "20200102-030406-1.jpg",
+	}, e)
+	data, err := ioutil.ReadFile(filepath.Join(dir, e.Clip))
+	assert.NoError(t, err)
+	_, frames := readAVI(t, data)
+	assert.Equal(t, 11, len(frames))
+	assert.Equal(t, jpegOf(t, 70), frames[0])
+	assert.Equal(t, jpegOf(t, 170), frames[10])
+	snapshot, err := ioutil.ReadFile(filepath.Join(dir, e.Snapshot))
+	assert.NoError(t, err)
+	assert.Equal(t, jpegOf(t, 100), snapshot)
+
+	// an event being recorded is finished when stopping
+	m.Feed(&Frame{Time: t0.Add(3 * time.Second), JPEG: jpegOf(t, 0), Mask: moving, Width: width, Height: height})
+	m.Stop()
+	assert.Equal(t, 2, len(events))
+	assert.Equal(t, 2, events[1].ID)
+	assert.Equal(t, 1, events[1].Frames)
+
+	// serve the snapshot and the events
+	svr := httptest.NewServer(m.Handler())
+	defer svr.Close()
+	resp, err := http.Get(svr.URL + "/snapshot")
+	assert.NoError(t, err)
+	body, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	assert.Equal(t, "image/jpeg", resp.Header.Get("Content-Type"))
+	assert.Equal(t, jpegOf(t, 0), body)
+
+	resp, err = http.Get(svr.URL + "/events")
+	assert.NoError(t, err)
+	var served []*Event
+	assert.NoError(t, json.NewDecoder(resp.Body).Decode(&served))
+	resp.Body.Close()
+	assert.Equal(t, 2, len(served))
+
+	resp, err = http.Get(svr.URL + "/events/" + e.Clip)
+	assert.NoError(t, err)
+	body, _ = ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	assert.Equal(t, data, body)
+
+	resp, err = http.Get(svr.URL + "/events/" + indexFile)
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	// the events are loaded from the index
+	m2, err := New(cfg)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(m2.Events()))
+	assert.Equal(t, 3, m2.nextID)
+}
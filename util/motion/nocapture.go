@@ -0,0 +1,9 @@
+// +build !gocv
+
+package motion
+
+const canCapture = false
+
+func (m *Monitor) capture(quit chan bool) error {
+	return ErrNoCV
+}
@@ -0,0 +1,297 @@
+package nav
+
+import (
+	"errors"
+	"math"
+	"sync"
+
+	"github.com/jakefau/rpi-devices/util/geo"
+)
+
+// LocalizerConfig ...
+// OdomNoise: the std of the odometry error per meter traveled, e.g. 0.05 for 5%
+// YawNoise: the std of the yaw error per degree turned, e.g. 0.02 for 2%
+// YawDrift: the std of the yaw drift in degree in each prediction
+// UERE: the user equivalent range error of gps in meter, the std of a gps fix is UERE * HDOP
+// Gate: the max squared mahalanobis distance of a gps fix, the fix out of the gate will be rejected
+// MaxRejects: the localizer will be reset to the gps fix after MaxRejects fixes rejected in a row
+// HeadingDist: the distance in meter to travel for initializing the heading if it is unknown
+type LocalizerConfig struct {
+	OdomNoise   float64
+	YawNoise    float64
+	YawDrift    float64
+	UERE        float64
+	Gate        float64
+	MaxRejects  int
+	HeadingDist float64
+}
+
+// Estimate is a pose with its uncertainty
+// PosStd: the std of the location in meter, along the worst direction
+// HeadingStd: the std of the heading in degree, it is 180 if the heading is unknown
+type Estimate struct {
+	Pose
+	PosStd     float64
+	HeadingStd float64
+}
+
+// mat3 is the covariance of the state [x, y, theta]
+type mat3 [3][3]float64
+
+// Localizer is an extended kalman filter fusing wheel odometry, yaw and gps fixes.
+// the state is [x, y, theta] in a local plane around the first gps fix,
+// theta is the math angle in radian, counter-clockwise from east.
+//
+// Predict() moves the state with the odometry distance and the yaw change,
+// Update() corrects the state with a gps fix whose covariance derives from the hdop.
+type Localizer struct {
+	cfg  *LocalizerConfig
+	mu   sync.Mutex
+	proj *Projection
+
+	x, y, theta float64
+	p           mat3
+	headingOK   bool
+	rejects     int
+
+	// for initializing the heading
+	anchor XY
+	odom   float64
+	turned float64
+}
+
+// NewLocalizer ...
+func NewLocalizer(cfg *LocalizerConfig) *Localizer {
+	return &Localizer{cfg: cfg}
+}
+
+// SetHeading sets the heading in degree (clockwise from north) and its std in degree,
+// use it when the heading is known, e.g. from a compass.
+func (l *Localizer) SetHeading(heading, std float64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.theta = Heading(heading)
+	for i := 0; i < 2; i++ {
+		l.p[i][2] = 0
+		l.p[2][i] = 0
+	}
+	l.p[2][2] = sq(geo.Rad(std))
+	l.headingOK = true
+}
+
+// Predict moves the state with the odometry.
+// ds: the distance traveled in meter, negative for moving backward
+// dyaw: the yaw change in degree, clockwise positive
+func (l *Localizer) Predict(ds, dyaw float64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.proj == nil {
+		// don't know where we are until the first gps fix
+		return
+	}
+
+	dtheta := -geo.Rad(dyaw)
+	sigmaS := l.cfg.OdomNoise * math.Abs(ds)
+	sigmaT := geo.Rad(l.cfg.YawNoise*math.Abs(dyaw) + l.cfg.YawDrift)
+
+	if !l.headingOK {
+		// the location moves in an unknown direction
+		l.odom += ds
+		l.turned += dtheta
+		l.p[0][0] += sq(ds)
+		l.p[1][1] += sq(ds)
+		return
+	}
+
+	mid := l.theta + dtheta/2
+	cos, sin := math.Cos(mid), math.Sin(mid)
+	l.x += ds * cos
+	l.y += ds * sin
+	l.theta = normAngle(l.theta + dtheta)
+
+	// P = F*P*F' + G*M*G'
+	f := mat3{
+		{1, 0, -ds * sin},
+		{0, 1, ds * cos},
+		{0, 0, 1},
+	}
+	p := f.mul(l.p).mul(f.t())
+	g := [3][2]float64{
+		{cos, -ds / 2 * sin},
+		{sin, ds / 2 * cos},
+		{0, 1},
+	}
+	m := [2]float64{sq(sigmaS), sq(sigmaT)}
+	for i := 0; i < 3; i++ {
+		for j := 0; j < 3; j++ {
+			p[i][j] += g[i][0]*m[0]*g[j][0] + g[i][1]*m[1]*g[j][1]
+		}
+	}
+	l.p = p
+}
+
+// Update corrects the state with a gps fix
+func (l *Localizer) Update(pt *geo.Point, hdop float64) error {
+	if pt == nil {
+		return errors.New("nil point")
+	}
+	if hdop <= 0 {
+		return errors.New("invalid hdop")
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	r := sq(l.cfg.UERE * hdop)
+	if l.proj == nil {
+		l.reset(pt, r)
+		return nil
+	}
+
+	z := l.proj.ToXY(pt)
+	vx, vy := z.X-l.x, z.Y-l.y
+
+	// S = H*P*H' + R, H picks x and y
+	s00, s01, s11 := l.p[0][0]+r, l.p[0][1], l.p[1][1]+r
+	det := s00*s11 - s01*s01
+	if det <= 0 {
+		l.reset(pt, r)
+		return nil
+	}
+	i00, i01, i11 := s11/det, -s01/det, s00/det
+	if d2 := vx*(i00*vx+i01*vy) + vy*(i01*vx+i11*vy); l.cfg.Gate > 0 && d2 > l.cfg.Gate {
+		l.rejects++
+		if l.rejects < l.cfg.MaxRejects {
+			return errors.New("gps fix is rejected as an outlier")
+		}
+		// the filter might be lost, trust the gps
+		l.reset(pt, r)
+		return nil
+	}
+	l.rejects = 0
+
+	// K = P*H'*inv(S)
+	var k [3][2]float64
+	for i := 0; i < 3; i++ {
+		k[i][0] = l.p[i][0]*i00 + l.p[i][1]*i01
+		k[i][1] = l.p[i][0]*i01 + l.p[i][1]*i11
+	}
+	l.x += k[0][0]*vx + k[0][1]*vy
+	l.y += k[1][0]*vx + k[1][1]*vy
+	l.theta = normAngle(l.theta + k[2][0]*vx + k[2][1]*vy)
+
+	// P = (I - K*H)*P
+	var p mat3
+	for i := 0; i < 3; i++ {
+		for j := 0; j < 3; j++ {
+			p[i][j] = l.p[i][j] - k[i][0]*l.p[0][j] - k[i][1]*l.p[1][j]
+		}
+	}
+	l.p = p.sym()
+
+	if !l.headingOK {
+		l.initHeading(z, r)
+	}
+	return nil
+}
+
+// Estimate returns the current pose with its uncertainty,
+// false will be returned if there isn't any gps fix yet.
+func (l *Localizer) Estimate() (*Estimate, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.proj == nil {
+		return nil, false
+	}
+
+	// the largest eigenvalue of the location covariance
+	a, b, c := l.p[0][0], l.p[0][1], l.p[1][1]
+	lambda := (a+c)/2 + math.Sqrt(sq((a-c)/2)+sq(b))
+
+	e := &Estimate{
+		Pose: Pose{
+			Loc:     l.proj.ToGeo(XY{X: l.x, Y: l.y}),
+			Heading: Compass(l.theta),
+		},
+		PosStd:     math.Sqrt(lambda),
+		HeadingStd: 180,
+	}
+	if l.headingOK {
+		e.HeadingStd = math.Min(180, math.Sqrt(l.p[2][2])*180/math.Pi)
+	}
+	return e, true
+}
+
+// reset resets the location to the gps fix, and keeps the heading
+func (l *Localizer) reset(pt *geo.Point, r float64) {
+	if l.proj == nil {
+		l.proj = NewProjection(pt)
+	}
+	xy := l.proj.ToXY(pt)
+	l.x, l.y = xy.X, xy.Y
+	ptt := l.p[2][2]
+	l.p = mat3{}
+	l.p[0][0], l.p[1][1], l.p[2][2] = r, r, ptt
+	l.rejects = 0
+	if !l.headingOK {
+		l.anchor = xy
+		l.odom, l.turned = 0, 0
+	}
+}
+
+// initHeading initializes the heading from the displacement since the anchor
+// when the car traveled far enough
+func (l *Localizer) initHeading(z XY, r float64) {
+	d := dist(l.anchor, z)
+	if d < l.cfg.HeadingDist || math.Abs(l.odom) < l.cfg.HeadingDist/2 {
+		return
+	}
+	// the displacement is along the average heading of the arc
+	theta := math.Atan2(z.Y-l.anchor.Y, z.X-l.anchor.X)
+	if l.odom < 0 {
+		theta += math.Pi
+	}
+	l.theta = normAngle(theta + l.turned/2)
+	for i := 0; i < 2; i++ {
+		l.p[i][2] = 0
+		l.p[2][i] = 0
+	}
+	l.p[2][2] = 2*r/sq(d) + sq(l.turned/2)
+	l.headingOK = true
+}
+
+func (m mat3) mul(n mat3) mat3 {
+	var o mat3
+	for i := 0; i < 3; i++ {
+		for j := 0; j < 3; j++ {
+			for k := 0; k < 3; k++ {
+				o[i][j] += m[i][k] * n[k][j]
+			}
+		}
+	}
+	return o
+}
+
+func (m mat3) t() mat3 {
+	var o mat3
+	for i := 0; i < 3; i++ {
+		for j := 0; j < 3; j++ {
+			o[i][j] = m[j][i]
+		}
+	}
+	return o
+}
+
+// sym makes the matrix symmetric against the rounding errors
+func (m mat3) sym() mat3 {
+	for i := 0; i < 3; i++ {
+		for j := i + 1; j < 3; j++ {
+			v := (m[i][j] + m[j][i]) / 2
+			m[i][j], m[j][i] = v, v
+		}
+	}
+	return m
+}
+
+func sq(v float64) float64 {
+	return v * v
+}
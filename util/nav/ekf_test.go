@@ -0,0 +1,141 @@
+package nav
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/jakefau/rpi-devices/dev"
+	"github.com/jakefau/rpi-devices/util/geo"
+	"github.com/stretchr/testify/assert"
+)
+
+var testLocCfg = &LocalizerConfig{
+	OdomNoise:   0.05,
+	YawNoise:    0.02,
+	YawDrift:    0.1,
+	UERE:        3,
+	Gate:        16,
+	MaxRejects:  5,
+	HeadingDist: 5,
+}
+
+func TestPredict(t *testing.T) {
+	org := &geo.Point{Lat: 39.9557, Lon: 116.4442}
+	proj := NewProjection(org)
+	l := NewLocalizer(testLocCfg)
+
+	// nothing to predict without any gps fix
+	l.Predict(1, 0)
+	_, ok := l.Estimate()
+	assert.False(t, ok)
+
+	assert.NoError(t, l.Update(org, 1))
+	l.SetHeading(90, 1)
+	for i := 0; i < 10; i++ {
+		l.Predict(1, 0)
+	}
+	e, ok := l.Estimate()
+	assert.True(t, ok)
+	xy := proj.ToXY(e.Loc)
+	assert.InDelta(t, 10, xy.X, 1e-3)
+	assert.InDelta(t, 0, xy.Y, 1e-3)
+	assert.InDelta(t, 90, e.Heading, 1e-6)
+	// uncertainty grows without gps fixes
+	assert.True(t, e.PosStd > 3)
+
+	// turn right
+	for i := 0; i < 9; i++ {
+		l.Predict(0, 10)
+	}
+	e, _ = l.Estimate()
+	assert.InDelta(t, 180, e.Heading, 1e-6)
+}
+
+func TestUpdate(t *testing.T) {
+	org := &geo.Point{Lat: 39.9557, Lon: 116.4442}
+	proj := NewProjection(org)
+	l := NewLocalizer(testLocCfg)
+
+	assert.Error(t, l.Update(org, 0))
+	assert.NoError(t, l.Update(org, 1))
+	e, ok := l.Estimate()
+	assert.True(t, ok)
+	assert.InDelta(t, 3, e.PosStd, 1e-6)
+	assert.Equal(t, 180.0, e.HeadingStd)
+
+	// the heading is initialized after moving to north
+	for i := 1; i <= 6; i++ {
+		l.Predict(1, 0)
+		assert.NoError(t, l.Update(proj.ToGeo(XY{X: 0, Y: float64(i)}), 1))
+	}
+	e, _ = l.Estimate()
+	assert.True(t, e.HeadingStd < 90)
+	assert.InDelta(t, 0, math.Sin(geo.Rad(e.Heading)), 0.1)
+
+	// an outlier will be rejected
+	assert.Error(t, l.Update(proj.ToGeo(XY{X: 100, Y: 6}), 1))
+	e2, _ := l.Estimate()
+	assert.Equal(t, e.Loc, e2.Loc)
+}
+
+// TestLocalize drives along the trace of a mock gps,
+// and compares the estimates with the noisy gps fixes.
+func TestLocalize(t *testing.T) {
+	gps := dev.NewMockGPS("../../dev/test/gps.csv")
+	assert.NotNil(t, gps)
+
+	var truth []*geo.Point
+	for i := 0; i < 10; i++ {
+		fix, err := gps.Fix()
+		assert.NoError(t, err)
+		truth = append(truth, fix.Loc)
+	}
+	proj := NewProjection(truth[0])
+	rnd := rand.New(rand.NewSource(1))
+	l := NewLocalizer(testLocCfg)
+
+	const steps = 50 // steps between two points of the trace
+	var (
+		gpsErr, estErr float64
+		n              int
+		heading        = -1.0
+	)
+	for i := 1; i < len(truth); i++ {
+		a, b := proj.ToXY(truth[i-1]), proj.ToXY(truth[i])
+		h := geo.Bearing(truth[i-1], truth[i])
+		dyaw := 0.0
+		if heading >= 0 {
+			dyaw = h - heading
+		}
+		heading = h
+		ds := dist(a, b) / steps
+		for j := 1; j <= steps; j++ {
+			l.Predict(ds*(1+0.05*rnd.NormFloat64()), dyaw)
+			dyaw = 0
+
+			r := float64(j) / steps
+			pos := XY{X: a.X + (b.X-a.X)*r, Y: a.Y + (b.Y-a.Y)*r}
+			noisy := XY{X: pos.X + 3*rnd.NormFloat64(), Y: pos.Y + 3*rnd.NormFloat64()}
+			l.Update(proj.ToGeo(noisy), 1)
+
+			if i == 1 {
+				// converging
+				continue
+			}
+			e, ok := l.Estimate()
+			assert.True(t, ok)
+			gpsErr += sq(dist(noisy, pos))
+			estErr += sq(dist(proj.ToXY(e.Loc), pos))
+			n++
+		}
+	}
+	gpsErr = math.Sqrt(gpsErr / float64(n))
+	estErr = math.Sqrt(estErr / float64(n))
+	t.Logf("rms error of gps: %.2f m, rms error of estimates: %.2f m", gpsErr, estErr)
+	assert.True(t, estErr < gpsErr/2)
+
+	e, _ := l.Estimate()
+	assert.InDelta(t, heading, e.Heading, 5)
+	assert.True(t, e.PosStd < 3)
+}
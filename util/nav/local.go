@@ -0,0 +1,75 @@
+package nav
+
+import (
+	"math"
+
+	"github.com/jakefau/rpi-devices/util/geo"
+)
+
+// XY is a point in a local plane in meter, x points to east and y points to north
+type XY struct {
+	X float64
+	Y float64
+}
+
+// Projection projects gps points to a local plane around the origin.
+// it uses equirectangular projection, which is accurate enough in a few kilometers.
+type Projection struct {
+	origin *geo.Point
+	cosLat float64
+}
+
+// NewProjection ...
+func NewProjection(origin *geo.Point) *Projection {
+	return &Projection{
+		origin: origin,
+		cosLat: math.Cos(geo.Rad(origin.Lat)),
+	}
+}
+
+// ToXY ...
+func (p *Projection) ToXY(pt *geo.Point) XY {
+	return XY{
+		X: geo.Rad(pt.Lon-p.origin.Lon) * geo.EarthRadius * p.cosLat,
+		Y: geo.Rad(pt.Lat-p.origin.Lat) * geo.EarthRadius,
+	}
+}
+
+// ToGeo ...
+func (p *Projection) ToGeo(xy XY) *geo.Point {
+	return &geo.Point{
+		Lat: p.origin.Lat + xy.Y/geo.EarthRadius*180/math.Pi,
+		Lon: p.origin.Lon + xy.X/(geo.EarthRadius*p.cosLat)*180/math.Pi,
+	}
+}
+
+// Heading converts a compass heading in degree (clockwise from north)
+// to a math angle in radian (counter-clockwise from east)
+func Heading(degree float64) float64 {
+	return normAngle(geo.Rad(90 - degree))
+}
+
+// Compass converts a math angle in radian to a compass heading in degree [0, 360)
+func Compass(rad float64) float64 {
+	d := 90 - rad*180/math.Pi
+	d = math.Mod(d, 360)
+	if d < 0 {
+		d += 360
+	}
+	return d
+}
+
+// normAngle normalizes an angle in radian to (-pi, pi]
+func normAngle(a float64) float64 {
+	for a > math.Pi {
+		a -= 2 * math.Pi
+	}
+	for a <= -math.Pi {
+		a += 2 * math.Pi
+	}
+	return a
+}
+
+func dist(a, b XY) float64 {
+	return math.Hypot(a.X-b.X, a.Y-b.Y)
+}
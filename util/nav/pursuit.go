@@ -0,0 +1,190 @@
+/*
+Package nav ...
+
+PurePursuit is a path-following controller for a differential drive vehicle.
+It looks ahead on the path for a goal point, and computes the curvature of
+the arc from the current pose to the goal point.
+
+	             goal
+	    path      *
+	*------------/-----*
+	            /
+	           / arc
+	          |
+	          * vehicle
+
+The look-ahead distance grows with the speed, which makes following
+smooth at high speed and tight at low speed.
+*/
+package nav
+
+import (
+	"errors"
+	"math"
+
+	"github.com/jakefau/rpi-devices/util/geo"
+)
+
+// PursuitConfig ...
+// MinLookahead: the min look-ahead distance in meter
+// MaxLookahead: the max look-ahead distance in meter
+// LookaheadGain: look-ahead distance = LookaheadGain * speed(m/s) + MinLookahead
+// TrackWidth: the distance between the left and right wheels in meter
+type PursuitConfig struct {
+	MinLookahead  float64
+	MaxLookahead  float64
+	LookaheadGain float64
+	TrackWidth    float64
+}
+
+// Pose is the location and heading of a vehicle,
+// heading is in degree, clockwise from north.
+type Pose struct {
+	Loc     *geo.Point
+	Heading float64
+}
+
+// PurePursuit ...
+type PurePursuit struct {
+	cfg   *PursuitConfig
+	proj  *Projection
+	path  []XY
+	index int // the index of the segment which the vehicle is on
+}
+
+// NewPurePursuit creates a controller following the path,
+// the path is a polyline and the last point of it is the goal.
+func NewPurePursuit(path []*geo.Point, cfg *PursuitConfig) (*PurePursuit, error) {
+	if len(path) == 0 {
+		return nil, errors.New("empty path")
+	}
+	if cfg.MinLookahead <= 0 || cfg.MaxLookahead < cfg.MinLookahead {
+		return nil, errors.New("invalid look-ahead distance")
+	}
+	proj := NewProjection(path[0])
+	var xys []XY
+	for _, pt := range path {
+		xy := proj.ToXY(pt)
+		if n := len(xys); n > 0 && dist(xys[n-1], xy) < 1e-6 {
+			continue
+		}
+		xys = append(xys, xy)
+	}
+	return &PurePursuit{
+		cfg:  cfg,
+		proj: proj,
+		path: xys,
+	}, nil
+}
+
+// Lookahead returns the look-ahead distance in the speed(m/s)
+func (p *PurePursuit) Lookahead(speed float64) float64 {
+	l := p.cfg.LookaheadGain*math.Abs(speed) + p.cfg.MinLookahead
+	if l > p.cfg.MaxLookahead {
+		l = p.cfg.MaxLookahead
+	}
+	return l
+}
+
+// Steer computes the curvature(1/m) for the pose and speed(m/s),
+// curvature > 0: turn left, curvature < 0: turn right.
+// it also returns the distance to the end along the path,
+// which is from the pose to the closest point on the current segment and then along the rest of the path.
+func (p *PurePursuit) Steer(pose *Pose, speed float64) (curvature float64, remain float64) {
+	pos := p.proj.ToXY(pose.Loc)
+	p.advance(pos)
+	remain = p.remain(pos)
+
+	l := p.Lookahead(speed)
+	goal := p.goal(pos, l)
+
+	// the lateral offset of the goal point in the frame of the vehicle
+	theta := Heading(pose.Heading)
+	dx, dy := goal.X-pos.X, goal.Y-pos.Y
+	lateral := -math.Sin(theta)*dx + math.Cos(theta)*dy
+	d2 := dx*dx + dy*dy
+	if d2 < 1e-9 {
+		return 0, remain
+	}
+	return 2 * lateral / d2, remain
+}
+
+// Wheels converts the curvature to the speed of left and right wheels in a differential drive,
+// speed is the speed of the center of the vehicle.
+func (p *PurePursuit) Wheels(curvature, speed float64) (left, right float64) {
+	w := p.cfg.TrackWidth / 2
+	return speed * (1 - curvature*w), speed * (1 + curvature*w)
+}
+
+// goal finds the goal point on the path which is l meters away from the pos.
+// it searches forward from the current segment, so the vehicle never goes backward along the path.
+func (p *PurePursuit) goal(pos XY, l float64) XY {
+	end := p.path[len(p.path)-1]
+	if len(p.path) == 1 || dist(pos, end) <= l {
+		return end
+	}
+
+	for i := p.index; i < len(p.path)-1; i++ {
+		if pt, ok := intersect(pos, l, p.path[i], p.path[i+1]); ok {
+			return pt
+		}
+	}
+
+	// the vehicle is far away from the path, go to the closest point first
+	pt, _ := project(pos, p.path[p.index], p.path[p.index+1])
+	return pt
+}
+
+// advance moves the current segment forward to the closest one to the pos
+func (p *PurePursuit) advance(pos XY) {
+	best := math.MaxFloat64
+	for i := p.index; i < len(p.path)-1; i++ {
+		_, d := project(pos, p.path[i], p.path[i+1])
+		if d < best {
+			best = d
+			p.index = i
+		}
+	}
+}
+
+// remain returns the distance from the pos to the end along the path
+func (p *PurePursuit) remain(pos XY) float64 {
+	if len(p.path) == 1 {
+		return dist(pos, p.path[0])
+	}
+	q, d := project(pos, p.path[p.index], p.path[p.index+1])
+	d += dist(q, p.path[p.index+1])
+	for i := p.index + 1; i < len(p.path)-1; i++ {
+		d += dist(p.path[i], p.path[i+1])
+	}
+	return d
+}
+
+// project returns the closest point to p on segment ab, and the distance
+func project(p, a, b XY) (XY, float64) {
+	abx, aby := b.X-a.X, b.Y-a.Y
+	t := ((p.X-a.X)*abx + (p.Y-a.Y)*aby) / (abx*abx + aby*aby)
+	t = math.Max(0, math.Min(1, t))
+	q := XY{X: a.X + t*abx, Y: a.Y + t*aby}
+	return q, dist(p, q)
+}
+
+// intersect returns the intersection of circle(c, r) and segment ab which is the closest to b
+func intersect(c XY, r float64, a, b XY) (XY, bool) {
+	dx, dy := b.X-a.X, b.Y-a.Y
+	fx, fy := a.X-c.X, a.Y-c.Y
+	qa := dx*dx + dy*dy
+	qb := 2 * (fx*dx + fy*dy)
+	qc := fx*fx + fy*fy - r*r
+	disc := qb*qb - 4*qa*qc
+	if disc < 0 {
+		return XY{}, false
+	}
+	disc = math.Sqrt(disc)
+	for _, t := range []float64{(-qb + disc) / (2 * qa), (-qb - disc) / (2 * qa)} {
+		if t >= 0 && t <= 1 {
+			return XY{X: a.X + t*dx, Y: a.Y + t*dy}, true
+		}
+	}
+	return XY{}, false
+}
@@ -0,0 +1,162 @@
+package nav
+
+import (
+	"math"
+	"testing"
+
+	"github.com/jakefau/rpi-devices/util/geo"
+	"github.com/stretchr/testify/assert"
+)
+
+var testCfg = &PursuitConfig{
+	MinLookahead:  2,
+	MaxLookahead:  6,
+	LookaheadGain: 2,
+	TrackWidth:    0.2,
+}
+
+func TestSteer(t *testing.T) {
+	org := &geo.Point{Lat: 39.9557, Lon: 116.4442}
+	proj := NewProjection(org)
+	// a straight path to north
+	path := []*geo.Point{org, proj.ToGeo(XY{X: 0, Y: 20})}
+	p, err := NewPurePursuit(path, testCfg)
+	assert.NoError(t, err)
+
+	testCases := []struct {
+		desc    string
+		pos     XY
+		heading float64
+		sign    float64
+	}{
+		{
+			desc:    "on the path",
+			pos:     XY{X: 0, Y: 5},
+			heading: 0,
+			sign:    0,
+		},
+		{
+			desc:    "on the right of the path",
+			pos:     XY{X: 1, Y: 5},
+			heading: 0,
+			sign:    1,
+		},
+		{
+			desc:    "on the left of the path",
+			pos:     XY{X: -1, Y: 5},
+			heading: 0,
+			sign:    -1,
+		},
+		{
+			desc:    "heading to east",
+			pos:     XY{X: 0, Y: 5},
+			heading: 90,
+			sign:    1,
+		},
+	}
+
+	for _, test := range testCases {
+		pose := &Pose{Loc: proj.ToGeo(test.pos), Heading: test.heading}
+		k, remain := p.Steer(pose, 0.5)
+		assert.InDelta(t, math.Abs(test.pos.X)+20-test.pos.Y, remain, 0.01, test.desc)
+		if test.sign == 0 {
+			assert.InDelta(t, 0, k, 1e-6, test.desc)
+			continue
+		}
+		assert.True(t, k*test.sign > 0, test.desc)
+	}
+}
+
+func TestRemain(t *testing.T) {
+	org := &geo.Point{Lat: 39.9557, Lon: 116.4442}
+	proj := NewProjection(org)
+	// an L-shaped path, it's 30m long and the end is 21.2m away from the start in a straight line
+	path := []*geo.Point{
+		org,
+		proj.ToGeo(XY{X: 0, Y: 15}),
+		proj.ToGeo(XY{X: 15, Y: 15}),
+	}
+	p, err := NewPurePursuit(path, testCfg)
+	assert.NoError(t, err)
+
+	testCases := []struct {
+		desc   string
+		pos    XY
+		remain float64
+	}{
+		{desc: "at the start", pos: XY{X: 0, Y: 0}, remain: 30},
+		{desc: "on the first segment", pos: XY{X: 0, Y: 5}, remain: 25},
+		{desc: "on the second segment", pos: XY{X: 5, Y: 15}, remain: 10},
+		{desc: "off the second segment", pos: XY{X: 10, Y: 16}, remain: 6},
+		{desc: "at the end", pos: XY{X: 15, Y: 15}, remain: 0},
+	}
+	for _, test := range testCases {
+		_, remain := p.Steer(&Pose{Loc: proj.ToGeo(test.pos)}, 0.5)
+		assert.InDelta(t, test.remain, remain, 0.01, test.desc)
+	}
+}
+
+func TestLookahead(t *testing.T) {
+	p, err := NewPurePursuit([]*geo.Point{{Lat: 39.9557, Lon: 116.4442}}, testCfg)
+	assert.NoError(t, err)
+	assert.Equal(t, 2.0, p.Lookahead(0))
+	assert.Equal(t, 4.0, p.Lookahead(1))
+	assert.Equal(t, 6.0, p.Lookahead(10))
+}
+
+func TestWheels(t *testing.T) {
+	p, err := NewPurePursuit([]*geo.Point{{Lat: 39.9557, Lon: 116.4442}}, testCfg)
+	assert.NoError(t, err)
+	l, r := p.Wheels(0, 1)
+	assert.Equal(t, 1.0, l)
+	assert.Equal(t, 1.0, r)
+
+	l, r = p.Wheels(2, 1)
+	assert.InDelta(t, 0.8, l, 1e-9)
+	assert.InDelta(t, 1.2, r, 1e-9)
+}
+
+// TestFollow drives a kinematic differential-drive vehicle along an L-shaped path
+func TestFollow(t *testing.T) {
+	org := &geo.Point{Lat: 39.9557, Lon: 116.4442}
+	proj := NewProjection(org)
+	path := []*geo.Point{
+		org,
+		proj.ToGeo(XY{X: 0, Y: 15}),
+		proj.ToGeo(XY{X: 15, Y: 15}),
+	}
+	p, err := NewPurePursuit(path, testCfg)
+	assert.NoError(t, err)
+
+	var (
+		pos     = XY{X: 1, Y: 0}
+		theta   = math.Pi / 2
+		speed   = 0.5
+		dt      = 0.1
+		maxErr  float64
+		arrived bool
+	)
+	for i := 0; i < 2000; i++ {
+		pose := &Pose{Loc: proj.ToGeo(pos), Heading: Compass(theta)}
+		k, remain := p.Steer(pose, speed)
+		if remain < 0.5 {
+			arrived = true
+			break
+		}
+		l, r := p.Wheels(k, speed)
+		v := (l + r) / 2
+		w := (r - l) / testCfg.TrackWidth
+		theta += w * dt
+		pos.X += v * math.Cos(theta) * dt
+		pos.Y += v * math.Sin(theta) * dt
+
+		// cross-track error against the path
+		e := math.Min(math.Abs(pos.X), math.Abs(pos.Y-15))
+		if pos.Y < 10 {
+			e = math.Abs(pos.X)
+		}
+		maxErr = math.Max(maxErr, e)
+	}
+	assert.True(t, arrived)
+	assert.True(t, maxErr < 1.5)
+}
@@ -0,0 +1,128 @@
+package notify
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"strings"
+	"time"
+
+	"github.com/jakefau/rpi-devices/util"
+)
+
+// SMTP sends the messages by email, the attachments are attached as the mime parts
+type SMTP struct {
+	Host     string
+	Port     int
+	From     string
+	Password string
+	To       []string
+
+	// send is smtp.SendMail, it's replaced in testing
+	send func(addr string, a smtp.Auth, from string, to []string, msg []byte) error
+}
+
+// NewSMTP creates a smtp notifier by the email config, sending to the addresses
+func NewSMTP(cfg *util.EmailConfig, to ...string) *SMTP {
+	return &SMTP{
+		Host:     cfg.SMTP,
+		Port:     cfg.SMTPPort,
+		From:     cfg.Address,
+		Password: cfg.Password,
+		To:       to,
+		send:     smtp.SendMail,
+	}
+}
+
+// Notify ...
+func (s *SMTP) Notify(m *Message) error {
+	if len(s.To) == 0 {
+		return errors.New("no recipients")
+	}
+	msg, err := s.build(m, time.Now())
+	if err != nil {
+		return err
+	}
+	addr := fmt.Sprintf("%v:%v", s.Host, s.Port)
+	auth := smtp.PlainAuth("", s.From, s.Password, s.Host)
+	return s.send(addr, auth, s.From, s.To, msg)
+}
+
+// build builds the mime message, a plain text one if there isn't any attachment, or a multipart one
+func (s *SMTP) build(m *Message, date time.Time) ([]byte, error) {
+	var to []string
+	for _, addr := range s.To {
+		to = append(to, (&mail.Address{Address: addr}).String())
+	}
+
+	var buf bytes.Buffer
+	header := func(k, v string) {
+		fmt.Fprintf(&buf, "%v: %v\r\n", k, v)
+	}
+	header("From", (&mail.Address{Address: s.From}).String())
+	header("To", strings.Join(to, ", "))
+	header("Subject", mime.QEncoding.Encode("utf-8", m.Title))
+	header("Date", date.Format(time.RFC1123Z))
+	header("MIME-Version", "1.0")
+	if m.Priority >= High {
+		header("X-Priority", "1")
+	}
+
+	if len(m.Attachments) == 0 {
+		header("Content-Type", "text/plain; charset=utf-8")
+		header("Content-Transfer-Encoding", "base64")
+		buf.WriteString("\r\n")
+		writeBase64(&buf, []byte(m.Body))
+		return buf.Bytes(), nil
+	}
+
+	mw := multipart.NewWriter(&buf)
+	header("Content-Type", fmt.Sprintf("multipart/mixed; boundary=%q", mw.Boundary()))
+	buf.WriteString("\r\n")
+
+	text, err := mw.CreatePart(textproto.MIMEHeader{
+		"Content-Type":              {"text/plain; charset=utf-8"},
+		"Content-Transfer-Encoding": {"base64"},
+	})
+	if err != nil {
+		return nil, err
+	}
+	writeBase64(text, []byte(m.Body))
+
+	for _, a := range m.Attachments {
+		ctype := a.ContentType
+		if ctype == "" {
+			ctype = "application/octet-stream"
+		}
+		part, err := mw.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {mime.FormatMediaType(ctype, map[string]string{"name": a.Name})},
+			"Content-Disposition":       {mime.FormatMediaType("attachment", map[string]string{"filename": a.Name})},
+			"Content-Transfer-Encoding": {"base64"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		writeBase64(part, a.Data)
+	}
+	if err := mw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// writeBase64 writes the data in base64 with lines of 76 characters
+func writeBase64(w io.Writer, data []byte) {
+	s := base64.StdEncoding.EncodeToString(data)
+	for len(s) > 76 {
+		w.Write([]byte(s[:76] + "\r\n"))
+		s = s[76:]
+	}
+	w.Write([]byte(s + "\r\n"))
+}
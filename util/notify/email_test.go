@@ -0,0 +1,86 @@
+package notify
+
+import (
+	"bytes"
+	"encoding/base64"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net/mail"
+	"net/smtp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jakefau/rpi-devices/util"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSMTP(t *testing.T) {
+	cfg := &util.EmailConfig{
+		SMTP:     "smtp.example.com",
+		SMTPPort: 25,
+		Address:  "pi@example.com",
+		Password: "secret",
+	}
+	s := NewSMTP(cfg, "a@example.com", "b@example.com")
+	var (
+		addr string
+		to   []string
+		raw  []byte
+	)
+	s.send = func(a string, auth smtp.Auth, from string, rcpt []string, msg []byte) error {
+		addr, to, raw = a, rcpt, msg
+		return nil
+	}
+
+	snapshot := []byte("jpeg data")
+	assert.NoError(t, s.Notify(&Message{
+		Title:       "有人来了",
+		Body:        "somebody at the door",
+		Priority:    High,
+		Attachments: []*Attachment{{Name: "door.jpg", ContentType: "image/jpeg", Data: snapshot}},
+	}))
+	assert.Equal(t, "smtp.example.com:25", addr)
+	assert.Equal(t, []string{"a@example.com", "b@example.com"}, to)
+
+	msg, err := mail.ReadMessage(bytes.NewReader(raw))
+	assert.NoError(t, err)
+	rcpts, err := msg.Header.AddressList("To")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(rcpts))
+	assert.Equal(t, "b@example.com", rcpts[1].Address)
+	subject, err := new(mime.WordDecoder).DecodeHeader(msg.Header.Get("Subject"))
+	assert.NoError(t, err)
+	assert.Equal(t, "有人来了", subject)
+	assert.Equal(t, "1", msg.Header.Get("X-Priority"))
+
+	mtype, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	assert.NoError(t, err)
+	assert.Equal(t, "multipart/mixed", mtype)
+	mr := multipart.NewReader(msg.Body, params["boundary"])
+	var parts []string
+	for {
+		p, err := mr.NextPart()
+		if err != nil {
+			break
+		}
+		data, _ := ioutil.ReadAll(p)
+		decoded, err := base64.StdEncoding.DecodeString(string(data))
+		assert.NoError(t, err)
+		parts = append(parts, p.FileName()+":"+string(decoded))
+	}
+	assert.Equal(t, []string{":somebody at the door", "door.jpg:jpeg data"}, parts)
+
+	// plain text
+	body := strings.Repeat("0123456789", 10)
+	raw, err = s.build(&Message{Title: "hi", Body: body}, time.Now())
+	assert.NoError(t, err)
+	msg, err = mail.ReadMessage(bytes.NewReader(raw))
+	assert.NoError(t, err)
+	assert.Equal(t, "text/plain; charset=utf-8", msg.Header.Get("Content-Type"))
+	data, _ := ioutil.ReadAll(base64.NewDecoder(base64.StdEncoding, msg.Body))
+	assert.Equal(t, body, string(data))
+
+	assert.Error(t, NewSMTP(cfg).Notify(&Message{}))
+}
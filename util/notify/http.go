@@ -0,0 +1,238 @@
+package notify
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	telegramAPI = "https://api.telegram.org"
+)
+
+var client = &http.Client{Timeout: 30 * time.Second}
+
+// Webhook posts the messages in json to the url.
+// Format formats the body posted, it's the default json of title, body, priority and key if it's nil,
+// e.g. {"value1": title, "value2": body} for ifttt.
+type Webhook struct {
+	URL    string
+	Header http.Header
+	Format func(m *Message) ([]byte, error)
+}
+
+type webhookMessage struct {
+	Title    string `json:"title"`
+	Body     string `json:"body"`
+	Priority int    `json:"priority"`
+	Key      string `json:"key,omitempty"`
+}
+
+// NewWebhook ...
+func NewWebhook(url string) *Webhook {
+	return &Webhook{
+		URL:    url,
+		Header: http.Header{},
+	}
+}
+
+// Notify ...
+func (w *Webhook) Notify(m *Message) error {
+	format := w.Format
+	if format == nil {
+		format = func(m *Message) ([]byte, error) {
+			return json.Marshal(&webhookMessage{
+				Title:    m.Title,
+				Body:     m.Body,
+				Priority: int(m.Priority),
+				Key:      m.Key,
+			})
+		}
+	}
+	data, err := format(m)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest("POST", w.URL, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range w.Header {
+		req.Header[k] = v
+	}
+	return do(req)
+}
+
+// Ntfy pushes the messages to a topic of a ntfy server, e.g. https://ntfy.sh,
+// the first attachment is uploaded with the message.
+type Ntfy struct {
+	Server string
+	Topic  string
+	Token  string
+}
+
+// NewNtfy ...
+func NewNtfy(server, topic string) *Ntfy {
+	return &Ntfy{
+		Server: server,
+		Topic:  topic,
+	}
+}
+
+// Notify ...
+func (n *Ntfy) Notify(m *Message) error {
+	u := strings.TrimRight(n.Server, "/") + "/" + n.Topic
+	var (
+		req *http.Request
+		err error
+	)
+	if len(m.Attachments) > 0 {
+		a := m.Attachments[0]
+		req, err = http.NewRequest("PUT", u, bytes.NewReader(a.Data))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Filename", a.Name)
+		req.Header.Set("Message", strings.Replace(m.Body, "\n", "\\n", -1))
+	} else {
+		req, err = http.NewRequest("POST", u, strings.NewReader(m.Body))
+		if err != nil {
+			return err
+		}
+	}
+	req.Header.Set("Title", m.Title)
+	// 1~5 of ntfy
+	req.Header.Set("Priority", fmt.Sprintf("%v", int(m.Priority)+2))
+	if n.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+n.Token)
+	}
+	return do(req)
+}
+
+// Gotify pushes the messages to a gotify server by the token of an application
+type Gotify struct {
+	Server string
+	Token  string
+}
+
+type gotifyMessage struct {
+	Title    string `json:"title"`
+	Message  string `json:"message"`
+	Priority int    `json:"priority"`
+}
+
+// NewGotify ...
+func NewGotify(server, token string) *Gotify {
+	return &Gotify{
+		Server: server,
+		Token:  token,
+	}
+}
+
+// Notify ...
+func (g *Gotify) Notify(m *Message) error {
+	// 0~10 of gotify
+	priorities := map[Priority]int{Low: 2, Normal: 5, High: 8, Urgent: 10}
+	data, err := json.Marshal(&gotifyMessage{
+		Title:    m.Title,
+		Message:  m.Body,
+		Priority: priorities[m.Priority],
+	})
+	if err != nil {
+		return err
+	}
+	u := strings.TrimRight(g.Server, "/") + "/message?token=" + url.QueryEscape(g.Token)
+	req, err := http.NewRequest("POST", u, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	return do(req)
+}
+
+// Telegram sends the messages to a chat by a bot, the image attachments are sent as photos
+type Telegram struct {
+	API    string
+	Token  string
+	ChatID string
+}
+
+// NewTelegram ...
+func NewTelegram(token, chatID string) *Telegram {
+	return &Telegram{
+		API:    telegramAPI,
+		Token:  token,
+		ChatID: chatID,
+	}
+}
+
+// Notify ...
+func (t *Telegram) Notify(m *Message) error {
+	text := m.Body
+	if m.Title != "" {
+		text = m.Title + "\n" + m.Body
+	}
+	form := url.Values{
+		"chat_id":              {t.ChatID},
+		"text":                 {text},
+		"disable_notification": {fmt.Sprintf("%v", m.Priority == Low)},
+	}
+	if err := t.post("sendMessage", "application/x-www-form-urlencoded", strings.NewReader(form.Encode())); err != nil {
+		return err
+	}
+
+	for _, a := range m.Attachments {
+		method, field := "sendDocument", "document"
+		if strings.HasPrefix(a.ContentType, "image/") {
+			method, field = "sendPhoto", "photo"
+		}
+		var buf bytes.Buffer
+		mw := multipart.NewWriter(&buf)
+		mw.WriteField("chat_id", t.ChatID)
+		mw.WriteField("caption", m.Title)
+		fw, err := mw.CreateFormFile(field, a.Name)
+		if err != nil {
+			return err
+		}
+		fw.Write(a.Data)
+		if err := mw.Close(); err != nil {
+			return err
+		}
+		if err := t.post(method, mw.FormDataContentType(), &buf); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (t *Telegram) post(method, ctype string, body io.Reader) error {
+	u := fmt.Sprintf("%v/bot%v/%v", strings.TrimRight(t.API, "/"), t.Token, method)
+	req, err := http.NewRequest("POST", u, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", ctype)
+	return do(req)
+}
+
+// do sends the request, and returns an error if the status isn't 2xx
+func do(req *http.Request) error {
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%v, %v", resp.Status, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
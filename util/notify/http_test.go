@@ -0,0 +1,133 @@
+package notify
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type request struct {
+	method string
+	path   string
+	query  string
+	header http.Header
+	body   string
+	form   map[string][]string
+	files  map[string]string
+}
+
+func newServer(status int, reqs *[]*request) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		req := &request{
+			method: r.Method,
+			path:   r.URL.Path,
+			query:  r.URL.RawQuery,
+			header: r.Header,
+		}
+		if err := r.ParseMultipartForm(1 << 20); err == nil {
+			req.form = r.MultipartForm.Value
+			req.files = map[string]string{}
+			for k, fs := range r.MultipartForm.File {
+				f, _ := fs[0].Open()
+				data, _ := ioutil.ReadAll(f)
+				req.files[k] = fs[0].Filename + ":" + string(data)
+			}
+		} else if r.Header.Get("Content-Type") == "application/x-www-form-urlencoded" {
+			r.ParseForm()
+			req.form = r.PostForm
+		} else {
+			data, _ := ioutil.ReadAll(r.Body)
+			req.body = string(data)
+		}
+		*reqs = append(*reqs, req)
+		w.WriteHeader(status)
+		w.Write([]byte("done"))
+	}))
+}
+
+func TestWebhook(t *testing.T) {
+	var reqs []*request
+	svr := newServer(http.StatusOK, &reqs)
+	defer svr.Close()
+
+	w := NewWebhook(svr.URL + "/hook")
+	w.Header.Set("X-Token", "abc")
+	assert.NoError(t, w.Notify(&Message{Title: "t", Body: "b", Priority: High}))
+	assert.Equal(t, "/hook", reqs[0].path)
+	assert.Equal(t, "abc", reqs[0].header.Get("X-Token"))
+	assert.JSONEq(t, `{"title": "t", "body": "b", "priority": 2}`, reqs[0].body)
+
+	// ifttt
+	w.Format = func(m *Message) ([]byte, error) {
+		return json.Marshal(map[string]string{"value1": m.Title})
+	}
+	assert.NoError(t, w.Notify(&Message{Title: "t"}))
+	assert.JSONEq(t, `{"value1": "t"}`, reqs[1].body)
+
+	bad := newServer(http.StatusBadRequest, &reqs)
+	defer bad.Close()
+	err := NewWebhook(bad.URL).Notify(&Message{})
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "done")
+}
+
+func TestPush(t *testing.T) {
+	var reqs []*request
+	svr := newServer(http.StatusOK, &reqs)
+	defer svr.Close()
+
+	ntfy := NewNtfy(svr.URL+"/", "door")
+	ntfy.Token = "tk"
+	assert.NoError(t, ntfy.Notify(&Message{Title: "t", Body: "b", Priority: Urgent}))
+	assert.Equal(t, "POST", reqs[0].method)
+	assert.Equal(t, "/door", reqs[0].path)
+	assert.Equal(t, "t", reqs[0].header.Get("Title"))
+	assert.Equal(t, "5", reqs[0].header.Get("Priority"))
+	assert.Equal(t, "Bearer tk", reqs[0].header.Get("Authorization"))
+	assert.Equal(t, "b", reqs[0].body)
+
+	assert.NoError(t, ntfy.Notify(&Message{Title: "t", Body: "b", Attachments: []*Attachment{{Name: "a.jpg", Data: []byte("img")}}}))
+	assert.Equal(t, "PUT", reqs[1].method)
+	assert.Equal(t, "a.jpg", reqs[1].header.Get("Filename"))
+	assert.Equal(t, "b", reqs[1].header.Get("Message"))
+	assert.Equal(t, "img", reqs[1].body)
+
+	gotify := NewGotify(svr.URL, "app token")
+	assert.NoError(t, gotify.Notify(&Message{Title: "t", Body: "b", Priority: High}))
+	assert.Equal(t, "/message", reqs[2].path)
+	assert.Equal(t, "token=app+token", reqs[2].query)
+	assert.JSONEq(t, `{"title": "t", "message": "b", "priority": 8}`, reqs[2].body)
+}
+
+func TestTelegram(t *testing.T) {
+	var reqs []*request
+	svr := newServer(http.StatusOK, &reqs)
+	defer svr.Close()
+
+	tg := NewTelegram("123:abc", "42")
+	tg.API = svr.URL
+	assert.NoError(t, tg.Notify(&Message{
+		Title:    "t",
+		Body:     "b",
+		Priority: Low,
+		Attachments: []*Attachment{
+			{Name: "a.jpg", ContentType: "image/jpeg", Data: []byte("img")},
+			{Name: "a.avi", ContentType: "video/x-msvideo", Data: []byte("clip")},
+		},
+	}))
+	assert.Equal(t, 3, len(reqs))
+	assert.Equal(t, "/bot123:abc/sendMessage", reqs[0].path)
+	assert.Equal(t, []string{"42"}, reqs[0].form["chat_id"])
+	assert.Equal(t, []string{"t\nb"}, reqs[0].form["text"])
+	assert.Equal(t, []string{"true"}, reqs[0].form["disable_notification"])
+
+	assert.Equal(t, "/bot123:abc/sendPhoto", reqs[1].path)
+	assert.Equal(t, []string{"t"}, reqs[1].form["caption"])
+	assert.Equal(t, "a.jpg:img", reqs[1].files["photo"])
+	assert.Equal(t, "/bot123:abc/sendDocument", reqs[2].path)
+	assert.Equal(t, "a.avi:clip", reqs[2].files["document"])
+}
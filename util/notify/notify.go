@@ -0,0 +1,207 @@
+/*
+Package notify sends the notifications by email, webhook, push services like ntfy and gotify, and telegram bots.
+
+All of the backends implement Notifier, the messages can be rendered from templates,
+and a Limiter limits the rate of a notifier and drops the duplicated messages.
+*/
+package notify
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+)
+
+// Priority is the priority of a message
+type Priority int
+
+const (
+	// Low is for the messages nobody needs to read soon
+	Low Priority = iota
+	// Normal ...
+	Normal
+	// High is for the warnings
+	High
+	// Urgent is for the alerts, it isn't limited by the rate of a limiter
+	Urgent
+)
+
+var (
+	// ErrLimited means the message was dropped for the rate limit
+	ErrLimited = errors.New("rate limited")
+	// ErrDuplicated means the message was dropped since the same one was sent just now
+	ErrDuplicated = errors.New("duplicated")
+)
+
+// Attachment is a file attached to a message, e.g. a snapshot of the camera
+type Attachment struct {
+	Name        string
+	ContentType string
+	Data        []byte
+}
+
+// Message is a notification.
+// Key identifies the duplicated messages, the messages with the same title and body are duplicated if it's empty.
+type Message struct {
+	Title       string
+	Body        string
+	Priority    Priority
+	Key         string
+	Attachments []*Attachment
+}
+
+// Notifier sends the messages
+type Notifier interface {
+	Notify(m *Message) error
+}
+
+// Multi sends the messages by all of the notifiers
+type Multi []Notifier
+
+// NewMulti ...
+func NewMulti(notifiers ...Notifier) Multi {
+	return Multi(notifiers)
+}
+
+// Notify sends the message by all of the notifiers, it returns the errors of all the failed ones
+func (ms Multi) Notify(m *Message) error {
+	var errs []string
+	for _, n := range ms {
+		if err := n.Notify(m); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("failed to notify, error: %v", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// Template renders the messages from the text templates of the title and the body
+type Template struct {
+	Priority Priority
+	title    *template.Template
+	body     *template.Template
+}
+
+// NewTemplate parses the templates of the title and the body, e.g. "High Temperature: {{.Temp}} C"
+func NewTemplate(title, body string, p Priority) (*Template, error) {
+	t, err := template.New("title").Parse(title)
+	if err != nil {
+		return nil, err
+	}
+	b, err := template.New("body").Parse(body)
+	if err != nil {
+		return nil, err
+	}
+	return &Template{
+		Priority: p,
+		title:    t,
+		body:     b,
+	}, nil
+}
+
+// Render renders a message with the data
+func (t *Template) Render(data interface{}) (*Message, error) {
+	var title, body bytes.Buffer
+	if err := t.title.Execute(&title, data); err != nil {
+		return nil, err
+	}
+	if err := t.body.Execute(&body, data); err != nil {
+		return nil, err
+	}
+	return &Message{
+		Title:    title.String(),
+		Body:     body.String(),
+		Priority: t.Priority,
+	}, nil
+}
+
+// Limiter sends max messages in a period at most, and drops the same message in the dedup window
+type Limiter struct {
+	n      Notifier
+	max    int
+	period time.Duration
+	dedup  time.Duration
+	now    func() time.Time
+
+	mu   sync.Mutex
+	sent []time.Time
+	seen map[string]time.Time
+}
+
+// NewLimiter limits the rate of the notifier
+func NewLimiter(n Notifier, max int, period, dedup time.Duration) *Limiter {
+	return &Limiter{
+		n:      n,
+		max:    max,
+		period: period,
+		dedup:  dedup,
+		now:    time.Now,
+		seen:   map[string]time.Time{},
+	}
+}
+
+// Notify sends the message if it isn't limited or duplicated, the urgent messages are never limited.
+// a message failed to send doesn't count, so it can be retried at once.
+func (l *Limiter) Notify(m *Message) error {
+	key, now, err := l.allow(m)
+	if err != nil {
+		return err
+	}
+	if err := l.n.Notify(m); err != nil {
+		l.release(key, now)
+		return err
+	}
+	return nil
+}
+
+// allow reserves the quota and the key of the message, they're released if it fails to send
+func (l *Limiter) allow(m *Message) (string, time.Time, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	for k, t := range l.seen {
+		if now.Sub(t) >= l.dedup {
+			delete(l.seen, k)
+		}
+	}
+	key := m.Key
+	if key == "" {
+		key = m.Title + "\x00" + m.Body
+	}
+	if _, ok := l.seen[key]; ok {
+		return "", now, ErrDuplicated
+	}
+
+	for len(l.sent) > 0 && now.Sub(l.sent[0]) >= l.period {
+		l.sent = l.sent[1:]
+	}
+	if m.Priority < Urgent && len(l.sent) >= l.max {
+		return "", now, ErrLimited
+	}
+	l.sent = append(l.sent, now)
+	l.seen[key] = now
+	return key, now, nil
+}
+
+// release gives back the quota and the key reserved at t
+func (l *Limiter) release(key string, t time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for i := len(l.sent) - 1; i >= 0; i-- {
+		if l.sent[i].Equal(t) {
+			l.sent = append(l.sent[:i:i], l.sent[i+1:]...)
+			break
+		}
+	}
+	if seen, ok := l.seen[key]; ok && seen.Equal(t) {
+		delete(l.seen, key)
+	}
+}
@@ -0,0 +1,91 @@
+package notify
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type recorder struct {
+	messages []*Message
+	err      error
+}
+
+func (r *recorder) Notify(m *Message) error {
+	r.messages = append(r.messages, m)
+	return r.err
+}
+
+func TestMulti(t *testing.T) {
+	r1, r2 := &recorder{}, &recorder{err: errors.New("down")}
+	m := &Message{Title: "hi"}
+	err := NewMulti(r1, r2).Notify(m)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "down")
+	assert.Equal(t, []*Message{m}, r1.messages)
+	assert.Equal(t, []*Message{m}, r2.messages)
+
+	assert.NoError(t, NewMulti(r1).Notify(m))
+}
+
+func TestTemplate(t *testing.T) {
+	tmpl, err := NewTemplate("{{.Name}} Warning", "temperature: {{printf \"%.1f\" .Temp}} C", High)
+	assert.NoError(t, err)
+	m, err := tmpl.Render(map[string]interface{}{"Name": "High Temperature", "Temp": 31.25})
+	assert.NoError(t, err)
+	assert.Equal(t, &Message{Title: "High Temperature Warning", Body: "temperature: 31.2 C", Priority: High}, m)
+
+	_, err = NewTemplate("{{.Name", "", Normal)
+	assert.Error(t, err)
+}
+
+func TestLimiter(t *testing.T) {
+	r := &recorder{}
+	l := NewLimiter(r, 2, time.Minute, 10*time.Second)
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	l.now = func() time.Time { return now }
+
+	testCases := []struct {
+		desc  string
+		after time.Duration
+		msg   *Message
+		err   error
+	}{
+		{"first", 0, &Message{Title: "a"}, nil},
+		{"duplicated", time.Second, &Message{Title: "a"}, ErrDuplicated},
+		{"another", time.Second, &Message{Title: "b"}, nil},
+		{"limited", time.Second, &Message{Title: "c"}, ErrLimited},
+		{"urgent", time.Second, &Message{Title: "d", Key: "door", Priority: Urgent}, nil},
+		{"the same key", time.Second, &Message{Title: "e", Key: "door", Priority: Urgent}, ErrDuplicated},
+		{"not duplicated any more but limited", 10 * time.Second, &Message{Title: "a"}, ErrLimited},
+		{"in the next period", time.Minute, &Message{Title: "a"}, nil},
+	}
+	sent := 0
+	for _, test := range testCases {
+		now = now.Add(test.after)
+		assert.Equal(t, test.err, l.Notify(test.msg), test.desc)
+		if test.err == nil {
+			sent++
+		}
+		assert.Equal(t, sent, len(r.messages), test.desc)
+	}
+}
+
+func TestLimiterFailed(t *testing.T) {
+	r := &recorder{err: errors.New("down")}
+	l := NewLimiter(r, 1, time.Minute, 10*time.Second)
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	l.now = func() time.Time { return now }
+
+	m := &Message{Title: "a"}
+	assert.EqualError(t, l.Notify(m), "down")
+	assert.EqualError(t, l.Notify(m), "down", "retry the failed one")
+
+	r.err = nil
+	assert.NoError(t, l.Notify(m), "the failed ones don't use up the quota")
+	assert.Equal(t, ErrDuplicated, l.Notify(m))
+	assert.Equal(t, ErrLimited, l.Notify(&Message{Title: "b"}))
+	assert.Len(t, r.messages, 3)
+}
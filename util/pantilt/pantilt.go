@@ -0,0 +1,466 @@
+/*
+Package pantilt controls a two-degree-of-freedom pan-tilt of two servos.
+
+It moves the camera to the absolute angles smoothly in small steps within the soft limits,
+keeps the named presets on disk, patrols the presets in turn and resumes the patrol after restarting,
+and centres a region of the frame (e.g. the motion or a face) in auto-track mode.
+*/
+package pantilt
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"io/ioutil"
+	"log"
+	"math"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrNoPreset means the preset doesn't exist
+	ErrNoPreset = errors.New("no such preset")
+)
+
+// Servo is the servo rolling to an angle, e.g. dev.SG90
+type Servo interface {
+	Roll(angle int)
+}
+
+// Position is the angles of the pan and the tilt, pan > 0 is right, and tilt > 0 is up
+type Position struct {
+	Pan  int `json:"pan"`
+	Tilt int `json:"tilt"`
+}
+
+// Config is the config of a pan-tilt.
+// the angles are limited in [PanMin, PanMax] and [TiltMin, TiltMax], and the servos roll Step degrees at most at a time.
+// HFOV and VFOV are the horizontal and vertical field of view of the camera in degrees,
+// the region to track is ignored if its center is in the Deadband (in ratio of the frame) around the center,
+// and a track move is followed by a TrackInterval at least, since the move of the camera looks like motion too.
+type Config struct {
+	PanMin        int
+	PanMax        int
+	TiltMin       int
+	TiltMax       int
+	Step          int
+	HFOV          float64
+	VFOV          float64
+	Deadband      float64
+	TrackInterval time.Duration
+}
+
+// DefaultConfig returns the config of the pi camera v2 on a sg90 pan-tilt
+func DefaultConfig() *Config {
+	return &Config{
+		PanMin:        -90,
+		PanMax:        90,
+		TiltMin:       -90,
+		TiltMax:       90,
+		Step:          5,
+		HFOV:          62.2,
+		VFOV:          48.8,
+		Deadband:      0.1,
+		TrackInterval: 2 * time.Second,
+	}
+}
+
+// Status is the status of a pan-tilt
+type Status struct {
+	Position   Position            `json:"position"`
+	Presets    map[string]Position `json:"presets"`
+	Patrolling []string            `json:"patrolling"`
+	Tracking   bool                `json:"tracking"`
+}
+
+// patrol is the patrol going on, it's saved to resume it after restarting
+type patrol struct {
+	Route []string      `json:"route"`
+	Dwell time.Duration `json:"dwell"`
+}
+
+// PanTilt ...
+type PanTilt struct {
+	pan  Servo
+	tilt Servo
+	cfg  *Config
+
+	// rolling serializes the rolls of the servos
+	rolling sync.Mutex
+
+	mu        sync.Mutex
+	pos       Position
+	seq       int
+	presets   map[string]Position
+	file      string
+	route     []string
+	dwell     time.Duration
+	quit      chan bool
+	tracking  bool
+	lastTrack time.Time
+
+	// the patrol is saved in patrolFile
+	patrolFile string
+}
+
+// New ...
+func New(pan, tilt Servo, cfg *Config) *PanTilt {
+	return &PanTilt{
+		pan:     pan,
+		tilt:    tilt,
+		cfg:     cfg,
+		presets: map[string]Position{},
+	}
+}
+
+// LoadPresets loads the presets from the json file, and the presets saved later are written to it.
+// it's fine if the file doesn't exist.
+func (p *PanTilt) LoadPresets(file string) error {
+	presets := map[string]Position{}
+	data, err := ioutil.ReadFile(file)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err == nil {
+		if err := json.Unmarshal(data, &presets); err != nil {
+			return fmt.Errorf("failed to load presets from %v, error: %v", file, err)
+		}
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.file = file
+	p.presets = presets
+	return nil
+}
+
+// LoadPatrol resumes the patrol saved in the json file, and the patrols started or stopped later are saved to it,
+// so the patrol goes on after restarting. it's fine if the file doesn't exist.
+func (p *PanTilt) LoadPatrol(file string) error {
+	var pt patrol
+	data, err := ioutil.ReadFile(file)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err == nil {
+		if err := json.Unmarshal(data, &pt); err != nil {
+			return fmt.Errorf("failed to load patrol from %v, error: %v", file, err)
+		}
+	}
+
+	p.mu.Lock()
+	p.patrolFile = file
+	p.mu.Unlock()
+	if len(pt.Route) == 0 {
+		return nil
+	}
+	return p.Patrol(pt.Route, pt.Dwell)
+}
+
+// Reset rolls the servos to the home position directly
+func (p *PanTilt) Reset() {
+	p.mu.Lock()
+	p.seq++
+	p.pos = p.limit(Position{})
+	pos := p.pos
+	p.mu.Unlock()
+
+	p.rolling.Lock()
+	defer p.rolling.Unlock()
+	p.pan.Roll(pos.Pan)
+	p.tilt.Roll(pos.Tilt)
+}
+
+// Position returns the current position
+func (p *PanTilt) Position() Position {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.pos
+}
+
+// MoveTo stops patrolling, and moves to the position smoothly, it returns the position reached.
+// a move is interrupted by the later one.
+func (p *PanTilt) MoveTo(pos Position) Position {
+	p.StopPatrol()
+	return p.moveTo(pos)
+}
+
+// Move moves by the angles relative to the current position
+func (p *PanTilt) Move(pan, tilt int) Position {
+	cur := p.Position()
+	return p.MoveTo(Position{Pan: cur.Pan + pan, Tilt: cur.Tilt + tilt})
+}
+
+// SavePreset saves the current position as the named preset
+func (p *PanTilt) SavePreset(name string) error {
+	if name == "" {
+		return errors.New("empty name")
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.presets[name] = p.pos
+	return p.savePresets()
+}
+
+// DeletePreset ...
+func (p *PanTilt) DeletePreset(name string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if _, ok := p.presets[name]; !ok {
+		return ErrNoPreset
+	}
+	delete(p.presets, name)
+	return p.savePresets()
+}
+
+// GotoPreset moves to the named preset
+func (p *PanTilt) GotoPreset(name string) (Position, error) {
+	pos, ok := p.preset(name)
+	if !ok {
+		return p.Position(), ErrNoPreset
+	}
+	return p.MoveTo(pos), nil
+}
+
+// Presets returns the names of the presets in order
+func (p *PanTilt) Presets() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var names []string
+	for name := range p.presets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Patrol moves to the presets of the route in turn, and dwells for a while at each of them,
+// until it's stopped by StopPatrol or any move.
+func (p *PanTilt) Patrol(route []string, dwell time.Duration) error {
+	if len(route) == 0 {
+		return errors.New("empty route")
+	}
+	if dwell <= 0 {
+		return fmt.Errorf("invalid dwell: %v", dwell)
+	}
+	for _, name := range route {
+		if _, ok := p.preset(name); !ok {
+			return fmt.Errorf("%v: %v", ErrNoPreset, name)
+		}
+	}
+
+	p.StopPatrol()
+	quit := make(chan bool)
+	p.mu.Lock()
+	p.route = route
+	p.dwell = dwell
+	p.quit = quit
+	if err := p.savePatrol(); err != nil {
+		log.Printf("[pantilt]failed to save patrol, error: %v", err)
+	}
+	p.mu.Unlock()
+
+	go func() {
+		for i := 0; ; i = (i + 1) % len(route) {
+			if pos, ok := p.preset(route[i]); ok {
+				p.moveTo(pos)
+			}
+			select {
+			case <-quit:
+				return
+			case <-time.After(dwell):
+				// next
+			}
+		}
+	}()
+	log.Printf("[pantilt]patrol %v", route)
+	return nil
+}
+
+// StopPatrol ...
+func (p *PanTilt) StopPatrol() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.quit == nil {
+		return
+	}
+	close(p.quit)
+	p.quit = nil
+	p.route = nil
+	p.dwell = 0
+	// interrupt the move of the patrol
+	p.seq++
+	if err := p.savePatrol(); err != nil {
+		log.Printf("[pantilt]failed to save patrol, error: %v", err)
+	}
+}
+
+// SetTracking turns on or off the auto-track mode
+func (p *PanTilt) SetTracking(on bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.tracking = on
+}
+
+// Track moves the camera to centre the region of the frame in auto-track mode,
+// it returns false if it doesn't move, e.g. the mode is off, it's patrolling,
+// the region is in the deadband, or it moved in the last TrackInterval.
+func (p *PanTilt) Track(region image.Rectangle, frame image.Point, now time.Time) bool {
+	if frame.X <= 0 || frame.Y <= 0 || region.Empty() {
+		return false
+	}
+	p.mu.Lock()
+	if !p.tracking || p.quit != nil || now.Sub(p.lastTrack) < p.cfg.TrackInterval {
+		p.mu.Unlock()
+		return false
+	}
+	// the offset of the center in [-0.5, 0.5]
+	dx := float64(region.Min.X+region.Max.X)/2/float64(frame.X) - 0.5
+	dy := float64(region.Min.Y+region.Max.Y)/2/float64(frame.Y) - 0.5
+	if math.Abs(dx) < p.cfg.Deadband/2 && math.Abs(dy) < p.cfg.Deadband/2 {
+		p.mu.Unlock()
+		return false
+	}
+	// the y of the frame is downward, and the tilt is upward
+	pos := Position{
+		Pan:  p.pos.Pan + int(dx*p.cfg.HFOV),
+		Tilt: p.pos.Tilt - int(dy*p.cfg.VFOV),
+	}
+	if p.limit(pos) == p.pos {
+		p.mu.Unlock()
+		return false
+	}
+	p.lastTrack = now
+	p.mu.Unlock()
+
+	p.moveTo(pos)
+	return true
+}
+
+// Status ...
+func (p *PanTilt) Status() *Status {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	presets := map[string]Position{}
+	for name, pos := range p.presets {
+		presets[name] = pos
+	}
+	return &Status{
+		Position:   p.pos,
+		Presets:    presets,
+		Patrolling: p.route,
+		Tracking:   p.tracking,
+	}
+}
+
+// moveTo moves to the position step by step, the pan and the tilt arrive at the same time
+func (p *PanTilt) moveTo(pos Position) Position {
+	p.mu.Lock()
+	p.seq++
+	seq := p.seq
+	from := p.pos
+	to := p.limit(pos)
+	p.mu.Unlock()
+
+	steps := 1
+	if p.cfg.Step > 0 {
+		steps = (max(abs(to.Pan-from.Pan), abs(to.Tilt-from.Tilt)) + p.cfg.Step - 1) / p.cfg.Step
+	}
+	p.rolling.Lock()
+	defer p.rolling.Unlock()
+	for i := 1; i <= steps; i++ {
+		next := Position{
+			Pan:  from.Pan + (to.Pan-from.Pan)*i/steps,
+			Tilt: from.Tilt + (to.Tilt-from.Tilt)*i/steps,
+		}
+		p.mu.Lock()
+		if p.seq != seq {
+			// interrupted
+			pos := p.pos
+			p.mu.Unlock()
+			return pos
+		}
+		cur := p.pos
+		p.pos = next
+		p.mu.Unlock()
+
+		if next.Pan != cur.Pan {
+			p.pan.Roll(next.Pan)
+		}
+		if next.Tilt != cur.Tilt {
+			p.tilt.Roll(next.Tilt)
+		}
+	}
+	return p.Position()
+}
+
+func (p *PanTilt) preset(name string) (Position, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	pos, ok := p.presets[name]
+	return pos, ok
+}
+
+// limit limits the position in the soft limits
+func (p *PanTilt) limit(pos Position) Position {
+	return Position{
+		Pan:  clamp(pos.Pan, p.cfg.PanMin, p.cfg.PanMax),
+		Tilt: clamp(pos.Tilt, p.cfg.TiltMin, p.cfg.TiltMax),
+	}
+}
+
+func (p *PanTilt) savePresets() error {
+	if p.file == "" {
+		return nil
+	}
+	return writeJSON(p.file, p.presets)
+}
+
+// savePatrol saves the patrol going on, the route is empty if it isn't patrolling
+func (p *PanTilt) savePatrol() error {
+	if p.patrolFile == "" {
+		return nil
+	}
+	return writeJSON(p.patrolFile, &patrol{Route: p.route, Dwell: p.dwell})
+}
+
+// writeJSON writes v to the file in json by renaming a temp file, so the file is never half written
+func writeJSON(file string, v interface{}) error {
+	data, err := json.MarshalIndent(v, "", "    ")
+	if err != nil {
+		return err
+	}
+	tmp := file + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, file)
+}
+
+func clamp(v, min, max int) int {
+	if v < min {
+		return min
+	}
+	if v > max {
+		return max
+	}
+	return v
+}
+
+func abs(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
+
+func max(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,243 @@
+package pantilt
+
+import (
+	"image"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type servo struct {
+	mu     sync.Mutex
+	angles []int
+}
+
+func (s *servo) Roll(angle int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.angles = append(s.angles, angle)
+}
+
+func (s *servo) rolled() []int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]int(nil), s.angles...)
+}
+
+func newPanTilt() (*PanTilt, *servo, *servo) {
+	pan, tilt := &servo{}, &servo{}
+	cfg := DefaultConfig()
+	cfg.PanMin, cfg.PanMax = -90, 75
+	cfg.TiltMin, cfg.TiltMax = -30, 90
+	cfg.Step = 10
+	return New(pan, tilt, cfg), pan, tilt
+}
+
+func TestMoveTo(t *testing.T) {
+	testCases := []struct {
+		desc  string
+		to    Position
+		want  Position
+		pans  []int
+		tilts []int
+	}{
+		{
+			desc:  "in steps",
+			to:    Position{Pan: 30, Tilt: 15},
+			want:  Position{Pan: 30, Tilt: 15},
+			pans:  []int{10, 20, 30},
+			tilts: []int{5, 10, 15},
+		},
+		{
+			desc:  "limited",
+			to:    Position{Pan: 90, Tilt: -90},
+			want:  Position{Pan: 75, Tilt: -30},
+			pans:  []int{9, 18, 28, 37, 46, 56, 65, 75},
+			tilts: []int{-3, -7, -11, -15, -18, -22, -26, -30},
+		},
+		{
+			desc:  "pan only",
+			to:    Position{Pan: -15},
+			want:  Position{Pan: -15},
+			pans:  []int{-7, -15},
+			tilts: nil,
+		},
+	}
+	for _, test := range testCases {
+		p, pan, tilt := newPanTilt()
+		assert.Equal(t, test.want, p.MoveTo(test.to), test.desc)
+		assert.Equal(t, test.want, p.Position(), test.desc)
+		assert.Equal(t, test.pans, pan.rolled(), test.desc)
+		assert.Equal(t, test.tilts, tilt.rolled(), test.desc)
+	}
+
+	p, _, _ := newPanTilt()
+	p.Move(20, 0)
+	assert.Equal(t, Position{Pan: 35, Tilt: 10}, p.Move(15, 10))
+}
+
+func TestPresets(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pantilt")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "presets.json")
+
+	p, _, _ := newPanTilt()
+	assert.NoError(t, p.LoadPresets(file))
+	assert.Error(t, p.SavePreset(""))
+	p.MoveTo(Position{Pan: 30, Tilt: 20})
+	assert.NoError(t, p.SavePreset("door"))
+	p.MoveTo(Position{Pan: -45})
+	assert.NoError(t, p.SavePreset("bed"))
+	assert.NoError(t, p.SavePreset("window"))
+	assert.NoError(t, p.DeletePreset("window"))
+	assert.Equal(t, ErrNoPreset, p.DeletePreset("window"))
+
+	// loaded from the file
+	p2, _, _ := newPanTilt()
+	assert.NoError(t, p2.LoadPresets(file))
+	assert.Equal(t, []string{"bed", "door"}, p2.Presets())
+	pos, err := p2.GotoPreset("door")
+	assert.NoError(t, err)
+	assert.Equal(t, Position{Pan: 30, Tilt: 20}, pos)
+	_, err = p2.GotoPreset("window")
+	assert.Equal(t, ErrNoPreset, err)
+
+	assert.NoError(t, ioutil.WriteFile(file, []byte("{"), 0644))
+	assert.Error(t, p2.LoadPresets(file))
+}
+
+func TestPatrol(t *testing.T) {
+	p, pan, _ := newPanTilt()
+	p.MoveTo(Position{Pan: 20})
+	assert.NoError(t, p.SavePreset("a"))
+	p.MoveTo(Position{Pan: -20})
+	assert.NoError(t, p.SavePreset("b"))
+
+	assert.Error(t, p.Patrol(nil, time.Millisecond))
+	assert.Error(t, p.Patrol([]string{"a"}, 0))
+	assert.Error(t, p.Patrol([]string{"a", "c"}, time.Millisecond))
+	assert.NoError(t, p.Patrol([]string{"a", "b"}, 10*time.Millisecond))
+	assert.Equal(t, []string{"a", "b"}, p.Status().Patrolling)
+	time.Sleep(50 * time.Millisecond)
+
+	// a move stops patrolling
+	p.MoveTo(Position{})
+	assert.Nil(t, p.Status().Patrolling)
+	n := len(pan.rolled())
+	time.Sleep(30 * time.Millisecond)
+	assert.Equal(t, n, len(pan.rolled()))
+	assert.Equal(t, Position{}, p.Position())
+
+	rolled := pan.rolled()
+	assert.Contains(t, rolled, 20)
+	assert.Contains(t, rolled, -20)
+}
+
+func TestResumePatrol(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pantilt")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	presets := filepath.Join(dir, "presets.json")
+	patrol := filepath.Join(dir, "patrol.json")
+
+	p, _, _ := newPanTilt()
+	assert.NoError(t, p.LoadPresets(presets))
+	assert.NoError(t, p.LoadPatrol(patrol))
+	assert.Nil(t, p.Status().Patrolling)
+	p.MoveTo(Position{Pan: 20})
+	assert.NoError(t, p.SavePreset("a"))
+	p.MoveTo(Position{Pan: -20})
+	assert.NoError(t, p.SavePreset("b"))
+	assert.NoError(t, p.Patrol([]string{"a", "b"}, 10*time.Millisecond))
+	p.StopPatrol()
+	assert.NoError(t, p.Patrol([]string{"b", "a"}, 10*time.Millisecond))
+
+	// resumed after restarting
+	p2, pan, _ := newPanTilt()
+	assert.NoError(t, p2.LoadPresets(presets))
+	assert.NoError(t, p2.LoadPatrol(patrol))
+	assert.Equal(t, []string{"b", "a"}, p2.Status().Patrolling)
+	time.Sleep(50 * time.Millisecond)
+	assert.Contains(t, pan.rolled(), 20)
+	p.StopPatrol()
+	p2.StopPatrol()
+
+	// not resumed after stopping
+	p3, _, _ := newPanTilt()
+	assert.NoError(t, p3.LoadPresets(presets))
+	assert.NoError(t, p3.LoadPatrol(patrol))
+	assert.Nil(t, p3.Status().Patrolling)
+
+	assert.NoError(t, ioutil.WriteFile(patrol, []byte("{"), 0644))
+	assert.Error(t, p3.LoadPatrol(patrol))
+}
+
+func TestTrack(t *testing.T) {
+	frame := image.Point{X: 640, Y: 480}
+	now := time.Now()
+	testCases := []struct {
+		desc     string
+		tracking bool
+		region   image.Rectangle
+		moved    bool
+		pos      Position
+	}{
+		{
+			desc:     "off",
+			tracking: false,
+			region:   image.Rect(600, 0, 640, 40),
+			moved:    false,
+			pos:      Position{},
+		},
+		{
+			desc:     "in the deadband",
+			tracking: true,
+			region:   image.Rect(300, 220, 360, 280),
+			moved:    false,
+			pos:      Position{},
+		},
+		{
+			desc:     "right and up",
+			tracking: true,
+			region:   image.Rect(600, 0, 640, 40),
+			moved:    true,
+			// 0.47*62.2, 0.46*48.8
+			pos: Position{Pan: 29, Tilt: 22},
+		},
+		{
+			desc:     "left and down",
+			tracking: true,
+			region:   image.Rect(0, 400, 160, 480),
+			moved:    true,
+			pos:      Position{Pan: -23, Tilt: -20},
+		},
+		{
+			desc:     "empty",
+			tracking: true,
+			region:   image.Rectangle{},
+			moved:    false,
+			pos:      Position{},
+		},
+	}
+	for _, test := range testCases {
+		p, _, _ := newPanTilt()
+		p.SetTracking(test.tracking)
+		assert.Equal(t, test.moved, p.Track(test.region, frame, now), test.desc)
+		assert.Equal(t, test.pos, p.Position(), test.desc)
+	}
+
+	// not again in the track interval
+	p, _, _ := newPanTilt()
+	p.SetTracking(true)
+	region := image.Rect(600, 0, 640, 40)
+	assert.True(t, p.Track(region, frame, now))
+	assert.False(t, p.Track(region, frame, now.Add(time.Second)))
+	assert.True(t, p.Track(region, frame, now.Add(3*time.Second)))
+	assert.Equal(t, Position{Pan: 58, Tilt: 44}, p.Position())
+}
@@ -0,0 +1,275 @@
+/*
+Package presence detects the presence of a person by fusing the readings of several sensors.
+
+The distance of an ultrasonic distance meter (e.g. dev.HCSR04) is filtered by the median of the latest samples,
+it contributes when it's near, or when the distance keeps decreasing (somebody is approaching).
+The digital sensors like dev.Infrared, dev.VoiceDetector, dev.SW420 or dev.ShockSensor contribute for a while after they're triggered.
+The weights of the contributions are summed up to a confidence in [0, 1],
+and the detector enters a visit when the confidence keeps above Enter for EnterAfter,
+and leaves it when the confidence keeps below Leave for LeaveAfter.
+So there is exactly one Enter and one Leave event for a visit, no matter how long the person stands there.
+*/
+package presence
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Kind is the kind of an event
+type Kind string
+
+const (
+	// Enter means a person comes
+	Enter Kind = "enter"
+	// Leave means the person has gone
+	Leave Kind = "leave"
+)
+
+// Ranger measures the distance in cm, e.g. dev.HCSR04
+type Ranger interface {
+	Dist() float64
+}
+
+// Sensor reports whether something is detected, e.g. dev.Infrared and dev.VoiceDetector
+type Sensor interface {
+	Detected() bool
+}
+
+// SensorFunc adapts a func to a Sensor, e.g. SensorFunc(sw420.Shaked)
+type SensorFunc func() bool
+
+// Detected ...
+func (f SensorFunc) Detected() bool {
+	return f()
+}
+
+// Input is a digital sensor, it contributes Weight to the confidence in Hold after it's triggered
+type Input struct {
+	Name   string
+	Sensor Sensor
+	Weight float64
+	Hold   time.Duration
+}
+
+// Config is the config of a detector.
+// the distances out of [Min, Max] are invalid, the ones below Min are dropped as glitches,
+// and the ones beyond Max are taken as Max (nothing in range).
+// the median of the latest Samples distances contributes NearWeight if it's less than Near,
+// and ApproachWeight if it's decreased by Approach in the samples.
+type Config struct {
+	Interval time.Duration
+
+	Min            float64
+	Max            float64
+	Samples        int
+	Near           float64
+	NearWeight     float64
+	Approach       float64
+	ApproachWeight float64
+
+	Enter      float64
+	EnterAfter time.Duration
+	Leave      float64
+	LeaveAfter time.Duration
+}
+
+// DefaultConfig returns the config for a hc-sr04 watching a door
+func DefaultConfig() *Config {
+	return &Config{
+		Interval:       300 * time.Millisecond,
+		Min:            2,
+		Max:            450,
+		Samples:        5,
+		Near:           80,
+		NearWeight:     0.6,
+		Approach:       30,
+		ApproachWeight: 0.3,
+		Enter:          0.6,
+		EnterAfter:     600 * time.Millisecond,
+		Leave:          0.3,
+		LeaveAfter:     5 * time.Second,
+	}
+}
+
+// Event is the transition of the presence. Confidence is the one at entering for Enter,
+// and the peak one during the visit for Leave. Sources are the names of the contributions at the time,
+// "near" and "approach" for the distance.
+type Event struct {
+	Kind       Kind      `json:"kind"`
+	Visit      int       `json:"visit"`
+	Time       time.Time `json:"time"`
+	Confidence float64   `json:"confidence"`
+	Dist       float64   `json:"dist"`
+	Sources    []string  `json:"sources"`
+}
+
+// Status is the current state of a detector
+type Status struct {
+	Present    bool    `json:"present"`
+	Visit      int     `json:"visit"`
+	Confidence float64 `json:"confidence"`
+	Dist       float64 `json:"dist"`
+}
+
+// Detector ...
+type Detector struct {
+	cfg    *Config
+	ranger Ranger
+	inputs []*Input
+
+	dists     []float64
+	triggered map[string]time.Time
+	present   bool
+	visit     int
+	pending   time.Time
+	peak      float64
+
+	mu     sync.Mutex
+	status Status
+}
+
+// New creates a detector, ranger can be nil if there is no distance meter
+func New(ranger Ranger, cfg *Config, inputs ...*Input) *Detector {
+	return &Detector{
+		cfg:       cfg,
+		ranger:    ranger,
+		inputs:    inputs,
+		triggered: map[string]time.Time{},
+	}
+}
+
+// Update samples all of the sensors once, and returns the event if the presence changes, or nil
+func (d *Detector) Update(now time.Time) *Event {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.ranger != nil {
+		d.sample(d.ranger.Dist())
+	}
+	for _, in := range d.inputs {
+		if in.Sensor.Detected() {
+			d.triggered[in.Name] = now
+		}
+	}
+
+	conf, dist, sources := d.fuse(now)
+	d.status = Status{Present: d.present, Visit: d.visit, Confidence: conf, Dist: dist}
+	if d.present && conf > d.peak {
+		d.peak = conf
+	}
+
+	var changing bool
+	var after time.Duration
+	if d.present {
+		changing, after = conf < d.cfg.Leave, d.cfg.LeaveAfter
+	} else {
+		changing, after = conf >= d.cfg.Enter, d.cfg.EnterAfter
+	}
+	if !changing {
+		d.pending = time.Time{}
+		return nil
+	}
+	if d.pending.IsZero() {
+		d.pending = now
+	}
+	if now.Sub(d.pending) < after {
+		return nil
+	}
+
+	d.pending = time.Time{}
+	d.present = !d.present
+	d.status.Present = d.present
+	e := &Event{
+		Time:       now,
+		Confidence: conf,
+		Dist:       dist,
+		Sources:    sources,
+	}
+	if d.present {
+		d.visit++
+		d.peak = conf
+		e.Kind = Enter
+	} else {
+		e.Kind = Leave
+		e.Confidence = d.peak
+	}
+	e.Visit = d.visit
+	d.status.Visit = d.visit
+	return e
+}
+
+// Status returns the state at the last update
+func (d *Detector) Status() Status {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.status
+}
+
+// Run updates the detector in every interval and calls onEvent with the events, it returns when quit is closed.
+func (d *Detector) Run(quit chan bool, onEvent func(e *Event)) {
+	ticker := time.NewTicker(d.cfg.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-quit:
+			return
+		case now := <-ticker.C:
+			if e := d.Update(now); e != nil {
+				onEvent(e)
+			}
+		}
+	}
+}
+
+func (d *Detector) sample(dist float64) {
+	if dist < d.cfg.Min {
+		return
+	}
+	if dist > d.cfg.Max {
+		dist = d.cfg.Max
+	}
+	d.dists = append(d.dists, dist)
+	if len(d.dists) > d.cfg.Samples {
+		d.dists = d.dists[len(d.dists)-d.cfg.Samples:]
+	}
+}
+
+// fuse returns the confidence, the filtered distance and the names of the contributions
+func (d *Detector) fuse(now time.Time) (conf float64, dist float64, sources []string) {
+	sources = []string{}
+	dist = d.cfg.Max
+	if n := len(d.dists); n > 0 {
+		dist = median(d.dists)
+		if dist < d.cfg.Near {
+			conf += d.cfg.NearWeight
+			sources = append(sources, "near")
+		}
+		// compare the older half and the newer half of the samples
+		if n == d.cfg.Samples && n >= 2 && median(d.dists[:n/2])-median(d.dists[n-n/2:]) >= d.cfg.Approach {
+			conf += d.cfg.ApproachWeight
+			sources = append(sources, "approach")
+		}
+	}
+	for _, in := range d.inputs {
+		t, ok := d.triggered[in.Name]
+		if ok && now.Sub(t) <= in.Hold {
+			conf += in.Weight
+			sources = append(sources, in.Name)
+		}
+	}
+	if conf > 1 {
+		conf = 1
+	}
+	return conf, dist, sources
+}
+
+func median(a []float64) float64 {
+	s := append([]float64(nil), a...)
+	sort.Float64s(s)
+	n := len(s)
+	if n%2 == 1 {
+		return s[n/2]
+	}
+	return (s[n/2-1] + s[n/2]) / 2
+}
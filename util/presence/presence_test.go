@@ -0,0 +1,110 @@
+package presence
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeRanger struct {
+	dists []float64
+}
+
+func (r *fakeRanger) Dist() float64 {
+	if len(r.dists) == 0 {
+		return 3000
+	}
+	d := r.dists[0]
+	r.dists = r.dists[1:]
+	return d
+}
+
+func TestDetector(t *testing.T) {
+	ir := false
+	voice := false
+	testCases := []struct {
+		desc string
+		// the distance and the sensors at each tick of 300ms
+		dists   []float64
+		ir      []bool
+		voice   []bool
+		kinds   []Kind
+		sources []string
+	}{
+		{
+			desc:    "standing near",
+			dists:   []float64{300, 300, 60, 60, 60, 60, 60, 60, 60, 60, 60, 60},
+			kinds:   []Kind{Enter, Leave},
+			sources: []string{"near"},
+		},
+		{
+			desc:  "a glitch of the distance",
+			dists: []float64{300, 300, 300, 5, 50, 300, 300, 300},
+		},
+		{
+			desc:  "voice only",
+			voice: []bool{true, true, true, true, true, true},
+		},
+		{
+			desc:    "approaching with infrared",
+			dists:   []float64{400, 350, 300, 250, 200, 150, 120, 100, 100},
+			ir:      []bool{false, false, false, true, true, true, true, true, true},
+			kinds:   []Kind{Enter, Leave},
+			sources: []string{"approach", "ir"},
+		},
+		{
+			desc:    "infrared and voice",
+			ir:      []bool{true, true, true, true},
+			voice:   []bool{true, true, true, true},
+			kinds:   []Kind{Enter, Leave},
+			sources: []string{"ir", "voice"},
+		},
+		{
+			desc:    "standing too close",
+			dists:   []float64{300, 300, 1, 1, 1, 1, 8, 8, 8, 8, 8},
+			kinds:   []Kind{Enter, Leave},
+			sources: []string{"near"},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			r := &fakeRanger{dists: tc.dists}
+			d := New(r, DefaultConfig(),
+				&Input{Name: "ir", Sensor: SensorFunc(func() bool { return ir }), Weight: 0.4, Hold: 2 * time.Second},
+				&Input{Name: "voice", Sensor: SensorFunc(func() bool { return voice }), Weight: 0.2, Hold: time.Second},
+			)
+			now := time.Date(2020, 1, 2, 3, 4, 5, 0, time.Local)
+			var events []*Event
+			// 15s in total, nobody is there after the samples
+			for i := 0; i < 50; i++ {
+				ir = i < len(tc.ir) && tc.ir[i]
+				voice = i < len(tc.voice) && tc.voice[i]
+				if e := d.Update(now); e != nil {
+					events = append(events, e)
+				}
+				now = now.Add(300 * time.Millisecond)
+			}
+
+			var kinds []Kind
+			for _, e := range events {
+				kinds = append(kinds, e.Kind)
+			}
+			assert.Equal(t, tc.kinds, kinds)
+			if len(tc.kinds) == 0 {
+				return
+			}
+			assert.Equal(t, tc.sources, events[0].Sources)
+			assert.Equal(t, 1, events[0].Visit)
+			assert.Equal(t, 1, events[1].Visit)
+			assert.True(t, events[1].Confidence >= events[0].Confidence)
+			assert.True(t, events[1].Time.Sub(events[0].Time) > DefaultConfig().LeaveAfter)
+			assert.False(t, d.Status().Present)
+		})
+	}
+}
+
+func TestMedian(t *testing.T) {
+	assert.Equal(t, 2.0, median([]float64{3, 1, 2}))
+	assert.Equal(t, 2.5, median([]float64{4, 1, 2, 3}))
+}
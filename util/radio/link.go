@@ -0,0 +1,156 @@
+package radio
+
+import (
+	"errors"
+	"log"
+	"time"
+)
+
+const (
+	defaultAckTimeout = 300 * time.Millisecond
+	defaultRetries    = 3
+)
+
+// Transport is a serial radio, e.g. dev.LC12S,
+// Receive should return empty data if nothing is received in a while.
+type Transport interface {
+	Send(data []byte) error
+	Receive() ([]byte, error)
+}
+
+// Link sends and receives packets over a transport
+// AckTimeout: the time waiting for an ack
+// Retries: the times resending a packet without ack
+type Link struct {
+	AckTimeout time.Duration
+	Retries    int
+
+	t        Transport
+	dec      Decoder
+	seq      byte
+	lastSeq  int // the seq of the last packet received, -1 means none
+	lastSeen time.Time
+	pending  []*Packet // the packets received while waiting for an ack
+}
+
+// NewLink ...
+func NewLink(t Transport) *Link {
+	return &Link{
+		AckTimeout: defaultAckTimeout,
+		Retries:    defaultRetries,
+		t:          t,
+		lastSeq:    -1,
+	}
+}
+
+// Send sends a packet, it waits for the ack and resends the packet if ack is true
+func (l *Link) Send(typ PacketType, payload []byte, ack bool) error {
+	l.seq++
+	p := &Packet{
+		Seq:     l.seq,
+		Type:    typ,
+		Payload: payload,
+	}
+	if ack {
+		p.Flags |= FlagAck
+	}
+	frame, err := Encode(p)
+	if err != nil {
+		return err
+	}
+	for i := 0; i <= l.Retries; i++ {
+		if err := l.t.Send(frame); err != nil {
+			return err
+		}
+		if !ack || l.waitAck(p.Seq) {
+			return nil
+		}
+	}
+	return errors.New("no ack")
+}
+
+// SendControl ...
+func (l *Link) SendControl(c *Control, ack bool) error {
+	return l.Send(TypeControl, c.Marshal(), ack)
+}
+
+// Heartbeat ...
+func (l *Link) Heartbeat() error {
+	return l.Send(TypeHeartbeat, nil, false)
+}
+
+// Recv receives a packet, nil will be returned if nothing is received.
+// it acknowledges the packets asking for ack, and drops the resent packets and heartbeats.
+func (l *Link) Recv() (*Packet, error) {
+	if len(l.pending) == 0 {
+		data, err := l.t.Receive()
+		if err != nil {
+			return nil, err
+		}
+		l.pending = l.dec.Feed(data)
+	}
+	for len(l.pending) > 0 {
+		p := l.pending[0]
+		l.pending = l.pending[1:]
+		if p.Type == TypeAck {
+			// a late ack
+			continue
+		}
+		l.lastSeen = time.Now()
+		if p.Flags&FlagAck != 0 {
+			l.ack(p.Seq)
+		}
+		if l.lastSeq == int(p.Seq) {
+			// resent because the ack was lost
+			continue
+		}
+		l.lastSeq = int(p.Seq)
+		if p.Type == TypeHeartbeat {
+			continue
+		}
+		return p, nil
+	}
+	return nil, nil
+}
+
+// RecvControl receives a control, nil will be returned if nothing is received
+func (l *Link) RecvControl() (*Control, error) {
+	p, err := l.Recv()
+	if err != nil || p == nil {
+		return nil, err
+	}
+	if p.Type != TypeControl {
+		return nil, nil
+	}
+	return UnmarshalControl(p.Payload)
+}
+
+// Lost tells whether nothing has been received in the timeout
+func (l *Link) Lost(timeout time.Duration) bool {
+	return time.Since(l.lastSeen) > timeout
+}
+
+func (l *Link) ack(seq byte) {
+	frame, _ := Encode(&Packet{Type: TypeAck, Payload: []byte{seq}})
+	if err := l.t.Send(frame); err != nil {
+		log.Printf("[radio]failed to send ack, error: %v", err)
+	}
+}
+
+func (l *Link) waitAck(seq byte) bool {
+	deadline := time.Now().Add(l.AckTimeout)
+	for time.Now().Before(deadline) {
+		data, err := l.t.Receive()
+		if err != nil {
+			return false
+		}
+		for _, p := range l.dec.Feed(data) {
+			if p.Type == TypeAck && len(p.Payload) == 1 && p.Payload[0] == seq {
+				l.lastSeen = time.Now()
+				return true
+			}
+			l.pending = append(l.pending, p)
+		}
+	}
+	return false
+}
@@ -0,0 +1,65 @@
+package radio
+
+import (
+	"time"
+)
+
+const (
+	loopbackBuf         = 64
+	loopbackReadTimeout = 50 * time.Millisecond
+)
+
+// Loopback is a fake radio in memory for testing,
+// the data sent from one end is received by the other end.
+// Corrupt modifies the data to send, e.g. flipping bits or dropping bytes,
+// the data will be lost if Corrupt returns empty data.
+type Loopback struct {
+	Corrupt func(data []byte) []byte
+
+	in  chan []byte
+	out chan []byte
+}
+
+// NewLoopback creates the two ends of a loopback
+func NewLoopback() (*Loopback, *Loopback) {
+	a := make(chan []byte, loopbackBuf)
+	b := make(chan []byte, loopbackBuf)
+	return &Loopback{in: a, out: b}, &Loopback{in: b, out: a}
+}
+
+// Send ...
+func (l *Loopback) Send(data []byte) error {
+	data = append([]byte{}, data...)
+	if l.Corrupt != nil {
+		data = l.Corrupt(data)
+	}
+	if len(data) == 0 {
+		return nil
+	}
+	select {
+	case l.out <- data:
+	default:
+		// the buffer is full, lost like a real radio
+	}
+	return nil
+}
+
+// Receive receives the data, empty data will be returned if nothing is received in the read timeout
+func (l *Loopback) Receive() ([]byte, error) {
+	select {
+	case data := <-l.in:
+		return data, nil
+	case <-time.After(loopbackReadTimeout):
+		return []byte{}, nil
+	}
+}
+
+// Wakeup ...
+func (l *Loopback) Wakeup() {
+	return
+}
+
+// Sleep ...
+func (l *Loopback) Sleep() {
+	return
+}
@@ -0,0 +1,174 @@
+/*
+Package radio is a framed packet protocol over a serial radio like LC12S.
+
+A frame is:
+
+	+------+------+-----+-----+------+-------+---------+--------+
+	| 0xA5 | 0x5A | len | seq | type | flags | payload | crc16  |
+	+------+------+-----+-----+------+-------+---------+--------+
+	   1      1      1     1     1      1      len       2
+
+len is the length of the payload, and crc16(CCITT) covers len, seq, type, flags and payload.
+A corrupted frame is dropped and the decoder resyncs on the next header.
+*/
+package radio
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+const (
+	header0 = 0xA5
+	header1 = 0x5A
+	// the bytes of header, len, seq, type and flags
+	headSize = 6
+	crcSize  = 2
+	// MaxPayload is the max length of a payload
+	MaxPayload = 32
+)
+
+// PacketType ...
+type PacketType byte
+
+const (
+	// TypeControl is a control from the joystick
+	TypeControl PacketType = 0x01
+	// TypeAck acknowledges a packet, the payload is the seq of the packet
+	TypeAck PacketType = 0x02
+	// TypeHeartbeat keeps the link alive
+	TypeHeartbeat PacketType = 0x03
+)
+
+const (
+	// FlagAck asks the receiver to acknowledge the packet
+	FlagAck byte = 0x01
+)
+
+// Packet ...
+type Packet struct {
+	Seq     byte
+	Type    PacketType
+	Flags   byte
+	Payload []byte
+}
+
+// Encode encodes the packet into a frame
+func Encode(p *Packet) ([]byte, error) {
+	if len(p.Payload) > MaxPayload {
+		return nil, fmt.Errorf("payload is too long: %v", len(p.Payload))
+	}
+	frame := make([]byte, 0, headSize+len(p.Payload)+crcSize)
+	frame = append(frame, header0, header1, byte(len(p.Payload)), p.Seq, byte(p.Type), p.Flags)
+	frame = append(frame, p.Payload...)
+	crc := crc16(frame[2:])
+	frame = append(frame, byte(crc>>8), byte(crc))
+	return frame, nil
+}
+
+// Decoder decodes the frames from a stream of bytes
+type Decoder struct {
+	buf []byte
+	// Dropped is the number of bytes dropped because of corruption
+	Dropped int
+}
+
+// Feed feeds the data to the decoder, and returns the packets decoded
+func (d *Decoder) Feed(data []byte) []*Packet {
+	d.buf = append(d.buf, data...)
+	var pkts []*Packet
+	for {
+		// looking for the header
+		i := 0
+		for i < len(d.buf) && !(d.buf[i] == header0 && (i+1 == len(d.buf) || d.buf[i+1] == header1)) {
+			i++
+		}
+		d.Dropped += i
+		d.buf = d.buf[i:]
+		if len(d.buf) < headSize {
+			return pkts
+		}
+
+		n := int(d.buf[2])
+		if n > MaxPayload {
+			// a corrupted len
+			d.drop()
+			continue
+		}
+		size := headSize + n + crcSize
+		if len(d.buf) < size {
+			return pkts
+		}
+		frame := d.buf[:size]
+		if crc16(frame[2:size-crcSize]) != binary.BigEndian.Uint16(frame[size-crcSize:]) {
+			d.drop()
+			continue
+		}
+		p := &Packet{
+			Seq:     frame[3],
+			Type:    PacketType(frame[4]),
+			Flags:   frame[5],
+			Payload: append([]byte{}, frame[headSize:size-crcSize]...),
+		}
+		pkts = append(pkts, p)
+		d.buf = d.buf[size:]
+	}
+}
+
+// drop drops the header of a corrupted frame, and resyncs on the next header
+func (d *Decoder) drop() {
+	d.buf = d.buf[1:]
+	d.Dropped++
+}
+
+// Control is the analog input of a joystick
+// X: [-100, 100], forward is positive
+// Y: [-100, 100], right is positive
+// Button: the button of the joystick is pressed
+type Control struct {
+	X      int8
+	Y      int8
+	Button bool
+}
+
+// Marshal ...
+func (c *Control) Marshal() []byte {
+	var btn byte
+	if c.Button {
+		btn = 1
+	}
+	return []byte{byte(c.X), byte(c.Y), btn}
+}
+
+// UnmarshalControl ...
+func UnmarshalControl(data []byte) (*Control, error) {
+	if len(data) != 3 {
+		return nil, errors.New("invalid control")
+	}
+	c := &Control{
+		X:      int8(data[0]),
+		Y:      int8(data[1]),
+		Button: data[2] == 1,
+	}
+	if c.X < -100 || c.X > 100 || c.Y < -100 || c.Y > 100 {
+		return nil, fmt.Errorf("control out of range: %v, %v", c.X, c.Y)
+	}
+	return c, nil
+}
+
+// crc16 is CRC-16/CCITT-FALSE
+func crc16(data []byte) uint16 {
+	crc := uint16(0xFFFF)
+	for _, b := range data {
+		crc ^= uint16(b) << 8
+		for i := 0; i < 8; i++ {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x1021
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return crc
+}
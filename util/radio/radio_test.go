@@ -0,0 +1,131 @@
+package radio
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCRC16(t *testing.T) {
+	// the check value of CRC-16/CCITT-FALSE
+	assert.Equal(t, uint16(0x29B1), crc16([]byte("123456789")))
+}
+
+func TestDecode(t *testing.T) {
+	ctl := &Control{X: 50, Y: -20, Button: true}
+	frame, err := Encode(&Packet{Seq: 7, Type: TypeControl, Payload: ctl.Marshal()})
+	assert.NoError(t, err)
+
+	corrupted := append([]byte{}, frame...)
+	corrupted[7] ^= 0x10
+
+	testCases := []struct {
+		desc    string
+		stream  [][]byte
+		packets int
+	}{
+		{
+			desc:    "a frame",
+			stream:  [][]byte{frame},
+			packets: 1,
+		},
+		{
+			desc:    "a frame in pieces",
+			stream:  [][]byte{frame[:3], frame[3:5], frame[5:]},
+			packets: 1,
+		},
+		{
+			desc:    "garbage before a frame",
+			stream:  [][]byte{{0x11, 0xA5, 0x00}, frame},
+			packets: 1,
+		},
+		{
+			desc:    "a corrupted frame followed by a frame",
+			stream:  [][]byte{corrupted, frame},
+			packets: 1,
+		},
+		{
+			desc:    "two frames",
+			stream:  [][]byte{append(append([]byte{}, frame...), frame...)},
+			packets: 2,
+		},
+		{
+			desc:    "the legacy one-byte op",
+			stream:  [][]byte{{0x13}},
+			packets: 0,
+		},
+	}
+	for _, test := range testCases {
+		var d Decoder
+		var pkts []*Packet
+		for _, data := range test.stream {
+			pkts = append(pkts, d.Feed(data)...)
+		}
+		assert.Equal(t, test.packets, len(pkts), test.desc)
+		for _, p := range pkts {
+			assert.Equal(t, byte(7), p.Seq)
+			c, err := UnmarshalControl(p.Payload)
+			assert.NoError(t, err)
+			assert.Equal(t, ctl, c)
+		}
+	}
+}
+
+func TestUnmarshalControl(t *testing.T) {
+	_, err := UnmarshalControl([]byte{1, 2})
+	assert.Error(t, err)
+	_, err = UnmarshalControl([]byte{120, 0, 0})
+	assert.Error(t, err)
+}
+
+func TestLink(t *testing.T) {
+	a, b := NewLoopback()
+	sender, receiver := NewLink(a), NewLink(b)
+
+	// the receiver acks in background
+	chCtl := make(chan *Control, 8)
+	quit := make(chan bool)
+	go func() {
+		for {
+			select {
+			case <-quit:
+				return
+			default:
+			}
+			c, err := receiver.RecvControl()
+			if err == nil && c != nil {
+				chCtl <- c
+			}
+		}
+	}()
+	defer close(quit)
+
+	assert.NoError(t, sender.SendControl(&Control{X: 10}, false))
+	assert.Equal(t, int8(10), (<-chCtl).X)
+
+	// lose the first two frames, the packet will be resent
+	lost := 0
+	a.Corrupt = func(data []byte) []byte {
+		if lost < 2 {
+			lost++
+			return nil
+		}
+		return data
+	}
+	assert.NoError(t, sender.SendControl(&Control{Button: true}, true))
+	assert.True(t, (<-chCtl).Button)
+
+	// lose all the acks
+	b.Corrupt = func(data []byte) []byte {
+		return nil
+	}
+	assert.Error(t, sender.SendControl(&Control{Y: -30}, true))
+	// the resent packets are received only once
+	assert.Equal(t, int8(-30), (<-chCtl).Y)
+	time.Sleep(100 * time.Millisecond)
+	assert.Equal(t, 0, len(chCtl))
+
+	assert.False(t, receiver.Lost(time.Second))
+	assert.True(t, receiver.Lost(0))
+}
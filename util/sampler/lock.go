@@ -0,0 +1,24 @@
+// +build linux darwin
+
+package sampler
+
+import (
+	"os"
+	"syscall"
+)
+
+// lockFile locks the file exclusively, it blocks until the lock is released by the others
+func lockFile(path string) (unlock func(), err error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDONLY, 0666)
+	if err != nil {
+		return nil, err
+	}
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return func() {
+		syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+		f.Close()
+	}, nil
+}
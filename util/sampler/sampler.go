@@ -0,0 +1,259 @@
+/*
+Package sampler samples a set of sensors on schedule, and publishes the readings to the subscribers.
+
+Each sensor is sampled in its own period with a random jitter, so the sensors of the same period don't read at the same time.
+A reading fails with ErrTimeout if the sensor doesn't respond in the timeout,
+and the sensors on the same bus (e.g. PMS7003 and ZE08CH2O on /dev/ttyAMA0) are never read at the same time,
+even by the samplers in different processes, they're locked by a file lock of the bus in LockDir.
+A sensor isn't read again until its last reading returns, even if that reading timed out,
+and the samples waiting for the sensor or the bus in the meantime fail with ErrTimeout.
+*/
+package sampler
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrTimeout means the sensor didn't respond in the timeout
+	ErrTimeout = errors.New("timeout")
+
+	// LockDir is the directory of the lock files of the buses shared by the processes
+	LockDir = "/run/lock"
+)
+
+// Sensor is a sensor sampled in every Period plus a random delay in [0, Jitter).
+// the reading fails with ErrTimeout if Read doesn't return in Timeout, no timeout if it's 0,
+// it includes the waiting for the bus.
+// it's sampled again after Retry if the reading fails, or after Period if Retry is 0.
+// the sensors with the same Bus are read one by one, even in different processes.
+type Sensor struct {
+	Name    string
+	Read    func() (interface{}, error)
+	Period  time.Duration
+	Jitter  time.Duration
+	Timeout time.Duration
+	Retry   time.Duration
+	Bus     string
+}
+
+// Reading is a value read from a sensor at the time, Err is set if it failed
+type Reading struct {
+	Sensor string
+	Value  interface{}
+	Time   time.Time
+	Err    error
+}
+
+type subscriber struct {
+	names     map[string]bool
+	onReading func(r *Reading)
+}
+
+// Scheduler ...
+type Scheduler struct {
+	mu      sync.Mutex
+	sensors []*Sensor
+	names   map[string]bool
+	// buses are the locks of the buses, a sensor without a bus has a lock of its own
+	buses  map[string]chan struct{}
+	subs   []*subscriber
+	latest map[string]*Reading
+	rand   *rand.Rand
+}
+
+// New ...
+func New() *Scheduler {
+	return &Scheduler{
+		names:  map[string]bool{},
+		buses:  map[string]chan struct{}{},
+		latest: map[string]*Reading{},
+		rand:   rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+}
+
+// Add adds a sensor, it must be called before Run
+func (s *Scheduler) Add(sensor *Sensor) error {
+	if sensor.Name == "" || sensor.Read == nil {
+		return errors.New("a sensor must have a name and a read func")
+	}
+	if sensor.Period <= 0 {
+		return fmt.Errorf("invalid period of %v: %v", sensor.Name, sensor.Period)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.names[sensor.Name] {
+		return fmt.Errorf("duplicated sensor: %v", sensor.Name)
+	}
+	s.names[sensor.Name] = true
+	s.sensors = append(s.sensors, sensor)
+	bus := busOf(sensor)
+	if _, ok := s.buses[bus]; !ok {
+		s.buses[bus] = make(chan struct{}, 1)
+	}
+	return nil
+}
+
+// Subscribe calls onReading with the readings of the sensors, or of all sensors if no names are given.
+// onReading is called in the sampling of the sensor, so it should return quickly.
+func (s *Scheduler) Subscribe(onReading func(r *Reading), names ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sub := &subscriber{onReading: onReading}
+	if len(names) > 0 {
+		sub.names = map[string]bool{}
+		for _, n := range names {
+			sub.names[n] = true
+		}
+	}
+	s.subs = append(s.subs, sub)
+}
+
+// Latest returns the latest reading of the sensor, nil if it isn't sampled yet
+func (s *Scheduler) Latest(name string) *Reading {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.latest[name]
+}
+
+// Run samples the sensors until quit is closed
+func (s *Scheduler) Run(quit chan bool) {
+	s.mu.Lock()
+	sensors := append([]*Sensor(nil), s.sensors...)
+	s.mu.Unlock()
+
+	var wg sync.WaitGroup
+	for _, sensor := range sensors {
+		wg.Add(1)
+		go func(sensor *Sensor) {
+			defer wg.Done()
+			s.loop(sensor, quit)
+		}(sensor)
+	}
+	wg.Wait()
+}
+
+func (s *Scheduler) loop(sensor *Sensor, quit chan bool) {
+	next := time.Now()
+	for {
+		timer := time.NewTimer(time.Until(next) + s.jitter(sensor))
+		select {
+		case <-quit:
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		r := s.sample(sensor, quit)
+		if r == nil {
+			return
+		}
+		s.publish(r)
+
+		if r.Err != nil && sensor.Retry > 0 {
+			next = time.Now().Add(sensor.Retry)
+			continue
+		}
+		next = next.Add(sensor.Period)
+		if now := time.Now(); next.Before(now) {
+			// it's overrun, e.g. a long reading
+			next = now
+		}
+	}
+}
+
+// sample reads the sensor with the lock of the bus, it returns nil if quit is closed
+func (s *Scheduler) sample(sensor *Sensor, quit chan bool) *Reading {
+	s.mu.Lock()
+	lock := s.buses[busOf(sensor)]
+	s.mu.Unlock()
+
+	r := &Reading{Sensor: sensor.Name, Time: time.Now()}
+	// the timeout starts before waiting for the bus, so a reading hanging on the bus times out the others
+	var timeout <-chan time.Time
+	if sensor.Timeout > 0 {
+		timer := time.NewTimer(sensor.Timeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	select {
+	case lock <- struct{}{}:
+	case <-timeout:
+		return &Reading{Sensor: sensor.Name, Time: r.Time, Err: ErrTimeout}
+	case <-quit:
+		return nil
+	}
+
+	done := make(chan bool, 1)
+	go func() {
+		v, err := read(sensor)
+		// the bus is released when the reading returns, even if it timed out
+		<-lock
+		r.Value, r.Err = v, err
+		done <- true
+	}()
+
+	select {
+	case <-done:
+		return r
+	case <-timeout:
+		return &Reading{Sensor: sensor.Name, Time: r.Time, Err: ErrTimeout}
+	case <-quit:
+		return nil
+	}
+}
+
+func (s *Scheduler) publish(r *Reading) {
+	s.mu.Lock()
+	s.latest[r.Sensor] = r
+	subs := append([]*subscriber(nil), s.subs...)
+	s.mu.Unlock()
+	for _, sub := range subs {
+		if sub.names == nil || sub.names[r.Sensor] {
+			sub.onReading(r)
+		}
+	}
+}
+
+// jitter returns a random delay in [0, Jitter)
+func (s *Scheduler) jitter(sensor *Sensor) time.Duration {
+	if sensor.Jitter <= 0 {
+		return 0
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return time.Duration(s.rand.Int63n(int64(sensor.Jitter)))
+}
+
+// read reads the sensor with the file lock of the bus if it's on a bus, so it isn't read by another process at the same time
+func read(sensor *Sensor) (interface{}, error) {
+	if sensor.Bus == "" {
+		return sensor.Read()
+	}
+	unlock, err := lockFile(lockPath(sensor.Bus))
+	if err != nil {
+		return nil, fmt.Errorf("failed to lock bus %v, error: %v", sensor.Bus, err)
+	}
+	defer unlock()
+	return sensor.Read()
+}
+
+// lockPath returns the lock file of the bus, e.g. /run/lock/sampler-dev_ttyAMA0.lock of /dev/ttyAMA0
+func lockPath(bus string) string {
+	name := strings.NewReplacer("/", "_", "\\", "_", ":", "_").Replace(bus)
+	return filepath.Join(LockDir, "sampler-"+strings.Trim(name, "_")+".lock")
+}
+
+func busOf(sensor *Sensor) string {
+	if sensor.Bus != "" {
+		return sensor.Bus
+	}
+	// a sensor without a bus is locked by itself
+	return "sensor:" + sensor.Name
+}
@@ -0,0 +1,265 @@
+package sampler
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// counter counts the readings of the sensors, the calls of the reads, and the max number of the reads at the same time
+type counter struct {
+	mu       sync.Mutex
+	reading  int
+	max      int
+	calls    int
+	readings map[string][]*Reading
+}
+
+func (c *counter) read(d time.Duration, v interface{}, err error) func() (interface{}, error) {
+	return func() (interface{}, error) {
+		c.mu.Lock()
+		c.calls++
+		c.reading++
+		if c.reading > c.max {
+			c.max = c.reading
+		}
+		c.mu.Unlock()
+		time.Sleep(d)
+		c.mu.Lock()
+		c.reading--
+		c.mu.Unlock()
+		return v, err
+	}
+}
+
+func (c *counter) onReading(r *Reading) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.readings[r.Sensor] = append(c.readings[r.Sensor], r)
+}
+
+func (c *counter) count(name string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.readings[name])
+}
+
+func run(s *Scheduler, d time.Duration) {
+	quit := make(chan bool)
+	done := make(chan bool)
+	go func() {
+		s.Run(quit)
+		close(done)
+	}()
+	time.Sleep(d)
+	close(quit)
+	<-done
+}
+
+func TestMain(m *testing.M) {
+	dir, err := ioutil.TempDir("", "sampler")
+	if err != nil {
+		panic(err)
+	}
+	LockDir = dir
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+func TestScheduler(t *testing.T) {
+	testCases := []struct {
+		desc    string
+		sensors []*Sensor
+		// the sensors subscribed, all if nil
+		names []string
+		// the min and max readings of each sensor
+		min map[string]int
+		max map[string]int
+		// the max number of the readings at the same time
+		concurrent int
+	}{
+		{
+			desc: "periods",
+			sensors: []*Sensor{
+				{Name: "fast", Period: 20 * time.Millisecond},
+				{Name: "slow", Period: 60 * time.Millisecond},
+			},
+			min:        map[string]int{"fast": 4, "slow": 2},
+			max:        map[string]int{"fast": 7, "slow": 3},
+			concurrent: 2,
+		},
+		{
+			desc: "subscribed",
+			sensors: []*Sensor{
+				{Name: "fast", Period: 20 * time.Millisecond},
+				{Name: "slow", Period: 60 * time.Millisecond},
+			},
+			names:      []string{"slow"},
+			min:        map[string]int{"fast": 0, "slow": 2},
+			max:        map[string]int{"fast": 0, "slow": 3},
+			concurrent: 2,
+		},
+		{
+			desc: "the same bus",
+			sensors: []*Sensor{
+				{Name: "pms7003", Period: 20 * time.Millisecond, Bus: "/dev/ttyAMA0"},
+				{Name: "ze08ch2o", Period: 20 * time.Millisecond, Bus: "/dev/ttyAMA0"},
+			},
+			min:        map[string]int{"pms7003": 3, "ze08ch2o": 3},
+			max:        map[string]int{"pms7003": 7, "ze08ch2o": 7},
+			concurrent: 1,
+		},
+		{
+			desc: "jitter",
+			sensors: []*Sensor{
+				{Name: "a", Period: 20 * time.Millisecond, Jitter: 10 * time.Millisecond},
+			},
+			min:        map[string]int{"a": 3},
+			max:        map[string]int{"a": 7},
+			concurrent: 1,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			c := &counter{readings: map[string][]*Reading{}}
+			s := New()
+			for _, sensor := range tc.sensors {
+				sensor.Read = c.read(5*time.Millisecond, 1.5, nil)
+				assert.NoError(t, s.Add(sensor))
+			}
+			s.Subscribe(c.onReading, tc.names...)
+			run(s, 110*time.Millisecond)
+
+			for name, min := range tc.min {
+				n := c.count(name)
+				assert.True(t, n >= min && n <= tc.max[name], fmt.Sprintf("%v: %v readings", name, n))
+			}
+			c.mu.Lock()
+			defer c.mu.Unlock()
+			assert.True(t, c.max <= tc.concurrent, fmt.Sprintf("%v readings at the same time", c.max))
+		})
+	}
+}
+
+func TestBusOfProcesses(t *testing.T) {
+	// the schedulers are like the samplers in different processes
+	c := &counter{readings: map[string][]*Reading{}}
+	s1, s2 := New(), New()
+	assert.NoError(t, s1.Add(&Sensor{Name: "pms7003", Read: c.read(5*time.Millisecond, 1, nil), Period: 10 * time.Millisecond, Bus: "/dev/ttyAMA0"}))
+	assert.NoError(t, s2.Add(&Sensor{Name: "ze08ch2o", Read: c.read(5*time.Millisecond, 1, nil), Period: 10 * time.Millisecond, Bus: "/dev/ttyAMA0"}))
+	s1.Subscribe(c.onReading)
+	s2.Subscribe(c.onReading)
+
+	var wg sync.WaitGroup
+	for _, s := range []*Scheduler{s1, s2} {
+		wg.Add(1)
+		go func(s *Scheduler) {
+			defer wg.Done()
+			run(s, 100*time.Millisecond)
+		}(s)
+	}
+	wg.Wait()
+
+	assert.True(t, c.count("pms7003") >= 2, fmt.Sprintf("%v readings", c.count("pms7003")))
+	assert.True(t, c.count("ze08ch2o") >= 2, fmt.Sprintf("%v readings", c.count("ze08ch2o")))
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	assert.Equal(t, 1, c.max)
+	_, err := os.Stat(lockPath("/dev/ttyAMA0"))
+	assert.NoError(t, err)
+}
+
+func TestLockPath(t *testing.T) {
+	assert.Equal(t, filepath.Join(LockDir, "sampler-dev_ttyAMA0.lock"), lockPath("/dev/ttyAMA0"))
+	assert.Equal(t, filepath.Join(LockDir, "sampler-i2c-1.lock"), lockPath("i2c-1"))
+}
+
+func TestTimeoutAndRetry(t *testing.T) {
+	c := &counter{readings: map[string][]*Reading{}}
+	stuckc := &counter{}
+	s := New()
+	errBad := errors.New("bad data")
+	assert.NoError(t, s.Add(&Sensor{
+		Name:    "stuck",
+		Read:    stuckc.read(50*time.Millisecond, 1, nil),
+		Period:  10 * time.Millisecond,
+		Timeout: 10 * time.Millisecond,
+	}))
+	assert.NoError(t, s.Add(&Sensor{
+		Name:   "bad",
+		Read:   c.read(0, nil, errBad),
+		Period: time.Hour,
+		Retry:  20 * time.Millisecond,
+	}))
+	s.Subscribe(c.onReading)
+	run(s, 120*time.Millisecond)
+
+	c.mu.Lock()
+	stuck := c.readings["stuck"]
+	bad := c.readings["bad"]
+	c.mu.Unlock()
+	// a stuck sensor isn't read again until the last reading returns,
+	// and the samples in the meantime time out
+	stuckc.mu.Lock()
+	calls, max := stuckc.calls, stuckc.max
+	stuckc.mu.Unlock()
+	assert.True(t, calls >= 2 && calls <= 3, fmt.Sprintf("%v calls", calls))
+	assert.Equal(t, 1, max)
+	assert.True(t, len(stuck) >= 5, fmt.Sprintf("%v readings", len(stuck)))
+	for _, r := range stuck {
+		assert.Equal(t, ErrTimeout, r.Err)
+	}
+	assert.True(t, len(bad) >= 4, fmt.Sprintf("%v readings", len(bad)))
+	assert.Equal(t, errBad, bad[0].Err)
+	assert.Equal(t, errBad, s.Latest("bad").Err)
+	assert.Nil(t, s.Latest("none"))
+}
+
+func TestBusTimeout(t *testing.T) {
+	c := &counter{readings: map[string][]*Reading{}}
+	s := New()
+	assert.NoError(t, s.Add(&Sensor{Name: "hung", Read: c.read(300*time.Millisecond, 1, nil), Period: time.Hour, Bus: "/dev/ttyS0"}))
+	assert.NoError(t, s.Add(&Sensor{
+		Name:    "waiting",
+		Read:    c.read(0, 1, nil),
+		Period:  10 * time.Millisecond,
+		Jitter:  5 * time.Millisecond,
+		Timeout: 20 * time.Millisecond,
+		Bus:     "/dev/ttyS0",
+	}))
+	s.Subscribe(c.onReading, "waiting")
+	run(s, 100*time.Millisecond)
+
+	// the sensor waiting for the bus hung by the other times out instead of blocking silently
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	waiting := c.readings["waiting"]
+	assert.True(t, len(waiting) >= 2, fmt.Sprintf("%v readings", len(waiting)))
+	for _, r := range waiting {
+		assert.Equal(t, ErrTimeout, r.Err)
+	}
+}
+
+func TestAdd(t *testing.T) {
+	s := New()
+	read := func() (interface{}, error) { return nil, nil }
+	assert.NoError(t, s.Add(&Sensor{Name: "a", Read: read, Period: time.Second}))
+	assert.Error(t, s.Add(&Sensor{Name: "a", Read: read, Period: time.Second}))
+	assert.Error(t, s.Add(&Sensor{Name: "b", Read: read}))
+	assert.Error(t, s.Add(&Sensor{Name: "c", Period: time.Second}))
+	assert.Error(t, s.Add(&Sensor{Read: read, Period: time.Second}))
+
+	for i := 0; i < 100; i++ {
+		j := s.jitter(&Sensor{Jitter: 10 * time.Millisecond})
+		assert.True(t, j >= 0 && j < 10*time.Millisecond)
+	}
+	assert.Equal(t, time.Duration(0), s.jitter(&Sensor{}))
+}
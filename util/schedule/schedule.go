@@ -0,0 +1,318 @@
+/*
+Package schedule decides when a service is in service by calendar rules.
+
+A schedule is made up of the weekly rules, the holidays and the exceptions, e.g.
+
+	{
+	    "rules": [
+	        {"days": ["mon", "tue", "wed", "thu", "fri"], "start": "09:00", "end": "20:00"},
+	        {"days": ["sat", "sun", "holiday"], "start": "10:00", "end": "22:00"}
+	    ],
+	    "holidays": ["2020-10-01", "2020-10-02"],
+	    "exceptions": [
+	        {"date": "2020-12-24", "rules": [{"start": "09:00", "end": "02:00"}]},
+	        {"date": "2020-12-31"}
+	    ]
+	}
+
+a rule without days applies to every day except the holidays, and it crosses midnight if the end isn't after the start.
+the rules of "holiday" apply to the holidays instead of the ones of the weekdays,
+and the rules of an exception replace all of the rules on the date, it's out of service all day if it has no rules.
+*/
+package schedule
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	dateLayout = "2006-01-02"
+	holiday    = "holiday"
+	// the transitions are searched in the days ahead
+	horizon = 366
+)
+
+var (
+	// Run checks the state at most in maxWait, since the wall clock may be stepped while waiting,
+	// e.g. by ntp after a pi boots on fake-hwclock
+	maxWait = time.Minute
+	now     = time.Now
+)
+
+var days = map[string]time.Weekday{
+	"sun": time.Sunday,
+	"mon": time.Monday,
+	"tue": time.Tuesday,
+	"wed": time.Wednesday,
+	"thu": time.Thursday,
+	"fri": time.Friday,
+	"sat": time.Saturday,
+}
+
+// Rule is in service from Start to End on the Days, e.g. "09:00" to "20:00" on "mon" and "tue"
+type Rule struct {
+	Days  []string `json:"days,omitempty"`
+	Start string   `json:"start"`
+	End   string   `json:"end"`
+}
+
+// Exception replaces the rules on the date, e.g. "2020-12-24"
+type Exception struct {
+	Date  string `json:"date"`
+	Rules []Rule `json:"rules,omitempty"`
+}
+
+// Schedule ...
+type Schedule struct {
+	Rules      []Rule      `json:"rules"`
+	Holidays   []string    `json:"holidays,omitempty"`
+	Exceptions []Exception `json:"exceptions,omitempty"`
+}
+
+type interval struct {
+	start time.Time
+	end   time.Time
+}
+
+// Daily returns a schedule in service from start to end every day
+func Daily(start, end string) *Schedule {
+	return &Schedule{
+		Rules: []Rule{{Start: start, End: end}},
+	}
+}
+
+// Load loads the schedule from the json file
+func Load(file string) (*Schedule, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	s := &Schedule{}
+	if err := json.Unmarshal(data, s); err != nil {
+		return nil, fmt.Errorf("failed to load schedule from %v, error: %v", file, err)
+	}
+	if err := s.Validate(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// String returns the rules of the schedule, e.g. "09:00-20:00 on mon,tue, 10:00-22:00 on sat,sun,holiday",
+// with the counts of the holidays and the exceptions if any
+func (s *Schedule) String() string {
+	var rules []string
+	for _, r := range s.Rules {
+		rules = append(rules, r.String())
+	}
+	str := strings.Join(rules, ", ")
+	if len(s.Holidays) > 0 || len(s.Exceptions) > 0 {
+		str += fmt.Sprintf(" (%v holidays, %v exceptions)", len(s.Holidays), len(s.Exceptions))
+	}
+	return str
+}
+
+// String returns the rule like "09:00-20:00 on mon,tue", or "09:00-20:00" if it applies to every day
+func (r Rule) String() string {
+	if len(r.Days) == 0 {
+		return r.Start + "-" + r.End
+	}
+	return fmt.Sprintf("%v-%v on %v", r.Start, r.End, strings.Join(r.Days, ","))
+}
+
+// Validate validates the days, the dates and the times of the schedule
+func (s *Schedule) Validate() error {
+	validate := func(rules []Rule, exception bool) error {
+		for _, r := range rules {
+			if _, err := clock(r.Start); err != nil {
+				return err
+			}
+			if _, err := clock(r.End); err != nil {
+				return err
+			}
+			if exception && len(r.Days) > 0 {
+				return errors.New("the rules of an exception can't have days")
+			}
+			for _, d := range r.Days {
+				if _, ok := days[d]; !ok && d != holiday {
+					return fmt.Errorf("invalid day: %v", d)
+				}
+			}
+		}
+		return nil
+	}
+	if err := validate(s.Rules, false); err != nil {
+		return err
+	}
+	for _, d := range s.Holidays {
+		if _, err := time.Parse(dateLayout, d); err != nil {
+			return fmt.Errorf("invalid holiday: %v", d)
+		}
+	}
+	for _, e := range s.Exceptions {
+		if _, err := time.Parse(dateLayout, e.Date); err != nil {
+			return fmt.Errorf("invalid exception date: %v", e.Date)
+		}
+		if err := validate(e.Rules, true); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Active returns true if it's in service at t
+func (s *Schedule) Active(t time.Time) bool {
+	day := date(t)
+	for _, d := range []time.Time{day.AddDate(0, 0, -1), day} {
+		for _, i := range s.intervals(d) {
+			if !t.Before(i.start) && t.Before(i.end) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Next returns the time of the next transition after t, and whether it's in service since then.
+// it returns false for ok if the state doesn't change in a year.
+func (s *Schedule) Next(t time.Time) (next time.Time, active bool, ok bool) {
+	cur := s.Active(t)
+	day := date(t)
+	var bounds []time.Time
+	for n := -1; n <= horizon; n++ {
+		for _, i := range s.intervals(day.AddDate(0, 0, n)) {
+			bounds = append(bounds, i.start, i.end)
+		}
+	}
+	sort.Slice(bounds, func(i, j int) bool {
+		return bounds[i].Before(bounds[j])
+	})
+	for _, b := range bounds {
+		if !b.After(t) {
+			continue
+		}
+		if a := s.Active(b); a != cur {
+			return b, a, true
+		}
+	}
+	return time.Time{}, cur, false
+}
+
+// Run calls onChange with the state at once, and with the new state at each transition,
+// it returns when quit is closed.
+// the state is checked again at least once a minute, so a step of the wall clock is caught up soon.
+func (s *Schedule) Run(quit chan bool, onChange func(active bool)) {
+	last := s.Active(now())
+	onChange(last)
+	for {
+		t, wait := now(), maxWait
+		if next, _, ok := s.Next(t); ok && next.Sub(t) < wait {
+			wait = next.Sub(t)
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-quit:
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+		if active := s.Active(now()); active != last {
+			last = active
+			onChange(active)
+		}
+	}
+}
+
+// intervals returns the intervals in service starting on the date
+func (s *Schedule) intervals(d time.Time) []interval {
+	ds := d.Format(dateLayout)
+	rules := s.Rules
+	name := ""
+	for _, e := range s.Exceptions {
+		if e.Date == ds {
+			rules = e.Rules
+			name = "*"
+		}
+	}
+	if name == "" {
+		name = weekday(d.Weekday())
+		for _, h := range s.Holidays {
+			if h == ds {
+				name = holiday
+			}
+		}
+	}
+
+	var list []interval
+	for _, r := range rules {
+		if !r.on(name) {
+			continue
+		}
+		start, err1 := clock(r.Start)
+		end, err2 := clock(r.End)
+		if err1 != nil || err2 != nil {
+			continue
+		}
+		i := interval{
+			start: at(d, start),
+			end:   at(d, end),
+		}
+		if end <= start {
+			i.end = at(d.AddDate(0, 0, 1), end)
+		}
+		list = append(list, i)
+	}
+	return list
+}
+
+// on returns true if the rule applies to the day named, "*" is any day of an exception
+func (r *Rule) on(name string) bool {
+	if name == "*" {
+		return true
+	}
+	if len(r.Days) == 0 {
+		return name != holiday
+	}
+	for _, d := range r.Days {
+		if d == name {
+			return true
+		}
+	}
+	return false
+}
+
+// clock parses "15:04" to the minutes from midnight, "24:00" is the end of the day
+func clock(s string) (int, error) {
+	var h, m int
+	if n, err := fmt.Sscanf(s, "%d:%d", &h, &m); n != 2 || err != nil {
+		return 0, fmt.Errorf("invalid time: %v", s)
+	}
+	if h < 0 || m < 0 || m > 59 || h*60+m > 24*60 {
+		return 0, fmt.Errorf("invalid time: %v", s)
+	}
+	return h*60 + m, nil
+}
+
+func date(t time.Time) time.Time {
+	y, m, d := t.Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, t.Location())
+}
+
+func at(d time.Time, minutes int) time.Time {
+	y, m, day := d.Date()
+	return time.Date(y, m, day, minutes/60, minutes%60, 0, 0, d.Location())
+}
+
+func weekday(w time.Weekday) string {
+	for name, d := range days {
+		if d == w {
+			return name
+		}
+	}
+	return ""
+}
@@ -0,0 +1,185 @@
+package schedule
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testSchedule = `{
+    "rules": [
+        {"days": ["mon", "tue", "wed", "thu", "fri"], "start": "09:00", "end": "20:00"},
+        {"days": ["sat", "sun", "holiday"], "start": "22:00", "end": "02:00"}
+    ],
+    "holidays": ["2020-10-01"],
+    "exceptions": [
+        {"date": "2020-10-06", "rules": [{"start": "12:00", "end": "13:00"}]},
+        {"date": "2020-10-07"}
+    ]
+}`
+
+// oct returns the time of the day in oct 2020, 2020-10-01 is a thursday
+func oct(day, hour, min int) time.Time {
+	return time.Date(2020, 10, day, hour, min, 0, 0, time.Local)
+}
+
+func load(t *testing.T, content string) (*Schedule, error) {
+	dir, err := ioutil.TempDir("", "schedule")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "schedule.json")
+	assert.NoError(t, ioutil.WriteFile(file, []byte(content), 0644))
+	return Load(file)
+}
+
+func TestActive(t *testing.T) {
+	s, err := load(t, testSchedule)
+	assert.NoError(t, err)
+
+	testCases := []struct {
+		desc   string
+		t      time.Time
+		active bool
+	}{
+		{"a weekday", oct(5, 10, 0), true},
+		{"before the start", oct(5, 8, 59), false},
+		{"at the start", oct(5, 9, 0), true},
+		{"at the end", oct(5, 20, 0), false},
+		{"a holiday", oct(1, 10, 0), false},
+		{"the night of the holiday", oct(1, 23, 0), true},
+		{"after midnight", oct(2, 1, 0), true},
+		{"the weekday after the holiday", oct(2, 10, 0), true},
+		{"saturday night", oct(3, 22, 30), true},
+		{"sunday morning", oct(4, 1, 59), true},
+		{"sunday noon", oct(4, 12, 0), false},
+		{"an exception", oct(6, 12, 30), true},
+		{"the hours replaced", oct(6, 10, 0), false},
+		{"closed all day", oct(7, 10, 0), false},
+	}
+	for _, test := range testCases {
+		assert.Equal(t, test.active, s.Active(test.t), test.desc)
+	}
+}
+
+func TestString(t *testing.T) {
+	assert.Equal(t, "08:00-20:00", Daily("08:00", "20:00").String())
+
+	s := &Schedule{
+		Rules: []Rule{
+			{Days: []string{"mon", "tue"}, Start: "09:00", End: "20:00"},
+			{Days: []string{"sat", "holiday"}, Start: "22:00", End: "02:00"},
+		},
+		Holidays:   []string{"2020-10-01"},
+		Exceptions: []Exception{{Date: "2020-12-31"}},
+	}
+	assert.Equal(t, "09:00-20:00 on mon,tue, 22:00-02:00 on sat,holiday (1 holidays, 1 exceptions)", s.String())
+}
+
+func TestNext(t *testing.T) {
+	s, err := load(t, testSchedule)
+	assert.NoError(t, err)
+
+	testCases := []struct {
+		desc   string
+		t      time.Time
+		next   time.Time
+		active bool
+	}{
+		{"to the end", oct(5, 10, 0), oct(5, 20, 0), false},
+		{"to the start", oct(5, 20, 0), oct(6, 12, 0), true},
+		{"over the closed day", oct(6, 13, 0), oct(8, 9, 0), true},
+		{"to the night", oct(1, 0, 0), oct(1, 22, 0), true},
+		{"to the morning", oct(1, 22, 0), oct(2, 2, 0), false},
+	}
+	for _, test := range testCases {
+		next, active, ok := s.Next(test.t)
+		assert.True(t, ok, test.desc)
+		assert.Equal(t, test.next, next, test.desc)
+		assert.Equal(t, test.active, active, test.desc)
+	}
+
+	// always in service
+	_, active, ok := Daily("00:00", "24:00").Next(oct(1, 0, 0))
+	assert.True(t, active)
+	assert.False(t, ok)
+	// overnight
+	next, active, ok := Daily("20:00", "08:00").Next(oct(1, 7, 0))
+	assert.Equal(t, oct(1, 8, 0), next)
+	assert.False(t, active)
+	assert.True(t, ok)
+}
+
+func TestLoad(t *testing.T) {
+	testCases := []struct {
+		desc    string
+		content string
+		ok      bool
+	}{
+		{"ok", testSchedule, true},
+		{"bad json", `{`, false},
+		{"bad day", `{"rules": [{"days": ["monday"], "start": "09:00", "end": "20:00"}]}`, false},
+		{"bad time", `{"rules": [{"start": "9", "end": "20:00"}]}`, false},
+		{"out of the day", `{"rules": [{"start": "09:00", "end": "24:01"}]}`, false},
+		{"bad holiday", `{"rules": [], "holidays": ["10-01"]}`, false},
+		{"days in exception", `{"exceptions": [{"date": "2020-10-01", "rules": [{"days": ["mon"], "start": "09:00", "end": "20:00"}]}]}`, false},
+	}
+	for _, test := range testCases {
+		_, err := load(t, test.content)
+		assert.Equal(t, test.ok, err == nil, test.desc)
+	}
+}
+
+func TestRun(t *testing.T) {
+	quit := make(chan bool)
+	states := make(chan bool, 1)
+	go Daily("00:00", "24:00").Run(quit, func(active bool) {
+		states <- active
+	})
+	assert.True(t, <-states)
+	close(quit)
+}
+
+func TestRunClockStepped(t *testing.T) {
+	var (
+		mu    sync.Mutex
+		clock = oct(5, 7, 0)
+	)
+	defer func(w time.Duration, n func() time.Time) {
+		maxWait, now = w, n
+	}(maxWait, now)
+	maxWait = 5 * time.Millisecond
+	now = func() time.Time {
+		mu.Lock()
+		defer mu.Unlock()
+		return clock
+	}
+
+	quit := make(chan bool)
+	done := make(chan bool)
+	states := make(chan bool, 4)
+	go func() {
+		Daily("08:00", "20:00").Run(quit, func(active bool) {
+			states <- active
+		})
+		close(done)
+	}()
+	assert.False(t, <-states)
+
+	// the clock is stepped by ntp, it's in service at once instead of an hour later
+	mu.Lock()
+	clock = oct(5, 9, 0)
+	mu.Unlock()
+	select {
+	case active := <-states:
+		assert.True(t, active)
+	case <-time.After(time.Second):
+		t.Error("the step of the clock isn't caught up")
+	}
+	close(quit)
+	<-done
+}
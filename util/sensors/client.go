@@ -0,0 +1,205 @@
+package sensors
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	apiPrefix = "/api/v1"
+	// the delay of reconnecting in default
+	defaultRetry = 3 * time.Second
+)
+
+// Client ...
+type Client struct {
+	server string
+	http   *http.Client
+	// Retry is the delay of reconnecting, it's updated by the retry field of the server
+	Retry time.Duration
+}
+
+// NewClient creates a client of the server, e.g. "http://localhost:8000"
+func NewClient(server string) *Client {
+	return &Client{
+		server: strings.TrimRight(server, "/"),
+		http:   &http.Client{},
+		Retry:  defaultRetry,
+	}
+}
+
+// Sensors returns all of the sensors with the latest readings
+func (c *Client) Sensors() ([]*Sensor, error) {
+	var list []*Sensor
+	if err := c.get(context.Background(), "/sensors", nil, &list); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+// Sensor returns the sensor with the latest reading
+func (c *Client) Sensor(id string) (*Sensor, error) {
+	var s Sensor
+	if err := c.get(context.Background(), "/sensors/"+url.PathEscape(id), nil, &s); err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// Poll returns the events after the id, it waits for them in timeout if there are none.
+// it returns the latest event of each sensor if after is 0, and all of the sensors are polled if no ids.
+func (c *Client) Poll(after int64, timeout time.Duration, ids ...string) ([]*Event, error) {
+	q := url.Values{
+		"after":   {strconv.FormatInt(after, 10)},
+		"timeout": {timeout.String()},
+	}
+	if len(ids) > 0 {
+		q.Set("sensors", strings.Join(ids, ","))
+	}
+	var events []*Event
+	if err := c.get(context.Background(), "/events/poll", q, &events); err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+// Watch calls onEvent with the events of the sensors pushed by the server, all of the sensors are watched if no ids.
+// it gets the latest event of each sensor first, reconnects after Retry if the connection is broken,
+// and resumes from the last event. it returns when quit is closed.
+func (c *Client) Watch(quit chan bool, onEvent func(e *Event), ids ...string) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-quit:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	var last int64
+	for {
+		err := c.stream(ctx, ids, &last, onEvent)
+		select {
+		case <-ctx.Done():
+			return
+		default:
+		}
+		log.Printf("[sensors]the events are broken, reconnect in %v, error: %v", c.Retry, err)
+		timer := time.NewTimer(c.Retry)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+	}
+}
+
+// stream reads the events until the connection is broken, last is updated by the id of the events
+func (c *Client) stream(ctx context.Context, ids []string, last *int64, onEvent func(e *Event)) error {
+	u := c.server + apiPrefix + "/events"
+	if len(ids) > 0 {
+		u += "?" + url.Values{"sensors": {strings.Join(ids, ",")}}.Encode()
+	}
+	req, err := http.NewRequest(http.MethodGet, u, nil)
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Accept", "text/event-stream")
+	if *last > 0 {
+		req.Header.Set("Last-Event-ID", strconv.FormatInt(*last, 10))
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return statusError(resp)
+	}
+
+	var data []string
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			// dispatch the event
+			if len(data) == 0 {
+				continue
+			}
+			var e Event
+			err := json.Unmarshal([]byte(strings.Join(data, "\n")), &e)
+			data = nil
+			if err != nil {
+				log.Printf("[sensors]failed to unmarshal the event, error: %v", err)
+				continue
+			}
+			*last = e.ID
+			onEvent(&e)
+			continue
+		}
+		if strings.HasPrefix(line, ":") {
+			// a comment for keeping alive
+			continue
+		}
+		field, value := line, ""
+		if i := strings.Index(line, ":"); i >= 0 {
+			field, value = line[:i], strings.TrimPrefix(line[i+1:], " ")
+		}
+		switch field {
+		case "data":
+			data = append(data, value)
+		case "retry":
+			if ms, err := strconv.Atoi(value); err == nil {
+				c.Retry = time.Duration(ms) * time.Millisecond
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	return io.EOF
+}
+
+func (c *Client) get(ctx context.Context, path string, q url.Values, v interface{}) error {
+	u := c.server + apiPrefix + path
+	if len(q) > 0 {
+		u += "?" + q.Encode()
+	}
+	req, err := http.NewRequest(http.MethodGet, u, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := c.http.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return statusError(resp)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+func statusError(resp *http.Response) error {
+	body, _ := ioutil.ReadAll(resp.Body)
+	var e struct {
+		ErrorMsg string `json:"error_msg"`
+	}
+	if json.Unmarshal(body, &e) == nil && e.ErrorMsg != "" {
+		return fmt.Errorf("status: %v, err msg: %v", resp.Status, e.ErrorMsg)
+	}
+	return fmt.Errorf("status: %v", resp.Status)
+}
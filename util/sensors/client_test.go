@@ -0,0 +1,108 @@
+package sensors
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWatch(t *testing.T) {
+	var (
+		mu    sync.Mutex
+		conns int
+		lasts []string
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/api/v1/events", r.URL.Path)
+		assert.Equal(t, "temp,pm25", r.FormValue("sensors"))
+		mu.Lock()
+		conns++
+		n := conns
+		lasts = append(lasts, r.Header.Get("Last-Event-ID"))
+		mu.Unlock()
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprintf(w, "retry: 10\n\n")
+		if n == 1 {
+			// broken after two events
+			fmt.Fprintf(w, "id: 1\nevent: reading\ndata: {\"id\":1,\"sensor\":\"temp\",\"value\":21.5}\n\n")
+			fmt.Fprintf(w, ": ping\n\n")
+			fmt.Fprintf(w, "id: 2\nevent: reading\ndata: {\"id\":2,\"sensor\":\"pm25\",\"error\":\"timeout\"}\n\n")
+			return
+		}
+		fmt.Fprintf(w, "id: 3\nevent: reading\ndata: {\"id\":3,\"sensor\":\"temp\",\"value\":22}\n\n")
+		w.(http.Flusher).Flush()
+		<-r.Context().Done()
+	}))
+	defer srv.Close()
+
+	c := NewClient(srv.URL + "/")
+	events := make(chan *Event, 4)
+	quit := make(chan bool)
+	done := make(chan bool)
+	go func() {
+		c.Watch(quit, func(e *Event) { events <- e }, "temp", "pm25")
+		close(done)
+	}()
+
+	var got []*Event
+	for len(got) < 3 {
+		select {
+		case e := <-events:
+			got = append(got, e)
+		case <-time.After(2 * time.Second):
+			t.Fatal("timeout")
+		}
+	}
+	close(quit)
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("failed to quit")
+	}
+
+	assert.Equal(t, 21.5, got[0].Value)
+	assert.Equal(t, "timeout", got[1].Error)
+	assert.Equal(t, int64(3), got[2].ID)
+	assert.Equal(t, 10*time.Millisecond, c.Retry)
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, []string{"", "2"}, lasts)
+}
+
+func TestClient(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/v1/sensors/temp":
+			fmt.Fprintf(w, `{"id":"temp","unit":"°C","period":30,"latest":{"value":21.5,"time":"2020-01-02T03:04:05Z"}}`)
+		case "/api/v1/events/poll":
+			assert.Equal(t, "7", r.FormValue("after"))
+			assert.Equal(t, "10s", r.FormValue("timeout"))
+			assert.Equal(t, "pm25", r.FormValue("sensors"))
+			fmt.Fprintf(w, `[{"id":8,"sensor":"pm25","value":35}]`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprintf(w, `{"error_msg":"no such sensor: co2"}`)
+		}
+	}))
+	defer srv.Close()
+
+	c := NewClient(srv.URL)
+	s, err := c.Sensor("temp")
+	assert.NoError(t, err)
+	assert.Equal(t, "°C", s.Unit)
+	assert.Equal(t, 21.5, s.Latest.Value)
+
+	events, err := c.Poll(7, 10*time.Second, "pm25")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(events))
+	assert.Equal(t, int64(8), events[0].ID)
+
+	_, err = c.Sensor("co2")
+	assert.EqualError(t, err, "status: 404 Not Found, err msg: no such sensor: co2")
+}
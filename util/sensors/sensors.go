@@ -0,0 +1,60 @@
+/*
+Package sensors is the client of the sensor server (app/sserver).
+
+It gets the sensors with the latest readings, and watches the readings pushed by the server-sent events as they're sampled.
+A watch resumes from the last event after reconnecting, e.g.
+
+	c := sensors.NewClient("http://localhost:8000")
+	c.Watch(nil, func(e *sensors.Event) {
+		if e.Error != "" {
+			log.Printf("failed to read %v, error: %v", e.Sensor, e.Error)
+			return
+		}
+		log.Printf("%v: %v", e.Sensor, e.Value)
+	}, "temp", "pm25")
+*/
+package sensors
+
+import (
+	"time"
+)
+
+// Reading is a value of a sensor at the time
+type Reading struct {
+	Value float64   `json:"value"`
+	Time  time.Time `json:"time"`
+}
+
+// Sensor is a quantity measured by a device, e.g. the temperature of ds18b20.
+// Period is the sampling period in seconds, and Error is the error of the last sampling if it failed.
+type Sensor struct {
+	ID     string   `json:"id"`
+	Name   string   `json:"name"`
+	Unit   string   `json:"unit"`
+	Device string   `json:"device"`
+	Period int      `json:"period"`
+	Latest *Reading `json:"latest,omitempty"`
+	Error  string   `json:"error,omitempty"`
+}
+
+// Stats is the statistics of the readings of a sensor in [From, To]
+type Stats struct {
+	ID    string    `json:"id"`
+	Unit  string    `json:"unit"`
+	From  time.Time `json:"from"`
+	To    time.Time `json:"to"`
+	Count int       `json:"count"`
+	Min   float64   `json:"min"`
+	Max   float64   `json:"max"`
+	Avg   float64   `json:"avg"`
+}
+
+// Event is a sampling of a sensor, Error is set if it failed.
+// ID increases by one for every event of the server, it's used for resuming.
+type Event struct {
+	ID     int64     `json:"id"`
+	Sensor string    `json:"sensor"`
+	Value  float64   `json:"value"`
+	Time   time.Time `json:"time"`
+	Error  string    `json:"error,omitempty"`
+}
@@ -0,0 +1,185 @@
+package tts
+
+import (
+	"bytes"
+	"errors"
+	"log"
+	"sync"
+
+	"github.com/jakefau/rpi-devices/util/audio"
+)
+
+// Priority is the priority of an utterance
+type Priority int
+
+const (
+	// Chatter is the lowest priority, e.g. small talk
+	Chatter Priority = iota
+	// Normal is the priority of the answers and notices
+	Normal
+	// Alert is the highest priority, it preempts the lower ones being played
+	Alert
+)
+
+var (
+	// ErrPreempted means the utterance is preempted by a higher one
+	ErrPreempted = errors.New("preempted")
+	// ErrClosed means the queue is closed
+	ErrClosed = errors.New("queue closed")
+)
+
+// Utterance is a text in the queue
+type Utterance struct {
+	Text     string
+	Priority Priority
+
+	done chan bool
+	err  error
+}
+
+// Wait waits for the utterance to be played
+func (u *Utterance) Wait() error {
+	<-u.done
+	return u.err
+}
+
+func (u *Utterance) finish(err error) {
+	u.err = err
+	close(u.done)
+}
+
+// Queue plays the utterances one by one, the higher priority first, and the earlier first in the same priority.
+// an utterance being played is preempted and dropped by a higher one.
+type Queue struct {
+	engine Engine
+	cache  *Cache
+	dev    audio.Device
+
+	mu      sync.Mutex
+	cond    *sync.Cond
+	pending []*Utterance
+	playing *Utterance
+	pb      *audio.Playback
+	closed  bool
+}
+
+// NewQueue creates a queue playing the speech on the device, cache is optional
+func NewQueue(engine Engine, cache *Cache, dev audio.Device) *Queue {
+	q := &Queue{
+		engine: engine,
+		cache:  cache,
+		dev:    dev,
+	}
+	q.cond = sync.NewCond(&q.mu)
+	go q.run()
+	return q
+}
+
+// Say queues the text
+func (q *Queue) Say(text string, p Priority) *Utterance {
+	u := &Utterance{
+		Text:     text,
+		Priority: p,
+		done:     make(chan bool),
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.closed {
+		u.finish(ErrClosed)
+		return u
+	}
+	// keep the pending in priority
+	i := len(q.pending)
+	for i > 0 && q.pending[i-1].Priority < p {
+		i--
+	}
+	q.pending = append(q.pending, nil)
+	copy(q.pending[i+1:], q.pending[i:])
+	q.pending[i] = u
+
+	if q.playing != nil && q.playing.Priority < p && q.pb != nil {
+		log.Printf("[tts]%q is preempted by %q", q.playing.Text, text)
+		q.pb.Stop()
+	}
+	q.cond.Signal()
+	return u
+}
+
+// Close drops the pending utterances, and stops the one being played
+func (q *Queue) Close() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.closed = true
+	for _, u := range q.pending {
+		u.finish(ErrClosed)
+	}
+	q.pending = nil
+	if q.pb != nil {
+		q.pb.Stop()
+	}
+	q.cond.Signal()
+}
+
+func (q *Queue) run() {
+	for {
+		u := q.next()
+		if u == nil {
+			return
+		}
+		u.finish(q.play(u))
+		q.mu.Lock()
+		q.playing, q.pb = nil, nil
+		q.mu.Unlock()
+	}
+}
+
+// next waits for the next utterance, nil will be returned if the queue is closed
+func (q *Queue) next() *Utterance {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for len(q.pending) == 0 && !q.closed {
+		q.cond.Wait()
+	}
+	if q.closed {
+		return nil
+	}
+	u := q.pending[0]
+	q.pending = q.pending[1:]
+	q.playing = u
+	return u
+}
+
+func (q *Queue) play(u *Utterance) error {
+	data, err := synthesize(q.engine, q.cache, u.Text)
+	if err != nil {
+		log.Printf("[tts]failed to synthesize %q, error: %v", u.Text, err)
+		return err
+	}
+	b, err := audio.Decode(bytes.NewReader(data))
+	if err != nil {
+		log.Printf("[tts]failed to decode the speech of %q, error: %v", u.Text, err)
+		return err
+	}
+
+	q.mu.Lock()
+	if q.closed {
+		q.mu.Unlock()
+		return ErrClosed
+	}
+	if len(q.pending) > 0 && q.pending[0].Priority > u.Priority {
+		// a higher one came in while synthesizing
+		q.mu.Unlock()
+		return ErrPreempted
+	}
+	q.pb = audio.Play(q.dev, b)
+	pb := q.pb
+	q.mu.Unlock()
+
+	if err := pb.Wait(); err != nil {
+		if err == audio.ErrStopped {
+			return ErrPreempted
+		}
+		return err
+	}
+	return nil
+}
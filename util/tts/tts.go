@@ -0,0 +1,163 @@
+/*
+Package tts is a queue of text to speech,
+it synthesizes the text by a pluggable engine, caches the speech on disk, and plays it one by one in priority.
+*/
+package tts
+
+import (
+	"crypto/sha1"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+
+	"github.com/shanghuiyang/go-speech/oauth"
+	"github.com/shanghuiyang/go-speech/speech"
+)
+
+// Engine synthesizes speech
+type Engine interface {
+	// Name identifies the engine and its voice, e.g. "espeak/en/160/50",
+	// the speech is cached by the name and the text.
+	Name() string
+	// ToSpeech returns the speech of the text in wav
+	ToSpeech(text string) ([]byte, error)
+}
+
+// Baidu is the tts of baidu
+type Baidu struct {
+	tts *speech.TTS
+}
+
+// NewBaidu ...
+func NewBaidu(appKey, secretKey string) *Baidu {
+	auth := oauth.New(appKey, secretKey, oauth.NewCacheMan())
+	return &Baidu{tts: speech.NewTTS(auth)}
+}
+
+// Name ...
+func (b *Baidu) Name() string {
+	return "baidu"
+}
+
+// ToSpeech ...
+func (b *Baidu) ToSpeech(text string) ([]byte, error) {
+	return b.tts.ToSpeech(text)
+}
+
+// Espeak is a local engine using espeak, you need to install espeak first.
+// Voice: the voice, e.g. "en", "zh"
+// Speed: the words per minute
+// Pitch: [0, 99]
+type Espeak struct {
+	Voice string
+	Speed int
+	Pitch int
+}
+
+// NewEspeak ...
+func NewEspeak(voice string) *Espeak {
+	return &Espeak{
+		Voice: voice,
+		Speed: 160,
+		Pitch: 50,
+	}
+}
+
+// Name ...
+func (e *Espeak) Name() string {
+	return fmt.Sprintf("espeak/%v/%v/%v", e.Voice, e.Speed, e.Pitch)
+}
+
+// ToSpeech ...
+func (e *Espeak) ToSpeech(text string) ([]byte, error) {
+	f, err := ioutil.TempFile("", "espeak-*.wav")
+	if err != nil {
+		return nil, err
+	}
+	f.Close()
+	defer os.Remove(f.Name())
+
+	cmd := exec.Command("espeak",
+		"-v", e.Voice,
+		"-s", fmt.Sprintf("%v", e.Speed),
+		"-p", fmt.Sprintf("%v", e.Pitch),
+		"-w", f.Name(),
+		text,
+	)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return nil, fmt.Errorf("%v: %s", err, out)
+	}
+	return ioutil.ReadFile(f.Name())
+}
+
+// Cache caches the speech in wav files named by the hash of the engine name and the text
+type Cache struct {
+	dir string
+}
+
+// NewCache creates a cache in the directory
+func NewCache(dir string) (*Cache, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &Cache{dir: dir}, nil
+}
+
+// Get returns the speech cached, and false if it isn't cached
+func (c *Cache) Get(engine, text string) ([]byte, bool) {
+	data, err := ioutil.ReadFile(c.file(engine, text))
+	if err != nil {
+		return nil, false
+	}
+	return data, true
+}
+
+// Put caches the speech
+func (c *Cache) Put(engine, text string, data []byte) error {
+	// write to a temp file and rename it, the speech being cached won't be read by others
+	f, err := ioutil.TempFile(c.dir, "tmp-*")
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	return os.Rename(f.Name(), c.file(engine, text))
+}
+
+func (c *Cache) file(engine, text string) string {
+	h := sha1.Sum([]byte(engine + "\x00" + text))
+	return filepath.Join(c.dir, fmt.Sprintf("%x.wav", h))
+}
+
+// synthesize synthesizes the text by the engine, the cache is optional
+func synthesize(e Engine, c *Cache, text string) ([]byte, error) {
+	if e == nil {
+		return nil, errors.New("no tts engine")
+	}
+	if c != nil {
+		if data, ok := c.Get(e.Name(), text); ok {
+			return data, nil
+		}
+	}
+	data, err := e.ToSpeech(text)
+	if err != nil {
+		return nil, err
+	}
+	if c != nil {
+		if err := c.Put(e.Name(), text, data); err != nil {
+			log.Printf("[tts]failed to cache speech, error: %v", err)
+		}
+	}
+	return data, nil
+}
@@ -0,0 +1,132 @@
+package tts
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jakefau/rpi-devices/util/audio"
+	"github.com/stretchr/testify/assert"
+)
+
+// engine speaks every text in a silence of 100ms per char
+type engine struct {
+	sync.Mutex
+	name  string
+	texts []string
+}
+
+func (e *engine) Name() string {
+	return e.name
+}
+
+func (e *engine) ToSpeech(text string) ([]byte, error) {
+	e.Lock()
+	e.texts = append(e.texts, text)
+	e.Unlock()
+
+	n := len(text) * audio.Voice.Rate / 10
+	b := &audio.Buffer{Format: audio.Voice, Samples: make([]int16, n)}
+	var buf bytes.Buffer
+	if err := audio.Encode(&buf, b); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (e *engine) synthesized() []string {
+	e.Lock()
+	defer e.Unlock()
+	return append([]string{}, e.texts...)
+}
+
+func TestCache(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tts")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	c, err := NewCache(dir)
+	assert.NoError(t, err)
+	e := &engine{name: "fake"}
+	e2 := &engine{name: "fake/fast"}
+
+	testCases := []struct {
+		desc   string
+		engine *engine
+		text   string
+		texts  []string
+	}{
+		{
+			desc:   "the first time",
+			engine: e,
+			text:   "hello",
+			texts:  []string{"hello"},
+		},
+		{
+			desc:   "cached",
+			engine: e,
+			text:   "hello",
+			texts:  []string{"hello"},
+		},
+		{
+			desc:   "another text",
+			engine: e,
+			text:   "world",
+			texts:  []string{"hello", "world"},
+		},
+		{
+			desc:   "another voice",
+			engine: e2,
+			text:   "hello",
+			texts:  []string{"hello"},
+		},
+	}
+	for _, test := range testCases {
+		data, err := synthesize(test.engine, c, test.text)
+		assert.NoError(t, err, test.desc)
+		b, err := audio.Decode(bytes.NewReader(data))
+		assert.NoError(t, err, test.desc)
+		assert.Equal(t, time.Duration(len(test.text))*100*time.Millisecond, b.Duration(), test.desc)
+		assert.Equal(t, test.texts, test.engine.synthesized(), test.desc)
+	}
+}
+
+func TestQueue(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tts")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	dev := audio.NewFakeDevice("", "")
+	dev.Realtime = true
+	e := &engine{name: "fake"}
+	q := NewQueue(e, nil, dev)
+	defer q.Close()
+
+	// in priority
+	first := q.Say("a", Normal)
+	time.Sleep(20 * time.Millisecond)
+	chatter := q.Say("bb", Chatter)
+	normal := q.Say("cc", Normal)
+	assert.NoError(t, first.Wait())
+	assert.NoError(t, chatter.Wait())
+	assert.NoError(t, normal.Wait())
+	assert.Equal(t, []string{"a", "cc", "bb"}, e.synthesized())
+
+	// an alert preempts the chatter
+	long := q.Say("a long chatter", Chatter)
+	time.Sleep(300 * time.Millisecond)
+	alert := q.Say("fire", Alert)
+	assert.Equal(t, ErrPreempted, long.Wait())
+	assert.NoError(t, alert.Wait())
+	played := dev.Played()
+	assert.Equal(t, 5, len(played))
+	assert.True(t, played[3].Duration() < time.Second)
+	assert.Equal(t, 400*time.Millisecond, played[4].Duration())
+
+	// closed
+	q.Close()
+	assert.Equal(t, ErrClosed, q.Say("bye", Alert).Wait())
+}